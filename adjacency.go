@@ -0,0 +1,217 @@
+// Learn the AS adjacencies (neighbor links) of monitored ASNs, and alert when a
+// previously unseen adjacency appears.
+//
+// For a learning period every neighbor seen next to a monitored ASN in a path is
+// recorded silently. Once the period has passed, a neighbor not yet seen is
+// reported, this is how a Type-1 forged origin hijack (the attacker prepends
+// the victim's ASN to their own) appears in the routing table.
+// The learned set is persisted to a file so a restart does not re-learn.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AdjacencyEvent is emitted when a previously unseen neighbor of a monitored ASN is seen.
+type AdjacencyEvent struct {
+	ASN       int32 // The monitored ASN.
+	Neighbor  int32 // The new neighbor.
+	Path      []int32
+	Prefixes  []string
+	Collector string
+	Peer      string
+	Time      time.Time
+}
+
+// adjacencyState is the persisted form of an AdjacencyMonitor.
+type adjacencyState struct {
+	LearnUntil  time.Time                   `json:"learn_until"`
+	Adjacencies map[int32]map[int32]float64 `json:"adjacencies"` // ASN -> neighbor -> first seen.
+}
+
+// AdjacencyMonitor learns, and alerts on new, adjacencies of the monitored ASNs.
+type AdjacencyMonitor struct {
+	mu       sync.Mutex
+	file     string
+	learnFor time.Duration
+	lastSave time.Time
+	state    *adjacencyState
+}
+
+// learningSaveInterval limits how often the state is saved while learning, when
+// most messages add a new adjacency.
+const learningSaveInterval = time.Minute
+
+// NewAdjacencyMonitor creates an AdjacencyMonitor for asns, learning for the
+// learnFor duration from the first message seen. If file is set and exists
+// the learned adjacencies, and learning period, are loaded from it.
+func NewAdjacencyMonitor(asns []int32, learnFor time.Duration, file string) (*AdjacencyMonitor, error) {
+	a := &AdjacencyMonitor{
+		file:     file,
+		learnFor: learnFor,
+		state:    &adjacencyState{Adjacencies: map[int32]map[int32]float64{}},
+	}
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(b, a.state); err != nil {
+				return nil, fmt.Errorf("failed to decode adjacency file(%v): %v", file, err)
+			}
+		case !os.IsNotExist(err):
+			return nil, fmt.Errorf("failed to read adjacency file(%v): %v", file, err)
+		}
+	}
+	// Only the ASNs currently monitored are kept, a newly monitored ASN starts empty.
+	adj := map[int32]map[int32]float64{}
+	for _, asn := range asns {
+		adj[asn] = a.state.Adjacencies[asn]
+		if adj[asn] == nil {
+			adj[asn] = map[int32]float64{}
+		}
+	}
+	a.state.Adjacencies = adj
+	return a, nil
+}
+
+// Neighbors returns the neighbors of asn in path, ignoring prepends.
+func Neighbors(path []int32, asn int32) []int32 {
+	var result []int32
+	seen := map[int32]bool{}
+	for i, p := range path {
+		if p != asn {
+			continue
+		}
+		for _, j := range []int{i - 1, i + 1} {
+			if j < 0 || j >= len(path) || path[j] == asn || seen[path[j]] {
+				continue
+			}
+			seen[path[j]] = true
+			result = append(result, path[j])
+		}
+	}
+	return result
+}
+
+// Learning reports whether the monitor is still within its learning period at ts.
+func (a *AdjacencyMonitor) Learning(ts time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.learning(ts)
+}
+
+func (a *AdjacencyMonitor) learning(ts time.Time) bool {
+	if a.state.LearnUntil.IsZero() {
+		a.state.LearnUntil = ts.Add(a.learnFor)
+	}
+	return ts.Before(a.state.LearnUntil)
+}
+
+// Update applies a single message to the monitor, returning an event for each
+// new adjacency seen after the learning period. New adjacencies are recorded,
+// so each is reported only once, and the state is saved if a file is configured.
+func (a *AdjacencyMonitor) Update(rm *RisMessageData) ([]*AdjacencyEvent, error) {
+	if rm == nil || len(rm.DigestedPath) == 0 {
+		return nil, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ts := rm.Time()
+	learning := a.learning(ts)
+	var prefixes []string
+	for _, ann := range rm.Announcements {
+		prefixes = append(prefixes, ann.Prefixes...)
+	}
+
+	var events []*AdjacencyEvent
+	changed := false
+	for asn, neighbors := range a.state.Adjacencies {
+		for _, n := range Neighbors(rm.DigestedPath, asn) {
+			if _, ok := neighbors[n]; ok {
+				continue
+			}
+			neighbors[n] = rm.Timestamp
+			changed = true
+			if learning {
+				continue
+			}
+			events = append(events, &AdjacencyEvent{
+				ASN:       asn,
+				Neighbor:  n,
+				Path:      rm.DigestedPath,
+				Prefixes:  prefixes,
+				Collector: rm.Host,
+				Peer:      rm.Peer,
+				Time:      ts,
+			})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].ASN != events[j].ASN {
+			return events[i].ASN < events[j].ASN
+		}
+		return events[i].Neighbor < events[j].Neighbor
+	})
+	if !changed || (learning && ts.Sub(a.lastSave) < learningSaveInterval) {
+		return events, nil
+	}
+	a.lastSave = ts
+	return events, a.save()
+}
+
+// Adjacencies returns the learned neighbors of asn, sorted.
+func (a *AdjacencyMonitor) Adjacencies(asn int32) []int32 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var result []int32
+	for n := range a.state.Adjacencies[asn] {
+		result = append(result, n)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// Save writes the learned adjacencies to the monitor's file, if one is configured.
+func (a *AdjacencyMonitor) Save() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.save()
+}
+
+// save writes the state to a temporary file, renamed over the destination, so a
+// crash while saving does not lose the previously learned state.
+func (a *AdjacencyMonitor) save() error {
+	if a.file == "" {
+		return nil
+	}
+	b, err := json.Marshal(a.state)
+	if err != nil {
+		return fmt.Errorf("failed to encode adjacencies: %v", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(a.file), filepath.Base(a.file)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary adjacency file: %v", err)
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write adjacency file(%v): %v", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to close adjacency file(%v): %v", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), a.file); err != nil {
+		return fmt.Errorf("failed to rename adjacency file(%v): %v", a.file, err)
+	}
+	return nil
+}
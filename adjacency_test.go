@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNeighbors(t *testing.T) {
+	tests := []struct {
+		desc string
+		path []int32
+		asn  int32
+		want []int32
+	}{{
+		desc: "Success - origin",
+		path: []int32{1, 2, 100},
+		asn:  100,
+		want: []int32{2},
+	}, {
+		desc: "Success - transit with prepends",
+		path: []int32{1, 100, 100, 3},
+		asn:  100,
+		want: []int32{1, 3},
+	}, {
+		desc: "Success - not in path",
+		path: []int32{1, 2, 3},
+		asn:  100,
+	}}
+
+	for _, test := range tests {
+		if diff := cmp.Diff(Neighbors(test.path, test.asn), test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestAdjacencyMonitor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adjacency")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "adjacencies.json")
+
+	a, err := NewAdjacencyMonitor([]int32{100}, time.Hour, file)
+	if err != nil {
+		t.Fatalf("failed to create adjacency monitor: %v", err)
+	}
+	// Learning, no events.
+	for _, rm := range []*RisMessageData{
+		announce(0, "rrc00", "1.1.1.1", []interface{}{1, 10, 100}, "192.0.2.0/24"),
+		announce(60, "rrc00", "1.1.1.1", []interface{}{1, 20, 100}, "192.0.2.0/24"),
+	} {
+		events, err := a.Update(rm)
+		if err != nil {
+			t.Fatalf("failed to update during learning: %v", err)
+		}
+		if len(events) != 0 {
+			t.Errorf("got events while learning: %v", events)
+		}
+	}
+
+	// After learning, a known neighbor is quiet, a new neighbor is reported once.
+	events, err := a.Update(announce(3600, "rrc00", "1.1.1.1", []interface{}{1, 10, 100}, "192.0.2.0/24"))
+	if err != nil || len(events) != 0 {
+		t.Errorf("known neighbor got events(%v) error(%v), want none", events, err)
+	}
+	hijack := announce(3601, "rrc01", "2.2.2.2", []interface{}{2, 666, 100}, "192.0.2.0/24")
+	events, err = a.Update(hijack)
+	if err != nil {
+		t.Fatalf("failed to update after learning: %v", err)
+	}
+	want := []*AdjacencyEvent{{
+		ASN:       100,
+		Neighbor:  666,
+		Path:      []int32{2, 666, 100},
+		Prefixes:  []string{"192.0.2.0/24"},
+		Collector: "rrc01",
+		Peer:      "2.2.2.2",
+		Time:      time.Unix(3601, 0),
+	}}
+	if diff := cmp.Diff(events, want); diff != "" {
+		t.Errorf("new neighbor got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if events, _ := a.Update(hijack); len(events) != 0 {
+		t.Errorf("repeated neighbor got events: %v", events)
+	}
+
+	// A restart loads the learned state, and does not re-learn.
+	b, err := NewAdjacencyMonitor([]int32{100, 200}, time.Hour, file)
+	if err != nil {
+		t.Fatalf("failed to reload adjacency monitor: %v", err)
+	}
+	if diff := cmp.Diff(b.Adjacencies(100), []int32{10, 20, 666}); diff != "" {
+		t.Errorf("reloaded adjacencies got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if b.Learning(time.Unix(3602, 0)) {
+		t.Errorf("reloaded monitor is learning, want learning complete")
+	}
+}
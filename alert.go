@@ -0,0 +1,400 @@
+// The alert pipeline: detectors produce structured Alerts from each message, a
+// dedup stage aggregates repeats (the same event seen by many peers) within a
+// window, and suppression rules silence known benign events.
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// Severity is the importance of an Alert.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "INFO"
+	case SeverityWarning:
+		return "WARNING"
+	case SeverityCritical:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+// MarshalText encodes the severity as its name, for JSON and other text encodings.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity from its name.
+func (s *Severity) UnmarshalText(b []byte) error {
+	for _, v := range []Severity{SeverityInfo, SeverityWarning, SeverityCritical} {
+		if string(b) == v.String() {
+			*s = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity: %v", string(b))
+}
+
+// Alert is a single event reported by a detector.
+type Alert struct {
+	Kind      string    `json:"kind"`     // The event, ie: MOAS_START, BOGON_PREFIX.
+	Detector  string    `json:"detector"` // The name of the detector which produced the alert.
+	Severity  Severity  `json:"severity"`
+	Prefix    string    `json:"prefix,omitempty"`
+	Origin    int32     `json:"origin,omitempty"`
+	ASN       int32     `json:"asn,omitempty"` // An ASN the alert relates to, other than the origin.
+	Path      []int32   `json:"path,omitempty"`
+	Collector string    `json:"collector,omitempty"`
+	Peer      string    `json:"peer,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Count     int       `json:"count"`
+	Message   string    `json:"message,omitempty"`
+}
+
+func (a *Alert) String() string {
+	return fmt.Sprintf("%v %v prefix: %v origin: %v count: %v: %v", a.Severity, a.Kind, a.Prefix, a.Origin, a.Count, a.Message)
+}
+
+// Detector examines each message in the stream, returning any alerts.
+type Detector interface {
+	Name() string
+	Detect(rm *RisMessageData) []*Alert
+}
+
+// Ticker is implemented by detectors which produce alerts as time passes,
+// rather than in response to a message (ie: a flap stops when updates stop).
+type Ticker interface {
+	Tick(now time.Time) []*Alert
+}
+
+// alertKey identifies the alerts which are aggregated together by the Deduper.
+type alertKey struct {
+	kind, prefix string
+	origin, asn  int32
+}
+
+// Deduper aggregates repeats of an alert within a window. The first alert is
+// passed through immediately, repeats are counted and, if there were any, an
+// aggregate alert is released when the window closes.
+type Deduper struct {
+	window time.Duration
+	open   map[alertKey]*Alert
+}
+
+// NewDeduper creates a Deduper which aggregates alerts for window.
+func NewDeduper(window time.Duration) *Deduper {
+	return &Deduper{window: window, open: map[alertKey]*Alert{}}
+}
+
+// Add adds an alert to the Deduper, returning the alert if it is not a repeat.
+func (d *Deduper) Add(a *Alert) *Alert {
+	if a.Count == 0 {
+		a.Count = 1
+	}
+	k := alertKey{a.Kind, a.Prefix, a.Origin, a.ASN}
+	if agg, ok := d.open[k]; ok {
+		agg.Count += a.Count
+		if a.LastSeen.After(agg.LastSeen) {
+			agg.LastSeen = a.LastSeen
+		}
+		return nil
+	}
+	agg := *a
+	agg.Count = 0
+	d.open[k] = &agg
+	return a
+}
+
+// Flush closes the windows which started before now - window, returning the
+// aggregate alerts of those which saw repeats. If all is true every window is closed.
+func (d *Deduper) Flush(now time.Time, all bool) []*Alert {
+	var result []*Alert
+	for k, agg := range d.open {
+		if !all && now.Sub(agg.FirstSeen) < d.window {
+			continue
+		}
+		delete(d.open, k)
+		if agg.Count > 0 {
+			result = append(result, agg)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].FirstSeen.Before(result[j].FirstSeen) })
+	return result
+}
+
+// SuppressRule silences alerts matching all of its set fields.
+type SuppressRule struct {
+	Kind   string
+	Prefix *net.IPNet // Alerts for this prefix, or more specifics of it.
+	Origin int32
+	ASN    int32
+	Until  time.Time // The rule expires at Until, if set.
+}
+
+// ParseSuppressRule parses a rule of comma separated key=value pairs, ie:
+//
+//	kind=FLAP_START,prefix=192.0.2.0/24,origin=64500,asn=65000,until=2020-01-02T15:04:05Z
+func ParseSuppressRule(s string) (*SuppressRule, error) {
+	r := &SuppressRule{}
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(kv), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("suppress rule element(%v) is not key=value", kv)
+		}
+		k, v := parts[0], parts[1]
+		switch k {
+		case "kind":
+			r.Kind = v
+		case "prefix":
+			_, n, err := net.ParseCIDR(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse suppress rule prefix(%v): %v", v, err)
+			}
+			r.Prefix = n
+		case "origin", "asn":
+			asn, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse suppress rule %v(%v): %v", k, v, err)
+			}
+			if k == "origin" {
+				r.Origin = int32(asn)
+			} else {
+				r.ASN = int32(asn)
+			}
+		case "until":
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse suppress rule until(%v): %v", v, err)
+			}
+			r.Until = t
+		default:
+			return nil, fmt.Errorf("unknown suppress rule key: %v", k)
+		}
+	}
+	return r, nil
+}
+
+// ParseSuppressRules parses semicolon separated rules, as ParseSuppressRule.
+func ParseSuppressRules(s string) ([]*SuppressRule, error) {
+	var result []*SuppressRule
+	for _, rs := range strings.Split(s, ";") {
+		if strings.TrimSpace(rs) == "" {
+			continue
+		}
+		r, err := ParseSuppressRule(rs)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// Match reports whether the rule suppresses the alert.
+func (r *SuppressRule) Match(a *Alert) bool {
+	if !r.Until.IsZero() && a.FirstSeen.After(r.Until) {
+		return false
+	}
+	if r.Kind != "" && r.Kind != a.Kind {
+		return false
+	}
+	if r.Origin != 0 && r.Origin != a.Origin {
+		return false
+	}
+	if r.ASN != 0 && r.ASN != a.ASN {
+		return false
+	}
+	if r.Prefix != nil {
+		ip, n, err := net.ParseCIDR(a.Prefix)
+		if err != nil || !r.Prefix.Contains(ip) {
+			return false
+		}
+		rlen, _ := r.Prefix.Mask.Size()
+		if plen, _ := n.Mask.Size(); plen < rlen {
+			return false
+		}
+	}
+	return true
+}
+
+// AlertPipeline runs the detectors over a stream of messages, passing the
+// resulting alerts through suppression and dedup to the Out channel.
+type AlertPipeline struct {
+	Detectors    []Detector
+	Rules        []*SuppressRule
+	Dedup        *Deduper
+	TickInterval time.Duration // Stream time between Ticker and Dedup flushes.
+	Out          chan *Alert
+	lastTick     time.Time
+}
+
+// NewAlertPipeline creates an AlertPipeline, with a dedup window of window.
+func NewAlertPipeline(detectors []Detector, rules []*SuppressRule, window time.Duration, buffer int) *AlertPipeline {
+	return &AlertPipeline{
+		Detectors:    detectors,
+		Rules:        rules,
+		Dedup:        NewDeduper(window),
+		TickInterval: 10 * time.Second,
+		Out:          make(chan *Alert, buffer),
+	}
+}
+
+// Run processes messages from in until it is closed, then flushes any open
+// dedup windows and closes Out. Time is taken from the message timestamps, so
+// a replayed file behaves as the live stream did.
+func (p *AlertPipeline) Run(in <-chan RisMessage) {
+	defer close(p.Out)
+	var now time.Time
+	for rm := range in {
+		if rm.Data == nil {
+			rm.Release()
+			continue
+		}
+		now = rm.Data.Time()
+		alerts := p.Process(rm.Data)
+		rm.Release()
+		for _, a := range alerts {
+			p.Out <- a
+		}
+		if now.Sub(p.lastTick) >= p.TickInterval {
+			for _, a := range p.Tick(now) {
+				p.Out <- a
+			}
+		}
+	}
+	for _, a := range p.Tick(now) {
+		p.Out <- a
+	}
+	for _, a := range p.Dedup.Flush(now, true) {
+		p.Out <- a
+	}
+}
+
+// Process runs the detectors over a single message, returning the alerts which
+// pass suppression and dedup. The alerts keep a copy of the message's path, so
+// the message may be released.
+func (p *AlertPipeline) Process(rm *RisMessageData) []*Alert {
+	var alerts []*Alert
+	for _, d := range p.Detectors {
+		alerts = append(alerts, d.Detect(rm)...)
+	}
+	// The Deduper keeps the alerts it aggregates.
+	for _, a := range alerts {
+		a.Path = clonePath(a.Path)
+	}
+	return p.filter(alerts)
+}
+
+// Tick runs the Ticker detectors and closes expired dedup windows.
+func (p *AlertPipeline) Tick(now time.Time) []*Alert {
+	p.lastTick = now
+	var alerts []*Alert
+	for _, d := range p.Detectors {
+		if t, ok := d.(Ticker); ok {
+			alerts = append(alerts, t.Tick(now)...)
+		}
+	}
+	return append(p.filter(alerts), p.Dedup.Flush(now, false)...)
+}
+
+// filter removes suppressed and repeated alerts.
+func (p *AlertPipeline) filter(alerts []*Alert) []*Alert {
+	var result []*Alert
+	for _, a := range alerts {
+		if p.suppressed(a) {
+			log.V(2).Infof("suppressed alert: %v", a)
+			continue
+		}
+		if a = p.Dedup.Add(a); a != nil {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+func (p *AlertPipeline) suppressed(a *Alert) bool {
+	for _, r := range p.Rules {
+		if r.Match(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// AlertHub fans alerts out to streaming clients. Clients which fall behind miss
+// alerts, rather than holding up the pipeline.
+type AlertHub struct {
+	mu     sync.Mutex
+	subs   map[chan *Alert]bool
+	closed bool
+}
+
+// NewAlertHub creates an AlertHub.
+func NewAlertHub() *AlertHub {
+	return &AlertHub{subs: map[chan *Alert]bool{}}
+}
+
+// Subscribe returns a channel of buffer alerts, closed on Unsubscribe or Close.
+func (h *AlertHub) Subscribe(buffer int) chan *Alert {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := make(chan *Alert, buffer)
+	if h.closed {
+		close(c)
+		return c
+	}
+	h.subs[c] = true
+	return c
+}
+
+// Unsubscribe removes a client, closing its channel.
+func (h *AlertHub) Unsubscribe(c chan *Alert) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[c] {
+		delete(h.subs, c)
+		close(c)
+	}
+}
+
+// Publish sends an alert to every client with room for it.
+func (h *AlertHub) Publish(a *Alert) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.subs {
+		select {
+		case c <- a:
+		default:
+			log.V(2).Infof("alert client fell behind, dropped: %v", a)
+		}
+	}
+}
+
+// Close removes every client, closing their channels.
+func (h *AlertHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for c := range h.subs {
+		delete(h.subs, c)
+		close(c)
+	}
+}
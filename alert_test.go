@@ -0,0 +1,194 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeDetector returns an alert for every announced prefix, and a single alert per Tick.
+type fakeDetector struct {
+	ticks int
+}
+
+func (f *fakeDetector) Name() string { return "fake" }
+
+func (f *fakeDetector) Detect(rm *RisMessageData) []*Alert {
+	var result []*Alert
+	for _, p := range announced(rm) {
+		result = append(result, &Alert{Kind: "FAKE", Detector: f.Name(), Prefix: p, Peer: rm.Peer, FirstSeen: rm.Time(), LastSeen: rm.Time()})
+	}
+	return result
+}
+
+func (f *fakeDetector) Tick(now time.Time) []*Alert {
+	f.ticks++
+	return nil
+}
+
+func TestDeduper(t *testing.T) {
+	d := NewDeduper(time.Minute)
+	first := &Alert{Kind: "FAKE", Prefix: "192.0.2.0/24", Peer: "1.1.1.1", FirstSeen: time.Unix(0, 0), LastSeen: time.Unix(0, 0)}
+	if got := d.Add(first); got != first {
+		t.Errorf("first alert was not passed through: %v", got)
+	}
+	if got := d.Add(&Alert{Kind: "FAKE", Prefix: "192.0.2.0/24", Peer: "2.2.2.2", FirstSeen: time.Unix(10, 0), LastSeen: time.Unix(10, 0)}); got != nil {
+		t.Errorf("repeated alert was passed through: %v", got)
+	}
+	if got := d.Add(&Alert{Kind: "FAKE", Prefix: "198.51.100.0/24", FirstSeen: time.Unix(10, 0), LastSeen: time.Unix(10, 0)}); got == nil {
+		t.Errorf("alert for a different prefix was not passed through")
+	}
+	if got := d.Flush(time.Unix(30, 0), false); len(got) != 0 {
+		t.Errorf("flush inside the window released alerts: %v", got)
+	}
+
+	want := []*Alert{{Kind: "FAKE", Prefix: "192.0.2.0/24", Peer: "1.1.1.1", FirstSeen: time.Unix(0, 0), LastSeen: time.Unix(10, 0), Count: 1}}
+	if diff := cmp.Diff(d.Flush(time.Unix(60, 0), false), want); diff != "" {
+		t.Errorf("Flush() got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	// The window has closed, the same alert passes through again.
+	if got := d.Add(&Alert{Kind: "FAKE", Prefix: "192.0.2.0/24", FirstSeen: time.Unix(61, 0)}); got == nil {
+		t.Errorf("alert after the window closed was not passed through")
+	}
+}
+
+func TestParseSuppressRule(t *testing.T) {
+	_, n, _ := net.ParseCIDR("192.0.2.0/24")
+	tests := []struct {
+		desc    string
+		rule    string
+		want    *SuppressRule
+		wantErr bool
+	}{{
+		desc: "Success - all fields",
+		rule: "kind=FLAP_START, prefix=192.0.2.0/24,origin=64500,asn=4200000000,until=2020-01-02T15:04:05Z",
+		want: &SuppressRule{
+			Kind:   "FLAP_START",
+			Prefix: n,
+			Origin: 64500,
+			ASN:    int32(-94967296),
+			Until:  time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC),
+		},
+	}, {
+		desc:    "Error - not key=value",
+		rule:    "kind",
+		wantErr: true,
+	}, {
+		desc:    "Error - bad prefix",
+		rule:    "prefix=192.0.2/24",
+		wantErr: true,
+	}, {
+		desc:    "Error - unknown key",
+		rule:    "colour=blue",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		got, err := ParseSuppressRule(test.rule)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+		}
+	}
+}
+
+func TestSuppressRuleMatch(t *testing.T) {
+	alert := &Alert{Kind: "FLAP_START", Prefix: "192.0.2.0/25", Origin: 64500, FirstSeen: time.Unix(100, 0)}
+	tests := []struct {
+		desc string
+		rule string
+		want bool
+	}{
+		{desc: "Success - kind", rule: "kind=FLAP_START", want: true},
+		{desc: "Success - covering prefix", rule: "prefix=192.0.2.0/24", want: true},
+		{desc: "Success - less specific alert is not matched", rule: "prefix=192.0.2.0/26", want: false},
+		{desc: "Success - different origin", rule: "kind=FLAP_START,origin=64501", want: false},
+		{desc: "Success - expired rule", rule: "kind=FLAP_START,until=1970-01-01T00:01:00Z", want: false},
+	}
+
+	for _, test := range tests {
+		r, err := ParseSuppressRule(test.rule)
+		if err != nil {
+			t.Fatalf("[%v]: failed to parse rule: %v", test.desc, err)
+		}
+		if got := r.Match(alert); got != test.want {
+			t.Errorf("[%v]: got(%v)/want(%v) mismatch", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestAlertPipelineRun(t *testing.T) {
+	f := &fakeDetector{}
+	rules, err := ParseSuppressRules("prefix=198.51.100.0/24;")
+	if err != nil {
+		t.Fatalf("failed to parse rules: %v", err)
+	}
+	p := NewAlertPipeline([]Detector{f}, rules, time.Minute, 10)
+
+	in := make(chan RisMessage, 10)
+	for _, rm := range []*RisMessageData{
+		announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+		announce(1, "rrc00", "2.2.2.2", []interface{}{2, 100}, "192.0.2.0/24"),
+		announce(2, "rrc00", "3.3.3.3", []interface{}{3, 100}, "198.51.100.0/24"),
+		announce(3, "rrc00", "4.4.4.4", []interface{}{4, 100}, "192.0.2.0/24"),
+	} {
+		in <- RisMessage{Type: "ris_message", Data: rm}
+	}
+	close(in)
+	go p.Run(in)
+
+	var got []*Alert
+	for a := range p.Out {
+		got = append(got, a)
+	}
+	want := []*Alert{
+		{Kind: "FAKE", Detector: "fake", Prefix: "192.0.2.0/24", Peer: "1.1.1.1", FirstSeen: time.Unix(0, 0), LastSeen: time.Unix(0, 0), Count: 1},
+		{Kind: "FAKE", Detector: "fake", Prefix: "192.0.2.0/24", Peer: "1.1.1.1", FirstSeen: time.Unix(0, 0), LastSeen: time.Unix(3, 0), Count: 2},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if f.ticks == 0 {
+		t.Errorf("detector was never ticked")
+	}
+}
+
+func TestAlertHub(t *testing.T) {
+	h := NewAlertHub()
+	fast, slow := h.Subscribe(10), h.Subscribe(1)
+	gone := h.Subscribe(10)
+	h.Unsubscribe(gone)
+	for i := 0; i < 3; i++ {
+		h.Publish(&Alert{Kind: "MOAS_START", Count: i})
+	}
+	h.Close()
+
+	var got []int
+	for a := range fast {
+		got = append(got, a.Count)
+	}
+	if diff := cmp.Diff(got, []int{0, 1, 2}); diff != "" {
+		t.Errorf("fast client got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	got = nil
+	for a := range slow {
+		got = append(got, a.Count)
+	}
+	if diff := cmp.Diff(got, []int{0}); diff != "" {
+		t.Errorf("slow client got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if _, ok := <-gone; ok {
+		t.Errorf("got alert after unsubscribing")
+	}
+	if _, ok := <-h.Subscribe(1); ok {
+		t.Errorf("got alert subscribing after close")
+	}
+}
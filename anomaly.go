@@ -0,0 +1,263 @@
+// Detect anomalies in the shape of AS paths: excessive prepending, non-adjacent
+// AS loops, path length outliers and new upstreams of a watched origin.
+//
+// A loop, where an ASN appears twice in the path separated by other ASNs, should
+// never be accepted by a BGP speaker and indicates path poisoning or forgery.
+// A new upstream adjacent to a watched origin is the classic signal of a hijack
+// which forges the origin at the end of the path.
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PathAnomalyKind describes the anomaly a PathAnomaly reports.
+type PathAnomalyKind int
+
+const (
+	ExcessivePrepend PathAnomalyKind = iota // An ASN is repeated consecutively too many times.
+	PathLoop                                // An ASN appears in two non-adjacent positions.
+	PathLengthChange                        // The path length differs sharply from the prefix's baseline.
+	NewUpstream                             // An ASN not previously seen is adjacent to a watched origin.
+)
+
+func (k PathAnomalyKind) String() string {
+	switch k {
+	case ExcessivePrepend:
+		return "EXCESSIVE_PREPEND"
+	case PathLoop:
+		return "PATH_LOOP"
+	case PathLengthChange:
+		return "PATH_LENGTH_CHANGE"
+	case NewUpstream:
+		return "NEW_UPSTREAM"
+	}
+	return "PATH_ANOMALY_UNKNOWN"
+}
+
+// PathAnomaly is a single anomaly found in a message's path.
+type PathAnomaly struct {
+	Kind   PathAnomalyKind
+	Prefix string  // The prefix, for anomalies which relate to a prefix.
+	ASN    int32   // The prepended, looped or new upstream ASN.
+	Origin int32   // The origin ASN of the path.
+	Path   []int32 // The path the anomaly was found in.
+	Length int     // The path length, excluding prepends.
+	Mean   float64 // The baseline mean path length.
+	Count  int     // The number of prepends.
+	Time   time.Time
+}
+
+// AnomalyConfig holds the thresholds used by a PathAnomalyDetector.
+type AnomalyConfig struct {
+	MaxPrepend     int      // More consecutive copies of an ASN than this is excessive.
+	WatchedPrefix  []string // Prefixes whose path lengths are baselined.
+	WatchedOrigins []int32  // Origins whose upstreams are learned, and alerted if new.
+	LengthSamples  int      // Samples required before a length baseline is used.
+	LengthStdDev   float64  // Deviations from the baseline mean which are anomalous.
+	LengthMinDiff  float64  // The minimum absolute length difference which is anomalous.
+	LearnUpstreams int      // Announcements of a watched origin before new upstreams are alerted.
+}
+
+// DefaultAnomalyConfig returns an AnomalyConfig with conservative thresholds.
+func DefaultAnomalyConfig() *AnomalyConfig {
+	return &AnomalyConfig{
+		MaxPrepend:     10,
+		LengthSamples:  50,
+		LengthStdDev:   3,
+		LengthMinDiff:  2,
+		LearnUpstreams: 100,
+	}
+}
+
+// lengthBaseline is a running mean and variance (Welford) of path lengths.
+type lengthBaseline struct {
+	n        int
+	mean, m2 float64
+}
+
+func (b *lengthBaseline) add(x float64) {
+	b.n++
+	d := x - b.mean
+	b.mean += d / float64(b.n)
+	b.m2 += d * (x - b.mean)
+}
+
+func (b *lengthBaseline) stddev() float64 {
+	if b.n < 2 {
+		return 0
+	}
+	return math.Sqrt(b.m2 / float64(b.n-1))
+}
+
+type originUpstreams struct {
+	seen      int
+	upstreams map[int32]bool
+}
+
+// PathAnomalyDetector inspects the DigestedPath of each message for anomalies.
+type PathAnomalyDetector struct {
+	mu        sync.Mutex
+	cfg       *AnomalyConfig
+	watched   map[string]bool
+	baselines map[string]*lengthBaseline
+	origins   map[int32]*originUpstreams
+}
+
+// NewPathAnomalyDetector creates a PathAnomalyDetector, a nil config uses DefaultAnomalyConfig.
+func NewPathAnomalyDetector(cfg *AnomalyConfig) *PathAnomalyDetector {
+	if cfg == nil {
+		cfg = DefaultAnomalyConfig()
+	}
+	d := &PathAnomalyDetector{
+		cfg:       cfg,
+		watched:   map[string]bool{},
+		baselines: map[string]*lengthBaseline{},
+		origins:   map[int32]*originUpstreams{},
+	}
+	for _, p := range cfg.WatchedPrefix {
+		d.watched[p] = true
+	}
+	for _, o := range cfg.WatchedOrigins {
+		d.origins[o] = &originUpstreams{upstreams: map[int32]bool{}}
+	}
+	return d
+}
+
+// Prepends returns the largest run of consecutive copies of a single ASN in path,
+// and that ASN.
+func Prepends(path []int32) (int32, int) {
+	var asn int32
+	max := 0
+	for i := 0; i < len(path); {
+		j := i
+		for j < len(path) && path[j] == path[i] {
+			j++
+		}
+		if j-i > max {
+			asn, max = path[i], j-i
+		}
+		i = j
+	}
+	return asn, max
+}
+
+// Loops returns the ASNs which appear in non-adjacent positions in path. The
+// members of its AS_SETs, sets, are skipped: an aggregator lists the ASNs of
+// the routes it aggregated, which may include its neighbors in the path.
+func Loops(path []int32, sets []PathSet) []int32 {
+	var result []int32
+	last := map[int32]int{}
+	looped := map[int32]bool{}
+	for i, asn := range path {
+		for len(sets) > 0 && sets[0].End <= i {
+			sets = sets[1:]
+		}
+		if len(sets) > 0 && sets[0].Start <= i {
+			continue
+		}
+		if j, ok := last[asn]; ok && j != i-1 && !looped[asn] {
+			looped[asn] = true
+			result = append(result, asn)
+		}
+		last[asn] = i
+	}
+	return result
+}
+
+// pathLength returns the length of the path with prepends removed.
+func pathLength(path []int32) int {
+	n := 0
+	for i := range path {
+		if i == 0 || path[i] != path[i-1] {
+			n++
+		}
+	}
+	return n
+}
+
+// upstream returns the first ASN before the origin in path, ignoring origin prepends.
+func upstream(path []int32) (int32, bool) {
+	if len(path) == 0 {
+		return 0, false
+	}
+	origin := path[len(path)-1]
+	for i := len(path) - 2; i >= 0; i-- {
+		if path[i] != origin {
+			return path[i], true
+		}
+	}
+	return 0, false
+}
+
+// Check returns the anomalies found in the message, updating the length baselines
+// and learned upstreams as it does so.
+func (d *PathAnomalyDetector) Check(rm *RisMessageData) []*PathAnomaly {
+	path := rm.DigestedPath
+	origin, ok := rm.OriginASN()
+	if !ok {
+		return nil
+	}
+	ts := rm.Time()
+	length := pathLength(path)
+	var result []*PathAnomaly
+
+	if asn, n := Prepends(path); d.cfg.MaxPrepend > 0 && n > d.cfg.MaxPrepend {
+		result = append(result, &PathAnomaly{Kind: ExcessivePrepend, ASN: asn, Origin: origin, Path: path, Length: length, Count: n, Time: ts})
+	}
+	for _, asn := range Loops(path, rm.PathSets) {
+		result = append(result, &PathAnomaly{Kind: PathLoop, ASN: asn, Origin: origin, Path: path, Length: length, Time: ts})
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, a := range rm.Announcements {
+		for _, prefix := range a.Prefixes {
+			if !d.watched[prefix] {
+				continue
+			}
+			b, ok := d.baselines[prefix]
+			if !ok {
+				b = &lengthBaseline{}
+				d.baselines[prefix] = b
+			}
+			if b.n >= d.cfg.LengthSamples {
+				diff := math.Abs(float64(length) - b.mean)
+				if diff >= d.cfg.LengthMinDiff && diff > d.cfg.LengthStdDev*b.stddev() {
+					result = append(result, &PathAnomaly{Kind: PathLengthChange, Prefix: prefix, Origin: origin, Path: path, Length: length, Mean: b.mean, Time: ts})
+				}
+			}
+			b.add(float64(length))
+		}
+	}
+
+	if ou, ok := d.origins[origin]; ok {
+		if up, ok := upstream(path); ok && !ou.upstreams[up] {
+			ou.upstreams[up] = true
+			if ou.seen >= d.cfg.LearnUpstreams {
+				result = append(result, &PathAnomaly{Kind: NewUpstream, ASN: up, Origin: origin, Path: path, Length: length, Time: ts})
+			}
+		}
+		ou.seen++
+	}
+	return result
+}
+
+// Upstreams returns the upstreams learned for a watched origin.
+func (d *PathAnomalyDetector) Upstreams(origin int32) []int32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var result []int32
+	if ou, ok := d.origins[origin]; ok {
+		for up := range ou.upstreams {
+			result = append(result, up)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestPrependsLoops(t *testing.T) {
+	tests := []struct {
+		desc        string
+		path        []int32
+		sets        []PathSet
+		wantASN     int32
+		wantPrepend int
+		wantLoops   []int32
+	}{{
+		desc:        "Success - no prepends, no loops",
+		path:        []int32{1, 2, 3},
+		wantASN:     1,
+		wantPrepend: 1,
+	}, {
+		desc:        "Success - origin prepends",
+		path:        []int32{1, 2, 3, 3, 3},
+		wantASN:     3,
+		wantPrepend: 3,
+	}, {
+		desc:        "Success - loop",
+		path:        []int32{1, 2, 3, 2, 4},
+		wantASN:     1,
+		wantPrepend: 1,
+		wantLoops:   []int32{2},
+	}, {
+		desc:        "Success - prepends are not a loop",
+		path:        []int32{1, 2, 2, 2, 4},
+		wantASN:     2,
+		wantPrepend: 3,
+	}, {
+		desc:        "Success - AS_SET members are not a loop",
+		path:        []int32{1, 2, 2, 3},
+		sets:        []PathSet{{2, 4}},
+		wantASN:     2,
+		wantPrepend: 2,
+	}, {
+		desc:        "Success - loop around an AS_SET",
+		path:        []int32{1, 2, 5, 2, 3},
+		sets:        []PathSet{{2, 3}, {4, 4}},
+		wantASN:     1,
+		wantPrepend: 1,
+		wantLoops:   []int32{2},
+	}}
+
+	for _, test := range tests {
+		asn, n := Prepends(test.path)
+		if asn != test.wantASN || n != test.wantPrepend {
+			t.Errorf("[%v]: Prepends() got (%v, %v) want (%v, %v)", test.desc, asn, n, test.wantASN, test.wantPrepend)
+		}
+		if diff := cmp.Diff(Loops(test.path, test.sets), test.wantLoops); diff != "" {
+			t.Errorf("[%v]: Loops() got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestPathAnomalyDetectorCheck(t *testing.T) {
+	cfg := &AnomalyConfig{
+		MaxPrepend:     3,
+		WatchedPrefix:  []string{"192.0.2.0/24"},
+		WatchedOrigins: []int32{100},
+		LengthSamples:  3,
+		LengthStdDev:   3,
+		LengthMinDiff:  2,
+		LearnUpstreams: 2,
+	}
+	// Train the length baseline and learn upstreams 10 and 20 for AS100.
+	training := []*RisMessageData{
+		announce(0, "rrc00", "1.1.1.1", []interface{}{1, 10, 100}, "192.0.2.0/24"),
+		announce(0, "rrc00", "2.2.2.2", []interface{}{2, 20, 100}, "192.0.2.0/24"),
+		announce(0, "rrc00", "3.3.3.3", []interface{}{3, 10, 100}, "192.0.2.0/24"),
+	}
+	cmpOpts := []cmp.Option{cmpopts.IgnoreFields(PathAnomaly{}, "Path", "Time"), cmpopts.EquateApprox(0, 0.001)}
+
+	tests := []struct {
+		desc string
+		msg  *RisMessageData
+		want []*PathAnomaly
+	}{{
+		desc: "Success - normal path",
+		msg:  announce(1, "rrc00", "4.4.4.4", []interface{}{4, 20, 100}, "192.0.2.0/24"),
+	}, {
+		desc: "Success - excessive prepend",
+		msg:  announce(1, "rrc00", "4.4.4.4", []interface{}{4, 20, 100, 100, 100, 100}, "198.51.100.0/24"),
+		want: []*PathAnomaly{{Kind: ExcessivePrepend, ASN: 100, Origin: 100, Length: 3, Count: 4}},
+	}, {
+		desc: "Success - loop",
+		msg:  announce(1, "rrc00", "4.4.4.4", []interface{}{4, 20, 4, 10, 100}, "198.51.100.0/24"),
+		want: []*PathAnomaly{{Kind: PathLoop, ASN: 4, Origin: 100, Length: 5}},
+	}, {
+		desc: "Success - path length change",
+		msg:  announce(1, "rrc00", "4.4.4.4", []interface{}{4, 5, 6, 7, 20, 100}, "192.0.2.0/24"),
+		want: []*PathAnomaly{{Kind: PathLengthChange, Prefix: "192.0.2.0/24", Origin: 100, Length: 6, Mean: 3}},
+	}, {
+		desc: "Success - new upstream of a watched origin",
+		msg:  announce(1, "rrc00", "4.4.4.4", []interface{}{4, 666, 100}, "198.51.100.0/24"),
+		want: []*PathAnomaly{{Kind: NewUpstream, ASN: 666, Origin: 100, Length: 3}},
+	}}
+
+	for _, test := range tests {
+		d := NewPathAnomalyDetector(cfg)
+		for _, rm := range training {
+			if got := d.Check(rm); len(got) != 0 {
+				t.Fatalf("[%v]: training produced anomalies: %v", test.desc, got)
+			}
+		}
+		got := d.Check(test.msg)
+		if diff := cmp.Diff(got, test.want, cmpOpts...); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestUpstreams(t *testing.T) {
+	d := NewPathAnomalyDetector(&AnomalyConfig{WatchedOrigins: []int32{100}})
+	d.Check(announce(0, "rrc00", "1.1.1.1", []interface{}{1, 20, 100, 100}, "192.0.2.0/24"))
+	d.Check(announce(0, "rrc00", "1.1.1.1", []interface{}{1, 10, 100}, "192.0.2.0/24"))
+	d.Check(announce(0, "rrc00", "1.1.1.1", []interface{}{1, 10, 200}, "192.0.2.0/24"))
+
+	if diff := cmp.Diff(d.Upstreams(100), []int32{10, 20}); diff != "" {
+		t.Errorf("Upstreams() got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
@@ -0,0 +1,203 @@
+// A REST API for queries of the RIB, JSON answers to:
+//
+//	GET /prefix/{cidr}          who originates a prefix, which peers see it, their
+//	                            paths and the RPKI state of each origin. A bare
+//	                            address is looked up as a /32 or /128. The match
+//	                            parameter selects the prefixes answered:
+//	                              longest        the most specific covering prefix (default)
+//	                              exact          only the prefix itself
+//	                              more-specific  the prefix and its more specifics
+//	GET /asn/{asn}/prefixes     the prefixes an ASN currently originates
+//	GET /asn/{asn}/neighbors    the ASNs adjacent to an ASN in the current paths
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// QueryAPI serves the REST API from a RIB.
+type QueryAPI struct {
+	RIB  *RIB
+	ROAs *ROATable // If set, the RPKI state of each origin is included.
+}
+
+// apiRoute is a Route as the API returns it.
+type apiRoute struct {
+	Collector string    `json:"collector"`
+	Peer      string    `json:"peer"`
+	PeerASN   string    `json:"peer_asn,omitempty"`
+	Path      []uint32  `json:"path"`
+	NextHop   string    `json:"next_hop,omitempty"`
+	Community [][]int32 `json:"community,omitempty"`
+	Updated   time.Time `json:"updated"`
+}
+
+// apiOrigin is an origin of a prefix, with the number of peers carrying it.
+type apiOrigin struct {
+	ASN   uint32 `json:"asn"`
+	Peers int    `json:"peers"`
+	RPKI  string `json:"rpki,omitempty"`
+}
+
+// apiPrefix is the routing state of a prefix.
+type apiPrefix struct {
+	Prefix  string       `json:"prefix"`
+	Origins []*apiOrigin `json:"origins"`
+	Routes  []*apiRoute  `json:"routes"`
+}
+
+// apiError replies with an error and its status.
+func apiError(w http.ResponseWriter, code int, format string, a ...interface{}) {
+	apiReply(w, code, map[string]string{"error": fmt.Sprintf(format, a...)})
+}
+
+// apiReply replies with v encoded as JSON.
+func apiReply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Infof("failed to send API reply: %v", err)
+	}
+}
+
+// ServeHTTP routes the API requests.
+func (a *QueryAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		apiError(w, http.StatusMethodNotAllowed, "unsupported method: %v", req.Method)
+		return
+	}
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case parts[0] == "prefix" && len(parts) >= 2:
+		// A prefix has a / of its own, /prefix/8.8.8.0/24.
+		a.servePrefix(w, req, strings.Join(parts[1:], "/"))
+	case parts[0] == "asn" && len(parts) == 3 && parts[2] == "prefixes":
+		a.serveASN(w, parts[1], func(asn int32) interface{} {
+			return struct {
+				ASN      uint32   `json:"asn"`
+				Prefixes []string `json:"prefixes"`
+			}{uint32(asn), a.RIB.Originated(asn)}
+		})
+	case parts[0] == "asn" && len(parts) == 3 && parts[2] == "neighbors":
+		a.serveASN(w, parts[1], func(asn int32) interface{} {
+			type neighbor struct {
+				ASN    uint32 `json:"asn"`
+				Routes int    `json:"routes"`
+			}
+			result := struct {
+				ASN       uint32      `json:"asn"`
+				Neighbors []*neighbor `json:"neighbors"`
+			}{ASN: uint32(asn)}
+			for _, n := range a.RIB.Neighbors(asn) {
+				result.Neighbors = append(result.Neighbors, &neighbor{uint32(n.ASN), n.Routes})
+			}
+			return result
+		})
+	default:
+		apiError(w, http.StatusNotFound, "unknown path: %v", req.URL.Path)
+	}
+}
+
+// serveASN replies with the result of f for the ASN parameter.
+func (a *QueryAPI) serveASN(w http.ResponseWriter, s string, f func(int32) interface{}) {
+	asns, err := parseASNs([]string{s})
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	apiReply(w, http.StatusOK, f(asns[0]))
+}
+
+// parseQueryPrefix parses a prefix, or an address as a host prefix.
+func parseQueryPrefix(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	return parsePrefix(s)
+}
+
+// servePrefix replies with the routing state of the prefixes matching s.
+func (a *QueryAPI) servePrefix(w http.ResponseWriter, req *http.Request, s string) {
+	n, err := parseQueryPrefix(s)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	var prefixes []*net.IPNet
+	switch m := req.URL.Query().Get("match"); m {
+	case "", "longest":
+		if lm := a.RIB.LongestMatch(n); lm != nil {
+			prefixes = append(prefixes, lm)
+		}
+	case "exact":
+		if len(a.RIB.Routes(n)) > 0 {
+			prefixes = append(prefixes, n)
+		}
+	case "more-specific":
+		if len(a.RIB.Routes(n)) > 0 {
+			prefixes = append(prefixes, n)
+		}
+		prefixes = append(prefixes, a.RIB.MoreSpecifics(n)...)
+	default:
+		apiError(w, http.StatusBadRequest, "unsupported match: %q", m)
+		return
+	}
+	if len(prefixes) == 0 {
+		apiError(w, http.StatusNotFound, "no routes for %v", n)
+		return
+	}
+	result := struct {
+		Query    string       `json:"query"`
+		Prefixes []*apiPrefix `json:"prefixes"`
+	}{Query: n.String()}
+	for _, p := range prefixes {
+		result.Prefixes = append(result.Prefixes, a.prefix(p))
+	}
+	apiReply(w, http.StatusOK, result)
+}
+
+// prefix returns the routing state of n.
+func (a *QueryAPI) prefix(n *net.IPNet) *apiPrefix {
+	result := &apiPrefix{Prefix: n.String()}
+	origins := map[int32]*apiOrigin{}
+	for _, rt := range a.RIB.Routes(n) {
+		r := &apiRoute{
+			Collector: rt.Collector,
+			Peer:      rt.Peer,
+			PeerASN:   rt.PeerASN,
+			Path:      []uint32{},
+			NextHop:   rt.NextHop,
+			Community: rt.Community,
+			Updated:   rt.Updated.UTC(),
+		}
+		for _, asn := range rt.Path {
+			r.Path = append(r.Path, uint32(asn))
+		}
+		result.Routes = append(result.Routes, r)
+
+		origin, _ := rt.Origin()
+		o, ok := origins[origin]
+		if !ok {
+			o = &apiOrigin{ASN: uint32(origin)}
+			if a.ROAs != nil {
+				o.RPKI = a.ROAs.Validate(n, origin).String()
+			}
+			origins[origin] = o
+			result.Origins = append(result.Origins, o)
+		}
+		o.Peers++
+	}
+	sort.Slice(result.Origins, func(i, j int) bool { return result.Origins[i].ASN < result.Origins[j].ASN })
+	return result
+}
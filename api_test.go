@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestQueryAPI(t *testing.T) {
+	roas, err := ParseROAs([]byte(testROAs))
+	if err != nil {
+		t.Fatalf("failed to parse ROAs: %v", err)
+	}
+	srv := httptest.NewServer(&QueryAPI{RIB: newTestRIB(), ROAs: roas})
+	defer srv.Close()
+
+	tests := []struct {
+		desc       string
+		path       string
+		wantStatus int
+		want       string
+	}{{
+		desc:       "Success - prefix",
+		path:       "/prefix/8.8.8.0/24",
+		wantStatus: http.StatusOK,
+		want: `{"query": "8.8.8.0/24", "prefixes": [{
+			"prefix": "8.8.8.0/24",
+			"origins": [{"asn": 15169, "peers": 2, "rpki": "valid"}],
+			"routes": [
+				{"collector": "rrc00", "peer": "192.0.2.1", "peer_asn": "64496", "path": [64496, 3356, 15169], "next_hop": "192.0.2.1", "updated": "2019-05-23T14:00:47Z"},
+				{"collector": "rrc01", "peer": "192.0.2.2", "peer_asn": "64497", "path": [64497, 64497, 3356, 15169], "next_hop": "192.0.2.2", "updated": "2019-05-23T14:00:48Z"}
+			]}]}`,
+	}, {
+		desc:       "Success - longest match of an address",
+		path:       "/prefix/8.8.8.200",
+		wantStatus: http.StatusOK,
+		want: `{"query": "8.8.8.200/32", "prefixes": [{
+			"prefix": "8.8.8.128/25",
+			"origins": [{"asn": 64511, "peers": 1, "rpki": "invalid"}],
+			"routes": [{"collector": "rrc01", "peer": "192.0.2.2", "peer_asn": "64497", "path": [64497, 64511], "next_hop": "192.0.2.2", "updated": "2019-05-23T14:00:49Z"}]
+		}]}`,
+	}, {
+		desc:       "Success - originated prefixes",
+		path:       "/asn/AS15169/prefixes",
+		wantStatus: http.StatusOK,
+		want:       `{"asn": 15169, "prefixes": ["2001:db8::/32", "8.8.8.0/24"]}`,
+	}, {
+		desc:       "Success - neighbors",
+		path:       "/asn/64497/neighbors",
+		wantStatus: http.StatusOK,
+		want:       `{"asn": 64497, "neighbors": [{"asn": 3356, "routes": 1}, {"asn": 64511, "routes": 1}]}`,
+	}, {
+		desc:       "Failure - exact match of an unrouted prefix",
+		path:       "/prefix/8.8.0.0/16?match=exact",
+		wantStatus: http.StatusNotFound,
+	}, {
+		desc:       "Failure - not routed",
+		path:       "/prefix/192.0.2.1",
+		wantStatus: http.StatusNotFound,
+	}, {
+		desc:       "Failure - bad prefix",
+		path:       "/prefix/8.8.8.0/33",
+		wantStatus: http.StatusBadRequest,
+	}, {
+		desc:       "Failure - bad match",
+		path:       "/prefix/8.8.8.0/24?match=some",
+		wantStatus: http.StatusBadRequest,
+	}, {
+		desc:       "Failure - bad ASN",
+		path:       "/asn/x/prefixes",
+		wantStatus: http.StatusBadRequest,
+	}, {
+		desc:       "Failure - unknown path",
+		path:       "/asn/15169/peers",
+		wantStatus: http.StatusNotFound,
+	}}
+	for _, test := range tests {
+		resp, err := http.Get(srv.URL + test.path)
+		if err != nil {
+			t.Errorf("[%v]: failed to get: %v", test.desc, err)
+			continue
+		}
+		var got interface{}
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("[%v]: failed to decode reply: %v", test.desc, err)
+			continue
+		}
+		if resp.StatusCode != test.wantStatus {
+			t.Errorf("[%v]: got status %v, want %v: %v", test.desc, resp.StatusCode, test.wantStatus, got)
+			continue
+		}
+		if test.want == "" {
+			continue
+		}
+		var want interface{}
+		if err := json.Unmarshal([]byte(test.want), &want); err != nil {
+			t.Fatalf("[%v]: failed to parse want: %v", test.desc, err)
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestQueryAPIMoreSpecifics(t *testing.T) {
+	srv := httptest.NewServer(&QueryAPI{RIB: newTestRIB()})
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/prefix/8.8.8.0/24?match=more-specific")
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	defer resp.Body.Close()
+	var got struct {
+		Prefixes []struct {
+			Prefix  string
+			Origins []map[string]interface{}
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode reply: %v", err)
+	}
+	var prefixes []string
+	for _, p := range got.Prefixes {
+		prefixes = append(prefixes, p.Prefix)
+		for _, o := range p.Origins {
+			if _, ok := o["rpki"]; ok {
+				t.Errorf("got rpki state %v without ROAs", o)
+			}
+		}
+	}
+	if diff := cmp.Diff(prefixes, []string{"8.8.8.0/24", "8.8.8.128/25"}); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
@@ -0,0 +1,239 @@
+// Backpressure policies for RisLive.Chan, which decide what happens when the
+// consumer is slower than the firehose: block (and risk the server disconnecting
+// us), drop messages, or spill them to disk until the consumer catches up.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	log "github.com/golang/glog"
+)
+
+// OverflowPolicy is the action taken when RisLive.Chan is full.
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // Wait for the consumer.
+	OverflowDropNewest                       // Drop the message being sent.
+	OverflowDropOldest                       // Drop the oldest queued message, a ring buffer.
+	OverflowSpill                            // Queue messages on disk, in order.
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowSpill:
+		return "spill"
+	}
+	return "unknown"
+}
+
+// ParseOverflowPolicy parses a policy name: block, drop-newest, drop-oldest or spill.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	for _, p := range []OverflowPolicy{OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowSpill} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return OverflowBlock, fmt.Errorf("unknown overflow policy: %v", s)
+}
+
+// send sends a message to the channel, according to the overflow policy. The
+// hold of a pooled message passes to the channel, those dropped or spilled are
+// released.
+func (r *RisLive) send(rm RisMessage) {
+	if depth := float64(len(r.Chan)); depth > r.Metrics.HighWater.Get() {
+		r.Metrics.HighWater.Set(depth)
+	}
+	switch r.Overflow {
+	case OverflowDropNewest:
+		select {
+		case r.Chan <- rm:
+		default:
+			rm.Release()
+			r.Metrics.Dropped.Inc(r.Overflow.String())
+		}
+		return
+	case OverflowDropOldest:
+		for {
+			select {
+			case r.Chan <- rm:
+				return
+			default:
+			}
+			// The consumer may empty the channel meanwhile, so the oldest is only
+			// dropped if there is one.
+			select {
+			case old := <-r.Chan:
+				old.Release()
+				r.Metrics.Dropped.Inc(r.Overflow.String())
+			default:
+			}
+		}
+	case OverflowSpill:
+		if r.spill == nil {
+			s, err := newSpiller(r.SpillDir, r.Chan)
+			if err != nil {
+				log.Errorf("failed to create spill file, blocking instead: %v", err)
+				r.Overflow = OverflowBlock
+				r.Chan <- rm
+				return
+			}
+			r.spill = s
+			r.Metrics.GaugeFunc("rislive_spill_backlog", "Messages spilled to disk, waiting for the consumer.", func() float64 { return float64(s.Pending()) })
+		}
+		// Once spilling, messages continue to be spilled until the backlog drains,
+		// keeping them in order.
+		if r.spill.Pending() == 0 {
+			select {
+			case r.Chan <- rm:
+				return
+			default:
+			}
+		}
+		err := r.spill.Write(rm)
+		rm.Release()
+		if err != nil {
+			log.Errorf("failed to spill message, dropping it: %v", err)
+			r.Metrics.Dropped.Inc(r.Overflow.String())
+			return
+		}
+		r.Metrics.Spilled.Inc()
+		return
+	}
+	r.Chan <- rm
+}
+
+// closeChan closes the channel, after any spilled messages have been delivered.
+func (r *RisLive) closeChan() {
+	if r.spill != nil {
+		if err := r.spill.Close(); err != nil {
+			log.Errorf("failed to remove spill file: %v", err)
+		}
+	}
+	close(r.Chan)
+}
+
+// spiller queues messages in a file, delivering them to a channel in order as
+// the consumer takes them. The file is truncated whenever the backlog drains.
+type spiller struct {
+	out  chan RisMessage
+	w    *os.File
+	rf   *os.File
+	r    *bufio.Reader
+	done chan struct{}
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending int
+	closed  bool
+}
+
+// newSpiller creates a spill file in dir, the default temporary directory if empty.
+func newSpiller(dir string, out chan RisMessage) (*spiller, error) {
+	w, err := ioutil.TempFile(dir, "rislive-spill-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %v", err)
+	}
+	rf, err := os.Open(w.Name())
+	if err != nil {
+		w.Close()
+		os.Remove(w.Name())
+		return nil, fmt.Errorf("failed to open spill file(%v): %v", w.Name(), err)
+	}
+	s := &spiller{out: out, w: w, rf: rf, r: bufio.NewReader(rf), done: make(chan struct{})}
+	s.cond = sync.NewCond(&s.mu)
+	go s.drain()
+	return s, nil
+}
+
+// Pending returns the number of messages in the spill file.
+func (s *spiller) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// Write appends a message to the spill file.
+func (s *spiller) Write(rm RisMessage) error {
+	b, err := json.Marshal(rm)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write spill file(%v): %v", s.w.Name(), err)
+	}
+	s.pending++
+	s.cond.Signal()
+	return nil
+}
+
+// drain delivers spilled messages to the channel until the spiller is closed
+// and the backlog is empty.
+func (s *spiller) drain() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		for s.pending == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.pending == 0 {
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+
+		// Messages are written whole before pending is incremented.
+		line, err := s.r.ReadBytes('\n')
+		var rm RisMessage
+		if err == nil {
+			err = json.Unmarshal(line, &rm)
+		}
+		if err != nil {
+			log.Errorf("failed to read spill file(%v), message lost: %v", s.w.Name(), err)
+		} else {
+			s.out <- rm
+		}
+
+		s.mu.Lock()
+		if s.pending--; s.pending == 0 {
+			s.reset()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// reset truncates the drained spill file, the lock must be held.
+func (s *spiller) reset() {
+	if err := s.w.Truncate(0); err != nil {
+		log.Errorf("failed to truncate spill file(%v): %v", s.w.Name(), err)
+		return
+	}
+	s.w.Seek(0, 0)
+	s.rf.Seek(0, 0)
+	s.r.Reset(s.rf)
+}
+
+// Close waits for the backlog to be delivered, then removes the spill file.
+func (s *spiller) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	<-s.done
+	s.rf.Close()
+	s.w.Close()
+	return os.Remove(s.w.Name())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, p := range []OverflowPolicy{OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowSpill} {
+		got, err := ParseOverflowPolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParseOverflowPolicy(%v) = %v, %v", p, got, err)
+		}
+	}
+	if _, err := ParseOverflowPolicy("drop-all"); err == nil {
+		t.Errorf("did not get error for an unknown policy")
+	}
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		desc      string
+		policy    OverflowPolicy
+		want      []float64 // The timestamps of the messages read from the channel.
+		dropped   float64
+		spilled   float64
+		highWater float64
+	}{{
+		desc:      "Success - drop newest",
+		policy:    OverflowDropNewest,
+		want:      []float64{1, 2},
+		dropped:   3,
+		highWater: 2,
+	}, {
+		desc:      "Success - drop oldest",
+		policy:    OverflowDropOldest,
+		want:      []float64{4, 5},
+		dropped:   3,
+		highWater: 2,
+	}, {
+		desc:      "Success - spill",
+		policy:    OverflowSpill,
+		want:      []float64{1, 2, 3, 4, 5},
+		spilled:   3,
+		highWater: 2,
+	}}
+
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "rislive-test")
+		if err != nil {
+			t.Fatalf("failed to create temp dir: %v", err)
+		}
+		r := &RisLive{
+			Chan:     make(chan RisMessage, 2),
+			Metrics:  NewMetrics(),
+			Overflow: test.policy,
+			SpillDir: dir,
+		}
+		// No consumer is reading, so all but 2 messages overflow.
+		for ts := 1; ts <= 5; ts++ {
+			r.send(RisMessage{Type: "ris_message", Data: &RisMessageData{Timestamp: float64(ts), Host: "rrc00"}})
+		}
+		if got := r.Metrics.Dropped.Get(test.policy.String()); got != test.dropped {
+			t.Errorf("[%v]: got %v dropped, want %v", test.desc, got, test.dropped)
+		}
+		if got := r.Metrics.Spilled.Get(); got != test.spilled {
+			t.Errorf("[%v]: got %v spilled, want %v", test.desc, got, test.spilled)
+		}
+		if got := r.Metrics.HighWater.Get(); got != test.highWater {
+			t.Errorf("[%v]: got high water %v, want %v", test.desc, got, test.highWater)
+		}
+
+		// Closing waits for the spill backlog, so it is done while consuming.
+		go r.closeChan()
+		var got []float64
+		for rm := range r.Chan {
+			got = append(got, rm.Data.Timestamp)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+		if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+			t.Errorf("[%v]: spill files remain: %v", test.desc, files)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSpillerDrains(t *testing.T) {
+	out := make(chan RisMessage)
+	s, err := newSpiller("", out)
+	if err != nil {
+		t.Fatalf("failed to create spiller: %v", err)
+	}
+	defer s.Close()
+
+	// The backlog drains, and the file is reused, across rounds of spilling.
+	for round := 0; round < 2; round++ {
+		for ts := 1; ts <= 3; ts++ {
+			if err := s.Write(RisMessage{Data: &RisMessageData{Timestamp: float64(ts), DigestedPath: []int32{1, 2}}}); err != nil {
+				t.Fatalf("failed to spill: %v", err)
+			}
+		}
+		for ts := 1; ts <= 3; ts++ {
+			rm := <-out
+			if rm.Data.Timestamp != float64(ts) || len(rm.Data.DigestedPath) != 2 {
+				t.Errorf("round %d: got %+v, want timestamp %v", round, rm.Data, ts)
+			}
+		}
+	}
+}
@@ -0,0 +1,696 @@
+// Decode BGP messages (RFC 4271) to the RisMessageData model, as RIS Live does:
+// the type of each message and, for UPDATEs, the ORIGIN, AS_PATH, NEXT_HOP and
+// COMMUNITIES attributes with the announced and withdrawn prefixes, of IPv4 and,
+// through MP_REACH_NLRI and MP_UNREACH_NLRI (RFC 4760), IPv6 unicast.
+//
+// AS paths hold 2 or 4 byte ASNs depending on the session (RFC 6793). A 2 byte
+// path is merged with its AS4_PATH attribute, if there is one.
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	bgpMarkerLen = 16
+	bgpHeaderLen = 19
+)
+
+// BGP message types.
+const (
+	bgpOpen         = 1
+	bgpUpdate       = 2
+	bgpNotification = 3
+	bgpKeepalive    = 4
+	bgpRouteRefresh = 5
+)
+
+// bgpTypeName returns the name RIS Live gives a BGP message type.
+func bgpTypeName(t uint8) string {
+	switch t {
+	case bgpOpen:
+		return "OPEN"
+	case bgpUpdate:
+		return "UPDATE"
+	case bgpNotification:
+		return "NOTIFICATION"
+	case bgpKeepalive:
+		return "KEEPALIVE"
+	case bgpRouteRefresh:
+		return "ROUTE-REFRESH"
+	}
+	return fmt.Sprintf("UNKNOWN-%d", t)
+}
+
+// BGP path attribute type codes.
+const (
+	attrOrigin      = 1
+	attrASPath      = 2
+	attrNextHop     = 3
+	attrCommunities = 8
+	attrMPReach     = 14
+	attrMPUnreach   = 15
+	attrAS4Path     = 17
+)
+
+// BGP path attribute flags.
+const (
+	attrFlagOptional   = 0x80
+	attrFlagTransitive = 0x40
+	attrFlagExtended   = 0x10
+)
+
+// AS_PATH segment types.
+const (
+	asSet      = 1
+	asSequence = 2
+)
+
+// Address families, and the unicast subsequent address family.
+const (
+	afiIPv4     = 1
+	afiIPv6     = 2
+	safiUnicast = 1
+)
+
+// asPathElem is a single ASN of an AS_SEQUENCE, or an AS_SET.
+type asPathElem struct {
+	asns []uint32
+	set  bool
+}
+
+// bgpAttrs holds the path attributes of an UPDATE, or of a RIB entry.
+type bgpAttrs struct {
+	origin    string
+	path      []asPathElem
+	as4Path   []asPathElem
+	nextHop   string
+	community [][]int32
+	mpNextHop []string
+	mpReach   []string
+	mpUnreach []string
+}
+
+// parseBGPMessage decodes a BGP message, from its marker, to rm. The raw
+// message is kept, hex encoded, as RIS Live sends it.
+func parseBGPMessage(b []byte, as4 bool, rm *RisMessageData) error {
+	if len(b) < bgpHeaderLen {
+		return fmt.Errorf("truncated BGP message of %v bytes", len(b))
+	}
+	l := int(binary.BigEndian.Uint16(b[bgpMarkerLen:]))
+	if l < bgpHeaderLen || l > len(b) {
+		return fmt.Errorf("invalid BGP message length %v of %v bytes", l, len(b))
+	}
+	b = b[:l]
+	rm.Type = bgpTypeName(b[18])
+	rm.Raw = strings.ToUpper(hex.EncodeToString(b))
+	if b[18] != bgpUpdate {
+		return nil
+	}
+	return parseBGPUpdate(b[bgpHeaderLen:], as4, rm)
+}
+
+// parseBGPUpdate decodes the body of an UPDATE message to rm.
+func parseBGPUpdate(b []byte, as4 bool, rm *RisMessageData) error {
+	withdrawn, b, err := bgpField(b, "withdrawn routes")
+	if err != nil {
+		return err
+	}
+	attrs, nlri, err := bgpField(b, "path attributes")
+	if err != nil {
+		return err
+	}
+	a, err := parseBGPAttrs(attrs, as4, 0)
+	if err != nil {
+		return withdrawBGPUpdate(withdrawn, attrs, nlri, rm, err)
+	}
+	wp, err := parseNLRI(withdrawn, afiIPv4)
+	if err != nil {
+		return fmt.Errorf("failed to parse withdrawn routes: %v", err)
+	}
+	np, err := parseNLRI(nlri, afiIPv4)
+	if err != nil {
+		return fmt.Errorf("failed to parse NLRI: %v", err)
+	}
+	a.apply(rm)
+	rm.Withdrawals = append(wp, a.mpUnreach...)
+	if len(np) > 0 {
+		rm.Announcements = append(rm.Announcements, &RisAnnouncement{NextHop: a.nextHop, Prefixes: np})
+	}
+	if len(a.mpReach) > 0 {
+		for _, nh := range a.mpNextHop {
+			rm.Announcements = append(rm.Announcements, &RisAnnouncement{NextHop: nh, Prefixes: a.mpReach})
+		}
+	}
+	return nil
+}
+
+// bgpAttrError is the error of an UPDATE whose path attributes are malformed,
+// but whose prefixes could be decoded. RFC 7606 treats such an UPDATE as the
+// withdrawal of all of its prefixes, as which it is decoded.
+type bgpAttrError struct {
+	err error
+}
+
+func (e *bgpAttrError) Error() string {
+	return fmt.Sprintf("malformed path attributes, treated as withdrawn: %v", e.err)
+}
+
+// withdrawBGPUpdate decodes an UPDATE, whose path attributes failed to parse
+// with attrErr, to rm as a withdrawal of its withdrawn routes, NLRI, and the
+// prefixes of its MP_REACH_NLRI and MP_UNREACH_NLRI. A bgpAttrError is returned
+// if the prefixes are decoded, otherwise the error decoding them.
+func withdrawBGPUpdate(withdrawn, attrs, nlri []byte, rm *RisMessageData, attrErr error) error {
+	var prefixes []string
+	for _, f := range []struct {
+		name string
+		b    []byte
+	}{{"withdrawn routes", withdrawn}, {"NLRI", nlri}} {
+		p, err := parseNLRI(f.b, afiIPv4)
+		if err != nil {
+			return fmt.Errorf("failed to parse %v: %v", f.name, err)
+		}
+		prefixes = append(prefixes, p...)
+	}
+	for len(attrs) > 0 {
+		typ, v, rest, err := nextBGPAttr(attrs)
+		if err != nil {
+			return err
+		}
+		attrs = rest
+		var p []string
+		switch typ {
+		case attrMPReach:
+			a := &bgpAttrs{}
+			err = a.parseMPReach(v)
+			p = a.mpReach
+		case attrMPUnreach:
+			p, err = parseMPUnreach(v)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse attribute %v: %v", typ, err)
+		}
+		prefixes = append(prefixes, p...)
+	}
+	rm.Withdrawals = prefixes
+	return &bgpAttrError{err: attrErr}
+}
+
+// bgpField splits a field with a 2 byte length from the front of b.
+func bgpField(b []byte, name string) ([]byte, []byte, error) {
+	if len(b) < 2 {
+		return nil, nil, fmt.Errorf("truncated %v length", name)
+	}
+	l := int(binary.BigEndian.Uint16(b))
+	if l > len(b)-2 {
+		return nil, nil, fmt.Errorf("%v length %v exceeds the %v bytes left", name, l, len(b)-2)
+	}
+	return b[2 : 2+l], b[2+l:], nil
+}
+
+// apply sets the path attributes of rm, the path as a RisDecoder decodes it
+// from RIS Live, see ASPath.
+func (a *bgpAttrs) apply(rm *RisMessageData) {
+	rm.Origin = a.origin
+	rm.Community = a.community
+	rm.Path, rm.DigestedPath, rm.PathSets = nil, nil, nil
+	for _, e := range mergeAS4Path(a.path, a.as4Path) {
+		start := len(rm.DigestedPath)
+		for _, asn := range e.asns {
+			rm.DigestedPath = append(rm.DigestedPath, int32(asn))
+		}
+		if e.set {
+			rm.PathSets = append(rm.PathSets, PathSet{Start: start, End: len(rm.DigestedPath)})
+		}
+	}
+}
+
+// mergeAS4Path reconstructs the path of a 2 byte session from its AS_PATH and
+// AS4_PATH, as RFC 6793. An AS4_PATH longer than the AS_PATH is ignored.
+func mergeAS4Path(path, as4Path []asPathElem) []asPathElem {
+	if len(as4Path) == 0 || len(as4Path) > len(path) {
+		return path
+	}
+	result := append([]asPathElem{}, path[:len(path)-len(as4Path)]...)
+	return append(result, as4Path...)
+}
+
+// parseBGPAttrs decodes path attributes. MRT TABLE_DUMP_V2 RIB entries abbreviate
+// MP_REACH_NLRI to the next hop, for those ribAFI is the address family of the entry.
+func parseBGPAttrs(b []byte, as4 bool, ribAFI int) (*bgpAttrs, error) {
+	a := &bgpAttrs{}
+	for len(b) > 0 {
+		typ, v, rest, err := nextBGPAttr(b)
+		if err != nil {
+			return nil, err
+		}
+		b = rest
+		l := len(v)
+		switch typ {
+		case attrOrigin:
+			if l != 1 {
+				return nil, fmt.Errorf("invalid ORIGIN length %v", l)
+			}
+			switch v[0] {
+			case 0:
+				a.origin = "igp"
+			case 1:
+				a.origin = "egp"
+			case 2:
+				a.origin = "incomplete"
+			}
+		case attrASPath:
+			asnLen := 2
+			if as4 {
+				asnLen = 4
+			}
+			a.path, err = parseASPath(v, asnLen)
+		case attrAS4Path:
+			// Only 2 byte sessions carry an AS4_PATH, it is ignored on others.
+			if !as4 {
+				a.as4Path, err = parseASPath(v, 4)
+			}
+		case attrNextHop:
+			if l != net.IPv4len {
+				return nil, fmt.Errorf("invalid NEXT_HOP length %v", l)
+			}
+			a.nextHop = net.IP(v).String()
+		case attrCommunities:
+			if l%4 != 0 {
+				return nil, fmt.Errorf("invalid COMMUNITIES length %v", l)
+			}
+			for i := 0; i < l; i += 4 {
+				a.community = append(a.community, []int32{int32(binary.BigEndian.Uint16(v[i:])), int32(binary.BigEndian.Uint16(v[i+2:]))})
+			}
+		case attrMPReach:
+			if ribAFI != 0 && l > 0 && int(v[0])+1 == l {
+				a.mpNextHop, err = mpNextHop(v[1:])
+				break
+			}
+			err = a.parseMPReach(v)
+		case attrMPUnreach:
+			a.mpUnreach, err = parseMPUnreach(v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse attribute %v: %v", typ, err)
+		}
+	}
+	return a, nil
+}
+
+// nextBGPAttr splits the path attribute at the front of b, returning its type,
+// value, and the attributes after it.
+func nextBGPAttr(b []byte) (byte, []byte, []byte, error) {
+	if len(b) < 3 {
+		return 0, nil, nil, fmt.Errorf("truncated attribute header")
+	}
+	flags, typ := b[0], b[1]
+	var l int
+	if flags&attrFlagExtended != 0 {
+		if len(b) < 4 {
+			return 0, nil, nil, fmt.Errorf("truncated attribute header")
+		}
+		l, b = int(binary.BigEndian.Uint16(b[2:])), b[4:]
+	} else {
+		l, b = int(b[2]), b[3:]
+	}
+	if l > len(b) {
+		return 0, nil, nil, fmt.Errorf("attribute %v length %v exceeds the %v bytes left", typ, l, len(b))
+	}
+	return typ, b[:l], b[l:], nil
+}
+
+// parseMPUnreach decodes the unicast prefixes of an MP_UNREACH_NLRI attribute.
+func parseMPUnreach(v []byte) ([]string, error) {
+	if len(v) < 3 {
+		return nil, fmt.Errorf("truncated MP_UNREACH_NLRI")
+	}
+	afi := int(binary.BigEndian.Uint16(v))
+	if !unicastFamily(afi, v[2]) {
+		return nil, nil
+	}
+	return parseNLRI(v[3:], afi)
+}
+
+// unicastFamily reports whether an AFI and SAFI are IPv4 or IPv6 unicast, the
+// only families whose prefixes are kept.
+func unicastFamily(afi int, safi byte) bool {
+	return (afi == afiIPv4 || afi == afiIPv6) && safi == safiUnicast
+}
+
+// parseMPReach decodes an MP_REACH_NLRI attribute. Only unicast prefixes are
+// kept, other families, ie: flowspec or VPNs, are skipped without decoding
+// their next hop, which need not be an address.
+func (a *bgpAttrs) parseMPReach(v []byte) error {
+	if len(v) < 4 {
+		return fmt.Errorf("truncated MP_REACH_NLRI")
+	}
+	afi, safi, l := int(binary.BigEndian.Uint16(v)), v[2], int(v[3])
+	if !unicastFamily(afi, safi) {
+		return nil
+	}
+	if len(v) < 5+l {
+		return fmt.Errorf("truncated MP_REACH_NLRI next hop")
+	}
+	nh, err := mpNextHop(v[4 : 4+l])
+	if err != nil {
+		return err
+	}
+	a.mpNextHop = nh
+	// The next hop is followed by a reserved byte.
+	a.mpReach, err = parseNLRI(v[5+l:], afi)
+	return err
+}
+
+// mpNextHop decodes the next hop of MP_REACH_NLRI, an address or an IPv6 global
+// and link local address pair. As RIS Live, each is a next hop of the prefixes.
+func mpNextHop(v []byte) ([]string, error) {
+	switch len(v) {
+	case net.IPv4len:
+		return []string{net.IP(v).String()}, nil
+	case net.IPv6len:
+		return []string{ipv6String(v)}, nil
+	case 2 * net.IPv6len:
+		return []string{ipv6String(v[:net.IPv6len]), ipv6String(v[net.IPv6len:])}, nil
+	}
+	return nil, fmt.Errorf("invalid next hop length %v", len(v))
+}
+
+// ipv6String formats an IPv6 address as RIS Live does: an IPv4-mapped address as
+// ::ffff:192.0.2.1 where net.IP would give the IPv4 address, and a single zero
+// group compressed to :: where net.IP leaves it.
+func ipv6String(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	s := ip.String()
+	if strings.Contains(s, "::") {
+		return s
+	}
+	groups := strings.Split(s, ":")
+	for i, g := range groups {
+		if g == "0" {
+			return strings.Join(groups[:i], ":") + "::" + strings.Join(groups[i+1:], ":")
+		}
+	}
+	return s
+}
+
+// parseASPath decodes the segments of an AS_PATH with ASNs of asnLen bytes.
+// Confederation segments are not part of the path, and are skipped.
+func parseASPath(b []byte, asnLen int) ([]asPathElem, error) {
+	var path []asPathElem
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, fmt.Errorf("truncated AS_PATH segment header")
+		}
+		typ, n := b[0], int(b[1])
+		if len(b) < 2+n*asnLen {
+			return nil, fmt.Errorf("truncated AS_PATH segment of %v ASNs", n)
+		}
+		asns := make([]uint32, n)
+		for i := range asns {
+			v := b[2+i*asnLen:]
+			if asnLen == 4 {
+				asns[i] = binary.BigEndian.Uint32(v)
+			} else {
+				asns[i] = uint32(binary.BigEndian.Uint16(v))
+			}
+		}
+		b = b[2+n*asnLen:]
+		switch typ {
+		case asSequence:
+			for _, asn := range asns {
+				path = append(path, asPathElem{asns: []uint32{asn}})
+			}
+		case asSet:
+			// As RIS Live, a set of only the previous ASN is dropped, as a prepend.
+			if n == 1 && len(path) > 0 && !path[len(path)-1].set && path[len(path)-1].asns[0] == asns[0] {
+				continue
+			}
+			path = append(path, asPathElem{asns: asns, set: true})
+		}
+	}
+	return path, nil
+}
+
+// parseNLRI decodes a list of prefixes of the address family.
+func parseNLRI(b []byte, afi int) ([]string, error) {
+	size := net.IPv4len
+	switch afi {
+	case afiIPv4:
+	case afiIPv6:
+		size = net.IPv6len
+	default:
+		return nil, fmt.Errorf("unsupported address family %v", afi)
+	}
+	var result []string
+	for len(b) > 0 {
+		n, l, err := parsePrefixBytes(b, size)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, n.String())
+		b = b[l:]
+	}
+	return result, nil
+}
+
+// parsePrefixBytes decodes a single length prefixed prefix, of an address of
+// size bytes, returning it and the bytes it used.
+func parsePrefixBytes(b []byte, size int) (*net.IPNet, int, error) {
+	bits := int(b[0])
+	if bits > size*8 {
+		return nil, 0, fmt.Errorf("invalid prefix length %v", bits)
+	}
+	l := (bits + 7) / 8
+	if len(b) < 1+l {
+		return nil, 0, fmt.Errorf("truncated prefix of length %v", bits)
+	}
+	ip := make(net.IP, size)
+	copy(ip, b[1:1+l])
+	mask := net.CIDRMask(bits, size*8)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, 1 + l, nil
+}
+
+// bgpMessage encodes a BGP message of the type and body, with its header.
+func bgpMessage(typ uint8, body []byte) []byte {
+	b := make([]byte, bgpHeaderLen, bgpHeaderLen+len(body))
+	for i := 0; i < bgpMarkerLen; i++ {
+		b[i] = 0xff
+	}
+	binary.BigEndian.PutUint16(b[bgpMarkerLen:], uint16(bgpHeaderLen+len(body)))
+	b[18] = typ
+	return append(b, body...)
+}
+
+// bgpAttr encodes a path attribute, with an extended length if it needs one.
+func bgpAttr(flags, typ uint8, v []byte) []byte {
+	if len(v) > 255 {
+		b := []byte{flags | attrFlagExtended, typ, 0, 0}
+		binary.BigEndian.PutUint16(b[2:], uint16(len(v)))
+		return append(b, v...)
+	}
+	return append([]byte{flags, typ, byte(len(v))}, v...)
+}
+
+// prefixIsIPv4 reports whether a prefix is of IPv4, by its mask, as IPv4-mapped
+// IPv6 prefixes, ie: ::ffff:192.0.2.0/120, have an IPv4 address.
+func prefixIsIPv4(n *net.IPNet) bool {
+	return len(n.Mask) == net.IPv4len
+}
+
+// encodePrefix encodes a prefix as NLRI, its address of the length of its mask.
+func encodePrefix(n *net.IPNet) []byte {
+	ones, _ := n.Mask.Size()
+	ip := n.IP.To16()
+	if prefixIsIPv4(n) {
+		ip = n.IP.To4()
+	}
+	return append([]byte{byte(ones)}, ip[:(ones+7)/8]...)
+}
+
+// encodeASPath encodes the path of rm as AS_PATH segments of 4 byte ASNs.
+func encodeASPath(rm *RisMessageData) ([]byte, error) {
+	var path []asPathElem
+	for _, p := range rm.ASPath() {
+		switch v := p.(type) {
+		case float64:
+			path = append(path, asPathElem{asns: []uint32{uint32(v)}})
+		case []interface{}:
+			e := asPathElem{set: true}
+			for _, s := range v {
+				f, ok := s.(float64)
+				if !ok {
+					return nil, fmt.Errorf("failed to encode AS_SET element: %v", s)
+				}
+				e.asns = append(e.asns, uint32(f))
+			}
+			path = append(path, e)
+		default:
+			return nil, fmt.Errorf("failed to encode path element: %v", p)
+		}
+	}
+
+	var b []byte
+	for i := 0; i < len(path); {
+		typ, n := byte(asSequence), 0
+		var asns []uint32
+		if path[i].set {
+			typ, asns, n = asSet, path[i].asns, 1
+		} else {
+			// Consecutive ASNs of the sequence share a segment, of at most 255.
+			for i+n < len(path) && !path[i+n].set && n < 255 {
+				asns = append(asns, path[i+n].asns[0])
+				n++
+			}
+		}
+		if len(asns) > 255 {
+			return nil, fmt.Errorf("AS_SET of %v ASNs is too large", len(asns))
+		}
+		b = append(b, typ, byte(len(asns)))
+		for _, asn := range asns {
+			b = append(b, byte(asn>>24), byte(asn>>16), byte(asn>>8), byte(asn))
+		}
+		i += n
+	}
+	return b, nil
+}
+
+// encodeBGPUpdates encodes the announcements and withdrawals of rm as UPDATE
+// messages with 4 byte ASNs, one for each next hop. An IPv6 announcement
+// followed by one of the same prefixes from a link local next hop is encoded
+// with both next hops, as it is decoded by parseBGPUpdate.
+func encodeBGPUpdates(rm *RisMessageData) ([][]byte, error) {
+	var w4, w6 []byte
+	for _, p := range rm.Withdrawals {
+		n, err := parsePrefix(p)
+		if err != nil {
+			return nil, err
+		}
+		if prefixIsIPv4(n) {
+			w4 = append(w4, encodePrefix(n)...)
+		} else {
+			w6 = append(w6, encodePrefix(n)...)
+		}
+	}
+
+	var common []byte
+	if len(rm.Announcements) > 0 {
+		switch rm.Origin {
+		case "igp", "":
+			common = append(common, bgpAttr(attrFlagTransitive, attrOrigin, []byte{0})...)
+		case "egp":
+			common = append(common, bgpAttr(attrFlagTransitive, attrOrigin, []byte{1})...)
+		case "incomplete":
+			common = append(common, bgpAttr(attrFlagTransitive, attrOrigin, []byte{2})...)
+		default:
+			return nil, fmt.Errorf("unknown origin: %v", rm.Origin)
+		}
+		path, err := encodeASPath(rm)
+		if err != nil {
+			return nil, err
+		}
+		common = append(common, bgpAttr(attrFlagTransitive, attrASPath, path)...)
+		if len(rm.Community) > 0 {
+			var c []byte
+			for _, v := range rm.Community {
+				if len(v) != 2 {
+					return nil, fmt.Errorf("invalid community: %v", v)
+				}
+				c = append(c, byte(v[0]>>8), byte(v[0]), byte(v[1]>>8), byte(v[1]))
+			}
+			common = append(common, bgpAttr(attrFlagOptional|attrFlagTransitive, attrCommunities, c)...)
+		}
+	}
+
+	// The attributes and NLRI of an UPDATE for each next hop.
+	type update struct {
+		attrs, nlri []byte
+	}
+	var updates []update
+	for i := 0; i < len(rm.Announcements); i++ {
+		a := rm.Announcements[i]
+		nh := net.ParseIP(a.NextHop)
+		if nh == nil {
+			return nil, fmt.Errorf("failed to parse next hop: %q", a.NextHop)
+		}
+		var nlri []byte
+		v4 := true
+		for j, p := range a.Prefixes {
+			n, err := parsePrefix(p)
+			if err != nil {
+				return nil, err
+			}
+			if j > 0 && v4 != prefixIsIPv4(n) {
+				return nil, fmt.Errorf("announcement of mixed address families: %v", a.Prefixes)
+			}
+			v4 = prefixIsIPv4(n)
+			nlri = append(nlri, encodePrefix(n)...)
+		}
+		if v4 && nh.To4() != nil {
+			updates = append(updates, update{append(append([]byte{}, common...), bgpAttr(attrFlagTransitive, attrNextHop, nh.To4())...), nlri})
+			continue
+		}
+		afi := afiIPv6
+		if v4 {
+			afi = afiIPv4
+		}
+		mp := []byte{0, byte(afi), safiUnicast, net.IPv6len}
+		mp = append(mp, nh.To16()...)
+		if i+1 < len(rm.Announcements) {
+			ll := rm.Announcements[i+1]
+			if lip := net.ParseIP(ll.NextHop); lip != nil && lip.IsLinkLocalUnicast() && lip.To4() == nil && equalStrings(ll.Prefixes, a.Prefixes) {
+				mp[3] = 2 * net.IPv6len
+				mp = append(mp, lip...)
+				i++
+			}
+		}
+		mp = append(append(mp, 0), nlri...)
+		updates = append(updates, update{append(append([]byte{}, common...), bgpAttr(attrFlagOptional, attrMPReach, mp)...), nil})
+	}
+	if len(updates) == 0 {
+		if len(w4) == 0 && len(w6) == 0 {
+			return nil, nil
+		}
+		updates = append(updates, update{})
+	}
+	if len(w6) > 0 {
+		updates[0].attrs = append(updates[0].attrs, bgpAttr(attrFlagOptional, attrMPUnreach, append([]byte{0, afiIPv6, safiUnicast}, w6...))...)
+	}
+
+	var result [][]byte
+	for i, u := range updates {
+		var w []byte
+		if i == 0 {
+			w = w4
+		}
+		body := make([]byte, 0, 4+len(w)+len(u.attrs)+len(u.nlri))
+		body = append(body, byte(len(w)>>8), byte(len(w)))
+		body = append(body, w...)
+		body = append(body, byte(len(u.attrs)>>8), byte(len(u.attrs)))
+		body = append(append(body, u.attrs...), u.nlri...)
+		if bgpHeaderLen+len(body) > 0xffff {
+			return nil, fmt.Errorf("UPDATE of %v bytes is too large", bgpHeaderLen+len(body))
+		}
+		result = append(result, bgpMessage(bgpUpdate, body))
+	}
+	return result, nil
+}
+
+// equalStrings reports whether two lists of strings are equal.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// TestParseBGPMessageRIS decodes the raw messages of a RIS Live capture, which
+// should match the fields RIS Live decoded from them.
+func TestParseBGPMessageRIS(t *testing.T) {
+	f, err := os.Open("testdata/1k-msgs")
+	if err != nil {
+		t.Fatalf("failed to open testdata: %v", err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	var n int
+	for s.Scan() {
+		var rm RisMessage
+		if err := json.Unmarshal(s.Bytes(), &rm); err != nil {
+			t.Fatalf("failed to parse testdata(%s): %v", s.Bytes(), err)
+		}
+		want := rm.Data
+		if err := digestPath(want); err != nil {
+			t.Fatalf("failed to digest path(%v): %v", want.Path, err)
+		}
+		path := want.Path
+		want.Path = nil
+		raw, err := hex.DecodeString(want.Raw)
+		if err != nil {
+			t.Fatalf("failed to decode raw(%v): %v", want.Raw, err)
+		}
+		// RIS Live does not say which peers have 2 byte sessions, those fail to parse with 4 byte ASNs.
+		got := &RisMessageData{Timestamp: want.Timestamp, Peer: want.Peer, PeerASN: want.PeerASN, ID: want.ID, Host: want.Host}
+		if err := parseBGPMessage(raw, true, got); err != nil {
+			got = &RisMessageData{Timestamp: want.Timestamp, Peer: want.Peer, PeerASN: want.PeerASN, ID: want.ID, Host: want.Host}
+			if err := parseBGPMessage(raw, false, got); err != nil {
+				t.Errorf("failed to parse message(%v): %v", want.Raw, err)
+				continue
+			}
+		}
+		if diff := cmp.Diff(got, want, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", want.ID, diff)
+		}
+		if diff := cmp.Diff(got.ASPath(), path, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("[%v]: ASPath got/want mismatch diff(-got, +want):\n%v\n", want.ID, diff)
+		}
+		n++
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+	if n == 0 {
+		t.Errorf("no messages were read from testdata")
+	}
+}
+
+func TestParseBGPMessage(t *testing.T) {
+	tests := []struct {
+		desc    string
+		raw     string
+		as4     bool
+		want    *RisMessageData
+		wantErr bool
+	}{{
+		desc: "Success - 2 byte path merged with AS4_PATH",
+		// AS_PATH 64496 23456 (AS_TRANS), AS4_PATH 4200000000, NEXT_HOP 192.0.2.1, NLRI 198.51.100.0/24.
+		raw: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" + "0038" + "02" + "0000" + "001D" +
+			"40010100" + "400206" + "0202FBF05BA0" + "C01106" + "0201FA56EA00" + "400304C0000201" +
+			"18C63364",
+		want: &RisMessageData{
+			Type:          "UPDATE",
+			Origin:        "igp",
+			DigestedPath:  []int32{64496, int32(-94967296)},
+			Announcements: []*RisAnnouncement{{NextHop: "192.0.2.1", Prefixes: []string{"198.51.100.0/24"}}},
+		},
+	}, {
+		desc: "Success - AS_SET and IPv6 with a link local next hop",
+		raw: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" + "0066" + "02" + "0000" + "004F" +
+			"40010102" + "400210" + "02010000FBF0" + "01020000FBF10000FBF2" +
+			"800E2A" + "000201" + "20" + "20010DB8000000000000000000000001" + "FE800000000000000000000000000001" + "00" + "2020010DB8" +
+			"800F08" + "000201" + "2020010DB9",
+		as4: true,
+		want: &RisMessageData{
+			Type:         "UPDATE",
+			Origin:       "incomplete",
+			DigestedPath: []int32{64496, 64497, 64498},
+			PathSets:     []PathSet{{1, 3}},
+			Announcements: []*RisAnnouncement{
+				{NextHop: "2001:db8::1", Prefixes: []string{"2001:db8::/32"}},
+				{NextHop: "fe80::1", Prefixes: []string{"2001:db8::/32"}},
+			},
+			Withdrawals: []string{"2001:db9::/32"},
+		},
+	}, {
+		desc: "Success - VPN MP_REACH_NLRI skipped",
+		// MP_REACH_NLRI of VPNv4, with a route distinguisher in the next hop, alongside NLRI 198.51.100.0/24.
+		raw: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" + "0050" + "02" + "0000" + "0035" +
+			"40010100" + "400204" + "0201FBF0" + "400304C0000201" +
+			"800E20" + "0001" + "80" + "0C" + "0000000000000000C0000202" + "00" + "70" + "000101" + "0000FBF000000001" + "CB0071" +
+			"18C63364",
+		want: &RisMessageData{
+			Type:          "UPDATE",
+			Origin:        "igp",
+			DigestedPath:  []int32{64496},
+			Announcements: []*RisAnnouncement{{NextHop: "192.0.2.1", Prefixes: []string{"198.51.100.0/24"}}},
+		},
+	}, {
+		desc: "Success - flowspec MP_REACH_NLRI and MP_UNREACH_NLRI skipped",
+		// Flowspec of IPv4, without a next hop, announced and withdrawn.
+		raw: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" + "0036" + "02" + "0000" + "001F" +
+			"40010100" + "400204" + "0201FBF0" +
+			"800E0A" + "0001" + "85" + "00" + "00" + "04" + "0118C633" +
+			"800F04" + "0001" + "85" + "00",
+		want: &RisMessageData{
+			Type:         "UPDATE",
+			Origin:       "igp",
+			DigestedPath: []int32{64496},
+		},
+	}, {
+		desc: "Success - keepalive",
+		raw:  "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF001304",
+		want: &RisMessageData{Type: "KEEPALIVE"},
+	}, {
+		desc:    "Failure - truncated header",
+		raw:     "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF00",
+		wantErr: true,
+	}, {
+		desc:    "Failure - length beyond the message",
+		raw:     "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF001704",
+		wantErr: true,
+	}, {
+		desc:    "Failure - attributes beyond the message",
+		raw:     "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" + "0017" + "02" + "0000" + "0010",
+		wantErr: true,
+	}, {
+		desc:    "Failure - prefix too long",
+		raw:     "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" + "001C" + "02" + "0000" + "0000" + "21C6336400",
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		raw, err := hex.DecodeString(test.raw)
+		if err != nil {
+			t.Fatalf("[%v]: failed to decode raw: %v", test.desc, err)
+		}
+		got := &RisMessageData{}
+		err = parseBGPMessage(raw, test.as4, got)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			test.want.Raw = test.raw
+			if diff := cmp.Diff(got, test.want, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+		}
+	}
+}
+
+func TestIPv6String(t *testing.T) {
+	tests := []struct {
+		desc string
+		ip   string
+		want string
+	}{{
+		desc: "Success - zero groups compressed",
+		ip:   "2001:db8:0:0:0:0:0:1",
+		want: "2001:db8::1",
+	}, {
+		desc: "Success - a single zero group compressed",
+		ip:   "2001:7f8:2a:0:2:1:3:892",
+		want: "2001:7f8:2a::2:1:3:892",
+	}, {
+		desc: "Success - a single leading zero group compressed",
+		ip:   "0:1:2:3:4:5:6:7",
+		want: "::1:2:3:4:5:6:7",
+	}, {
+		desc: "Success - IPv4-mapped",
+		ip:   "::ffff:192.0.2.1",
+		want: "::ffff:192.0.2.1",
+	}}
+	for _, test := range tests {
+		if got := ipv6String(net.ParseIP(test.ip)); got != test.want {
+			t.Errorf("[%v]: got %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
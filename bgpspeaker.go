@@ -0,0 +1,534 @@
+// A BGP speaker (RFC 4271), which accepts the sessions of peers, or connects to
+// its configured neighbors, and receives their UPDATEs, never advertising a
+// route of its own. If neighbors are configured, the sessions of other peers are
+// rejected. Of two sessions with a neighbor, each side having connected to the
+// other, one is closed as RFC 4271 resolves the collision. The 4 byte ASN (RFC
+// 6793) and multiprotocol (RFC 4760) IPv4 and IPv6 unicast capabilities are
+// advertised, 4 byte ASNs being used with the peers which advertise it too.
+//
+// As from BMP, the received messages are converted to RisMessageData as RIS
+// Live sends them, the speaker being their collector. UPDATEs with malformed
+// path attributes are treated as withdrawals (RFC 7606), keeping the session.
+//
+// The messages of the sessions are handled alongside the stream's, under the
+// same lock, so while a slow consumer holds up the stream the sessions are not
+// read either, and the peers' UPDATEs back up. The speaker sends its KEEPALIVEs
+// apart from reading, and restarts its hold timer at each read, so neither side
+// expires a held up session, but a peer may still end one which stays full.
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+const (
+	bgpVersion  = 4
+	bgpMaxLen   = 4096
+	bgpOpenLen  = 10              // The OPEN body before its optional parameters.
+	bgpASTrans  = 23456           // The 2 byte ASN of a 4 byte ASN speaker (RFC 6793).
+	bgpOpenHold = 4 * time.Minute // The hold time until the peer's OPEN is received.
+	bgpCapParam = 2               // The capabilities optional parameter.
+	bgpCapMP    = 1
+	bgpCapAS4   = 65
+	bgpMinHold  = 3 // Hold times, in seconds, of 1 and 2 are unacceptable.
+
+	bgpConnectTimeout = 30 * time.Second
+	bgpConnectRetry   = 30 * time.Second // The default wait to reconnect to a neighbor.
+)
+
+// BGP NOTIFICATION error codes, and the subcodes which are sent.
+const (
+	bgpErrHeader    = 1
+	bgpErrOpen      = 2
+	bgpErrUpdate    = 3
+	bgpErrHold      = 4
+	bgpErrFSM       = 5
+	bgpErrCease     = 6
+	bgpSubNotSync   = 1
+	bgpSubBadLen    = 2
+	bgpSubBadType   = 3
+	bgpSubVersion   = 1
+	bgpSubBadPeerAS = 2
+	bgpSubBadID     = 3
+	bgpSubBadHold   = 6
+	bgpSubCollision = 7 // Of a Cease, the session lost a connection collision.
+)
+
+// bgpError is an error of the session, sent to the peer as a NOTIFICATION.
+type bgpError struct {
+	code, subcode byte
+	data          []byte
+	err           error
+}
+
+func (e *bgpError) Error() string {
+	return fmt.Sprintf("BGP error %v/%v: %v", e.code, e.subcode, e.err)
+}
+
+// BGPNeighbor is a configured peer of a BGPSpeaker.
+type BGPNeighbor struct {
+	Addr    net.IP
+	ASN     uint32 // The ASN of the neighbor, any if 0.
+	Connect string // If set, the address the speaker connects to, ie: 192.0.2.1:179.
+}
+
+// ParseBGPNeighbors parses comma separated neighbors of the form
+// [ASN@]address[:port], ie: 64496@192.0.2.1:179. Neighbors with a port are
+// connected to.
+func ParseBGPNeighbors(s string) ([]*BGPNeighbor, error) {
+	var result []*BGPNeighbor
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		n := &BGPNeighbor{}
+		addr := e
+		if i := strings.Index(e, "@"); i >= 0 {
+			asn, err := strconv.ParseUint(e[:i], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse neighbor ASN(%v): %v", e, err)
+			}
+			n.ASN, addr = uint32(asn), e[i+1:]
+		}
+		host := addr
+		if h, _, err := net.SplitHostPort(addr); err == nil {
+			host, n.Connect = h, addr
+		}
+		if n.Addr = net.ParseIP(host); n.Addr == nil {
+			return nil, fmt.Errorf("failed to parse neighbor address: %q", e)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// BGPSpeaker accepts the BGP sessions of peers.
+type BGPSpeaker struct {
+	Addr         string         // The address to accept sessions on, ie: :179.
+	ASN          uint32         // The local ASN.
+	RouterID     net.IP         // The BGP identifier, an IPv4 address.
+	HoldTime     time.Duration  // The proposed hold time, the lower of it and the peer's is used.
+	Host         string         // The collector of the received messages.
+	Neighbors    []*BGPNeighbor // If set, the sessions of other peers are rejected.
+	ConnectRetry time.Duration  // The wait to reconnect to a neighbor, bgpConnectRetry if 0.
+
+	mu       sync.Mutex
+	sessions map[string]*bgpSession // peer -> the session past OpenSent.
+}
+
+// allow returns an OPEN error if the peer of the ASN is not a neighbor.
+func (s *BGPSpeaker) allow(peer string, asn uint32) error {
+	if len(s.Neighbors) == 0 {
+		return nil
+	}
+	ip := net.ParseIP(peer)
+	for _, n := range s.Neighbors {
+		if !n.Addr.Equal(ip) {
+			continue
+		}
+		if n.ASN != 0 && n.ASN != asn {
+			return &bgpError{code: bgpErrOpen, subcode: bgpSubBadPeerAS, err: fmt.Errorf("neighbor %v is of AS%v, not AS%v", peer, n.ASN, asn)}
+		}
+		return nil
+	}
+	return &bgpError{code: bgpErrOpen, err: fmt.Errorf("peer %v is not a neighbor", peer)}
+}
+
+// register records a session whose OPEN was received, resolving a collision
+// with another session of the peer (RFC 4271 6.8): an established session is
+// kept, otherwise the session connected by the speaker of the higher BGP
+// identifier. A Cease is returned if ss is to be closed, else the other is.
+func (s *BGPSpeaker) register(ss *bgpSession, id net.IP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions == nil {
+		s.sessions = map[string]*bgpSession{}
+	}
+	if other, ok := s.sessions[ss.peer]; ok {
+		higher := binary.BigEndian.Uint32(s.RouterID.To4()) > binary.BigEndian.Uint32(id.To4())
+		if other.established || higher == other.outbound {
+			return &bgpError{code: bgpErrCease, subcode: bgpSubCollision, err: fmt.Errorf("connection collision with %v", ss.peer)}
+		}
+		other.collided = true
+		body := []byte{bgpErrCease, bgpSubCollision}
+		if err := other.write(bgpMessage(bgpNotification, body)); err != nil {
+			log.V(2).Infof("failed to send NOTIFICATION to %v: %v", other.peer, err)
+		}
+		other.c.Close()
+	}
+	s.sessions[ss.peer] = ss
+	return nil
+}
+
+// unregister removes a session which ended.
+func (s *BGPSpeaker) unregister(ss *bgpSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions[ss.peer] == ss {
+		delete(s.sessions, ss.peer)
+	}
+}
+
+// open encodes the OPEN message of the speaker.
+func (s *BGPSpeaker) open() []byte {
+	asn := s.ASN
+	if asn > 0xffff {
+		asn = bgpASTrans
+	}
+	var caps []byte
+	for _, afi := range []uint16{afiIPv4, afiIPv6} {
+		caps = append(caps, bgpCapMP, 4, byte(afi>>8), byte(afi), 0, safiUnicast)
+	}
+	caps = append(caps, bgpCapAS4, 4, byte(s.ASN>>24), byte(s.ASN>>16), byte(s.ASN>>8), byte(s.ASN))
+
+	b := make([]byte, bgpOpenLen, bgpOpenLen+2+len(caps))
+	b[0] = bgpVersion
+	binary.BigEndian.PutUint16(b[1:], uint16(asn))
+	binary.BigEndian.PutUint16(b[3:], uint16(s.HoldTime/time.Second))
+	copy(b[5:9], s.RouterID.To4())
+	b[9] = byte(2 + len(caps))
+	b = append(b, bgpCapParam, byte(len(caps)))
+	return bgpMessage(bgpOpen, append(b, caps...))
+}
+
+// bgpOpenMsg is a received OPEN message.
+type bgpOpenMsg struct {
+	asn  uint32
+	hold time.Duration
+	id   net.IP
+	as4  bool // The peer advertised the 4 byte ASN capability.
+}
+
+// parseBGPOpen decodes the body of an OPEN message.
+func parseBGPOpen(b []byte) (*bgpOpenMsg, error) {
+	if len(b) < bgpOpenLen || len(b) < bgpOpenLen+int(b[9]) {
+		return nil, &bgpError{code: bgpErrHeader, subcode: bgpSubBadLen, err: fmt.Errorf("truncated OPEN")}
+	}
+	if b[0] != bgpVersion {
+		return nil, &bgpError{code: bgpErrOpen, subcode: bgpSubVersion, data: []byte{0, bgpVersion}, err: fmt.Errorf("unsupported version %v", b[0])}
+	}
+	o := &bgpOpenMsg{
+		asn:  uint32(binary.BigEndian.Uint16(b[1:])),
+		hold: time.Duration(binary.BigEndian.Uint16(b[3:])) * time.Second,
+		id:   net.IP(b[5:9]),
+	}
+	if o.hold > 0 && o.hold < bgpMinHold*time.Second {
+		return nil, &bgpError{code: bgpErrOpen, subcode: bgpSubBadHold, err: fmt.Errorf("unacceptable hold time %v", o.hold)}
+	}
+	if o.id.Equal(net.IPv4zero) {
+		return nil, &bgpError{code: bgpErrOpen, subcode: bgpSubBadID, err: fmt.Errorf("bad BGP identifier %v", o.id)}
+	}
+	params := b[bgpOpenLen : bgpOpenLen+int(b[9])]
+	for len(params) > 0 {
+		if len(params) < 2 || len(params) < 2+int(params[1]) {
+			return nil, &bgpError{code: bgpErrOpen, err: fmt.Errorf("truncated optional parameter")}
+		}
+		typ, v := params[0], params[2:2+int(params[1])]
+		params = params[2+len(v):]
+		if typ != bgpCapParam {
+			continue
+		}
+		for len(v) > 0 {
+			if len(v) < 2 || len(v) < 2+int(v[1]) {
+				return nil, &bgpError{code: bgpErrOpen, err: fmt.Errorf("truncated capability")}
+			}
+			code, c := v[0], v[2:2+int(v[1])]
+			v = v[2+len(c):]
+			if code == bgpCapAS4 && len(c) == 4 {
+				o.as4, o.asn = true, binary.BigEndian.Uint32(c)
+			}
+		}
+	}
+	return o, nil
+}
+
+// readBGPMessage reads a BGP message, returning its type and the message.
+func readBGPMessage(r io.Reader) (byte, []byte, error) {
+	h := make([]byte, bgpHeaderLen)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return 0, nil, err
+	}
+	for _, m := range h[:bgpMarkerLen] {
+		if m != 0xff {
+			return 0, nil, &bgpError{code: bgpErrHeader, subcode: bgpSubNotSync, err: fmt.Errorf("bad marker")}
+		}
+	}
+	l := int(binary.BigEndian.Uint16(h[bgpMarkerLen:]))
+	if l < bgpHeaderLen || l > bgpMaxLen {
+		return 0, nil, &bgpError{code: bgpErrHeader, subcode: bgpSubBadLen, data: h[bgpMarkerLen : bgpMarkerLen+2], err: fmt.Errorf("bad message length %v", l)}
+	}
+	b := make([]byte, l)
+	copy(b, h)
+	if _, err := io.ReadFull(r, b[bgpHeaderLen:]); err != nil {
+		return 0, nil, fmt.Errorf("truncated BGP message: %v", err)
+	}
+	return h[18], b, nil
+}
+
+// bgpSession is the state of a session with a peer.
+type bgpSession struct {
+	s        *BGPSpeaker
+	c        net.Conn
+	r        *bufio.Reader
+	peer     string
+	outbound bool // The speaker connected to the peer.
+
+	mu      sync.Mutex // Serializes writes, of the keepalives and the session.
+	peerASN string
+	as4     bool
+	hold    time.Duration
+
+	// Guarded by the speaker's mu.
+	established bool
+	collided    bool // The session was closed for another of the peer.
+}
+
+func (ss *bgpSession) write(b []byte) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	_, err := ss.c.Write(b)
+	return err
+}
+
+// read reads a message, failing if none is received within the hold time.
+func (ss *bgpSession) read(hold time.Duration) (byte, []byte, error) {
+	if hold > 0 {
+		ss.c.SetReadDeadline(time.Now().Add(hold))
+	} else {
+		ss.c.SetReadDeadline(time.Time{})
+	}
+	typ, b, err := readBGPMessage(ss.r)
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		err = &bgpError{code: bgpErrHold, err: fmt.Errorf("hold timer expired")}
+	}
+	return typ, b, err
+}
+
+// message returns a message of the peer, received now.
+func (ss *bgpSession) message() *RisMessageData {
+	return &RisMessageData{
+		Timestamp: float64(time.Now().UnixNano()) / 1e9,
+		Peer:      ss.peer,
+		PeerASN:   ss.peerASN,
+		Host:      ss.s.Host,
+	}
+}
+
+// session runs the state machine of a session on c, from its OpenSent state,
+// until it fails or the peer closes it. Its UPDATEs, and its state changes to
+// and from established, are passed to handle. Errors are sent to the peer as a
+// NOTIFICATION. If outbound, the speaker connected to the peer.
+func (s *BGPSpeaker) session(c net.Conn, host string, outbound bool, handle func(rm *RisMessageData)) error {
+	ss := &bgpSession{s: s, c: c, r: bufio.NewReader(c), peer: host, outbound: outbound}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		ss.peer = ipv6String(ip)
+	}
+	defer s.unregister(ss)
+	established := false
+	err := ss.run(func() {
+		established = true
+		s.mu.Lock()
+		ss.established = true
+		s.mu.Unlock()
+		rm := ss.message()
+		rm.Type, rm.State = "RIS_PEER_STATE", "connected"
+		handle(rm)
+	}, handle)
+	if be, ok := err.(*bgpError); ok {
+		body := append([]byte{be.code, be.subcode}, be.data...)
+		if werr := ss.write(bgpMessage(bgpNotification, body)); werr != nil {
+			log.V(2).Infof("failed to send NOTIFICATION to %v: %v", ss.peer, werr)
+		}
+	}
+	if established {
+		rm := ss.message()
+		rm.Type, rm.State = "RIS_PEER_STATE", "down"
+		handle(rm)
+	}
+	s.mu.Lock()
+	collided := ss.collided
+	s.mu.Unlock()
+	if err == io.EOF || collided {
+		return nil
+	}
+	return err
+}
+
+func (ss *bgpSession) run(up func(), handle func(rm *RisMessageData)) error {
+	if err := ss.write(ss.s.open()); err != nil {
+		return fmt.Errorf("failed to send OPEN: %v", err)
+	}
+
+	// OpenSent.
+	typ, b, err := ss.read(bgpOpenHold)
+	if err != nil {
+		return err
+	}
+	if typ != bgpOpen {
+		return &bgpError{code: bgpErrFSM, err: fmt.Errorf("unexpected %v in OpenSent", bgpTypeName(typ))}
+	}
+	o, err := parseBGPOpen(b[bgpHeaderLen:])
+	if err != nil {
+		return err
+	}
+	if err := ss.s.allow(ss.peer, o.asn); err != nil {
+		return err
+	}
+	if err := ss.s.register(ss, o.id); err != nil {
+		return err
+	}
+	ss.peerASN, ss.as4 = strconv.FormatUint(uint64(o.asn), 10), o.as4
+	ss.hold = ss.s.HoldTime
+	if o.hold < ss.hold {
+		ss.hold = o.hold
+	}
+	if err := ss.write(bgpMessage(bgpKeepalive, nil)); err != nil {
+		return fmt.Errorf("failed to send KEEPALIVE: %v", err)
+	}
+	if ss.hold > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go ss.keepalive(done)
+	}
+
+	// OpenConfirm.
+	if typ, _, err = ss.read(ss.hold); err != nil {
+		return err
+	}
+	if typ == bgpNotification {
+		return io.EOF
+	}
+	if typ != bgpKeepalive {
+		return &bgpError{code: bgpErrFSM, err: fmt.Errorf("unexpected %v in OpenConfirm", bgpTypeName(typ))}
+	}
+
+	// Established.
+	log.Infof("BGP session with %v AS%v established", ss.peer, ss.peerASN)
+	up()
+	for {
+		typ, b, err := ss.read(ss.hold)
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case bgpUpdate:
+			rm := ss.message()
+			if err := parseBGPMessage(b, ss.as4, rm); err != nil {
+				// Malformed attributes withdraw the UPDATE's prefixes, rather than resetting the session (RFC 7606).
+				if _, ok := err.(*bgpAttrError); !ok {
+					return &bgpError{code: bgpErrUpdate, err: err}
+				}
+				log.Errorf("UPDATE from %v: %v", ss.peer, err)
+			}
+			handle(rm)
+		case bgpKeepalive, bgpRouteRefresh:
+		case bgpNotification:
+			return io.EOF
+		case bgpOpen:
+			return &bgpError{code: bgpErrFSM, err: fmt.Errorf("unexpected OPEN in Established")}
+		default:
+			return &bgpError{code: bgpErrHeader, subcode: bgpSubBadType, data: []byte{typ}, err: fmt.Errorf("bad message type %v", typ)}
+		}
+	}
+}
+
+// keepalive sends a KEEPALIVE every third of the hold time, until done is closed.
+func (ss *bgpSession) keepalive(done chan struct{}) {
+	t := time.NewTicker(ss.hold / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			if err := ss.write(bgpMessage(bgpKeepalive, nil)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// connect keeps a session with a neighbor, connecting to it again after each
+// session ends, or fails to connect, until done is closed.
+func (s *BGPSpeaker) connect(n *BGPNeighbor, done <-chan struct{}, handle func(rm *RisMessageData)) {
+	retry := s.ConnectRetry
+	if retry <= 0 {
+		retry = bgpConnectRetry
+	}
+	for {
+		c, err := net.DialTimeout("tcp", n.Connect, bgpConnectTimeout)
+		if err != nil {
+			log.Infof("failed to connect to BGP neighbor %v: %v", n.Connect, err)
+		} else {
+			log.Infof("BGP session to %v", n.Connect)
+			ended := make(chan struct{})
+			go func() {
+				select {
+				case <-done:
+					c.Close()
+				case <-ended:
+				}
+			}()
+			err = s.session(c, n.Addr.String(), true, handle)
+			close(ended)
+			c.Close()
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err != nil {
+				log.Errorf("BGP session to %v failed: %v", n.Connect, err)
+			}
+		}
+		select {
+		case <-done:
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// serveBGP accepts the BGP sessions of peers on l, and connects to the
+// neighbors with an address to connect to, sending their messages to the
+// channel alongside the stream's, held up as the stream is. The returned
+// function closes l and the sessions, and waits for them to end.
+func (r *RisLive) serveBGP(l net.Listener, s *BGPSpeaker, logf io.Writer) func() {
+	handle := func(rm *RisMessageData) {
+		r.handle(&DecodedMessage{
+			Message: RisMessage{Type: "ris_message", Data: rm},
+			Match:   r.Prefilter == nil || r.Prefilter(rm),
+		}, logf)
+	}
+	stop := r.serveSessions(l, "BGP", func(c net.Conn, host string) error {
+		return s.session(c, host, false, handle)
+	})
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, n := range s.Neighbors {
+		if n.Connect == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(n *BGPNeighbor) {
+			defer wg.Done()
+			s.connect(n, done, handle)
+		}(n)
+	}
+	return func() {
+		close(done)
+		stop()
+		wg.Wait()
+	}
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// fakeOpen encodes the OPEN of a fake speaker, with the capabilities.
+func fakeOpen(version byte, asn, hold uint16, caps ...[]byte) []byte {
+	c := bytes.Join(caps, nil)
+	b := bytes.Join([][]byte{{version}, u16(asn), u16(hold), {192, 0, 2, 1}}, nil)
+	if len(c) == 0 {
+		return bgpMessage(bgpOpen, append(b, 0))
+	}
+	return bgpMessage(bgpOpen, append(append(b, byte(2+len(c)), bgpCapParam, byte(len(c))), c...))
+}
+
+func TestBGPSpeaker(t *testing.T) {
+	update4 := "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF003E02000000234001010040020A02020000E15F00009312400304C43C09A5E00808E15F2EE0E15F2EE118C43246"
+	update2 := "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" + "002F" + "02" + "0000" + "0014" +
+		"40010100" + "400206" + "0202FBF0FBF1" + "400304C0000201" + "18C63364"
+	// An ORIGIN of 2 bytes, withdrawing 192.0.2.0/24 and announcing 198.51.100.0/24.
+	badOrigin := "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" + "0034" + "02" + "0004" + "18C00002" + "0015" +
+		"4001020000" + "400206" + "0202FBF0FBF1" + "400304C0000201" + "18C63364"
+	keepalive := bgpMessage(bgpKeepalive, nil)
+	cease := bgpMessage(bgpNotification, []byte{6, 2})
+	state := func(asn, s string) *RisMessageData {
+		return &RisMessageData{Host: "bgp", Peer: "127.0.0.1", PeerASN: asn, Type: "RIS_PEER_STATE", State: s}
+	}
+
+	tests := []struct {
+		desc     string
+		send     [][]byte
+		want     []*RisMessageData
+		wantSent []byte // The types of the messages the speaker sends.
+		wantErr  []byte // The code and subcode of the NOTIFICATION it sends.
+	}{{
+		desc: "Success - 4 byte ASN peer",
+		send: [][]byte{
+			fakeOpen(bgpVersion, bgpASTrans, 30, []byte{bgpCapMP, 4, 0, afiIPv4, 0, safiUnicast}, []byte{bgpCapAS4, 4}, u32(57695)),
+			keepalive, mustHex(t, update4), keepalive, cease,
+		},
+		want: []*RisMessageData{state("57695", "connected"), {
+			Host:          "bgp",
+			Peer:          "127.0.0.1",
+			PeerASN:       "57695",
+			Type:          "UPDATE",
+			DigestedPath:  []int32{57695, 37650},
+			Community:     [][]int32{{57695, 12000}, {57695, 12001}},
+			Origin:        "igp",
+			Announcements: []*RisAnnouncement{{NextHop: "196.60.9.165", Prefixes: []string{"196.50.70.0/24"}}},
+			Raw:           update4,
+		}, state("57695", "down")},
+		wantSent: []byte{bgpOpen, bgpKeepalive},
+	}, {
+		desc: "Success - 2 byte ASN peer",
+		send: [][]byte{fakeOpen(bgpVersion, 64496, 0), keepalive, mustHex(t, update2), cease},
+		want: []*RisMessageData{state("64496", "connected"), {
+			Host:          "bgp",
+			Peer:          "127.0.0.1",
+			PeerASN:       "64496",
+			Type:          "UPDATE",
+			DigestedPath:  []int32{64496, 64497},
+			Origin:        "igp",
+			Announcements: []*RisAnnouncement{{NextHop: "192.0.2.1", Prefixes: []string{"198.51.100.0/24"}}},
+			Raw:           update2,
+		}, state("64496", "down")},
+		wantSent: []byte{bgpOpen, bgpKeepalive},
+	}, {
+		desc: "Success - malformed attributes treated as a withdrawal",
+		send: [][]byte{fakeOpen(bgpVersion, 64496, 0), keepalive, mustHex(t, badOrigin), mustHex(t, update2), cease},
+		want: []*RisMessageData{state("64496", "connected"), {
+			Host:        "bgp",
+			Peer:        "127.0.0.1",
+			PeerASN:     "64496",
+			Type:        "UPDATE",
+			Withdrawals: []string{"192.0.2.0/24", "198.51.100.0/24"},
+			Raw:         badOrigin,
+		}, {
+			Host:          "bgp",
+			Peer:          "127.0.0.1",
+			PeerASN:       "64496",
+			Type:          "UPDATE",
+			DigestedPath:  []int32{64496, 64497},
+			Origin:        "igp",
+			Announcements: []*RisAnnouncement{{NextHop: "192.0.2.1", Prefixes: []string{"198.51.100.0/24"}}},
+			Raw:           update2,
+		}, state("64496", "down")},
+		wantSent: []byte{bgpOpen, bgpKeepalive},
+	}, {
+		desc:     "Failure - unsupported version",
+		send:     [][]byte{fakeOpen(3, 64496, 90)},
+		wantSent: []byte{bgpOpen, bgpNotification},
+		wantErr:  []byte{bgpErrOpen, bgpSubVersion, 0, bgpVersion},
+	}, {
+		desc:     "Failure - unacceptable hold time",
+		send:     [][]byte{fakeOpen(bgpVersion, 64496, 2)},
+		wantSent: []byte{bgpOpen, bgpNotification},
+		wantErr:  []byte{bgpErrOpen, bgpSubBadHold},
+	}, {
+		desc:     "Failure - UPDATE before the OPEN",
+		send:     [][]byte{mustHex(t, update2)},
+		wantSent: []byte{bgpOpen, bgpNotification},
+		wantErr:  []byte{bgpErrFSM, 0},
+	}, {
+		desc:     "Failure - malformed UPDATE",
+		send:     [][]byte{fakeOpen(bgpVersion, 64496, 90), keepalive, bgpMessage(bgpUpdate, []byte{0, 9})},
+		want:     []*RisMessageData{state("64496", "connected"), state("64496", "down")},
+		wantSent: []byte{bgpOpen, bgpKeepalive, bgpNotification},
+		wantErr:  []byte{bgpErrUpdate, 0},
+	}, {
+		desc:     "Failure - bad marker",
+		send:     [][]byte{append(make([]byte, bgpMarkerLen), 0, bgpHeaderLen, bgpKeepalive)},
+		wantSent: []byte{bgpOpen, bgpNotification},
+		wantErr:  []byte{bgpErrHeader, bgpSubNotSync},
+	}}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &BGPSpeaker{ASN: 4200000001, RouterID: net.ParseIP("192.0.2.254"), HoldTime: 90 * time.Second, Host: "bgp"}
+	r := &RisLive{
+		Filter:   &RisFilter{},
+		Chan:     make(chan RisMessage, 20),
+		Metrics:  NewMetrics(),
+		Watchdog: NewWatchdog(0),
+	}
+	stop := r.serveBGP(l, s, ioutil.Discard)
+	defer stop()
+
+	for _, test := range tests {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("[%v]: failed to connect: %v", test.desc, err)
+		}
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		br := bufio.NewReader(c)
+		typ, b, err := readBGPMessage(br)
+		if err != nil || typ != bgpOpen {
+			t.Fatalf("[%v]: failed to read OPEN(%v): %v", test.desc, typ, err)
+		}
+		o, err := parseBGPOpen(b[bgpHeaderLen:])
+		if err != nil {
+			t.Fatalf("[%v]: failed to parse OPEN: %v", test.desc, err)
+		}
+		if o.asn != s.ASN || !o.as4 || o.hold != s.HoldTime || binaryASN(b) != bgpASTrans {
+			t.Errorf("[%v]: got OPEN of AS%v (%v), 4 byte ASNs %v, hold %v", test.desc, o.asn, binaryASN(b), o.as4, o.hold)
+		}
+		for _, m := range test.send {
+			if _, err := c.Write(m); err != nil {
+				t.Fatalf("[%v]: failed to send: %v", test.desc, err)
+			}
+		}
+		// The speaker closes the session after the NOTIFICATION, either side's.
+		sent, gotErr := []byte{bgpOpen}, []byte(nil)
+		for {
+			typ, b, err := readBGPMessage(br)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("[%v]: failed to read: %v", test.desc, err)
+			}
+			sent = append(sent, typ)
+			if typ == bgpNotification {
+				gotErr = b[bgpHeaderLen:]
+			}
+		}
+		c.Close()
+
+		var got []*RisMessageData
+		for len(r.Chan) > 0 {
+			got = append(got, (<-r.Chan).Data)
+		}
+		if diff := cmp.Diff(sent, test.wantSent); diff != "" {
+			t.Errorf("[%v]: sent got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+		if diff := cmp.Diff(gotErr, test.wantErr); diff != "" {
+			t.Errorf("[%v]: NOTIFICATION got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+		if diff := cmp.Diff(got, test.want, cmpopts.EquateEmpty(), cmpopts.IgnoreFields(RisMessageData{}, "Timestamp")); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+// binaryASN returns the 2 byte ASN of an OPEN message.
+func binaryASN(b []byte) uint16 {
+	return uint16(b[bgpHeaderLen+1])<<8 | uint16(b[bgpHeaderLen+2])
+}
+
+func TestBGPSpeakerKeepalive(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	s := &BGPSpeaker{ASN: 64511, RouterID: net.ParseIP("192.0.2.254"), HoldTime: 3 * time.Second, Host: "bgp"}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.session(a, "192.0.2.1", false, func(*RisMessageData) {})
+		a.Close()
+	}()
+
+	b.SetDeadline(time.Now().Add(10 * time.Second))
+	br := bufio.NewReader(b)
+	if _, _, err := readBGPMessage(br); err != nil {
+		t.Fatalf("failed to read OPEN: %v", err)
+	}
+	go b.Write(bytes.Join([][]byte{fakeOpen(bgpVersion, 64496, 90), bgpMessage(bgpKeepalive, nil)}, nil))
+	// The speaker sends keepalives every second, then its hold timer expires.
+	var keepalives int
+	for {
+		typ, m, err := readBGPMessage(br)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if typ == bgpKeepalive {
+			keepalives++
+			continue
+		}
+		if diff := cmp.Diff(m[bgpHeaderLen:], []byte{bgpErrHold, 0}); typ != bgpNotification || diff != "" {
+			t.Fatalf("got message of type %v, want a hold timer NOTIFICATION: %v", typ, diff)
+		}
+		break
+	}
+	if keepalives < 2 {
+		t.Errorf("got %v keepalives, want 2 or more", keepalives)
+	}
+	if err := <-errc; err == nil {
+		t.Errorf("got no error from the expired session")
+	}
+}
+
+func TestParseBGPNeighbors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		s       string
+		want    []*BGPNeighbor
+		wantErr bool
+	}{{
+		desc: "Success - passive and connected neighbors",
+		s:    "64496@192.0.2.1, 4200000000@[2001:db8::1]:179,192.0.2.2",
+		want: []*BGPNeighbor{
+			{Addr: net.ParseIP("192.0.2.1"), ASN: 64496},
+			{Addr: net.ParseIP("2001:db8::1"), ASN: 4200000000, Connect: "[2001:db8::1]:179"},
+			{Addr: net.ParseIP("192.0.2.2")},
+		},
+	}, {
+		desc: "Success - IPv6 without a port",
+		s:    "64496@2001:db8::1",
+		want: []*BGPNeighbor{{Addr: net.ParseIP("2001:db8::1"), ASN: 64496}},
+	}, {
+		desc: "Success - empty",
+		s:    "",
+	}, {
+		desc:    "Failure - bad ASN",
+		s:       "AS64496@192.0.2.1",
+		wantErr: true,
+	}, {
+		desc:    "Failure - bad address",
+		s:       "64496@rrc00",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		got, err := ParseBGPNeighbors(test.s)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+		}
+	}
+}
+
+func TestBGPSpeakerNeighbors(t *testing.T) {
+	tests := []struct {
+		desc     string
+		peer     string
+		asn      uint16
+		wantSent []byte // The types of the messages the speaker sends.
+		wantErr  []byte // The code and subcode of the NOTIFICATION it sends.
+	}{{
+		desc:     "Success - neighbor",
+		peer:     "192.0.2.1",
+		asn:      64496,
+		wantSent: []byte{bgpOpen, bgpKeepalive},
+	}, {
+		desc:     "Success - neighbor of any ASN",
+		peer:     "2001:db8::1",
+		asn:      64511,
+		wantSent: []byte{bgpOpen, bgpKeepalive},
+	}, {
+		desc:     "Failure - neighbor of another ASN",
+		peer:     "192.0.2.1",
+		asn:      64497,
+		wantSent: []byte{bgpOpen, bgpNotification},
+		wantErr:  []byte{bgpErrOpen, bgpSubBadPeerAS},
+	}, {
+		desc:     "Failure - not a neighbor",
+		peer:     "192.0.2.2",
+		asn:      64496,
+		wantSent: []byte{bgpOpen, bgpNotification},
+		wantErr:  []byte{bgpErrOpen, 0},
+	}}
+
+	s := &BGPSpeaker{
+		ASN:      64511,
+		RouterID: net.ParseIP("192.0.2.254"),
+		HoldTime: 90 * time.Second,
+		Host:     "bgp",
+		Neighbors: []*BGPNeighbor{
+			{Addr: net.ParseIP("192.0.2.1"), ASN: 64496},
+			{Addr: net.ParseIP("2001:db8::1")},
+		},
+	}
+	for _, test := range tests {
+		a, b := net.Pipe()
+		go func() {
+			s.session(a, test.peer, false, func(*RisMessageData) {})
+			a.Close()
+		}()
+		b.SetDeadline(time.Now().Add(5 * time.Second))
+		br := bufio.NewReader(b)
+		go b.Write(fakeOpen(bgpVersion, test.asn, 90))
+		var sent, gotErr []byte
+		for len(sent) < len(test.wantSent) {
+			typ, m, err := readBGPMessage(br)
+			if err != nil {
+				t.Fatalf("[%v]: failed to read: %v", test.desc, err)
+			}
+			sent = append(sent, typ)
+			if typ == bgpNotification {
+				gotErr = m[bgpHeaderLen:]
+			}
+		}
+		b.Close()
+		if diff := cmp.Diff(sent, test.wantSent); diff != "" {
+			t.Errorf("[%v]: sent got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+		if diff := cmp.Diff(gotErr, test.wantErr); diff != "" {
+			t.Errorf("[%v]: NOTIFICATION got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestBGPSpeakerCollision(t *testing.T) {
+	tests := []struct {
+		desc             string
+		remoteID         string
+		otherOutbound    bool
+		otherEstablished bool
+		wantOther        bool // The other session is kept, rather than the new one.
+	}{{
+		desc:          "Success - higher identifier keeps its connection",
+		remoteID:      "192.0.2.1",
+		otherOutbound: true,
+		wantOther:     true,
+	}, {
+		desc:     "Success - higher identifier closes the accepted connection",
+		remoteID: "192.0.2.1",
+	}, {
+		desc:          "Success - lower identifier closes its connection",
+		remoteID:      "198.51.100.1",
+		otherOutbound: true,
+	}, {
+		desc:      "Success - lower identifier keeps the accepted connection",
+		remoteID:  "198.51.100.1",
+		wantOther: true,
+	}, {
+		desc:             "Success - established session is kept",
+		remoteID:         "198.51.100.1",
+		otherOutbound:    true,
+		otherEstablished: true,
+		wantOther:        true,
+	}}
+
+	for _, test := range tests {
+		s := &BGPSpeaker{RouterID: net.ParseIP("192.0.2.254")}
+		a, b := net.Pipe()
+		go ioutil.ReadAll(b)
+		other := &bgpSession{s: s, c: a, peer: "192.0.2.1", outbound: test.otherOutbound, established: test.otherEstablished}
+		if err := s.register(other, net.ParseIP(test.remoteID)); err != nil {
+			t.Fatalf("[%v]: failed to register the first session: %v", test.desc, err)
+		}
+		ss := &bgpSession{s: s, peer: "192.0.2.1", outbound: !test.otherOutbound}
+		err := s.register(ss, net.ParseIP(test.remoteID))
+		be, ok := err.(*bgpError)
+		switch {
+		case test.wantOther && (!ok || be.code != bgpErrCease || be.subcode != bgpSubCollision):
+			t.Errorf("[%v]: got error %v, want a collision Cease", test.desc, err)
+		case !test.wantOther && err != nil:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		}
+		if kept := s.sessions["192.0.2.1"] == other; kept != test.wantOther || other.collided == test.wantOther {
+			t.Errorf("[%v]: got other session kept %v, collided %v, want kept %v", test.desc, kept, other.collided, test.wantOther)
+		}
+		a.Close()
+	}
+}
+
+func TestBGPSpeakerConnect(t *testing.T) {
+	newRisLive := func() *RisLive {
+		return &RisLive{
+			Filter:   &RisFilter{},
+			Chan:     make(chan RisMessage, 20),
+			Metrics:  NewMetrics(),
+			Watchdog: NewWatchdog(0),
+		}
+	}
+	la, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	lb, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	// b connects to a, which only accepts b.
+	a := &BGPSpeaker{
+		ASN:       64496,
+		RouterID:  net.ParseIP("192.0.2.1"),
+		HoldTime:  90 * time.Second,
+		Host:      "a",
+		Neighbors: []*BGPNeighbor{{Addr: net.ParseIP("127.0.0.1"), ASN: 4200000000}},
+	}
+	b := &BGPSpeaker{
+		ASN:          4200000000,
+		RouterID:     net.ParseIP("192.0.2.2"),
+		HoldTime:     90 * time.Second,
+		Host:         "b",
+		Neighbors:    []*BGPNeighbor{{Addr: net.ParseIP("127.0.0.1"), ASN: 64496, Connect: la.Addr().String()}},
+		ConnectRetry: 10 * time.Millisecond,
+	}
+	ra, rb := newRisLive(), newRisLive()
+	stopA := ra.serveBGP(la, a, ioutil.Discard)
+	defer stopA()
+	stopB := rb.serveBGP(lb, b, ioutil.Discard)
+
+	next := func(r *RisLive) *RisMessageData {
+		select {
+		case rm := <-r.Chan:
+			return rm.Data
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for a message")
+		}
+		return nil
+	}
+	state := func(host, asn, s string) *RisMessageData {
+		return &RisMessageData{Host: host, Peer: "127.0.0.1", PeerASN: asn, Type: "RIS_PEER_STATE", State: s}
+	}
+	opts := []cmp.Option{cmpopts.EquateEmpty(), cmpopts.IgnoreFields(RisMessageData{}, "Timestamp")}
+	if diff := cmp.Diff(next(ra), state("a", "4200000000", "connected"), opts...); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if diff := cmp.Diff(next(rb), state("b", "64496", "connected"), opts...); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	// Stopping b ends the session.
+	stopB()
+	if diff := cmp.Diff(next(ra), state("a", "4200000000", "down"), opts...); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
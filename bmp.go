@@ -0,0 +1,263 @@
+// Read BMP (RFC 7854) sessions, which routers open to a monitoring station to
+// report their peers' routes: Route Monitoring messages carry each peer's BGP
+// UPDATEs, Peer Up and Peer Down notifications its session state, and Stats
+// Reports its counters.
+//
+// Messages are converted to RisMessageData as RIS Live sends them, so a private
+// routing view passes the same filters and detectors as the live stream. The
+// router is the collector, named by the sysName of its Initiation message.
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+const (
+	bmpVersion       = 3
+	bmpHeaderLen     = 6
+	bmpPeerHeaderLen = 42
+	bmpMaxLen        = 1 << 20 // Longer messages are taken as a corrupt stream.
+)
+
+// BMP message types.
+const (
+	bmpRouteMonitoring = 0
+	bmpStatsReport     = 1
+	bmpPeerDown        = 2
+	bmpPeerUp          = 3
+	bmpInitiation      = 4
+	bmpTermination     = 5
+)
+
+// Per-peer header flags.
+const (
+	bmpFlagIPv6 = 0x80
+	bmpFlagAS2  = 0x20 // The peer's messages have 2 byte ASNs.
+)
+
+// bmpSysName is the Initiation information TLV of the router's name.
+const bmpSysName = 2
+
+// bmpStats names the statistics of Stats Reports, by type. Others are named by
+// their type, ie: type-14.
+var bmpStats = map[uint16]string{
+	0: "rejected-prefixes",
+	1: "duplicate-prefixes",
+	2: "duplicate-withdrawals",
+	3: "invalid-cluster-list",
+	4: "invalid-as-path-loop",
+	5: "invalid-originator-id",
+	6: "invalid-as-confed-loop",
+	7: "adj-rib-in-routes",
+	8: "loc-rib-routes",
+}
+
+// bmpMessageError is a BMP message which failed to decode. The reader continues
+// with the next message.
+type bmpMessageError struct {
+	typ byte
+	err error
+}
+
+func (e *bmpMessageError) Error() string {
+	return fmt.Sprintf("failed to decode BMP message of type %v: %v", e.typ, e.err)
+}
+
+// isBMPMessageError reports whether err is a bmpMessageError, which skips the message.
+func isBMPMessageError(err error) bool {
+	_, ok := err.(*bmpMessageError)
+	return ok
+}
+
+// BMPReader reads the messages of a BMP session as RisMessageData.
+type BMPReader struct {
+	Host string // The collector of the messages, replaced by the sysName of the router if it sends one.
+
+	r   *bufio.Reader
+	err error // The error which ended the session.
+}
+
+// NewBMPReader creates a BMPReader of r, setting host as the collector of its
+// messages until the router names itself.
+func NewBMPReader(r io.Reader, host string) *BMPReader {
+	return &BMPReader{Host: host, r: bufio.NewReader(r)}
+}
+
+// Next returns the next message of the session, or io.EOF at its end, after a
+// Termination message. A message which fails to decode returns an error, after
+// which Next may be called to continue with the next message. Messages of other
+// types are skipped.
+func (m *BMPReader) Next() (*RisMessageData, error) {
+	for {
+		if m.err != nil {
+			return nil, m.err
+		}
+		var h [bmpHeaderLen]byte
+		if _, err := io.ReadFull(m.r, h[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = fmt.Errorf("truncated BMP message header")
+			}
+			m.err = err
+			return nil, err
+		}
+		if h[0] != bmpVersion {
+			m.err = fmt.Errorf("unsupported BMP version %v", h[0])
+			return nil, m.err
+		}
+		l, typ := binary.BigEndian.Uint32(h[1:]), h[5]
+		if l < bmpHeaderLen || l > bmpMaxLen {
+			m.err = fmt.Errorf("invalid BMP message length %v", l)
+			return nil, m.err
+		}
+		b := make([]byte, l-bmpHeaderLen)
+		if _, err := io.ReadFull(m.r, b); err != nil {
+			m.err = fmt.Errorf("truncated BMP message: %v", err)
+			return nil, m.err
+		}
+		rm, err := m.message(typ, b)
+		if err != nil {
+			return nil, &bmpMessageError{typ: typ, err: err}
+		}
+		if rm != nil {
+			return rm, nil
+		}
+	}
+}
+
+// message decodes the body of a message, returning nil for those which are not
+// converted.
+func (m *BMPReader) message(typ byte, b []byte) (*RisMessageData, error) {
+	switch typ {
+	case bmpInitiation:
+		return nil, m.initiation(b)
+	case bmpTermination:
+		m.err = io.EOF
+		return nil, nil
+	case bmpRouteMonitoring, bmpStatsReport, bmpPeerDown, bmpPeerUp:
+	default:
+		log.V(2).Infof("skipping BMP message of type %v", typ)
+		return nil, nil
+	}
+
+	rm, flags, b, err := m.peerHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case bmpRouteMonitoring:
+		if err := parseBGPMessage(b, flags&bmpFlagAS2 == 0, rm); err != nil {
+			// Malformed attributes withdraw the UPDATE's prefixes (RFC 7606).
+			if _, ok := err.(*bgpAttrError); !ok {
+				return nil, err
+			}
+			log.Errorf("UPDATE from %v of %v: %v", rm.Peer, m.Host, err)
+		}
+		if rm.Type != "UPDATE" {
+			return nil, fmt.Errorf("unexpected %v message in route monitoring", rm.Type)
+		}
+	case bmpStatsReport:
+		rm.Type = "STATS"
+		if rm.Stats, err = parseBMPStats(b); err != nil {
+			return nil, err
+		}
+	case bmpPeerUp:
+		rm.Type, rm.State = "RIS_PEER_STATE", "connected"
+	case bmpPeerDown:
+		rm.Type, rm.State = "RIS_PEER_STATE", "down"
+	}
+	return rm, nil
+}
+
+// initiation names the collector after the sysName of the router.
+func (m *BMPReader) initiation(b []byte) error {
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return fmt.Errorf("truncated information TLV")
+		}
+		typ, l := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+l {
+			return fmt.Errorf("truncated information TLV of type %v", typ)
+		}
+		if typ == bmpSysName && l > 0 {
+			m.Host = string(b[4 : 4+l])
+		}
+		b = b[4+l:]
+	}
+	return nil
+}
+
+// peerHeader decodes the per-peer header at the front of b to a message of the
+// peer, returning its flags and the rest of b.
+func (m *BMPReader) peerHeader(b []byte) (*RisMessageData, byte, []byte, error) {
+	if len(b) < bmpPeerHeaderLen {
+		return nil, 0, nil, fmt.Errorf("truncated per-peer header")
+	}
+	flags := b[1]
+	peer := ipv6String(b[10:26])
+	if flags&bmpFlagIPv6 == 0 {
+		peer = net.IP(b[22:26]).String()
+	}
+	rm := &RisMessageData{
+		Timestamp: float64(binary.BigEndian.Uint32(b[34:])) + float64(binary.BigEndian.Uint32(b[38:]))/1e6,
+		Peer:      peer,
+		PeerASN:   strconv.FormatUint(uint64(binary.BigEndian.Uint32(b[26:])), 10),
+		Host:      m.Host,
+	}
+	// The timestamp is optional, 0 if the router does not set it.
+	if rm.Timestamp == 0 {
+		rm.Timestamp = float64(time.Now().UnixNano()) / 1e9
+	}
+	return rm, flags, b[bmpPeerHeaderLen:], nil
+}
+
+// parseBMPStats decodes the statistics of a Stats Report.
+func parseBMPStats(b []byte) (map[string]uint64, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("truncated stats count")
+	}
+	n := binary.BigEndian.Uint32(b)
+	b = b[4:]
+	stats := map[string]uint64{}
+	for i := uint32(0); i < n; i++ {
+		if len(b) < 4 {
+			return nil, fmt.Errorf("truncated stat")
+		}
+		typ, l := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+l {
+			return nil, fmt.Errorf("truncated stat of type %v", typ)
+		}
+		name, ok := bmpStats[typ]
+		if !ok {
+			name = fmt.Sprintf("type-%v", typ)
+		}
+		switch v := b[4 : 4+l]; l {
+		case 4:
+			stats[name] = uint64(binary.BigEndian.Uint32(v))
+		case 8:
+			stats[name] = binary.BigEndian.Uint64(v)
+		default:
+			log.V(2).Infof("skipping BMP stat of type %v and length %v", typ, l)
+		}
+		b = b[4+l:]
+	}
+	return stats, nil
+}
+
+// serveBMP accepts the BMP sessions of routers on l, sending their messages to
+// the channel alongside the stream's, held up as the stream is: a session is
+// not read while a slow consumer holds up the stream. Each router is the
+// collector of its messages, named by its address until it sends its sysName.
+// The returned function closes l and the sessions, and waits for them to end.
+func (r *RisLive) serveBMP(l net.Listener, logf io.Writer) func() {
+	return r.serveSessions(l, "BMP", func(c net.Conn, host string) error {
+		return r.readMessages(NewBMPReader(c, host), isBMPMessageError, logf)
+	})
+}
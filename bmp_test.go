@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// bmpMsg encodes a BMP message of the body.
+func bmpMsg(typ byte, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	return append(append([]byte{bmpVersion}, u32(uint32(bmpHeaderLen+len(b)))...), append([]byte{typ}, b...)...)
+}
+
+// bmpPeer encodes a per-peer header.
+func bmpPeer(flags byte, addr string, asn, sec, usec uint32) []byte {
+	ip := net.ParseIP(addr).To16()
+	if flags&bmpFlagIPv6 == 0 {
+		ip = append(make([]byte, 12), ip.To4()...)
+	}
+	return bytes.Join([][]byte{{0, flags}, make([]byte, 8), ip, u32(asn), {192, 0, 2, 254}, u32(sec), u32(usec)}, nil)
+}
+
+// testBMP returns a BMP session, and the messages it holds.
+func testBMP(t *testing.T) ([]byte, []*RisMessageData) {
+	update, updateMsg := testUpdate(t, 1558620047.08, "router1", "196.60.9.165", "57695")
+	withdrawal, withdrawalMsg := testWithdrawal(t, 1558620048, "router1", "192.0.2.1", "64496")
+	// AS_PATH 64496 64497 of 2 byte ASNs, NEXT_HOP 192.0.2.1, NLRI 198.51.100.0/24.
+	update2 := "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" + "002F" + "02" + "0000" + "0014" +
+		"40010100" + "400206" + "0202FBF0FBF1" + "400304C0000201" + "18C63364"
+	msgs := [][]byte{
+		bmpMsg(bmpInitiation, u16(1), u16(4), []byte("test"), u16(bmpSysName), u16(7), []byte("router1")),
+		bmpMsg(bmpPeerUp, bmpPeer(0, "196.60.9.165", 57695, 1558620040, 0),
+			make([]byte, 16+4), mustHex(t, "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF001D0104E15F00B4C43C09A500")),
+		bmpMsg(bmpRouteMonitoring, bmpPeer(0, "196.60.9.165", 57695, 1558620047, 80000), update),
+		// A route mirroring message, which is skipped.
+		bmpMsg(6, bmpPeer(0, "196.60.9.165", 57695, 1558620047, 90000)),
+		bmpMsg(bmpRouteMonitoring, bmpPeer(bmpFlagAS2, "192.0.2.1", 64496, 1558620048, 0), mustHex(t, update2)),
+		// Malformed attributes, which withdraw the prefixes.
+		bmpMsg(bmpRouteMonitoring, bmpPeer(bmpFlagAS2, "192.0.2.1", 64496, 1558620048, 0), withdrawal),
+		// A keepalive, which is not route monitoring.
+		bmpMsg(bmpRouteMonitoring, bmpPeer(0, "192.0.2.1", 64496, 1558620048, 0), mustHex(t, "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF001304")),
+		bmpMsg(bmpStatsReport, bmpPeer(bmpFlagIPv6, "2001:db8::1", 64497, 1558620049, 0),
+			u32(3), u16(0), u16(4), u32(12), u16(7), u16(8), u32(0), u32(800000), u16(14), u16(2), u16(1)),
+		bmpMsg(bmpPeerDown, bmpPeer(bmpFlagIPv6, "2001:db8::1", 64497, 1558620050, 500000), []byte{2}, u16(0)),
+		bmpMsg(bmpTermination, u16(0), u16(0)),
+		// Messages after the termination are not read.
+		bmpMsg(bmpPeerDown, bmpPeer(0, "196.60.9.165", 57695, 1558620060, 0), []byte{2}, u16(0)),
+	}
+	want := []*RisMessageData{{
+		Timestamp: 1558620040,
+		Host:      "router1",
+		Peer:      "196.60.9.165",
+		PeerASN:   "57695",
+		Type:      "RIS_PEER_STATE",
+		State:     "connected",
+	}, updateMsg, {
+		Timestamp:     1558620048,
+		Host:          "router1",
+		Peer:          "192.0.2.1",
+		PeerASN:       "64496",
+		Type:          "UPDATE",
+		DigestedPath:  []int32{64496, 64497},
+		Origin:        "igp",
+		Announcements: []*RisAnnouncement{{NextHop: "192.0.2.1", Prefixes: []string{"198.51.100.0/24"}}},
+		Raw:           update2,
+	}, withdrawalMsg, {
+		Timestamp: 1558620049,
+		Host:      "router1",
+		Peer:      "2001:db8::1",
+		PeerASN:   "64497",
+		Type:      "STATS",
+		Stats:     map[string]uint64{"rejected-prefixes": 12, "adj-rib-in-routes": 800000},
+	}, {
+		Timestamp: 1558620050.5,
+		Host:      "router1",
+		Peer:      "2001:db8::1",
+		PeerASN:   "64497",
+		Type:      "RIS_PEER_STATE",
+		State:     "down",
+	}}
+	return bytes.Join(msgs, nil), want
+}
+
+func TestBMPReader(t *testing.T) {
+	raw, want := testBMP(t)
+	// The keepalive fails, the stat of type 14, of an unexpected length, is skipped.
+	testReader(t, "Success - session", NewBMPReader(bytes.NewReader(raw), "192.0.2.254"), isBMPMessageError, want, 1)
+}
+
+func TestBMPReaderFailure(t *testing.T) {
+	tests := []struct {
+		desc string
+		data []byte
+	}{{
+		desc: "Failure - truncated header",
+		data: []byte{bmpVersion, 0, 0},
+	}, {
+		desc: "Failure - unsupported version",
+		data: []byte{1, 0, 0, 0, 6, bmpInitiation},
+	}, {
+		desc: "Failure - length shorter than the header",
+		data: []byte{bmpVersion, 0, 0, 0, 5, bmpInitiation},
+	}, {
+		desc: "Failure - length too long",
+		data: []byte{bmpVersion, 0xff, 0xff, 0xff, 0xff, bmpInitiation},
+	}, {
+		desc: "Failure - truncated message",
+		data: bmpMsg(bmpPeerUp, make([]byte, 60))[:20],
+	}}
+	for _, test := range tests {
+		testReaderFailure(t, test.desc, NewBMPReader(bytes.NewReader(test.data), "192.0.2.254"), isBMPMessageError)
+	}
+}
+
+func TestServeBMP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	r := &RisLive{
+		Filter:    &RisFilter{},
+		Chan:      make(chan RisMessage, 20),
+		Metrics:   NewMetrics(),
+		Watchdog:  NewWatchdog(0),
+		Prefilter: func(rm *RisMessageData) bool { return rm.Type != "STATS" },
+	}
+	stop := r.serveBMP(l, ioutil.Discard)
+
+	raw, want := testBMP(t)
+	// A second router, which does not name itself, is the collector of its address.
+	raw2 := bmpMsg(bmpPeerDown, bmpPeer(0, "198.51.100.1", 64511, 1558620070, 0), []byte{2}, u16(0))
+	for _, b := range [][]byte{raw, raw2} {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer c.Close()
+		if _, err := c.Write(b); err != nil {
+			t.Fatalf("failed to write BMP: %v", err)
+		}
+	}
+	want = append(want[:4:4], want[5], &RisMessageData{
+		Timestamp: 1558620070,
+		Host:      "127.0.0.1",
+		Peer:      "198.51.100.1",
+		PeerASN:   "64511",
+		Type:      "RIS_PEER_STATE",
+		State:     "down",
+	})
+
+	var got []*RisMessageData
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(want) {
+		select {
+		case rm := <-r.Chan:
+			got = append(got, rm.Data)
+		case <-timeout:
+			t.Fatalf("got %v messages before the timeout, want %v", len(got), len(want))
+		}
+	}
+	// The second session stays open until the listener is stopped.
+	stop()
+	// The sessions are concurrent, each in order.
+	sort.SliceStable(got, func(i, j int) bool { return got[i].Host > got[j].Host })
+	if diff := cmp.Diff(got, want, cmpopts.EquateEmpty(), cmpopts.EquateApprox(0, 1e-6)); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Errorf("connected after the listener was stopped")
+	}
+}
@@ -0,0 +1,203 @@
+// Detect announcements of bogon prefixes, and paths which carry bogon ASNs.
+//
+// Bogon prefixes are those reserved for private, shared, documentation or other
+// special uses which should never appear in the global routing table.
+// Unallocated address space changes over time, so it is loaded from a local
+// file rather than built in.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// bogonPrefixes are the reserved/special purpose IPv4 and IPv6 prefixes.
+var bogonPrefixes = []string{
+	"0.0.0.0/8",       // RFC 1122 "this" network.
+	"10.0.0.0/8",      // RFC 1918 private space.
+	"100.64.0.0/10",   // RFC 6598 shared (CGN) space.
+	"127.0.0.0/8",     // RFC 1122 loopback.
+	"169.254.0.0/16",  // RFC 3927 link local.
+	"172.16.0.0/12",   // RFC 1918 private space.
+	"192.0.0.0/24",    // RFC 6890 IETF protocol assignments.
+	"192.0.2.0/24",    // RFC 5737 TEST-NET-1.
+	"192.168.0.0/16",  // RFC 1918 private space.
+	"198.18.0.0/15",   // RFC 2544 benchmarking.
+	"198.51.100.0/24", // RFC 5737 TEST-NET-2.
+	"203.0.113.0/24",  // RFC 5737 TEST-NET-3.
+	"224.0.0.0/4",     // RFC 5771 multicast.
+	"240.0.0.0/4",     // RFC 1112 reserved.
+	"::/8",            // RFC 4291 loopback, unspecified, v4-mapped.
+	"0100::/64",       // RFC 6666 discard only.
+	"2001:2::/48",     // RFC 5180 benchmarking.
+	"2001:10::/28",    // RFC 4843 ORCHID.
+	"2001:db8::/32",   // RFC 3849 documentation.
+	"3fff::/20",       // RFC 9637 documentation.
+	"fc00::/7",        // RFC 4193 unique local.
+	"fe80::/10",       // RFC 4291 link local.
+	"fec0::/10",       // RFC 3879 site local.
+	"ff00::/8",        // RFC 4291 multicast.
+}
+
+// IsBogonASN reports whether an ASN is reserved or private and should not appear
+// in a global routing table path. ASNs are carried as int32 in the DigestedPath,
+// so the value is reinterpreted as unsigned before comparison.
+func IsBogonASN(asn int32) bool {
+	a := uint32(asn)
+	switch {
+	case a == 0: // RFC 7607.
+		return true
+	case a == 23456: // RFC 6793 AS_TRANS.
+		return true
+	case a >= 64496 && a <= 64511: // RFC 5398 documentation.
+		return true
+	case a >= 64512 && a <= 65534: // RFC 6996 private use.
+		return true
+	case a == 65535: // RFC 7300 last 16 bit ASN.
+		return true
+	case a >= 65536 && a <= 65551: // RFC 5398 documentation.
+		return true
+	case a >= 4200000000: // RFC 6996 private use, RFC 7300 last ASN.
+		return true
+	}
+	return false
+}
+
+// BogonMatch describes a single bogon found in a message.
+type BogonMatch struct {
+	Prefix string // The announced prefix, if the prefix is a bogon.
+	Bogon  string // The bogon prefix which covers the announced prefix.
+	ASN    int32  // The bogon ASN in the path, if the path contains a bogon ASN.
+}
+
+func (b *BogonMatch) String() string {
+	if b.Prefix != "" {
+		return fmt.Sprintf("bogon prefix %v (covered by %v)", b.Prefix, b.Bogon)
+	}
+	return fmt.Sprintf("bogon ASN %v in path", uint32(b.ASN))
+}
+
+// BogonDetector holds the table of bogon prefixes used to check messages.
+type BogonDetector struct {
+	prefixes []*net.IPNet
+}
+
+// NewBogonDetector creates a BogonDetector from the built in bogon prefixes, and
+// optionally the unallocated prefixes listed in file.
+func NewBogonDetector(file string) (*BogonDetector, error) {
+	b := &BogonDetector{}
+	for _, p := range bogonPrefixes {
+		if err := b.Add(p); err != nil {
+			return nil, err
+		}
+	}
+	if file == "" {
+		return b, nil
+	}
+
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bogon file(%v): %v", file, err)
+	}
+	defer fd.Close()
+	if err := b.Load(fd); err != nil {
+		return nil, fmt.Errorf("failed to load bogon file(%v): %v", file, err)
+	}
+	return b, nil
+}
+
+// Add adds a single prefix to the bogon table.
+func (b *BogonDetector) Add(prefix string) error {
+	_, n, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return fmt.Errorf("failed to parse bogon prefix(%v): %v", prefix, err)
+	}
+	b.prefixes = append(b.prefixes, n)
+	return nil
+}
+
+// Load adds prefixes read from r, one per line. Blank lines and text
+// following a '#' are ignored.
+func (b *BogonDetector) Load(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := b.Add(line); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// Covering returns the bogon prefix which covers (is equal to or less specific
+// than) prefix, or nil if prefix is not a bogon.
+func (b *BogonDetector) Covering(prefix string) *net.IPNet {
+	ip, n, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil
+	}
+	plen, _ := n.Mask.Size()
+	for _, bogon := range b.prefixes {
+		blen, bits := bogon.Mask.Size()
+		if bits != len(n.Mask)*8 || blen > plen {
+			continue
+		}
+		if bogon.Contains(ip) {
+			return bogon
+		}
+	}
+	return nil
+}
+
+// Check returns the bogon prefixes announced, and bogon ASNs in the path, of a message.
+func (b *BogonDetector) Check(rm *RisMessageData) []*BogonMatch {
+	var result []*BogonMatch
+	for _, a := range rm.Announcements {
+		for _, p := range a.Prefixes {
+			if bogon := b.Covering(p); bogon != nil {
+				result = append(result, &BogonMatch{Prefix: p, Bogon: bogon.String()})
+			}
+		}
+	}
+	seen := map[int32]bool{}
+	for _, asn := range rm.DigestedPath {
+		if IsBogonASN(asn) && !seen[asn] {
+			seen[asn] = true
+			result = append(result, &BogonMatch{ASN: asn})
+		}
+	}
+	return result
+}
+
+// BogonMode selects how the RisFilter treats messages containing bogons.
+type BogonMode int
+
+const (
+	BogonIgnore  BogonMode = iota // Bogons are not considered when filtering.
+	BogonInclude                  // Only messages containing bogons pass the filter.
+	BogonExclude                  // Messages containing bogons are removed by the filter.
+)
+
+// ParseBogonMode parses a BogonMode by name: ignore, include or exclude.
+func ParseBogonMode(s string) (BogonMode, error) {
+	switch strings.ToLower(s) {
+	case "", "ignore":
+		return BogonIgnore, nil
+	case "include":
+		return BogonInclude, nil
+	case "exclude":
+		return BogonExclude, nil
+	}
+	return BogonIgnore, fmt.Errorf("unknown bogon mode: %q", s)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIsBogonASN(t *testing.T) {
+	tests := []struct {
+		desc string
+		asn  int32
+		want bool
+	}{
+		{desc: "AS0", asn: 0, want: true},
+		{desc: "AS_TRANS", asn: 23456, want: true},
+		{desc: "Documentation", asn: 64500, want: true},
+		{desc: "Private 16bit", asn: 65000, want: true},
+		{desc: "Private 32bit", asn: int32(-94967296), want: true}, // 4200000000 as int32.
+		{desc: "Not a bogon: 3356", asn: 3356, want: false},
+		{desc: "Not a bogon: 396982", asn: 396982, want: false},
+	}
+
+	for _, test := range tests {
+		if got := IsBogonASN(test.asn); got != test.want {
+			t.Errorf("[%v]: got/want mismatch got: %v want: %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestBogonDetectorCheck(t *testing.T) {
+	b, err := NewBogonDetector("")
+	if err != nil {
+		t.Fatalf("failed to create bogon detector: %v", err)
+	}
+	if err := b.Load(strings.NewReader("# Unallocated.\n\n45.0.0.0/8 # a comment\n")); err != nil {
+		t.Fatalf("failed to load unallocated prefixes: %v", err)
+	}
+
+	tests := []struct {
+		desc string
+		msg  *RisMessageData
+		want []*BogonMatch
+	}{{
+		desc: "Success - no bogons",
+		msg:  announce(1, "rrc00", "1.1.1.1", []interface{}{3356, 15169}, "8.8.8.0/24"),
+	}, {
+		desc: "Success - RFC1918 more specific",
+		msg:  announce(1, "rrc00", "1.1.1.1", []interface{}{3356, 15169}, "10.1.0.0/16"),
+		want: []*BogonMatch{{Prefix: "10.1.0.0/16", Bogon: "10.0.0.0/8"}},
+	}, {
+		desc: "Success - covering prefix is not a bogon",
+		msg:  announce(1, "rrc00", "1.1.1.1", []interface{}{3356, 15169}, "10.0.0.0/7"),
+	}, {
+		desc: "Success - IPv6 documentation",
+		msg:  announce(1, "rrc00", "1.1.1.1", []interface{}{3356, 15169}, "2001:db8:1::/48"),
+		want: []*BogonMatch{{Prefix: "2001:db8:1::/48", Bogon: "2001:db8::/32"}},
+	}, {
+		desc: "Success - unallocated from file",
+		msg:  announce(1, "rrc00", "1.1.1.1", []interface{}{3356, 15169}, "45.1.0.0/16"),
+		want: []*BogonMatch{{Prefix: "45.1.0.0/16", Bogon: "45.0.0.0/8"}},
+	}, {
+		desc: "Success - private 32bit ASN in a decoded path",
+		msg:  risData(t, `{"path":[3356,4200000001,15169],"announcements":[{"next_hop":"1.1.1.1","prefixes":["8.8.8.0/24"]}]}`),
+		want: []*BogonMatch{{ASN: int32(-94967295)}}, // 4200000001 as int32.
+	}, {
+		desc: "Success - private ASN in path",
+		msg:  announce(1, "rrc00", "1.1.1.1", []interface{}{3356, 65001, 65001, 15169}, "8.8.8.0/24"),
+		want: []*BogonMatch{{ASN: 65001}},
+	}}
+
+	for _, test := range tests {
+		if test.msg.DigestedPath == nil {
+			if err := digestPath(test.msg); err != nil {
+				t.Fatalf("[%v]: failed to digest path: %v", test.desc, err)
+			}
+		}
+		got := b.Check(test.msg)
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestCheckBogons(t *testing.T) {
+	b, err := NewBogonDetector("")
+	if err != nil {
+		t.Fatalf("failed to create bogon detector: %v", err)
+	}
+	bogon := announce(1, "rrc00", "1.1.1.1", []interface{}{3356, 15169}, "192.168.0.0/24")
+	clean := announce(1, "rrc00", "1.1.1.1", []interface{}{3356, 15169}, "8.8.8.0/24")
+
+	tests := []struct {
+		desc string
+		rl   *RisLive
+		msg  *RisMessageData
+		want bool
+	}{{
+		desc: "Success - ignore mode passes bogons",
+		rl:   &RisLive{Filter: &RisFilter{}, Bogons: b},
+		msg:  bogon,
+		want: true,
+	}, {
+		desc: "Success - include mode passes bogons",
+		rl:   &RisLive{Filter: &RisFilter{Bogons: BogonInclude}, Bogons: b},
+		msg:  bogon,
+		want: true,
+	}, {
+		desc: "Success - include mode removes clean messages",
+		rl:   &RisLive{Filter: &RisFilter{Bogons: BogonInclude}, Bogons: b},
+		msg:  clean,
+		want: false,
+	}, {
+		desc: "Success - exclude mode removes bogons",
+		rl:   &RisLive{Filter: &RisFilter{Bogons: BogonExclude}, Bogons: b},
+		msg:  bogon,
+		want: false,
+	}, {
+		desc: "Success - no detector passes everything",
+		rl:   &RisLive{Filter: &RisFilter{Bogons: BogonExclude}},
+		msg:  bogon,
+		want: true,
+	}}
+
+	for _, test := range tests {
+		if got := test.rl.CheckBogons(test.msg); got != test.want {
+			t.Errorf("[%v]: got(%v)/want(%v) mismatch", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestParseBogonMode(t *testing.T) {
+	tests := []struct {
+		desc    string
+		mode    string
+		want    BogonMode
+		wantErr bool
+	}{{
+		desc: "Success - empty",
+		want: BogonIgnore,
+	}, {
+		desc: "Success - include",
+		mode: "include",
+		want: BogonInclude,
+	}, {
+		desc: "Success - exclude, any case",
+		mode: "Exclude",
+		want: BogonExclude,
+	}, {
+		desc:    "Failure - unknown",
+		mode:    "only",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		got, err := ParseBogonMode(test.mode)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil && got != test.want:
+			t.Errorf("[%v]: got %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
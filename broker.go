@@ -0,0 +1,224 @@
+// A fan-out broker, which delivers the messages of one upstream stream to many
+// subscribers. Each subscriber has its own filter, buffer and overflow policy,
+// and subscribers may come and go while the stream runs.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Subscription is a subscriber to a Broker, receiving the matching messages on C.
+// The subscriber releases each message once done with it.
+type Subscription struct {
+	ID     int
+	Name   string
+	Filter *RisFilter                    // Evaluated as RisLive.Match, a nil filter matches every message.
+	Func   func(rm *RisMessageData) bool // If set, must also accept each message.
+	Policy OverflowPolicy
+	C      chan RisMessage // Closed when the subscription ends.
+
+	delivered, dropped uint64 // Updated atomically.
+	done               chan struct{}
+	once               sync.Once
+	mu                 sync.RWMutex // Held for reading while sending on C, and for writing to close it.
+	closed             bool
+}
+
+// Delivered returns the number of messages delivered to the subscriber.
+func (s *Subscription) Delivered() uint64 {
+	return atomic.LoadUint64(&s.delivered)
+}
+
+// Dropped returns the number of matching messages dropped because the subscriber fell behind.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Broker fans the messages of a stream out to its subscribers.
+type Broker struct {
+	Bogons  *BogonDetector // Used by subscriber filters with a BogonMode.
+	Metrics *Metrics       // If set, drops are counted per subscriber.
+
+	mu     sync.RWMutex
+	subs   map[int]*Subscription
+	list   []*Subscription // The subscribers, replaced rather than modified, so Publish can send without the lock.
+	nextID int
+	closed bool
+}
+
+// NewBroker creates a Broker.
+func NewBroker(bogons *BogonDetector, metrics *Metrics) *Broker {
+	return &Broker{Bogons: bogons, Metrics: metrics, subs: map[int]*Subscription{}}
+}
+
+// Subscribe adds a subscriber, receiving messages matching f on a channel of
+// buffer messages. When the subscriber falls behind, the policy decides whether
+// the broker blocks, holding up every subscriber, or drops messages.
+func (b *Broker) Subscribe(name string, f *RisFilter, buffer int, policy OverflowPolicy) (*Subscription, error) {
+	return b.subscribe(name, f, nil, buffer, policy)
+}
+
+// SubscribeFunc adds a subscriber as Subscribe, receiving the messages which match accepts.
+func (b *Broker) SubscribeFunc(name string, match func(rm *RisMessageData) bool, buffer int, policy OverflowPolicy) (*Subscription, error) {
+	return b.subscribe(name, nil, match, buffer, policy)
+}
+
+func (b *Broker) subscribe(name string, f *RisFilter, match func(rm *RisMessageData) bool, buffer int, policy OverflowPolicy) (*Subscription, error) {
+	if policy == OverflowSpill {
+		return nil, fmt.Errorf("overflow policy %v is not supported for subscribers", policy)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, fmt.Errorf("broker is closed")
+	}
+	b.nextID++
+	s := &Subscription{
+		ID:     b.nextID,
+		Name:   name,
+		Filter: f,
+		Func:   match,
+		Policy: policy,
+		C:      make(chan RisMessage, buffer),
+		done:   make(chan struct{}),
+	}
+	b.subs[s.ID] = s
+	b.updateList()
+	return s, nil
+}
+
+// updateList replaces the list of subscribers. b.mu must be held.
+func (b *Broker) updateList() {
+	list := make([]*Subscription, 0, len(b.subs))
+	for _, s := range b.subs {
+		list = append(list, s)
+	}
+	b.list = list
+}
+
+// Unsubscribe removes a subscriber, closing its channel.
+func (b *Broker) Unsubscribe(s *Subscription) {
+	// Release any Publish blocked on the subscriber, before waiting for the lock.
+	s.once.Do(func() { close(s.done) })
+	b.mu.Lock()
+	if _, ok := b.subs[s.ID]; !ok {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.subs, s.ID)
+	b.updateList()
+	b.mu.Unlock()
+	// A Publish may still hold the subscriber from the previous list.
+	s.mu.Lock()
+	s.closed = true
+	close(s.C)
+	s.mu.Unlock()
+}
+
+// Subscriptions returns the current subscribers, sorted by ID.
+func (b *Broker) Subscriptions() []*Subscription {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	result := make([]*Subscription, 0, len(b.subs))
+	for _, s := range b.subs {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Publish delivers a message to every subscriber whose filter it matches. The
+// broker's lock is not held while sending, so subscribers may come and go while
+// Publish blocks on one.
+func (b *Broker) Publish(rm RisMessage) {
+	if rm.Data == nil {
+		return
+	}
+	b.mu.RLock()
+	list := b.list
+	b.mu.RUnlock()
+	for _, s := range list {
+		if !s.Filter.Match(rm.Data, b.Bogons) || (s.Func != nil && !s.Func(rm.Data)) {
+			continue
+		}
+		// Each subscriber delivered a pooled message holds it, and releases it.
+		rm.Retain()
+		s.mu.RLock()
+		if !s.closed && b.deliver(s, rm) {
+			atomic.AddUint64(&s.delivered, 1)
+		} else {
+			rm.Release()
+		}
+		s.mu.RUnlock()
+	}
+}
+
+// deliver sends a message to a subscriber according to its policy, reporting
+// whether the message was delivered.
+func (b *Broker) deliver(s *Subscription, rm RisMessage) bool {
+	select {
+	case s.C <- rm:
+		return true
+	case <-s.done:
+		return false
+	default:
+	}
+	switch s.Policy {
+	case OverflowDropNewest:
+		b.drop(s)
+		return false
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.C <- rm:
+				return true
+			case <-s.done:
+				return false
+			default:
+			}
+			select {
+			case old := <-s.C:
+				old.Release()
+				b.drop(s)
+			default:
+			}
+		}
+	}
+	select {
+	case s.C <- rm:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (b *Broker) drop(s *Subscription) {
+	atomic.AddUint64(&s.dropped, 1)
+	if b.Metrics != nil {
+		b.Metrics.SubscriberDropped.Inc(s.Name)
+	}
+}
+
+// Run publishes the messages from in until it is closed, then closes the broker.
+// Pooled messages are released once published, their subscribers holding them.
+func (b *Broker) Run(in <-chan RisMessage) {
+	for rm := range in {
+		b.Publish(rm)
+		rm.Release()
+	}
+	b.Close()
+}
+
+// Close removes every subscriber, closing their channels. No new subscribers
+// are accepted after.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	for _, s := range b.Subscriptions() {
+		b.Unsubscribe(s)
+	}
+}
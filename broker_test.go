@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker(nil, NewMetrics())
+	all, err := b.Subscribe("all", nil, 10, OverflowBlock)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	v4, err := b.Subscribe("v4", &RisFilter{Prefix: []string{"192.0.2.0/24"}}, 10, OverflowBlock)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	// A slow subscriber, which never reads, drops the newest messages.
+	slow, err := b.Subscribe("slow", nil, 1, OverflowDropNewest)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if _, err := b.Subscribe("spill", nil, 1, OverflowSpill); err == nil {
+		t.Errorf("did not get error for a spill subscriber")
+	}
+
+	in := make(chan RisMessage)
+	go b.Run(in)
+	in <- RisMessage{Data: announce(1, "rrc00", "p1", []interface{}{1, 2}, "192.0.2.0/24")}
+	in <- RisMessage{Data: announce(2, "rrc00", "p1", []interface{}{1, 3}, "198.51.100.0/24")}
+	in <- RisMessage{Type: "pong"}
+	in <- RisMessage{Data: announce(3, "rrc00", "p1", []interface{}{1, 2}, "192.0.2.128/25")}
+	close(in)
+
+	read := func(s *Subscription) []float64 {
+		var result []float64
+		for rm := range s.C {
+			result = append(result, rm.Data.Timestamp)
+		}
+		return result
+	}
+	if diff := cmp.Diff(read(all), []float64{1, 2, 3}); diff != "" {
+		t.Errorf("all got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if diff := cmp.Diff(read(v4), []float64{1, 3}); diff != "" {
+		t.Errorf("v4 got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if diff := cmp.Diff(read(slow), []float64{1}); diff != "" {
+		t.Errorf("slow got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if slow.Dropped() != 2 || slow.Delivered() != 1 || all.Delivered() != 3 {
+		t.Errorf("got slow %d dropped, %d delivered, all %d delivered, want 2, 1, 3", slow.Dropped(), slow.Delivered(), all.Delivered())
+	}
+	if got := b.Metrics.SubscriberDropped.Get("slow"); got != 2 {
+		t.Errorf("got %v dropped metric, want 2", got)
+	}
+	if _, err := b.Subscribe("late", nil, 1, OverflowBlock); err == nil {
+		t.Errorf("did not get error subscribing to a closed broker")
+	}
+}
+
+func TestBrokerUnsubscribe(t *testing.T) {
+	b := NewBroker(nil, nil)
+	stuck, _ := b.Subscribe("stuck", nil, 0, OverflowBlock)
+
+	in := make(chan RisMessage)
+	go b.Run(in)
+	in <- RisMessage{Data: announce(1, "rrc00", "p1", []interface{}{1}, "192.0.2.0/24")}
+
+	// The broker is blocked on the stuck subscriber, until it unsubscribes.
+	published := make(chan bool)
+	go func() {
+		in <- RisMessage{Data: announce(2, "rrc00", "p1", []interface{}{1}, "192.0.2.0/24")}
+		published <- true
+	}()
+	select {
+	case <-published:
+		t.Fatalf("the broker did not block on the stuck subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// Subscribers come and go while the broker is blocked.
+	subscribed := make(chan bool)
+	go func() {
+		s, err := b.Subscribe("other", nil, 1, OverflowDropNewest)
+		if err == nil {
+			b.Unsubscribe(s)
+		}
+		subscribed <- err == nil
+	}()
+	select {
+	case ok := <-subscribed:
+		if !ok {
+			t.Errorf("failed to subscribe while the broker is blocked")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("subscribing hung while the broker is blocked")
+	}
+	b.Unsubscribe(stuck)
+	<-published
+	close(in)
+	if _, ok := <-stuck.C; ok {
+		t.Errorf("the channel of the unsubscribed subscriber is open")
+	}
+	if got := len(b.Subscriptions()); got != 0 {
+		t.Errorf("got %d subscriptions, want 0", got)
+	}
+}
+
+func TestBrokerDropOldest(t *testing.T) {
+	b := NewBroker(nil, nil)
+	oldest, _ := b.Subscribe("oldest", nil, 2, OverflowDropOldest)
+	for ts := 1; ts <= 4; ts++ {
+		b.Publish(RisMessage{Data: announce(float64(ts), "rrc00", "p1", []interface{}{1}, "192.0.2.0/24")})
+	}
+	b.Close()
+	var got []float64
+	for rm := range oldest.C {
+		got = append(got, rm.Data.Timestamp)
+	}
+	if diff := cmp.Diff(got, []float64{3, 4}); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if oldest.Dropped() != 2 || oldest.Delivered() != 4 {
+		t.Errorf("got %d dropped, %d delivered, want 2, 4", oldest.Dropped(), oldest.Delivered())
+	}
+}
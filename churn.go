@@ -0,0 +1,439 @@
+// Track route flaps and update churn, per prefix and per (peer, prefix).
+//
+// Each update adds a penalty to the route, in the style of RFC 2439 route flap
+// damping: withdrawals of an announced route, re-advertisements and attribute
+// changes each add a fixed penalty, and the penalty decays exponentially with a
+// configured half-life. A route starts flapping when its penalty exceeds the
+// suppress threshold and stops when the penalty decays below the reuse threshold.
+//
+// Routes are forgotten once their penalty has decayed, so the first update of a
+// long stable route is treated as if it were the first seen.
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ChurnConfig holds the penalties, thresholds and windows used by a ChurnTracker.
+type ChurnConfig struct {
+	WithdrawalPenalty      float64       // Added for each withdrawal of an announced route.
+	ReadvertisePenalty     float64       // Added for an announcement following a withdrawal.
+	AttributeChangePenalty float64       // Added for an announcement changing the attributes of an announced route.
+	HalfLife               time.Duration // Time for a penalty to decay to half its value.
+	Suppress, Reuse        float64       // Flap start/stop thresholds per (peer, prefix).
+	PrefixSuppress         float64       // Flap start threshold per prefix, across all peers.
+	PrefixReuse            float64       // Flap stop threshold per prefix, across all peers.
+	Window                 time.Duration // The sliding window used for TopPrefixes/TopOrigins.
+	Buckets                int           // The number of buckets the window is divided into.
+}
+
+// DefaultChurnConfig returns a ChurnConfig with the RFC 2439 suggested penalties.
+// Per prefix thresholds are higher, as every peer's updates are counted against the prefix.
+func DefaultChurnConfig() *ChurnConfig {
+	return &ChurnConfig{
+		WithdrawalPenalty:      1000,
+		ReadvertisePenalty:     0,
+		AttributeChangePenalty: 500,
+		HalfLife:               15 * time.Minute,
+		Suppress:               2000,
+		Reuse:                  750,
+		PrefixSuppress:         50000,
+		PrefixReuse:            20000,
+		Window:                 time.Hour,
+		Buckets:                60,
+	}
+}
+
+// FlapEventKind describes the transition a FlapEvent reports.
+type FlapEventKind int
+
+const (
+	FlapStart FlapEventKind = iota // The penalty crossed the suppress threshold.
+	FlapStop                       // The penalty decayed below the reuse threshold.
+)
+
+func (k FlapEventKind) String() string {
+	switch k {
+	case FlapStart:
+		return "FLAP_START"
+	case FlapStop:
+		return "FLAP_STOP"
+	}
+	return "FLAP_UNKNOWN"
+}
+
+// FlapEvent is emitted when a prefix, or a single peer's route to a prefix, starts
+// or stops flapping. Peer and Collector are empty for per prefix events.
+type FlapEvent struct {
+	Kind      FlapEventKind
+	Prefix    string
+	Collector string
+	Peer      string
+	Penalty   float64
+	Time      time.Time
+}
+
+// ChurnState is the update history of a prefix, or a single (peer, prefix).
+type ChurnState struct {
+	Announcements int64
+	Withdrawals   int64
+	Penalty       float64 // The penalty as of Updated.
+	Updated       time.Time
+	Flapping      bool
+	withdrawn     bool
+	attrs         uint64 // The hash of the attributes of the announced route.
+}
+
+// decay reduces the penalty to its value at ts.
+func (s *ChurnState) decay(ts time.Time, halfLife time.Duration) {
+	if dt := ts.Sub(s.Updated); dt > 0 && halfLife > 0 {
+		s.Penalty *= math.Exp2(-float64(dt) / float64(halfLife))
+	}
+	if ts.After(s.Updated) {
+		s.Updated = ts
+	}
+}
+
+// ChurnCount is an update count for a prefix or origin over the sliding window.
+type ChurnCount struct {
+	Prefix string
+	Origin int32
+	Count  int64
+}
+
+// churnBucket holds the update counts for one slice of the sliding window.
+type churnBucket struct {
+	start    time.Time
+	prefixes map[string]int64
+	origins  map[int32]int64
+}
+
+// ChurnTracker computes update churn and flap state over the stream.
+type ChurnTracker struct {
+	mu       sync.Mutex
+	cfg      *ChurnConfig
+	prefixes map[string]*ChurnState
+	peers    map[peerPrefix]*ChurnState
+	buckets  []*churnBucket // Oldest first.
+}
+
+// NewChurnTracker creates a ChurnTracker, a nil config uses DefaultChurnConfig.
+func NewChurnTracker(cfg *ChurnConfig) (*ChurnTracker, error) {
+	if cfg == nil {
+		cfg = DefaultChurnConfig()
+	}
+	switch {
+	case cfg.Buckets <= 0 || cfg.Window/time.Duration(cfg.Buckets) <= 0:
+		return nil, fmt.Errorf("churn window(%v) must be positive and divide into %v buckets", cfg.Window, cfg.Buckets)
+	case cfg.HalfLife < 0:
+		return nil, fmt.Errorf("churn half-life(%v) must not be negative", cfg.HalfLife)
+	case cfg.Reuse > cfg.Suppress || cfg.PrefixReuse > cfg.PrefixSuppress:
+		return nil, fmt.Errorf("churn reuse thresholds(%v, %v) must not exceed the suppress thresholds(%v, %v)",
+			cfg.Reuse, cfg.PrefixReuse, cfg.Suppress, cfg.PrefixSuppress)
+	}
+	return &ChurnTracker{
+		cfg:      cfg,
+		prefixes: map[string]*ChurnState{},
+		peers:    map[peerPrefix]*ChurnState{},
+	}, nil
+}
+
+// routeAttrs returns a hash of the attributes of an announcement of a message,
+// which changes if the path, communities, origin or next hop do. Each list and
+// string is preceded by its length, so that no two attributes hash the same
+// bytes.
+func routeAttrs(rm *RisMessageData, a *RisAnnouncement) uint64 {
+	h := fnv.New64a()
+	var b [4]byte
+	word := func(v uint32) {
+		binary.BigEndian.PutUint32(b[:], v)
+		h.Write(b[:])
+	}
+	str := func(s string) {
+		word(uint32(len(s)))
+		io.WriteString(h, s)
+	}
+	word(uint32(len(rm.DigestedPath)))
+	for _, asn := range rm.DigestedPath {
+		word(uint32(asn))
+	}
+	word(uint32(len(rm.PathSets)))
+	for _, set := range rm.PathSets {
+		word(uint32(set.Start))
+		word(uint32(set.End))
+	}
+	word(uint32(len(rm.Community)))
+	for _, c := range rm.Community {
+		word(uint32(len(c)))
+		for _, v := range c {
+			word(uint32(v))
+		}
+	}
+	str(rm.Origin)
+	str(a.NextHop)
+	return h.Sum64()
+}
+
+// Update applies a single message to the tracker, returning any flap events.
+func (c *ChurnTracker) Update(rm *RisMessageData) []*FlapEvent {
+	if rm == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ts := rm.Time()
+	pk := peerKey{host: rm.Host, peer: rm.Peer}
+	origin, hasOrigin := rm.OriginASN()
+	b := c.bucket(ts)
+
+	var events []*FlapEvent
+	for _, prefix := range rm.Withdrawals {
+		b.prefixes[prefix]++
+		events = append(events, c.apply(peerPrefix{pk, prefix}, ts, true, 0)...)
+	}
+	for _, a := range rm.Announcements {
+		attrs := routeAttrs(rm, a)
+		for _, prefix := range a.Prefixes {
+			b.prefixes[prefix]++
+			if hasOrigin {
+				b.origins[origin]++
+			}
+			events = append(events, c.apply(peerPrefix{pk, prefix}, ts, false, attrs)...)
+		}
+	}
+	return events
+}
+
+// apply adds a single announcement, of the attributes, or withdrawal of pp to the
+// per peer and per prefix state.
+func (c *ChurnTracker) apply(pp peerPrefix, ts time.Time, withdrawal bool, attrs uint64) []*FlapEvent {
+	ps, ok := c.peers[pp]
+	if !ok {
+		ps = &ChurnState{Updated: ts}
+		c.peers[pp] = ps
+	}
+	xs, ok := c.prefixes[pp.prefix]
+	if !ok {
+		xs = &ChurnState{Updated: ts}
+		c.prefixes[pp.prefix] = xs
+	}
+
+	// The penalty depends on the peer's previous state for the route, the first
+	// announcement seen, and withdrawals of a route which is not announced, ie:
+	// duplicates, carry no penalty.
+	announced := ps.Announcements > 0 && !ps.withdrawn
+	var penalty float64
+	switch {
+	case withdrawal:
+		if announced {
+			penalty = c.cfg.WithdrawalPenalty
+		}
+	case ps.withdrawn:
+		penalty = c.cfg.ReadvertisePenalty
+	case announced && ps.attrs != attrs:
+		penalty = c.cfg.AttributeChangePenalty
+	}
+
+	var events []*FlapEvent
+	for _, s := range []struct {
+		state           *ChurnState
+		suppress, reuse float64
+		pk              peerKey
+	}{
+		{ps, c.cfg.Suppress, c.cfg.Reuse, pp.peerKey},
+		{xs, c.cfg.PrefixSuppress, c.cfg.PrefixReuse, peerKey{}},
+	} {
+		s.state.decay(ts, c.cfg.HalfLife)
+		s.state.Penalty += penalty
+		if withdrawal {
+			s.state.Withdrawals++
+		} else {
+			s.state.Announcements++
+		}
+		if e := transition(s.state, s.suppress, s.reuse, pp.prefix, s.pk, ts); e != nil {
+			events = append(events, e)
+		}
+	}
+	ps.withdrawn = withdrawal
+	if !withdrawal {
+		ps.attrs = attrs
+	}
+	return events
+}
+
+// transition updates the flapping state of s, returning an event if it changed.
+func transition(s *ChurnState, suppress, reuse float64, prefix string, pk peerKey, ts time.Time) *FlapEvent {
+	var kind FlapEventKind
+	switch {
+	case !s.Flapping && s.Penalty >= suppress:
+		kind = FlapStart
+	case s.Flapping && s.Penalty < reuse:
+		kind = FlapStop
+	default:
+		return nil
+	}
+	s.Flapping = kind == FlapStart
+	return &FlapEvent{
+		Kind:      kind,
+		Prefix:    prefix,
+		Collector: pk.host,
+		Peer:      pk.peer,
+		Penalty:   s.Penalty,
+		Time:      ts,
+	}
+}
+
+// Decay decays all penalties to their value at now, returning flap stop events for
+// routes which have decayed below the reuse threshold. Routes with no remaining
+// penalty are forgotten. Decay should be called periodically, as a flap stops
+// when updates stop arriving.
+func (c *ChurnTracker) Decay(now time.Time) []*FlapEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var events []*FlapEvent
+	for pp, s := range c.peers {
+		s.decay(now, c.cfg.HalfLife)
+		if e := transition(s, c.cfg.Suppress, c.cfg.Reuse, pp.prefix, pp.peerKey, now); e != nil {
+			events = append(events, e)
+		}
+		if !s.Flapping && s.Penalty < 1 {
+			delete(c.peers, pp)
+		}
+	}
+	for prefix, s := range c.prefixes {
+		s.decay(now, c.cfg.HalfLife)
+		if e := transition(s, c.cfg.PrefixSuppress, c.cfg.PrefixReuse, prefix, peerKey{}, now); e != nil {
+			events = append(events, e)
+		}
+		if !s.Flapping && s.Penalty < 1 {
+			delete(c.prefixes, prefix)
+		}
+	}
+	c.expire(now)
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Prefix != events[j].Prefix {
+			return events[i].Prefix < events[j].Prefix
+		}
+		return events[i].Peer < events[j].Peer
+	})
+	return events
+}
+
+// Prefix returns a copy of the per prefix churn state, or nil if the prefix is not tracked.
+func (c *ChurnTracker) Prefix(prefix string) *ChurnState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.prefixes[prefix]; ok {
+		cp := *s
+		return &cp
+	}
+	return nil
+}
+
+// Peer returns a copy of the churn state of a single peer's route to prefix.
+func (c *ChurnTracker) Peer(collector, peer, prefix string) *ChurnState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.peers[peerPrefix{peerKey{collector, peer}, prefix}]; ok {
+		cp := *s
+		return &cp
+	}
+	return nil
+}
+
+// bucket returns the window bucket for ts, creating it if required.
+func (c *ChurnTracker) bucket(ts time.Time) *churnBucket {
+	size := c.cfg.Window / time.Duration(c.cfg.Buckets)
+	start := ts.Truncate(size)
+	for i := len(c.buckets) - 1; i >= 0; i-- {
+		if c.buckets[i].start.Equal(start) {
+			return c.buckets[i]
+		}
+	}
+	b := &churnBucket{start: start, prefixes: map[string]int64{}, origins: map[int32]int64{}}
+	c.buckets = append(c.buckets, b)
+	sort.Slice(c.buckets, func(i, j int) bool { return c.buckets[i].start.Before(c.buckets[j].start) })
+	c.expire(ts)
+	return b
+}
+
+// expire removes buckets which have fallen out of the window ending at now.
+func (c *ChurnTracker) expire(now time.Time) {
+	cutoff := now.Add(-c.cfg.Window)
+	i := 0
+	for i < len(c.buckets) && !c.buckets[i].start.After(cutoff) {
+		i++
+	}
+	c.buckets = c.buckets[i:]
+}
+
+// TopPrefixes returns the n prefixes with the most updates in the sliding window.
+func (c *ChurnTracker) TopPrefixes(n int) []*ChurnCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sums := map[string]int64{}
+	for _, b := range c.buckets {
+		for p, count := range b.prefixes {
+			sums[p] += count
+		}
+	}
+	var result []*ChurnCount
+	for p, count := range sums {
+		result = append(result, &ChurnCount{Prefix: p, Count: count})
+	}
+	return topChurn(result, n)
+}
+
+// TopOrigins returns the n origin ASNs with the most announcements in the sliding window.
+func (c *ChurnTracker) TopOrigins(n int) []*ChurnCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sums := map[int32]int64{}
+	for _, b := range c.buckets {
+		for o, count := range b.origins {
+			sums[o] += count
+		}
+	}
+	var result []*ChurnCount
+	for o, count := range sums {
+		result = append(result, &ChurnCount{Origin: o, Count: count})
+	}
+	return topChurn(result, n)
+}
+
+// topChurn sorts counts, highest first, and truncates the result to n entries.
+func topChurn(counts []*ChurnCount, n int) []*ChurnCount {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		if counts[i].Prefix != counts[j].Prefix {
+			return counts[i].Prefix < counts[j].Prefix
+		}
+		return counts[i].Origin < counts[j].Origin
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// String returns the prefix, or origin ASN, and the count.
+func (c *ChurnCount) String() string {
+	if c.Prefix != "" {
+		return c.Prefix + ": " + strconv.FormatInt(c.Count, 10)
+	}
+	return "AS" + strconv.FormatUint(uint64(uint32(c.Origin)), 10) + ": " + strconv.FormatInt(c.Count, 10)
+}
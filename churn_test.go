@@ -0,0 +1,229 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestChurnTrackerUpdate(t *testing.T) {
+	cfg := &ChurnConfig{
+		WithdrawalPenalty:      1000,
+		AttributeChangePenalty: 500,
+		HalfLife:               time.Minute,
+		Suppress:               2000,
+		Reuse:                  750,
+		PrefixSuppress:         3000,
+		PrefixReuse:            1000,
+		Window:                 time.Hour,
+		Buckets:                60,
+	}
+	tests := []struct {
+		desc      string
+		msgs      []*RisMessageData
+		decay     time.Time
+		want      []*FlapEvent
+		peerState bool // Compare the rrc00/1.1.1.1 route state, rather than the prefix state.
+		wantState *ChurnState
+	}{{
+		desc: "Success - a single announcement has no penalty",
+		msgs: []*RisMessageData{
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+		},
+		wantState: &ChurnState{Announcements: 1, Updated: time.Unix(0, 0)},
+	}, {
+		desc: "Success - peer flap starts",
+		msgs: []*RisMessageData{
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			withdraw(0, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			withdraw(0, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+		},
+		want: []*FlapEvent{
+			{Kind: FlapStart, Prefix: "192.0.2.0/24", Collector: "rrc00", Peer: "1.1.1.1", Penalty: 2000, Time: time.Unix(0, 0)},
+		},
+		peerState: true,
+		wantState: &ChurnState{Announcements: 2, Withdrawals: 2, Penalty: 2000, Updated: time.Unix(0, 0), Flapping: true},
+	}, {
+		desc: "Success - prefix flap starts across peers",
+		msgs: []*RisMessageData{
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			announce(0, "rrc00", "2.2.2.2", []interface{}{2, 100}, "192.0.2.0/24"),
+			announce(0, "rrc01", "3.3.3.3", []interface{}{3, 100}, "192.0.2.0/24"),
+			withdraw(0, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+			withdraw(0, "rrc00", "2.2.2.2", "192.0.2.0/24"),
+			withdraw(0, "rrc01", "3.3.3.3", "192.0.2.0/24"),
+		},
+		want: []*FlapEvent{
+			{Kind: FlapStart, Prefix: "192.0.2.0/24", Penalty: 3000, Time: time.Unix(0, 0)},
+		},
+		wantState: &ChurnState{Announcements: 3, Withdrawals: 3, Penalty: 3000, Updated: time.Unix(0, 0), Flapping: true},
+	}, {
+		desc: "Success - withdrawals of a route which is not announced have no penalty",
+		msgs: []*RisMessageData{
+			withdraw(0, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			withdraw(0, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+			withdraw(0, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+			withdraw(0, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+		},
+		peerState: true,
+		wantState: &ChurnState{Announcements: 1, Withdrawals: 4, Penalty: 1000, Updated: time.Unix(0, 0)},
+	}, {
+		desc: "Success - only attribute changes of an announced route have a penalty",
+		msgs: []*RisMessageData{
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 2, 100}, "192.0.2.0/24"),
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 2, 100}, "192.0.2.0/24"),
+			func() *RisMessageData {
+				rm := announce(0, "rrc00", "1.1.1.1", []interface{}{1, 2, 100}, "192.0.2.0/24")
+				rm.Community = [][]int32{{1, 666}}
+				return rm
+			}(),
+		},
+		peerState: true,
+		wantState: &ChurnState{Announcements: 5, Penalty: 1000, Updated: time.Unix(0, 0)},
+	}, {
+		desc: "Success - flap stops after decay",
+		msgs: []*RisMessageData{
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			withdraw(0, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			withdraw(0, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+		},
+		decay: time.Unix(120, 0),
+		want: []*FlapEvent{
+			{Kind: FlapStart, Prefix: "192.0.2.0/24", Collector: "rrc00", Peer: "1.1.1.1", Penalty: 2000, Time: time.Unix(0, 0)},
+			{Kind: FlapStop, Prefix: "192.0.2.0/24", Collector: "rrc00", Peer: "1.1.1.1", Penalty: 500, Time: time.Unix(120, 0)},
+		},
+		peerState: true,
+		wantState: &ChurnState{Announcements: 2, Withdrawals: 2, Penalty: 500, Updated: time.Unix(120, 0)},
+	}}
+
+	for _, test := range tests {
+		c, err := NewChurnTracker(cfg)
+		if err != nil {
+			t.Fatalf("[%v]: failed to create tracker: %v", test.desc, err)
+		}
+		var got []*FlapEvent
+		for _, rm := range test.msgs {
+			got = append(got, c.Update(rm)...)
+		}
+		if !test.decay.IsZero() {
+			got = append(got, c.Decay(test.decay)...)
+		}
+		if diff := cmp.Diff(got, test.want, cmpopts.EquateApprox(0, 0.001)); diff != "" {
+			t.Errorf("[%v]: got/want events mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+		if test.wantState == nil {
+			continue
+		}
+		state := c.Prefix("192.0.2.0/24")
+		if test.peerState {
+			state = c.Peer("rrc00", "1.1.1.1", "192.0.2.0/24")
+		}
+		if diff := cmp.Diff(state, test.wantState, cmpopts.IgnoreUnexported(ChurnState{}), cmpopts.EquateApprox(0, 0.001)); diff != "" {
+			t.Errorf("[%v]: got/want state mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestChurnTrackerTop(t *testing.T) {
+	c, err := NewChurnTracker(&ChurnConfig{Window: 10 * time.Minute, Buckets: 10, HalfLife: time.Minute})
+	if err != nil {
+		t.Fatalf("failed to create tracker: %v", err)
+	}
+	// Outside the window by the time of the last message.
+	c.Update(announce(0, "rrc00", "1.1.1.1", []interface{}{1, 300}, "203.0.113.0/24"))
+	c.Update(announce(0, "rrc00", "1.1.1.1", []interface{}{1, 300}, "203.0.113.0/24"))
+	c.Update(announce(0, "rrc00", "1.1.1.1", []interface{}{1, 300}, "203.0.113.0/24"))
+	// Inside the window.
+	c.Update(announce(900, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"))
+	c.Update(announce(901, "rrc00", "2.2.2.2", []interface{}{1, 100}, "192.0.2.0/24"))
+	c.Update(announce(960, "rrc00", "1.1.1.1", []interface{}{1, 200}, "198.51.100.0/24"))
+	c.Update(withdraw(961, "rrc00", "1.1.1.1", "192.0.2.0/24"))
+
+	wantPrefixes := []*ChurnCount{{Prefix: "192.0.2.0/24", Count: 3}}
+	if diff := cmp.Diff(c.TopPrefixes(1), wantPrefixes); diff != "" {
+		t.Errorf("TopPrefixes() got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	wantOrigins := []*ChurnCount{{Origin: 100, Count: 2}, {Origin: 200, Count: 1}}
+	if diff := cmp.Diff(c.TopOrigins(5), wantOrigins); diff != "" {
+		t.Errorf("TopOrigins() got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+func TestNewChurnTrackerFailure(t *testing.T) {
+	tests := []struct {
+		desc string
+		cfg  *ChurnConfig
+	}{{
+		desc: "Failure - no buckets",
+		cfg:  &ChurnConfig{Window: time.Hour},
+	}, {
+		desc: "Failure - no window",
+		cfg:  &ChurnConfig{Buckets: 60},
+	}, {
+		desc: "Failure - negative half-life",
+		cfg:  &ChurnConfig{Window: time.Hour, Buckets: 60, HalfLife: -time.Minute},
+	}, {
+		desc: "Failure - reuse above suppress",
+		cfg:  &ChurnConfig{Window: time.Hour, Buckets: 60, Suppress: 750, Reuse: 2000},
+	}}
+	for _, test := range tests {
+		if _, err := NewChurnTracker(test.cfg); err == nil {
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		}
+	}
+}
+
+func TestRouteAttrs(t *testing.T) {
+	base := &RisMessageData{
+		DigestedPath: []int32{1, 2, 3},
+		Community:    [][]int32{{1, 2}, {3, 4}},
+		Origin:       "igp",
+	}
+	a := &RisAnnouncement{NextHop: "192.0.2.1"}
+	tests := []struct {
+		desc     string
+		rm       *RisMessageData
+		nextHop  string
+		wantSame bool
+	}{{
+		desc:     "Success - same attributes",
+		rm:       &RisMessageData{DigestedPath: []int32{1, 2, 3}, Community: [][]int32{{1, 2}, {3, 4}}, Origin: "igp"},
+		nextHop:  "192.0.2.1",
+		wantSame: true,
+	}, {
+		desc:    "Success - path changed",
+		rm:      &RisMessageData{DigestedPath: []int32{1, 4, 3}, Community: [][]int32{{1, 2}, {3, 4}}, Origin: "igp"},
+		nextHop: "192.0.2.1",
+	}, {
+		desc:    "Success - AS_SET added",
+		rm:      &RisMessageData{DigestedPath: []int32{1, 2, 3}, PathSets: []PathSet{{2, 3}}, Community: [][]int32{{1, 2}, {3, 4}}, Origin: "igp"},
+		nextHop: "192.0.2.1",
+	}, {
+		desc:    "Success - communities regrouped",
+		rm:      &RisMessageData{DigestedPath: []int32{1, 2, 3}, Community: [][]int32{{1}, {2, 3, 4}}, Origin: "igp"},
+		nextHop: "192.0.2.1",
+	}, {
+		desc:    "Success - origin changed",
+		rm:      &RisMessageData{DigestedPath: []int32{1, 2, 3}, Community: [][]int32{{1, 2}, {3, 4}}, Origin: "egp"},
+		nextHop: "192.0.2.1",
+	}, {
+		desc:    "Success - next hop changed",
+		rm:      &RisMessageData{DigestedPath: []int32{1, 2, 3}, Community: [][]int32{{1, 2}, {3, 4}}, Origin: "igp"},
+		nextHop: "192.0.2.2",
+	}}
+
+	want := routeAttrs(base, a)
+	for _, test := range tests {
+		got := routeAttrs(test.rm, &RisAnnouncement{NextHop: test.nextHop})
+		if (got == want) != test.wantSame {
+			t.Errorf("[%v]: got hash %x for %x, want same: %v", test.desc, got, want, test.wantSame)
+		}
+	}
+}
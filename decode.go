@@ -0,0 +1,711 @@
+// A JSON decoder specialized for RIS Live messages. Compared to encoding/json
+// followed by digestPath it parses the AS path directly into the DigestedPath
+// and its PathSets, interns the strings which repeat between messages (hosts,
+// peers, prefixes), and reuses the slices of the message it decodes into, so
+// that decoding into a pooled message allocates little more than its id and
+// raw strings.
+//
+// Pooled messages are reference counted: each holder of one, ie: the broker and
+// each subscriber it is delivered to, releases it once done, and the last
+// returns it to the pool. A holder which keeps any of its slices copies them.
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Interner returns a single copy of each string, up to a maximum number of strings.
+type Interner struct {
+	mu  sync.RWMutex
+	m   map[string]string
+	max int
+}
+
+// NewInterner creates an Interner which holds at most max strings.
+func NewInterner(max int) *Interner {
+	return &Interner{m: map[string]string{}, max: max}
+}
+
+// Intern returns the string of b, allocating it only if it has not been seen.
+func (in *Interner) Intern(b []byte) string {
+	in.mu.RLock()
+	s, ok := in.m[string(b)]
+	in.mu.RUnlock()
+	if ok {
+		return s
+	}
+	s = string(b)
+	in.mu.Lock()
+	if len(in.m) < in.max {
+		in.m[s] = s
+	}
+	in.mu.Unlock()
+	return s
+}
+
+// Len returns the number of interned strings.
+func (in *Interner) Len() int {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return len(in.m)
+}
+
+// pooledData is the data of a pooled message, with the count of its holders.
+type pooledData struct {
+	RisMessageData
+	refs int32
+}
+
+var risDataPool = sync.Pool{New: func() interface{} { return &pooledData{} }}
+
+// GetRisMessage returns a message whose data is taken from the pool, held once,
+// by the caller. The slices of the data are reused by RisDecoder.Decode.
+func GetRisMessage() RisMessage {
+	p := risDataPool.Get().(*pooledData)
+	p.refs = 1
+	return RisMessage{Data: &p.RisMessageData, pool: p}
+}
+
+// Retain adds a holder of a pooled message, which must release it. Messages
+// not taken from the pool are unaffected.
+func (m RisMessage) Retain() {
+	if m.pool != nil {
+		atomic.AddInt32(&m.pool.refs, 1)
+	}
+}
+
+// Release drops a holder of a pooled message. The last returns it to the pool,
+// after which neither its data nor their slices may be used.
+func (m RisMessage) Release() {
+	if m.pool != nil && atomic.AddInt32(&m.pool.refs, -1) == 0 {
+		risDataPool.Put(m.pool)
+	}
+}
+
+// clonePath returns a copy of a path, for a holder which keeps it beyond its
+// message, whose slices are reused once it is pooled.
+func clonePath(p []int32) []int32 {
+	if p == nil {
+		return nil
+	}
+	return append([]int32{}, p...)
+}
+
+// cloneCommunity returns a copy of communities, as clonePath does of a path.
+func cloneCommunity(c [][]int32) [][]int32 {
+	if c == nil {
+		return nil
+	}
+	result := make([][]int32, len(c))
+	for i, pair := range c {
+		result[i] = clonePath(pair)
+	}
+	return result
+}
+
+// RisDecoder decodes RIS Live messages.
+type RisDecoder struct {
+	Intern  *Interner // If nil, strings are not interned.
+	SkipRaw bool      // Do not decode the raw BGP message, which is unique to each message.
+}
+
+// NewRisDecoder creates a RisDecoder which interns up to 1M strings.
+func NewRisDecoder() *RisDecoder {
+	return &RisDecoder{Intern: NewInterner(1 << 20)}
+}
+
+// Decode decodes a message into rm. If rm.Data is set it, and its slices, are
+// reused, so it must not be in use elsewhere, ie: it is of GetRisMessage. Path
+// is not set: DigestedPath and PathSets are, as digestPath sets them, with ASNs
+// of 2^31 and above kept as their uint32 bits.
+func (d *RisDecoder) Decode(raw []byte, rm *RisMessage) error {
+	s := scanner{b: raw}
+	rm.Type = ""
+	if err := s.expect('{'); err != nil {
+		return err
+	}
+	seenData := false
+	for first := true; ; first = false {
+		more, err := s.next('}', first)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		key, err := s.key()
+		if err != nil {
+			return err
+		}
+		switch string(key) {
+		case "type":
+			rm.Type, err = d.str(&s, true)
+		case "data":
+			seenData = true
+			if s.null() {
+				rm.Data = nil
+				break
+			}
+			if rm.Data == nil {
+				rm.Data = &RisMessageData{}
+			}
+			err = d.data(&s, rm.Data)
+		default:
+			err = s.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !seenData {
+		rm.Data = nil
+	}
+	s.ws()
+	if s.i != len(s.b) {
+		return s.errorf("unexpected data after message")
+	}
+	return nil
+}
+
+// data decodes the data object of a message, reusing the slices of m.
+func (d *RisDecoder) data(s *scanner, m *RisMessageData) error {
+	*m = RisMessageData{
+		DigestedPath:  m.DigestedPath[:0],
+		PathSets:      m.PathSets[:0],
+		Community:     m.Community[:0],
+		Announcements: m.Announcements[:0],
+		Withdrawals:   m.Withdrawals[:0],
+	}
+	if err := s.expect('{'); err != nil {
+		return err
+	}
+	for first := true; ; first = false {
+		more, err := s.next('}', first)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+		key, err := s.key()
+		if err != nil {
+			return err
+		}
+		switch string(key) {
+		case "timestamp":
+			m.Timestamp, err = s.float()
+		case "peer":
+			m.Peer, err = d.str(s, true)
+		case "peer_asn":
+			m.PeerASN, err = d.str(s, true)
+		case "id":
+			m.ID, err = d.str(s, false)
+		case "host":
+			m.Host, err = d.str(s, true)
+		case "type":
+			m.Type, err = d.str(s, true)
+		case "origin":
+			m.Origin, err = d.str(s, true)
+		case "state":
+			m.State, err = d.str(s, true)
+		case "raw":
+			if d.SkipRaw {
+				err = s.skip()
+			} else {
+				m.Raw, err = d.str(s, false)
+			}
+		case "path":
+			m.DigestedPath, m.PathSets, err = s.path(m.DigestedPath, m.PathSets)
+		case "community":
+			m.Community, err = s.community(m.Community)
+		case "announcements":
+			m.Announcements, err = d.announcements(s, m.Announcements)
+		case "withdrawals":
+			m.Withdrawals, err = d.strs(s, m.Withdrawals)
+		default:
+			err = s.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// announcements decodes a list of announcements, reusing those of anns.
+func (d *RisDecoder) announcements(s *scanner, anns []*RisAnnouncement) ([]*RisAnnouncement, error) {
+	if s.null() {
+		return anns, nil
+	}
+	if err := s.expect('['); err != nil {
+		return anns, err
+	}
+	for first := true; ; first = false {
+		more, err := s.next(']', first)
+		if err != nil || !more {
+			return anns, err
+		}
+		var a *RisAnnouncement
+		if n := len(anns); n < cap(anns) && anns[:n+1][n] != nil {
+			a = anns[:n+1][n]
+			*a = RisAnnouncement{Prefixes: a.Prefixes[:0]}
+		} else {
+			a = &RisAnnouncement{}
+		}
+		anns = append(anns, a)
+		if err := s.expect('{'); err != nil {
+			return anns, err
+		}
+		for first := true; ; first = false {
+			more, err := s.next('}', first)
+			if err != nil {
+				return anns, err
+			}
+			if !more {
+				break
+			}
+			key, err := s.key()
+			if err != nil {
+				return anns, err
+			}
+			switch string(key) {
+			case "next_hop":
+				a.NextHop, err = d.str(s, true)
+			case "prefixes":
+				a.Prefixes, err = d.strs(s, a.Prefixes)
+			default:
+				err = s.skip()
+			}
+			if err != nil {
+				return anns, err
+			}
+		}
+	}
+}
+
+// strs decodes a list of interned strings, appending to l.
+func (d *RisDecoder) strs(s *scanner, l []string) ([]string, error) {
+	if s.null() {
+		return l, nil
+	}
+	if err := s.expect('['); err != nil {
+		return l, err
+	}
+	for first := true; ; first = false {
+		more, err := s.next(']', first)
+		if err != nil || !more {
+			return l, err
+		}
+		v, err := d.str(s, true)
+		if err != nil {
+			return l, err
+		}
+		l = append(l, v)
+	}
+}
+
+// str decodes a string, interning it if intern is true and there is an Interner.
+func (d *RisDecoder) str(s *scanner, intern bool) (string, error) {
+	if s.null() {
+		return "", nil
+	}
+	b, err := s.str()
+	if err != nil {
+		return "", err
+	}
+	if intern && d.Intern != nil {
+		return d.Intern.Intern(b), nil
+	}
+	return string(b), nil
+}
+
+// scanner reads JSON values from a buffer.
+type scanner struct {
+	b   []byte
+	i   int
+	buf []byte // Holds unescaped strings.
+}
+
+func (s *scanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("failed to decode message at offset %d: %v", s.i, fmt.Sprintf(format, args...))
+}
+
+// ws skips whitespace.
+func (s *scanner) ws() {
+	for s.i < len(s.b) {
+		switch s.b[s.i] {
+		case ' ', '\t', '\n', '\r':
+			s.i++
+		default:
+			return
+		}
+	}
+}
+
+// expect consumes the byte c, after any whitespace.
+func (s *scanner) expect(c byte) error {
+	s.ws()
+	if s.i >= len(s.b) {
+		return s.errorf("unexpected end of message, want %q", c)
+	}
+	if s.b[s.i] != c {
+		return s.errorf("got %q, want %q", s.b[s.i], c)
+	}
+	s.i++
+	return nil
+}
+
+// null consumes a null value, if there is one.
+func (s *scanner) null() bool {
+	s.ws()
+	if len(s.b)-s.i >= 4 && string(s.b[s.i:s.i+4]) == "null" {
+		s.i += 4
+		return true
+	}
+	return false
+}
+
+// next reports whether another element follows in an object or array,
+// consuming the separating comma, or the closing end.
+func (s *scanner) next(end byte, first bool) (bool, error) {
+	s.ws()
+	if s.i >= len(s.b) {
+		return false, s.errorf("unexpected end of message, want %q", end)
+	}
+	if s.b[s.i] == end {
+		s.i++
+		return false, nil
+	}
+	if !first {
+		if err := s.expect(','); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// key reads an object key and the following colon.
+func (s *scanner) key() ([]byte, error) {
+	k, err := s.str()
+	if err != nil {
+		return nil, err
+	}
+	return k, s.expect(':')
+}
+
+// str reads a string, returning its unescaped bytes. The bytes are only valid
+// until the next call to str.
+func (s *scanner) str() ([]byte, error) {
+	if err := s.expect('"'); err != nil {
+		return nil, err
+	}
+	start := s.i
+	for s.i < len(s.b) {
+		switch c := s.b[s.i]; {
+		case c == '"':
+			s.i++
+			return s.b[start : s.i-1], nil
+		case c == '\\':
+			return s.unescape(start)
+		case c < 0x20:
+			return nil, s.errorf("control character in string")
+		}
+		s.i++
+	}
+	return nil, s.errorf("unterminated string")
+}
+
+// unescape reads the rest of a string containing escapes, which started at start.
+func (s *scanner) unescape(start int) ([]byte, error) {
+	s.buf = append(s.buf[:0], s.b[start:s.i]...)
+	for s.i < len(s.b) {
+		c := s.b[s.i]
+		switch {
+		case c == '"':
+			s.i++
+			return s.buf, nil
+		case c < 0x20:
+			return nil, s.errorf("control character in string")
+		case c != '\\':
+			s.buf = append(s.buf, c)
+			s.i++
+			continue
+		}
+		if s.i+1 >= len(s.b) {
+			return nil, s.errorf("unterminated string")
+		}
+		e := s.b[s.i+1]
+		s.i += 2
+		switch e {
+		case '"', '\\', '/':
+			s.buf = append(s.buf, e)
+		case 'b':
+			s.buf = append(s.buf, '\b')
+		case 'f':
+			s.buf = append(s.buf, '\f')
+		case 'n':
+			s.buf = append(s.buf, '\n')
+		case 'r':
+			s.buf = append(s.buf, '\r')
+		case 't':
+			s.buf = append(s.buf, '\t')
+		case 'u':
+			r, ok := s.hex4()
+			if !ok {
+				return nil, s.errorf("invalid unicode escape")
+			}
+			if utf16.IsSurrogate(r) {
+				r2 := utf8.RuneError
+				if len(s.b)-s.i >= 2 && s.b[s.i] == '\\' && s.b[s.i+1] == 'u' {
+					s.i += 2
+					if lo, ok := s.hex4(); ok {
+						r2 = lo
+					}
+				}
+				r = utf16.DecodeRune(r, r2)
+			}
+			var enc [utf8.UTFMax]byte
+			s.buf = append(s.buf, enc[:utf8.EncodeRune(enc[:], r)]...)
+		default:
+			return nil, s.errorf("invalid escape %q", e)
+		}
+	}
+	return nil, s.errorf("unterminated string")
+}
+
+// hex4 reads the 4 hex digits of a unicode escape.
+func (s *scanner) hex4() (rune, bool) {
+	if len(s.b)-s.i < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range s.b[s.i : s.i+4] {
+		switch {
+		case c >= '0' && c <= '9':
+			r = r<<4 | rune(c-'0')
+		case c >= 'a' && c <= 'f':
+			r = r<<4 | rune(c-'a'+10)
+		case c >= 'A' && c <= 'F':
+			r = r<<4 | rune(c-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+	s.i += 4
+	return r, true
+}
+
+// number returns the bytes of a number.
+func (s *scanner) number() ([]byte, error) {
+	s.ws()
+	start := s.i
+	for s.i < len(s.b) {
+		c := s.b[s.i]
+		if (c < '0' || c > '9') && c != '-' && c != '+' && c != '.' && c != 'e' && c != 'E' {
+			break
+		}
+		s.i++
+	}
+	if s.i == start {
+		return nil, s.errorf("expected a number")
+	}
+	return s.b[start:s.i], nil
+}
+
+// pow10 are the powers of ten exactly representable as a float64.
+var pow10 = [...]float64{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10,
+	1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22}
+
+// float reads a number as a float64. Plain decimals of up to 15 digits, such as
+// timestamps, are converted exactly without allocating: both the digits and the
+// power of ten are exact float64 values, so their quotient is correctly rounded.
+func (s *scanner) float() (float64, error) {
+	b, err := s.number()
+	if err != nil {
+		return 0, err
+	}
+	var mant uint64
+	digits, frac, neg, dot := 0, 0, false, false
+	for i, c := range b {
+		switch {
+		case c == '-' && i == 0:
+			neg = true
+		case c == '.' && !dot:
+			dot = true
+		case c >= '0' && c <= '9' && digits < 15:
+			mant = mant*10 + uint64(c-'0')
+			digits++
+			if dot {
+				frac++
+			}
+		default:
+			// Exponents and long numbers take the slow path.
+			f, err := strconv.ParseFloat(string(b), 64)
+			if err != nil {
+				return 0, s.errorf("invalid number %q", b)
+			}
+			return f, nil
+		}
+	}
+	if digits == 0 {
+		return 0, s.errorf("invalid number %q", b)
+	}
+	f := float64(mant) / pow10[frac]
+	if neg {
+		f = -f
+	}
+	return f, nil
+}
+
+// asn reads an ASN, an unsigned 32 bit integer. ASNs above 2^31 keep their bits
+// in the int32, as elsewhere uint32(asn) recovers them.
+func (s *scanner) asn() (int32, error) {
+	b, err := s.number()
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			// Tolerate ASNs written as floats, ie: 64500.0.
+			f, err := strconv.ParseFloat(string(b), 64)
+			if err != nil || f < 0 || f > math.MaxUint32 || f != math.Trunc(f) {
+				return 0, s.errorf("invalid ASN %q", b)
+			}
+			return int32(uint32(f)), nil
+		}
+		if v = v*10 + uint64(c-'0'); v > math.MaxUint32 {
+			return 0, s.errorf("ASN out of range %q", b)
+		}
+	}
+	return int32(uint32(v)), nil
+}
+
+// path reads an AS path of ASNs and AS_SETs, appending its ASNs to p and its
+// AS_SETs to sets.
+func (s *scanner) path(p []int32, sets []PathSet) ([]int32, []PathSet, error) {
+	if s.null() {
+		return p, sets, nil
+	}
+	if err := s.expect('['); err != nil {
+		return p, sets, err
+	}
+	for first := true; ; first = false {
+		more, err := s.next(']', first)
+		if err != nil || !more {
+			return p, sets, err
+		}
+		s.ws()
+		if s.i < len(s.b) && s.b[s.i] == '[' {
+			s.i++
+			start := len(p)
+			for first := true; ; first = false {
+				more, err := s.next(']', first)
+				if err != nil {
+					return p, sets, err
+				}
+				if !more {
+					break
+				}
+				asn, err := s.asn()
+				if err != nil {
+					return p, sets, err
+				}
+				p = append(p, asn)
+			}
+			sets = append(sets, PathSet{Start: start, End: len(p)})
+			continue
+		}
+		asn, err := s.asn()
+		if err != nil {
+			return p, sets, err
+		}
+		p = append(p, asn)
+	}
+}
+
+// community reads a list of [asn, value] communities, reusing the pairs of c.
+func (s *scanner) community(c [][]int32) ([][]int32, error) {
+	if s.null() {
+		return c, nil
+	}
+	if err := s.expect('['); err != nil {
+		return c, err
+	}
+	for first := true; ; first = false {
+		more, err := s.next(']', first)
+		if err != nil || !more {
+			return c, err
+		}
+		var pair []int32
+		if n := len(c); n < cap(c) {
+			pair = c[:n+1][n][:0]
+		}
+		if err := s.expect('['); err != nil {
+			return c, err
+		}
+		for first := true; ; first = false {
+			more, err := s.next(']', first)
+			if err != nil {
+				return c, err
+			}
+			if !more {
+				break
+			}
+			v, err := s.asn()
+			if err != nil {
+				return c, err
+			}
+			pair = append(pair, v)
+		}
+		c = append(c, pair)
+	}
+}
+
+// skip skips a value of any type.
+func (s *scanner) skip() error {
+	s.ws()
+	if s.i >= len(s.b) {
+		return s.errorf("unexpected end of message")
+	}
+	switch c := s.b[s.i]; c {
+	case '"':
+		_, err := s.str()
+		return err
+	case '{', '[':
+		end := byte('}')
+		if c == '[' {
+			end = ']'
+		}
+		s.i++
+		for first := true; ; first = false {
+			more, err := s.next(end, first)
+			if err != nil || !more {
+				return err
+			}
+			if end == '}' {
+				if _, err := s.key(); err != nil {
+					return err
+				}
+			}
+			if err := s.skip(); err != nil {
+				return err
+			}
+		}
+	case 't', 'f', 'n':
+		for _, lit := range []string{"true", "false", "null"} {
+			if len(s.b)-s.i >= len(lit) && string(s.b[s.i:s.i+len(lit)]) == lit {
+				s.i += len(lit)
+				return nil
+			}
+		}
+		return s.errorf("invalid literal")
+	}
+	_, err := s.number()
+	return err
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// jsonDecode decodes a message as Listen does without a RisDecoder, returning
+// the message without its Path, which a RisDecoder does not set, and the Path.
+func jsonDecode(raw []byte) (RisMessage, []interface{}, error) {
+	var rm RisMessage
+	if err := json.Unmarshal(raw, &rm); err != nil {
+		return rm, nil, err
+	}
+	var path []interface{}
+	if rm.Data != nil {
+		digestPath(rm.Data)
+		path, rm.Data.Path = rm.Data.Path, nil
+	}
+	return rm, path, nil
+}
+
+func TestRisDecoderMatchesJSON(t *testing.T) {
+	d := NewRisDecoder()
+	var reused RisMessage
+	for _, file := range []string{"testdata/1k-msgs", "testdata/fail-as-set"} {
+		for i, l := range readLines(t, file) {
+			want, path, err := jsonDecode(l)
+			if err != nil {
+				t.Fatalf("[%v:%d]: failed to decode with encoding/json: %v", file, i, err)
+			}
+			// Decoding into a fresh and a reused message gives the same result.
+			var fresh RisMessage
+			if err := d.Decode(l, &fresh); err != nil {
+				t.Errorf("[%v:%d]: got error when not expecting one: %v", file, i, err)
+				continue
+			}
+			if err := d.Decode(l, &reused); err != nil {
+				t.Errorf("[%v:%d]: got error when not expecting one: %v", file, i, err)
+				continue
+			}
+			for _, got := range []RisMessage{fresh, reused} {
+				if diff := cmp.Diff(got, want, cmpopts.EquateEmpty(), cmpopts.IgnoreUnexported(RisMessage{})); diff != "" {
+					t.Errorf("[%v:%d]: got/want mismatch diff(-got, +want):\n%v\n", file, i, diff)
+				}
+				if got.Data == nil {
+					continue
+				}
+				if diff := cmp.Diff(got.Data.ASPath(), path, cmpopts.EquateEmpty()); diff != "" {
+					t.Errorf("[%v:%d]: ASPath got/want mismatch diff(-got, +want):\n%v\n", file, i, diff)
+				}
+			}
+		}
+	}
+	if d.Intern.Len() == 0 {
+		t.Errorf("no strings were interned")
+	}
+}
+
+func TestRisDecoder(t *testing.T) {
+	tests := []struct {
+		desc    string
+		raw     string
+		skipRaw bool
+		want    RisMessage
+		wantErr bool
+	}{{
+		desc: "Success - pong without data",
+		raw:  `{"type":"pong","data":null}`,
+		want: RisMessage{Type: "pong"},
+	}, {
+		desc: "Success - unknown fields skipped",
+		raw: `{"type":"ris_message","extra":{"a":[1,2.5e3,"x",true,false,null,{"b":{}}]},
+			"data":{"timestamp":1.5e9,"med":10,"aggregator":"1:2.3.4.5","host":"rrc00","path":[1,[2,3],4294967295]}}`,
+		want: RisMessage{Type: "ris_message", Data: &RisMessageData{
+			Timestamp:    1.5e9,
+			Host:         "rrc00",
+			DigestedPath: []int32{1, 2, 3, int32(-1)},
+			PathSets:     []PathSet{{1, 3}},
+		}},
+	}, {
+		desc: "Success - escaped strings",
+		raw:  `{"type":"ris_error","data":{"id":"a\"b\\c\/dé😀\n"}}`,
+		want: RisMessage{Type: "ris_error", Data: &RisMessageData{ID: "a\"b\\c/dé😀\n"}},
+	}, {
+		desc: "Success - peer state",
+		raw:  `{"type":"ris_message","data":{"timestamp":1.5e9,"peer":"192.0.2.1","host":"rrc00","type":"RIS_PEER_STATE","state":"down"}}`,
+		want: RisMessage{Type: "ris_message", Data: &RisMessageData{
+			Timestamp: 1.5e9,
+			Peer:      "192.0.2.1",
+			Host:      "rrc00",
+			Type:      "RIS_PEER_STATE",
+			State:     "down",
+		}},
+	}, {
+		desc:    "Success - raw skipped",
+		raw:     `{"type":"ris_message","data":{"raw":"FFFF","withdrawals":["192.0.2.0/24"],"community":[[1,2]]}}`,
+		skipRaw: true,
+		want: RisMessage{Type: "ris_message", Data: &RisMessageData{
+			Withdrawals: []string{"192.0.2.0/24"},
+			Community:   [][]int32{{1, 2}},
+		}},
+	}, {
+		desc:    "Failure - truncated",
+		raw:     `{"type":"ris_message","data":{"peer":"192.0.2.1"`,
+		wantErr: true,
+	}, {
+		desc:    "Failure - bad ASN",
+		raw:     `{"type":"ris_message","data":{"path":[1,"two"]}}`,
+		wantErr: true,
+	}, {
+		desc:    "Failure - ASN out of range",
+		raw:     `{"type":"ris_message","data":{"path":[4294967296]}}`,
+		wantErr: true,
+	}, {
+		desc:    "Failure - trailing data",
+		raw:     `{"type":"pong"} {}`,
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		d := &RisDecoder{SkipRaw: test.skipRaw}
+		var got RisMessage
+		err := d.Decode([]byte(test.raw), &got)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if diff := cmp.Diff(got, test.want, cmpopts.EquateEmpty(), cmpopts.IgnoreUnexported(RisMessage{})); diff != "" {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+		}
+	}
+}
+
+func TestRisDecoderReuse(t *testing.T) {
+	d := NewRisDecoder()
+	rm := RisMessage{Data: &RisMessageData{}}
+	first := `{"type":"ris_message","data":{"peer":"192.0.2.1","path":[1,2,3],"announcements":[{"next_hop":"192.0.2.1","prefixes":["198.51.100.0/24","203.0.113.0/24"]}]}}`
+	second := `{"type":"ris_message","data":{"host":"rrc01","announcements":[{"prefixes":["192.0.2.0/24"]}]}}`
+	for _, raw := range []string{first, second} {
+		if err := d.Decode([]byte(raw), &rm); err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+	}
+	want := &RisMessageData{
+		Host:          "rrc01",
+		Announcements: []*RisAnnouncement{{Prefixes: []string{"192.0.2.0/24"}}},
+	}
+	if diff := cmp.Diff(rm.Data, want, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("fields of the previous message remain, diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+// BenchmarkDecodeJSON decodes testdata/1k-msgs with encoding/json and digestPath.
+func BenchmarkDecodeJSON(b *testing.B) {
+	lines := readLines(b, "testdata/1k-msgs")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, l := range lines {
+			var rm RisMessage
+			json.Unmarshal(l, &rm)
+			digestPath(rm.Data)
+		}
+	}
+}
+
+// BenchmarkRisDecoder decodes testdata/1k-msgs with the RisDecoder: into new
+// messages, into pooled messages as the DecodePipeline does, and into a single
+// reused message without the raw BGP message.
+func BenchmarkRisDecoder(b *testing.B) {
+	lines := readLines(b, "testdata/1k-msgs")
+	b.Run("new", func(b *testing.B) {
+		d := NewRisDecoder()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, l := range lines {
+				rm := RisMessage{Data: &RisMessageData{}}
+				d.Decode(l, &rm)
+			}
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		d := NewRisDecoder()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, l := range lines {
+				rm := GetRisMessage()
+				d.Decode(l, &rm)
+				rm.Release()
+			}
+		}
+	})
+	b.Run("reused-skipraw", func(b *testing.B) {
+		d := NewRisDecoder()
+		d.SkipRaw = true
+		var rm RisMessage
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, l := range lines {
+				d.Decode(l, &rm)
+			}
+		}
+	})
+}
+
+func TestRisMessageRelease(t *testing.T) {
+	rm := GetRisMessage()
+	held := rm
+	held.Retain()
+	rm.Release()
+	if got := atomic.LoadInt32(&rm.pool.refs); got != 1 {
+		t.Errorf("got %d holders after a release, want 1", got)
+	}
+	held.Release()
+	if got := atomic.LoadInt32(&rm.pool.refs); got != 0 {
+		t.Errorf("got %d holders after the last release, want 0", got)
+	}
+
+	// Messages not taken from the pool are unaffected.
+	unpooled := RisMessage{Data: &RisMessageData{}}
+	unpooled.Retain()
+	unpooled.Release()
+	unpooled.Release()
+}
@@ -0,0 +1,321 @@
+// Detector adapters, which turn the events of each tracker into Alerts for the AlertPipeline.
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// FilterDetector alerts on every message which matches the RisLive filter.
+type FilterDetector struct {
+	R *RisLive
+}
+
+func (d *FilterDetector) Name() string { return "filter" }
+
+func (d *FilterDetector) Detect(rm *RisMessageData) []*Alert {
+	if !d.R.Match(rm) {
+		return nil
+	}
+	origin, _ := rm.OriginASN()
+	var result []*Alert
+	for _, a := range rm.Announcements {
+		for _, p := range a.Prefixes {
+			result = append(result, &Alert{
+				Kind:      "FILTER_MATCH",
+				Detector:  d.Name(),
+				Severity:  SeverityInfo,
+				Prefix:    p,
+				Origin:    origin,
+				Path:      rm.DigestedPath,
+				Collector: rm.Host,
+				Peer:      rm.Peer,
+				FirstSeen: rm.Time(),
+				LastSeen:  rm.Time(),
+				Message:   fmt.Sprintf("Peer/ASN -> %v/%v", rm.Peer, rm.PeerASN),
+			})
+		}
+	}
+	return result
+}
+
+// MOASDetector alerts when MOAS conflicts start and end.
+type MOASDetector struct {
+	T *MOASTracker
+}
+
+func (d *MOASDetector) Name() string { return "moas" }
+
+func (d *MOASDetector) Detect(rm *RisMessageData) []*Alert {
+	var result []*Alert
+	for _, e := range d.T.Update(rm) {
+		sev := SeverityWarning
+		if e.Kind == MOASEnd {
+			sev = SeverityInfo
+		}
+		origin, _ := rm.OriginASN()
+		result = append(result, &Alert{
+			Kind:      e.Kind.String(),
+			Detector:  d.Name(),
+			Severity:  sev,
+			Prefix:    e.Prefix,
+			Origin:    origin,
+			Path:      rm.DigestedPath,
+			Collector: rm.Host,
+			Peer:      rm.Peer,
+			FirstSeen: e.Time,
+			LastSeen:  e.Time,
+			Message:   fmt.Sprintf("origins: %v", asnList(e.Origins)),
+		})
+	}
+	return result
+}
+
+// BogonAlertDetector alerts on announcements of bogon prefixes and paths with bogon ASNs.
+type BogonAlertDetector struct {
+	B *BogonDetector
+}
+
+func (d *BogonAlertDetector) Name() string { return "bogon" }
+
+func (d *BogonAlertDetector) Detect(rm *RisMessageData) []*Alert {
+	origin, _ := rm.OriginASN()
+	var result []*Alert
+	for _, m := range d.B.Check(rm) {
+		a := &Alert{
+			Kind:      "BOGON_PREFIX",
+			Detector:  d.Name(),
+			Severity:  SeverityWarning,
+			Prefix:    m.Prefix,
+			Origin:    origin,
+			Path:      rm.DigestedPath,
+			Collector: rm.Host,
+			Peer:      rm.Peer,
+			FirstSeen: rm.Time(),
+			LastSeen:  rm.Time(),
+			Message:   m.String(),
+		}
+		if m.Prefix == "" {
+			a.Kind = "BOGON_ASN"
+			a.ASN = m.ASN
+		}
+		result = append(result, a)
+	}
+	return result
+}
+
+// ChurnDetector alerts when routes start and stop flapping.
+type ChurnDetector struct {
+	T *ChurnTracker
+}
+
+func (d *ChurnDetector) Name() string { return "churn" }
+
+func (d *ChurnDetector) Detect(rm *RisMessageData) []*Alert {
+	return d.alerts(d.T.Update(rm))
+}
+
+func (d *ChurnDetector) Tick(now time.Time) []*Alert {
+	return d.alerts(d.T.Decay(now))
+}
+
+func (d *ChurnDetector) alerts(events []*FlapEvent) []*Alert {
+	var result []*Alert
+	for _, e := range events {
+		sev := SeverityWarning
+		if e.Kind == FlapStop {
+			sev = SeverityInfo
+		}
+		result = append(result, &Alert{
+			Kind:      e.Kind.String(),
+			Detector:  d.Name(),
+			Severity:  sev,
+			Prefix:    e.Prefix,
+			Collector: e.Collector,
+			Peer:      e.Peer,
+			FirstSeen: e.Time,
+			LastSeen:  e.Time,
+			Message:   fmt.Sprintf("penalty: %.0f", e.Penalty),
+		})
+	}
+	return result
+}
+
+// VisibilityDetector alerts when the visibility of watched prefixes changes.
+type VisibilityDetector struct {
+	T *VisibilityTracker
+}
+
+func (d *VisibilityDetector) Name() string { return "visibility" }
+
+func (d *VisibilityDetector) Detect(rm *RisMessageData) []*Alert {
+	return d.alerts(d.T.Update(rm))
+}
+
+func (d *VisibilityDetector) Tick(now time.Time) []*Alert {
+	return d.alerts(d.T.Expire(now))
+}
+
+func (d *VisibilityDetector) alerts(events []*VisibilityEvent) []*Alert {
+	var result []*Alert
+	for _, e := range events {
+		sev := SeverityInfo
+		if e.Kind == VisibilityLow {
+			sev = SeverityCritical
+		}
+		result = append(result, &Alert{
+			Kind:      e.Kind.String(),
+			Detector:  d.Name(),
+			Severity:  sev,
+			Prefix:    e.Prefix,
+			FirstSeen: e.Time,
+			LastSeen:  e.Time,
+			Message:   fmt.Sprintf("visibility: %.1f%% (%d/%d peers), was %.1f%%", e.Visibility*100, e.Seen, e.Total, e.Previous*100),
+		})
+	}
+	return result
+}
+
+// AnomalyDetector alerts on AS path anomalies.
+type AnomalyDetector struct {
+	D *PathAnomalyDetector
+}
+
+func (d *AnomalyDetector) Name() string { return "anomaly" }
+
+func (d *AnomalyDetector) Detect(rm *RisMessageData) []*Alert {
+	var result []*Alert
+	for _, e := range d.D.Check(rm) {
+		a := &Alert{
+			Kind:      e.Kind.String(),
+			Detector:  d.Name(),
+			Prefix:    e.Prefix,
+			Origin:    e.Origin,
+			ASN:       e.ASN,
+			Path:      e.Path,
+			Collector: rm.Host,
+			Peer:      rm.Peer,
+			FirstSeen: e.Time,
+			LastSeen:  e.Time,
+		}
+		switch e.Kind {
+		case ExcessivePrepend:
+			a.Severity = SeverityInfo
+			a.Message = fmt.Sprintf("AS%v prepended %v times", uint32(e.ASN), e.Count)
+		case PathLoop:
+			a.Severity = SeverityWarning
+			a.Message = fmt.Sprintf("AS%v appears in non-adjacent positions", uint32(e.ASN))
+		case PathLengthChange:
+			a.Severity = SeverityWarning
+			a.Message = fmt.Sprintf("path length %v, baseline mean %.1f", e.Length, e.Mean)
+		case NewUpstream:
+			a.Severity = SeverityCritical
+			a.Message = fmt.Sprintf("new upstream AS%v of AS%v", uint32(e.ASN), uint32(e.Origin))
+		}
+		// Path anomalies without a prefix relate to the prefixes of the message.
+		if a.Prefix != "" {
+			result = append(result, a)
+			continue
+		}
+		for _, p := range announced(rm) {
+			cp := *a
+			cp.Prefix = p
+			result = append(result, &cp)
+		}
+	}
+	return result
+}
+
+// AdjacencyDetector alerts on new adjacencies of monitored ASNs.
+type AdjacencyDetector struct {
+	M *AdjacencyMonitor
+}
+
+func (d *AdjacencyDetector) Name() string { return "adjacency" }
+
+func (d *AdjacencyDetector) Detect(rm *RisMessageData) []*Alert {
+	events, err := d.M.Update(rm)
+	if err != nil {
+		log.Errorf("failed to save adjacencies: %v", err)
+	}
+	origin, _ := rm.OriginASN()
+	var result []*Alert
+	for _, e := range events {
+		for _, p := range e.Prefixes {
+			result = append(result, &Alert{
+				Kind:      "NEW_ADJACENCY",
+				Detector:  d.Name(),
+				Severity:  SeverityCritical,
+				Prefix:    p,
+				Origin:    origin,
+				ASN:       e.Neighbor,
+				Path:      e.Path,
+				Collector: e.Collector,
+				Peer:      e.Peer,
+				FirstSeen: e.Time,
+				LastSeen:  e.Time,
+				Message:   fmt.Sprintf("new neighbor AS%v of AS%v", uint32(e.Neighbor), uint32(e.ASN)),
+			})
+		}
+	}
+	return result
+}
+
+// newDetectors creates the set of detectors used by main, watching the prefixes
+// and origins of the RisLive filter.
+func newDetectors(r *RisLive) ([]Detector, error) {
+	var origins []int32
+	for _, o := range r.Filter.Origins {
+		asn, err := strconv.ParseUint(o, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse origin(%v): %v", o, err)
+		}
+		origins = append(origins, int32(asn))
+	}
+	am, err := NewAdjacencyMonitor(origins, *adjacencyLearn, *adjacencyFile)
+	if err != nil {
+		return nil, err
+	}
+	ac := DefaultAnomalyConfig()
+	ac.WatchedPrefix = r.Filter.Prefix
+	ac.WatchedOrigins = origins
+
+	churn, err := NewChurnTracker(nil)
+	if err != nil {
+		return nil, err
+	}
+	detectors := []Detector{
+		&FilterDetector{R: r},
+		&MOASDetector{T: NewMOASTracker()},
+		&ChurnDetector{T: churn},
+		&VisibilityDetector{T: NewVisibilityTracker(DefaultVisibilityConfig(r.Filter.Prefix))},
+		&AnomalyDetector{D: NewPathAnomalyDetector(ac)},
+		&AdjacencyDetector{M: am},
+	}
+	if r.Bogons != nil {
+		detectors = append(detectors, &BogonAlertDetector{B: r.Bogons})
+	}
+	return detectors, nil
+}
+
+// announced returns all prefixes announced in a message.
+func announced(rm *RisMessageData) []string {
+	var result []string
+	for _, a := range rm.Announcements {
+		result = append(result, a.Prefixes...)
+	}
+	return result
+}
+
+// asnList formats ASNs as a comma separated list.
+func asnList(asns []int32) string {
+	s := make([]string, len(asns))
+	for i, a := range asns {
+		s[i] = fmt.Sprintf("AS%v", uint32(a))
+	}
+	return strings.Join(s, ", ")
+}
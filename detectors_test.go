@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMOASDetector(t *testing.T) {
+	d := &MOASDetector{T: NewMOASTracker()}
+	d.Detect(announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"))
+	got := d.Detect(announce(1, "rrc01", "2.2.2.2", []interface{}{2, 200}, "192.0.2.0/24"))
+
+	want := []*Alert{{
+		Kind:      "MOAS_START",
+		Detector:  "moas",
+		Severity:  SeverityWarning,
+		Prefix:    "192.0.2.0/24",
+		Origin:    200,
+		Path:      []int32{2, 200},
+		Collector: "rrc01",
+		Peer:      "2.2.2.2",
+		FirstSeen: time.Unix(1, 0),
+		LastSeen:  time.Unix(1, 0),
+		Message:   "origins: AS100, AS200",
+	}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+func TestAnomalyDetector(t *testing.T) {
+	d := &AnomalyDetector{D: NewPathAnomalyDetector(nil)}
+	got := d.Detect(announce(0, "rrc00", "1.1.1.1", []interface{}{1, 2, 1, 100}, "192.0.2.0/24", "198.51.100.0/24"))
+
+	var prefixes []string
+	for _, a := range got {
+		if a.Kind != "PATH_LOOP" || a.Severity != SeverityWarning || a.ASN != 1 {
+			t.Errorf("unexpected alert: %v", a)
+		}
+		prefixes = append(prefixes, a.Prefix)
+	}
+	if diff := cmp.Diff(prefixes, []string{"192.0.2.0/24", "198.51.100.0/24"}); diff != "" {
+		t.Errorf("alert prefixes got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+func TestFilterDetector(t *testing.T) {
+	d := &FilterDetector{R: &RisLive{Filter: &RisFilter{Prefix: []string{"192.0.2.0/24"}}}}
+	if got := d.Detect(announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "198.51.100.0/24")); len(got) != 0 {
+		t.Errorf("non-matching message got alerts: %v", got)
+	}
+	got := d.Detect(announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"))
+	if len(got) != 1 || got[0].Kind != "FILTER_MATCH" || got[0].Prefix != "192.0.2.0/24" {
+		t.Errorf("matching message got alerts: %v, want one FILTER_MATCH", got)
+	}
+}
@@ -0,0 +1,225 @@
+// Streaming of filtered messages over plain HTTP, for browser dashboards and
+// curl: /v1/messages/ sends the messages matching a RisFilter, compiled from
+// the query, as Server-Sent Events or newline delimited JSON.
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// maxStreamBuffer bounds the buffer a client may ask for.
+const maxStreamBuffer = 100000
+
+// queryList returns the values of a repeated or comma separated query parameter.
+func queryList(q url.Values, name string) []string {
+	var result []string
+	for _, v := range q[name] {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				result = append(result, e)
+			}
+		}
+	}
+	return result
+}
+
+// parseASNs parses a list of 4 byte ASNs.
+func parseASNs(l []string) ([]int32, error) {
+	var result []int32
+	for _, a := range l {
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(a), "AS"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ASN(%v): %v", a, err)
+		}
+		result = append(result, int32(asn))
+	}
+	return result, nil
+}
+
+// ParseRisFilterQuery compiles query parameters into a RisFilter, lists may be
+// repeated or comma separated:
+//
+//	aspath=701,7018   an as-path fragment
+//	transit=701,3356  invalid transit ASNs, matching paths which carry any of them
+//	origin=15169      origin ASNs
+//	prefix=8.8.8.0/24 prefixes, matching announcements of them or more specifics
+//	bogons=exclude    ignore, include or exclude messages with bogons
+func ParseRisFilterQuery(q url.Values) (*RisFilter, error) {
+	f := &RisFilter{}
+	var err error
+	if f.ASPath, err = parseASNs(queryList(q, "aspath")); err != nil {
+		return nil, fmt.Errorf("failed to parse aspath: %v", err)
+	}
+	transit, err := parseASNs(queryList(q, "transit"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse transit: %v", err)
+	}
+	if len(transit) > 0 {
+		f.InvalidTransitAS = map[int32]bool{}
+		for _, asn := range transit {
+			f.InvalidTransitAS[asn] = true
+		}
+	}
+	origins, err := parseASNs(queryList(q, "origin"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse origin: %v", err)
+	}
+	for _, asn := range origins {
+		f.Origins = append(f.Origins, strconv.FormatUint(uint64(uint32(asn)), 10))
+	}
+	for _, p := range queryList(q, "prefix") {
+		if _, _, err := net.ParseCIDR(p); err != nil {
+			return nil, fmt.Errorf("failed to parse prefix(%v): %v", p, err)
+		}
+		f.Prefix = append(f.Prefix, p)
+	}
+	if f.Bogons, err = ParseBogonMode(q.Get("bogons")); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// streamOptions are the per connection options of a message stream.
+type streamOptions struct {
+	sse        bool
+	buffer     int
+	policy     OverflowPolicy
+	includeRaw bool
+}
+
+// parseStreamOptions parses the format, buffer, overflow and includeRaw query
+// parameters. Without a format, clients accepting text/event-stream get SSE.
+func (s *LiveServer) parseStreamOptions(req *http.Request) (*streamOptions, error) {
+	q := req.URL.Query()
+	o := &streamOptions{buffer: s.Buffer, policy: s.Policy}
+	switch f := q.Get("format"); f {
+	case "":
+		o.sse = strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+	case "sse":
+		o.sse = true
+	case "ndjson", "json":
+	default:
+		return nil, fmt.Errorf("unsupported format: %q", f)
+	}
+	if v := q.Get("buffer"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxStreamBuffer {
+			return nil, fmt.Errorf("buffer must be 0 to %d: %q", maxStreamBuffer, v)
+		}
+		o.buffer = n
+	}
+	if v := q.Get("overflow"); v != "" {
+		p, err := ParseOverflowPolicy(v)
+		if err != nil {
+			return nil, err
+		}
+		if p != OverflowDropNewest && p != OverflowDropOldest {
+			return nil, fmt.Errorf("overflow must be drop-newest or drop-oldest: %q", v)
+		}
+		o.policy = p
+	}
+	if v := q.Get("includeRaw"); v != "" {
+		var err error
+		if o.includeRaw, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("failed to parse includeRaw(%v): %v", v, err)
+		}
+	}
+	return o, nil
+}
+
+// serveMessages streams the messages matching the query's RisFilter.
+func (s *LiveServer) serveMessages(w http.ResponseWriter, req *http.Request) {
+	o, err := s.parseStreamOptions(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := ParseRisFilterQuery(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	kind := "ndjson"
+	if o.sse {
+		kind = "sse"
+	}
+	sub, err := s.Broker.Subscribe(clientName(kind, req), f, o.buffer, o.policy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer s.Broker.Unsubscribe(sub)
+
+	if o.sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	s.stream(w, req, sub, o)
+}
+
+// stream writes the messages of a subscription until the client disconnects
+// or the broker closes. SSE clients are sent a comment every Heartbeat, so
+// proxies keep the connection open and a gone client is noticed, and an event
+// reporting the number of messages dropped if they fell behind.
+func (s *LiveServer) stream(w http.ResponseWriter, req *http.Request, sub *Subscription, o *streamOptions) {
+	flusher := w.(http.Flusher)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var heartbeat <-chan time.Time
+	if o.sse && s.Heartbeat > 0 {
+		t := time.NewTicker(s.Heartbeat)
+		defer t.Stop()
+		heartbeat = t.C
+	}
+	var id, dropped uint64
+	for {
+		var err error
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat:
+			if d := sub.Dropped(); d != dropped {
+				dropped = d
+				_, err = fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", d)
+			} else {
+				_, err = fmt.Fprint(w, ": keepalive\n\n")
+			}
+		case rm, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			b, merr := liveMessage(rm.Data, o.includeRaw)
+			rm.Release()
+			if merr != nil {
+				log.Errorf("failed to encode message for %v: %v", req.RemoteAddr, merr)
+				continue
+			}
+			if o.sse {
+				id++
+				_, err = fmt.Fprintf(w, "id: %d\nevent: ris_message\ndata: %s\n\n", id, b)
+			} else {
+				_, err = w.Write(append(b, '\n'))
+			}
+		}
+		if err != nil {
+			log.Infof("stream client %v gone: %v", req.RemoteAddr, err)
+			return
+		}
+		flusher.Flush()
+	}
+}
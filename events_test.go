@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseRisFilterQuery(t *testing.T) {
+	tests := []struct {
+		desc    string
+		query   string
+		want    *RisFilter
+		wantErr bool
+	}{{
+		desc:  "Success - empty",
+		query: "",
+		want:  &RisFilter{},
+	}, {
+		desc:  "Success - all fields",
+		query: "aspath=701,7018&transit=3356&transit=AS174&origin=15169,4200000000&prefix=8.8.8.0/24,2001:db8::/32&bogons=exclude",
+		want: &RisFilter{
+			ASPath:           []int32{701, 7018},
+			InvalidTransitAS: map[int32]bool{3356: true, 174: true},
+			Origins:          []string{"15169", "4200000000"},
+			Prefix:           []string{"8.8.8.0/24", "2001:db8::/32"},
+			Bogons:           BogonExclude,
+		},
+	}, {
+		desc:    "Failure - bad aspath",
+		query:   "aspath=701,x",
+		wantErr: true,
+	}, {
+		desc:    "Failure - ASN out of range",
+		query:   "origin=4294967296",
+		wantErr: true,
+	}, {
+		desc:    "Failure - bad prefix",
+		query:   "prefix=8.8.8.8",
+		wantErr: true,
+	}, {
+		desc:    "Failure - bad bogon mode",
+		query:   "bogons=some",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		q, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatalf("[%v]: failed to parse query: %v", test.desc, err)
+		}
+		got, err := ParseRisFilterQuery(q)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if diff := cmp.Diff(got, test.want); diff != "" {
+				t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+		}
+	}
+}
+
+// waitSubscribers waits until the broker has n subscribers.
+func waitSubscribers(t *testing.T, b *Broker, n int) {
+	t.Helper()
+	for start := time.Now(); len(b.Subscriptions()) != n; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("got %v subscribers, want %v", len(b.Subscriptions()), n)
+		}
+	}
+}
+
+func TestServeMessagesNDJSON(t *testing.T) {
+	b := NewBroker(nil, nil)
+	srv := httptest.NewServer(NewLiveServer(b, 10))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/v1/messages/?origin=15169&client=test")
+	if err != nil {
+		t.Fatalf("failed to get messages: %v", err)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("got Content-Type %v, want application/x-ndjson", got)
+	}
+	if subs := b.Subscriptions(); len(subs) != 1 || subs[0].Name != "ndjson:test" {
+		t.Errorf("got subscriptions %v, want ndjson:test", subs)
+	}
+	b.Publish(serverMsg01)
+	b.Publish(serverMsg00)
+	s := bufio.NewScanner(resp.Body)
+	if !s.Scan() {
+		t.Fatalf("failed to read message: %v", s.Err())
+	}
+	var got RisMessage
+	if err := json.Unmarshal(s.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse message(%s): %v", s.Bytes(), err)
+	}
+	if got.Data.Host != "rrc00" || got.Data.Raw != "" {
+		t.Errorf("got %s, want the rrc00 message without raw", s.Bytes())
+	}
+
+	// A disconnected client is unsubscribed.
+	resp.Body.Close()
+	waitSubscribers(t, b, 0)
+}
+
+func TestServeMessagesSSE(t *testing.T) {
+	b := NewBroker(nil, nil)
+	ls := NewLiveServer(b, 10)
+	ls.Heartbeat = 10 * time.Millisecond
+	srv := httptest.NewServer(ls)
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL+"/v1/messages/?prefix=8.8.0.0/16&includeRaw=true&buffer=1", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to get events: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("got Content-Type %v, want text/event-stream", got)
+	}
+	// With a buffer of 1, some of a burst is dropped, and reported.
+	for i := 0; i < 100; i++ {
+		b.Publish(serverMsg00)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	events := map[string]string{}
+	for events["ris_message"] == "" || events["dropped"] == "" {
+		var event, data string
+		for {
+			l, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read event: %v", err)
+			}
+			l = strings.TrimSuffix(l, "\n")
+			if l == "" {
+				break
+			}
+			switch {
+			case strings.HasPrefix(l, "event: "):
+				event = strings.TrimPrefix(l, "event: ")
+			case strings.HasPrefix(l, "data: "):
+				data = strings.TrimPrefix(l, "data: ")
+			}
+		}
+		if event != "" {
+			events[event] = data
+		}
+	}
+	var got RisMessage
+	if err := json.Unmarshal([]byte(events["ris_message"]), &got); err != nil {
+		t.Fatalf("failed to parse event data(%v): %v", events["ris_message"], err)
+	}
+	if got.Data.Host != "rrc00" || got.Data.Raw != "FFFF" {
+		t.Errorf("got %v, want the rrc00 message with raw", events["ris_message"])
+	}
+	var dropped struct{ Dropped int }
+	if err := json.Unmarshal([]byte(events["dropped"]), &dropped); err != nil || dropped.Dropped == 0 {
+		t.Errorf("got dropped event %v, want messages dropped", events["dropped"])
+	}
+}
+
+func TestServeMessagesBadRequest(t *testing.T) {
+	srv := httptest.NewServer(NewLiveServer(NewBroker(nil, nil), 10))
+	defer srv.Close()
+	for _, q := range []string{
+		"format=xml",
+		"buffer=-1",
+		"buffer=1000000",
+		"overflow=block",
+		"overflow=spill",
+		"includeRaw=maybe",
+		"aspath=x",
+	} {
+		resp, err := http.Get(srv.URL + "/v1/messages/?" + q)
+		if err != nil {
+			t.Errorf("[%v]: failed to get: %v", q, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("[%v]: got status %v, want 400", q, resp.StatusCode)
+		}
+	}
+}
@@ -4,6 +4,8 @@ require (
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
 	github.com/golang/protobuf v1.3.2
 	github.com/google/go-cmp v0.3.1
+	github.com/klauspost/compress v1.11.13
+	google.golang.org/grpc v1.27.1
 )
 
 go 1.13
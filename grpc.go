@@ -0,0 +1,326 @@
+// A gRPC API for non-Go consumers, see rislivepb/rislive.proto: streams of the
+// filtered messages and of the alerts, and queries of the MOAS and visibility
+// state the detectors track.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/golang/protobuf/ptypes"
+	pb "github.com/morrowc/rislive/rislivepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServer implements the RisLive gRPC service.
+type GRPCServer struct {
+	pb.UnimplementedRisLiveServer
+
+	Broker     *Broker
+	Alerts     *AlertHub
+	MOAS       *MOASTracker       // If set, answers the origin queries.
+	Visibility *VisibilityTracker // If set, adds the visibility of watched prefixes to GetPrefix.
+	Buffer     int                // The messages queued for each client, unless the client asks for more.
+	now        func() time.Time
+	clients    uint64 // The clients subscribed so far, updated atomically.
+}
+
+// NewGRPCServer creates a GRPCServer streaming the messages of b and alerts of h.
+func NewGRPCServer(b *Broker, h *AlertHub, buffer int) *GRPCServer {
+	return &GRPCServer{Broker: b, Alerts: h, Buffer: buffer, now: time.Now}
+}
+
+// risFilterFromProto converts a Filter to a RisFilter.
+func risFilterFromProto(f *pb.Filter) (*RisFilter, error) {
+	rf := &RisFilter{}
+	for _, asn := range f.GetAsPath() {
+		rf.ASPath = append(rf.ASPath, int32(asn))
+	}
+	if len(f.GetInvalidTransitAs()) > 0 {
+		rf.InvalidTransitAS = map[int32]bool{}
+		for _, asn := range f.GetInvalidTransitAs() {
+			rf.InvalidTransitAS[int32(asn)] = true
+		}
+	}
+	for _, asn := range f.GetOrigins() {
+		rf.Origins = append(rf.Origins, strconv.FormatUint(uint64(asn), 10))
+	}
+	for _, p := range f.GetPrefixes() {
+		if _, _, err := net.ParseCIDR(p); err != nil {
+			return nil, fmt.Errorf("failed to parse prefix(%v): %v", p, err)
+		}
+		rf.Prefix = append(rf.Prefix, p)
+	}
+	switch f.GetBogons() {
+	case pb.BogonMode_BOGON_IGNORE:
+		rf.Bogons = BogonIgnore
+	case pb.BogonMode_BOGON_INCLUDE:
+		rf.Bogons = BogonInclude
+	case pb.BogonMode_BOGON_EXCLUDE:
+		rf.Bogons = BogonExclude
+	default:
+		return nil, fmt.Errorf("unknown bogon mode: %v", f.GetBogons())
+	}
+	return rf, nil
+}
+
+// risMessageToProto converts a message to a RisMessage.
+func risMessageToProto(rm *RisMessageData, includeRaw bool) (*pb.RisMessage, error) {
+	ts, err := ptypes.TimestampProto(rm.Time())
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert timestamp(%v): %v", rm.Timestamp, err)
+	}
+	m := &pb.RisMessage{
+		Timestamp:   ts,
+		Host:        rm.Host,
+		Peer:        rm.Peer,
+		Id:          rm.ID,
+		Type:        rm.Type,
+		Origin:      rm.Origin,
+		Withdrawals: rm.Withdrawals,
+	}
+	if rm.PeerASN != "" {
+		asn, err := strconv.ParseUint(rm.PeerASN, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse peer ASN(%v): %v", rm.PeerASN, err)
+		}
+		m.PeerAsn = uint32(asn)
+	}
+	for _, asn := range rm.DigestedPath {
+		m.Path = append(m.Path, uint32(asn))
+	}
+	for _, c := range rm.Community {
+		if len(c) == 2 {
+			m.Communities = append(m.Communities, &pb.Community{Asn: uint32(c[0]), Value: uint32(c[1])})
+		}
+	}
+	for _, a := range rm.Announcements {
+		m.Announcements = append(m.Announcements, &pb.Announcement{NextHop: a.NextHop, Prefixes: a.Prefixes})
+	}
+	if includeRaw && rm.Raw != "" {
+		if m.Raw, err = hex.DecodeString(rm.Raw); err != nil {
+			return nil, fmt.Errorf("failed to decode raw message: %v", err)
+		}
+	}
+	return m, nil
+}
+
+// alertToProto converts an Alert to its proto form.
+func alertToProto(a *Alert) (*pb.Alert, error) {
+	first, err := ptypes.TimestampProto(a.FirstSeen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert first seen(%v): %v", a.FirstSeen, err)
+	}
+	last, err := ptypes.TimestampProto(a.LastSeen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert last seen(%v): %v", a.LastSeen, err)
+	}
+	m := &pb.Alert{
+		Kind:      a.Kind,
+		Detector:  a.Detector,
+		Severity:  pb.Severity(a.Severity),
+		Prefix:    a.Prefix,
+		Origin:    uint32(a.Origin),
+		Asn:       uint32(a.ASN),
+		Collector: a.Collector,
+		Peer:      a.Peer,
+		FirstSeen: first,
+		LastSeen:  last,
+		Count:     int64(a.Count),
+		Message:   a.Message,
+	}
+	for _, asn := range a.Path {
+		m.Path = append(m.Path, uint32(asn))
+	}
+	return m, nil
+}
+
+// matchAlert reports whether an alert is selected by the filter.
+func matchAlert(f *pb.AlertFilter, a *Alert) bool {
+	if int32(a.Severity) < int32(f.GetMinSeverity()) {
+		return false
+	}
+	if len(f.GetDetectors()) > 0 && !contains(f.GetDetectors(), a.Detector) {
+		return false
+	}
+	if len(f.GetPrefixes()) > 0 && !contains(f.GetPrefixes(), a.Prefix) {
+		return false
+	}
+	return true
+}
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// clientName names a client's broker subscription, by its address and a count
+// of the clients, which tells apart those of the same address.
+func (s *GRPCServer) clientName(ctx context.Context) string {
+	n := atomic.AddUint64(&s.clients, 1)
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return fmt.Sprintf("grpc:%v#%d", p.Addr, n)
+	}
+	return fmt.Sprintf("grpc#%d", n)
+}
+
+// Subscribe streams the messages matching the filter, dropping the newest
+// messages if the client falls behind.
+func (s *GRPCServer) Subscribe(f *pb.Filter, stream pb.RisLive_SubscribeServer) error {
+	rf, err := risFilterFromProto(f)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	buffer := s.Buffer
+	if b := int(f.GetBuffer()); b > buffer {
+		if b > maxStreamBuffer {
+			b = maxStreamBuffer
+		}
+		buffer = b
+	}
+	sub, err := s.Broker.Subscribe(s.clientName(stream.Context()), rf, buffer, OverflowDropNewest)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer s.Broker.Unsubscribe(sub)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case rm, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			m, err := risMessageToProto(rm.Data, f.GetIncludeRaw())
+			if err != nil {
+				rm.Release()
+				log.Errorf("failed to convert message for grpc client: %v", err)
+				continue
+			}
+			// The message shares the slices of rm, until it is sent.
+			err = stream.Send(m)
+			rm.Release()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StreamAlerts streams the alerts matching the filter.
+func (s *GRPCServer) StreamAlerts(f *pb.AlertFilter, stream pb.RisLive_StreamAlertsServer) error {
+	if s.Alerts == nil {
+		return status.Error(codes.Unavailable, "alerts are not enabled")
+	}
+	c := s.Alerts.Subscribe(s.Buffer)
+	defer s.Alerts.Unsubscribe(c)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case a, ok := <-c:
+			if !ok {
+				return nil
+			}
+			if !matchAlert(f, a) {
+				continue
+			}
+			m, err := alertToProto(a)
+			if err != nil {
+				log.Errorf("failed to convert alert for grpc client: %v", err)
+				continue
+			}
+			if err := stream.Send(m); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GetPrefix returns the origins and visibility of a prefix.
+func (s *GRPCServer) GetPrefix(ctx context.Context, req *pb.PrefixRequest) (*pb.PrefixState, error) {
+	_, n, err := net.ParseCIDR(req.GetPrefix())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse prefix(%v): %v", req.GetPrefix(), err)
+	}
+	if s.MOAS == nil && s.Visibility == nil {
+		return nil, status.Error(codes.Unavailable, "routing state is not tracked")
+	}
+	prefix := n.String()
+	result := &pb.PrefixState{Prefix: prefix}
+	if s.MOAS != nil {
+		for _, o := range s.MOAS.Prefix(prefix) {
+			first, err := ptypes.TimestampProto(o.FirstSeen)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to convert first seen(%v): %v", o.FirstSeen, err)
+			}
+			last, err := ptypes.TimestampProto(o.LastSeen)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to convert last seen(%v): %v", o.LastSeen, err)
+			}
+			result.Origins = append(result.Origins, &pb.OriginState{
+				Origin:     uint32(o.Origin),
+				FirstSeen:  first,
+				LastSeen:   last,
+				Collectors: o.Collectors,
+			})
+		}
+	}
+	var vis *Visibility
+	if s.Visibility != nil {
+		vis = s.Visibility.Prefix(prefix, s.now())
+	}
+	if vis != nil {
+		result.Visibility = vis.Visibility
+		result.SeenPeers = int32(vis.Seen)
+		result.TotalPeers = int32(vis.Total)
+		for _, p := range s.Visibility.Peers(prefix) {
+			result.Peers = append(result.Peers, &pb.Peer{Collector: p[0], Address: p[1]})
+		}
+	}
+	if len(result.Origins) == 0 && vis == nil {
+		return nil, status.Errorf(codes.NotFound, "prefix %v has not been seen", prefix)
+	}
+	return result, nil
+}
+
+// GetOriginPrefixes returns the prefixes an ASN currently originates.
+func (s *GRPCServer) GetOriginPrefixes(ctx context.Context, req *pb.OriginRequest) (*pb.OriginPrefixes, error) {
+	if s.MOAS == nil {
+		return nil, status.Error(codes.Unavailable, "origins are not tracked")
+	}
+	return &pb.OriginPrefixes{Asn: req.GetAsn(), Prefixes: s.MOAS.Origin(int32(req.GetAsn()))}, nil
+}
+
+// GetConflicts returns the prefixes currently originated by more than one ASN.
+func (s *GRPCServer) GetConflicts(ctx context.Context, req *pb.ConflictsRequest) (*pb.Conflicts, error) {
+	if s.MOAS == nil {
+		return nil, status.Error(codes.Unavailable, "origins are not tracked")
+	}
+	conflicts := s.MOAS.Conflicts()
+	result := &pb.Conflicts{}
+	for prefix, origins := range conflicts {
+		c := &pb.Conflict{Prefix: prefix}
+		for _, o := range origins {
+			c.Origins = append(c.Origins, uint32(o))
+		}
+		result.Conflicts = append(result.Conflicts, c)
+	}
+	sort.Slice(result.Conflicts, func(i, j int) bool { return result.Conflicts[i].Prefix < result.Conflicts[j].Prefix })
+	return result, nil
+}
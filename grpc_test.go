@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/go-cmp/cmp"
+	pb "github.com/morrowc/rislive/rislivepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// grpcTestClient serves s on an in-memory listener, returning a client of it.
+func grpcTestClient(t *testing.T, s *GRPCServer) (pb.RisLiveClient, func()) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterRisLiveServer(srv, s)
+	go srv.Serve(lis)
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	return pb.NewRisLiveClient(conn), func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
+
+func TestGRPCSubscribe(t *testing.T) {
+	b := NewBroker(nil, nil)
+	client, stop := grpcTestClient(t, NewGRPCServer(b, nil, 10))
+	defer stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.Subscribe(ctx, &pb.Filter{Origins: []uint32{15169}, IncludeRaw: true})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	waitSubscribers(t, b, 1)
+	// Each client is named by its address, and a count of the clients.
+	if got, want := b.Subscriptions()[0].Name, "grpc:bufconn#1"; got != want {
+		t.Errorf("got subscription %q, want %q", got, want)
+	}
+	d := *serverMsg00.Data
+	d.PeerASN = "64496"
+	d.Community = [][]int32{{64496, 100}}
+	rm := RisMessage{Type: "ris_message", Data: &d}
+	b.Publish(serverMsg01)
+	b.Publish(rm)
+	got, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	ts, _ := ptypes.TimestampProto(rm.Data.Time())
+	want := &pb.RisMessage{
+		Timestamp:     ts,
+		Host:          "rrc00",
+		Peer:          "192.0.2.1",
+		PeerAsn:       64496,
+		Type:          "UPDATE",
+		Path:          []uint32{64496, 15169},
+		Communities:   []*pb.Community{{Asn: 64496, Value: 100}},
+		Announcements: []*pb.Announcement{{NextHop: "192.0.2.1", Prefixes: []string{"8.8.8.0/24"}}},
+		Raw:           []byte{0xff, 0xff},
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// A cancelled client is unsubscribed.
+	cancel()
+	waitSubscribers(t, b, 0)
+
+	stream, err = client.Subscribe(context.Background(), &pb.Filter{Prefixes: []string{"8.8.8.8"}})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got %v for a bad prefix, want InvalidArgument", err)
+	}
+}
+
+func TestGRPCStreamAlerts(t *testing.T) {
+	h := NewAlertHub()
+	client, stop := grpcTestClient(t, NewGRPCServer(NewBroker(nil, nil), h, 10))
+	defer stop()
+
+	stream, err := client.StreamAlerts(context.Background(), &pb.AlertFilter{MinSeverity: pb.Severity_SEVERITY_WARNING, Detectors: []string{"moas"}})
+	if err != nil {
+		t.Fatalf("failed to stream alerts: %v", err)
+	}
+	// The subscription is made once the stream is running, publish until an alert arrives.
+	seen := time.Unix(1558620047, 0)
+	alerts := []*Alert{
+		{Kind: "BOGON_PREFIX", Detector: "bogon", Severity: SeverityCritical},
+		{Kind: "MOAS_END", Detector: "moas", Severity: SeverityInfo},
+		{Kind: "MOAS_START", Detector: "moas", Severity: SeverityWarning, Prefix: "8.8.8.0/24", Origin: 15169, Path: []int32{64496, 15169}, FirstSeen: seen, LastSeen: seen, Count: 2},
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			for _, a := range alerts {
+				h.Publish(a)
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}()
+	got, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	ts, _ := ptypes.TimestampProto(seen)
+	want := &pb.Alert{
+		Kind:      "MOAS_START",
+		Detector:  "moas",
+		Severity:  pb.Severity_SEVERITY_WARNING,
+		Prefix:    "8.8.8.0/24",
+		Origin:    15169,
+		Path:      []uint32{64496, 15169},
+		FirstSeen: ts,
+		LastSeen:  ts,
+		Count:     2,
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGRPCQueries(t *testing.T) {
+	moas := NewMOASTracker()
+	vis := NewVisibilityTracker(DefaultVisibilityConfig([]string{"8.8.8.0/24"}))
+	for _, rm := range []*RisMessageData{{
+		Timestamp:     1558620047,
+		Host:          "rrc00",
+		Peer:          "192.0.2.1",
+		DigestedPath:  []int32{64496, 15169},
+		Announcements: []*RisAnnouncement{{Prefixes: []string{"8.8.8.0/24"}}},
+	}, {
+		Timestamp:     1558620048,
+		Host:          "rrc01",
+		Peer:          "192.0.2.2",
+		DigestedPath:  []int32{64497, 64511},
+		Announcements: []*RisAnnouncement{{Prefixes: []string{"8.8.8.0/24"}}},
+	}} {
+		moas.Update(rm)
+		vis.Update(rm)
+	}
+	s := NewGRPCServer(NewBroker(nil, nil), nil, 10)
+	s.MOAS, s.Visibility = moas, vis
+	s.now = func() time.Time { return time.Unix(1558620050, 0) }
+	client, stop := grpcTestClient(t, s)
+	defer stop()
+	ctx := context.Background()
+
+	state, err := client.GetPrefix(ctx, &pb.PrefixRequest{Prefix: "8.8.8.1/24"})
+	if err != nil {
+		t.Fatalf("failed to get prefix: %v", err)
+	}
+	first, _ := ptypes.TimestampProto(time.Unix(1558620047, 0))
+	second, _ := ptypes.TimestampProto(time.Unix(1558620048, 0))
+	want := &pb.PrefixState{
+		Prefix: "8.8.8.0/24",
+		Origins: []*pb.OriginState{
+			{Origin: 15169, FirstSeen: first, LastSeen: first, Collectors: []string{"rrc00"}},
+			{Origin: 64511, FirstSeen: second, LastSeen: second, Collectors: []string{"rrc01"}},
+		},
+		Visibility: 1,
+		SeenPeers:  2,
+		TotalPeers: 2,
+		Peers:      []*pb.Peer{{Collector: "rrc00", Address: "192.0.2.1"}, {Collector: "rrc01", Address: "192.0.2.2"}},
+	}
+	if !proto.Equal(state, want) {
+		t.Errorf("got %v, want %v", state, want)
+	}
+
+	origin, err := client.GetOriginPrefixes(ctx, &pb.OriginRequest{Asn: 15169})
+	if err != nil {
+		t.Fatalf("failed to get origin prefixes: %v", err)
+	}
+	if diff := cmp.Diff(origin.GetPrefixes(), []string{"8.8.8.0/24"}); diff != "" {
+		t.Errorf("origin prefixes got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+
+	conflicts, err := client.GetConflicts(ctx, &pb.ConflictsRequest{})
+	if err != nil {
+		t.Fatalf("failed to get conflicts: %v", err)
+	}
+	wantConflicts := &pb.Conflicts{Conflicts: []*pb.Conflict{{Prefix: "8.8.8.0/24", Origins: []uint32{15169, 64511}}}}
+	if !proto.Equal(conflicts, wantConflicts) {
+		t.Errorf("got %v, want %v", conflicts, wantConflicts)
+	}
+
+	tests := []struct {
+		desc   string
+		prefix string
+		want   codes.Code
+	}{{
+		desc:   "Failure - bad prefix",
+		prefix: "8.8.8.8",
+		want:   codes.InvalidArgument,
+	}, {
+		desc:   "Failure - unknown prefix",
+		prefix: "192.0.2.0/24",
+		want:   codes.NotFound,
+	}}
+	for _, test := range tests {
+		if _, err := client.GetPrefix(ctx, &pb.PrefixRequest{Prefix: test.prefix}); status.Code(err) != test.want {
+			t.Errorf("[%v]: got %v, want %v", test.desc, err, test.want)
+		}
+	}
+}
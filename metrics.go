@@ -0,0 +1,209 @@
+// Metrics for the health of the stream and the detectors, exported in the
+// Prometheus text exposition format so that a stalled feed can be alerted on.
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetricVec is a counter or gauge, with a value for each set of label values.
+type MetricVec struct {
+	Name   string
+	Help   string
+	Type   string // counter or gauge.
+	Labels []string
+
+	mu     sync.Mutex
+	values map[string]*labeledValue
+}
+
+type labeledValue struct {
+	labels []string
+	v      float64
+}
+
+// NewCounter creates a counter MetricVec with the given label names.
+func NewCounter(name, help string, labels ...string) *MetricVec {
+	return &MetricVec{Name: name, Help: help, Type: "counter", Labels: labels, values: map[string]*labeledValue{}}
+}
+
+// NewGauge creates a gauge MetricVec with the given label names.
+func NewGauge(name, help string, labels ...string) *MetricVec {
+	return &MetricVec{Name: name, Help: help, Type: "gauge", Labels: labels, values: map[string]*labeledValue{}}
+}
+
+// value returns the value for the label values, creating it if required.
+// The lock must be held.
+func (m *MetricVec) value(lvs []string) *labeledValue {
+	if len(lvs) != len(m.Labels) {
+		panic(fmt.Sprintf("metric %v has labels %v, got values %v", m.Name, m.Labels, lvs))
+	}
+	k := strings.Join(lvs, "\xff")
+	v, ok := m.values[k]
+	if !ok {
+		v = &labeledValue{labels: append([]string(nil), lvs...)}
+		m.values[k] = v
+	}
+	return v
+}
+
+// Add adds d to the value for the label values.
+func (m *MetricVec) Add(d float64, lvs ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.value(lvs).v += d
+}
+
+// Inc adds 1 to the value for the label values.
+func (m *MetricVec) Inc(lvs ...string) {
+	m.Add(1, lvs...)
+}
+
+// Set sets the value for the label values.
+func (m *MetricVec) Set(v float64, lvs ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.value(lvs).v = v
+}
+
+// Get returns the value for the label values, 0 if it has not been set.
+func (m *MetricVec) Get(lvs ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.values[strings.Join(lvs, "\xff")]; ok {
+		return v.v
+	}
+	return 0
+}
+
+// Write writes the metric in the text exposition format, values sorted by label.
+func (m *MetricVec) Write(w io.Writer) error {
+	m.mu.Lock()
+	values := make([]*labeledValue, 0, len(m.values))
+	for _, v := range m.values {
+		values = append(values, &labeledValue{labels: v.labels, v: v.v})
+	}
+	m.mu.Unlock()
+	sort.Slice(values, func(i, j int) bool {
+		return strings.Join(values[i].labels, "\xff") < strings.Join(values[j].labels, "\xff")
+	})
+	// A metric without labels is always exported, so it can be seen as 0.
+	if len(m.Labels) == 0 && len(values) == 0 {
+		values = append(values, &labeledValue{})
+	}
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, m.Type); err != nil {
+		return err
+	}
+	for _, v := range values {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", m.Name, formatLabels(m.Labels, v.labels), formatValue(v.v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLabels returns the {name="value",...} label set of a sample.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, n, r.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// gaugeFunc is a gauge whose value is read when the metrics are written.
+type gaugeFunc struct {
+	name, help string
+	f          func() float64
+}
+
+// Metrics is the set of metrics exported by rislive.
+type Metrics struct {
+	Messages     *MetricVec // By message type and collector.
+	DecodeErrors *MetricVec
+	PathErrors   *MetricVec // Failures of digestPath.
+	Connects     *MetricVec // Connections to the stream, including reconnects.
+	Stalls       *MetricVec // Connections closed by the Watchdog.
+	PingRTT      *MetricVec
+	Age          *MetricVec // Seconds since a message was received, by collector.
+	Lag          *MetricVec // Wall clock less message timestamp, by collector.
+	LastMessage  *MetricVec // The newest message timestamp, by collector.
+	Alerts       *MetricVec // By detector and severity.
+	Dropped      *MetricVec // By overflow policy.
+	Spilled      *MetricVec
+	HighWater    *MetricVec // The deepest the channel has been.
+
+	SubscriberDropped *MetricVec // By Broker subscriber.
+
+	mu    sync.Mutex
+	funcs []*gaugeFunc
+}
+
+// NewMetrics creates the rislive Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Messages:     NewCounter("rislive_messages_total", "Messages received from the stream.", "type", "collector"),
+		DecodeErrors: NewCounter("rislive_decode_errors_total", "Messages which failed to decode."),
+		PathErrors:   NewCounter("rislive_path_errors_total", "Messages whose AS path failed to digest."),
+		Connects:     NewCounter("rislive_connects_total", "Connections made to the stream, including reconnects."),
+		Stalls:       NewCounter("rislive_stalls_total", "Connections closed because the stream stalled."),
+		PingRTT:      NewGauge("rislive_ping_rtt_seconds", "Round trip time of the last answered ping."),
+		Age:          NewGauge("rislive_collector_age_seconds", "Seconds since a message was last received from the collector.", "collector"),
+		Lag:          NewGauge("rislive_lag_seconds", "Seconds between the newest message timestamp and the wall clock when it was received.", "collector"),
+		LastMessage:  NewGauge("rislive_last_message_timestamp_seconds", "Unix timestamp of the newest message received.", "collector"),
+		Alerts:       NewCounter("rislive_alerts_total", "Alerts produced by the alert pipeline.", "detector", "severity"),
+		Dropped:      NewCounter("rislive_dropped_total", "Messages dropped because the consumer fell behind.", "policy"),
+		Spilled:      NewCounter("rislive_spilled_total", "Messages spilled to disk because the consumer fell behind."),
+		HighWater:    NewGauge("rislive_channel_high_water", "The deepest the RisLive channel has been."),
+
+		SubscriberDropped: NewCounter("rislive_subscriber_dropped_total", "Messages dropped because a subscriber fell behind.", "subscriber"),
+	}
+}
+
+// GaugeFunc adds a gauge whose value is returned by f when the metrics are written.
+func (m *Metrics) GaugeFunc(name, help string, f func() float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.funcs = append(m.funcs, &gaugeFunc{name: name, help: help, f: f})
+}
+
+// Write writes all metrics in the text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	for _, mv := range []*MetricVec{m.Messages, m.DecodeErrors, m.PathErrors, m.Connects, m.Stalls, m.PingRTT, m.Age, m.Lag, m.LastMessage, m.Alerts, m.Dropped, m.Spilled, m.HighWater, m.SubscriberDropped} {
+		if err := mv.Write(w); err != nil {
+			return err
+		}
+	}
+	m.mu.Lock()
+	funcs := append([]*gaugeFunc(nil), m.funcs...)
+	m.mu.Unlock()
+	for _, g := range funcs {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatValue(g.f())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves the metrics, for use as the /metrics handler.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := m.Write(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetricVecWrite(t *testing.T) {
+	tests := []struct {
+		desc string
+		m    *MetricVec
+		set  func(m *MetricVec)
+		want string
+	}{{
+		desc: "Success - unset counter without labels",
+		m:    NewCounter("c_total", "A counter."),
+		set:  func(m *MetricVec) {},
+		want: "# HELP c_total A counter.\n# TYPE c_total counter\nc_total 0\n",
+	}, {
+		desc: "Success - labeled counter, sorted",
+		m:    NewCounter("c_total", "A counter.", "type", "collector"),
+		set: func(m *MetricVec) {
+			m.Inc("ris_message", "rrc01")
+			m.Add(2, "ris_message", "rrc00")
+			m.Inc("ris_message", "rrc01")
+		},
+		want: "# HELP c_total A counter.\n# TYPE c_total counter\n" +
+			"c_total{type=\"ris_message\",collector=\"rrc00\"} 2\n" +
+			"c_total{type=\"ris_message\",collector=\"rrc01\"} 2\n",
+	}, {
+		desc: "Success - gauge, escaped label",
+		m:    NewGauge("g", "A gauge.", "name"),
+		set: func(m *MetricVec) {
+			m.Set(5, `a"b\c`)
+			m.Set(0.25, `a"b\c`)
+		},
+		want: "# HELP g A gauge.\n# TYPE g gauge\ng{name=\"a\\\"b\\\\c\"} 0.25\n",
+	}}
+
+	for _, test := range tests {
+		test.set(test.m)
+		var b bytes.Buffer
+		if err := test.m.Write(&b); err != nil {
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+			continue
+		}
+		if diff := cmp.Diff(b.String(), test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestListenMetrics(t *testing.T) {
+	r := &RisLive{
+		File:    proto.String("testdata/fail-as-set"),
+		Filter:  &RisFilter{},
+		Chan:    make(chan RisMessage, 10),
+		Metrics: NewMetrics(),
+	}
+	r.Metrics.GaugeFunc("rislive_channel_depth", "Messages queued in the RisLive channel.", func() float64 { return float64(len(r.Chan)) })
+	r.Listen()
+
+	if got := r.Count(); got != 1 {
+		t.Errorf("got %v records, want 1", got)
+	}
+	if got := r.Metrics.Messages.Get("ris_message", "rrc11"); got != 1 {
+		t.Errorf("got %v messages from rrc11, want 1", got)
+	}
+	if got := r.Metrics.LastMessage.Get("rrc11"); got != 1573830861.72 {
+		t.Errorf("got last message timestamp %v, want 1573830861.72", got)
+	}
+	if got := r.Metrics.Lag.Get("rrc11"); got <= 0 {
+		t.Errorf("got lag %v, want > 0", got)
+	}
+
+	rec := httptest.NewRecorder()
+	r.Metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	for _, s := range []string{
+		`rislive_messages_total{type="ris_message",collector="rrc11"} 1`,
+		"rislive_decode_errors_total 0",
+		"rislive_path_errors_total 0",
+		"# TYPE rislive_channel_depth gauge\nrislive_channel_depth 1\n",
+	} {
+		if !strings.Contains(string(body), s) {
+			t.Errorf("metrics do not contain %q:\n%s", s, body)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got content type %q", ct)
+	}
+}
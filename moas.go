@@ -0,0 +1,230 @@
+// Track prefixes which are originated by more than one ASN at the same time,
+// Multiple Origin AS (MOAS) conflicts.
+//
+// The tracker follows every (collector, peer, prefix) route in the stream, so an
+// origin is expired only when every peer which saw it has withdrawn the prefix,
+// or replaced the route with one from a different origin.
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MOASEventKind describes the transition a MOASEvent reports.
+type MOASEventKind int
+
+const (
+	MOASStart MOASEventKind = iota // A prefix became originated by more than one ASN.
+	MOASEnd                        // A prefix returned to a single (or no) origin ASN.
+)
+
+func (k MOASEventKind) String() string {
+	switch k {
+	case MOASStart:
+		return "MOAS_START"
+	case MOASEnd:
+		return "MOAS_END"
+	}
+	return "MOAS_UNKNOWN"
+}
+
+// MOASEvent is emitted when a MOAS conflict starts or ends for a prefix.
+type MOASEvent struct {
+	Kind    MOASEventKind
+	Prefix  string
+	Origins []int32   // The origins seen at the time of the event, sorted.
+	Time    time.Time // The timestamp of the message which caused the event.
+}
+
+// OriginState is a single origin ASN seen announcing a prefix.
+type OriginState struct {
+	Origin     int32
+	FirstSeen  time.Time
+	LastSeen   time.Time
+	Collectors []string // The collectors (rrc00, rrc01...) which have a peer seeing this origin.
+}
+
+// peerKey identifies a single peer on a single collector.
+type peerKey struct {
+	host, peer string
+}
+
+type peerPrefix struct {
+	peerKey
+	prefix string
+}
+
+// originEntry is the internal form of OriginState, peers which currently carry the route.
+type originEntry struct {
+	firstSeen, lastSeen time.Time
+	peers               map[peerKey]bool
+}
+
+// MOASTracker maintains a table of prefix -> origin ASNs across the stream.
+type MOASTracker struct {
+	mu       sync.Mutex
+	prefixes map[string]map[int32]*originEntry // prefix -> origin -> entry.
+	routes   map[peerPrefix]int32              // (peer, prefix) -> origin announced by the peer.
+}
+
+// NewMOASTracker creates a new, empty, MOASTracker.
+func NewMOASTracker() *MOASTracker {
+	return &MOASTracker{
+		prefixes: map[string]map[int32]*originEntry{},
+		routes:   map[peerPrefix]int32{},
+	}
+}
+
+// Update applies a single message to the tracker, returning any MOAS events
+// caused by the message's announcements and withdrawals.
+func (m *MOASTracker) Update(rm *RisMessageData) []*MOASEvent {
+	if rm == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ts := rm.Time()
+	pk := peerKey{host: rm.Host, peer: rm.Peer}
+	var events []*MOASEvent
+
+	for _, prefix := range rm.Withdrawals {
+		if e := m.remove(peerPrefix{pk, prefix}, ts); e != nil {
+			events = append(events, e)
+		}
+	}
+
+	origin, ok := rm.OriginASN()
+	if !ok {
+		return events
+	}
+	for _, a := range rm.Announcements {
+		for _, prefix := range a.Prefixes {
+			pp := peerPrefix{pk, prefix}
+			if old, ok := m.routes[pp]; ok && old != origin {
+				// An implicit withdrawal of the route from the old origin.
+				if e := m.remove(pp, ts); e != nil {
+					events = append(events, e)
+				}
+			}
+			if e := m.add(pp, origin, ts); e != nil {
+				events = append(events, e)
+			}
+		}
+	}
+	return events
+}
+
+// add records origin as announcing the prefix via the peer in pp.
+func (m *MOASTracker) add(pp peerPrefix, origin int32, ts time.Time) *MOASEvent {
+	origins, ok := m.prefixes[pp.prefix]
+	if !ok {
+		origins = map[int32]*originEntry{}
+		m.prefixes[pp.prefix] = origins
+	}
+	before := len(origins)
+	oe, ok := origins[origin]
+	if !ok {
+		oe = &originEntry{firstSeen: ts, peers: map[peerKey]bool{}}
+		origins[origin] = oe
+	}
+	oe.lastSeen = ts
+	oe.peers[pp.peerKey] = true
+	m.routes[pp] = origin
+
+	if before == 1 && len(origins) == 2 {
+		return &MOASEvent{Kind: MOASStart, Prefix: pp.prefix, Origins: sortedOrigins(origins), Time: ts}
+	}
+	return nil
+}
+
+// remove withdraws the route for pp, expiring the origin if no peer carries it any longer.
+func (m *MOASTracker) remove(pp peerPrefix, ts time.Time) *MOASEvent {
+	origin, ok := m.routes[pp]
+	if !ok {
+		return nil
+	}
+	delete(m.routes, pp)
+	origins := m.prefixes[pp.prefix]
+	oe := origins[origin]
+	delete(oe.peers, pp.peerKey)
+	if len(oe.peers) > 0 {
+		return nil
+	}
+
+	before := len(origins)
+	delete(origins, origin)
+	if len(origins) == 0 {
+		delete(m.prefixes, pp.prefix)
+	}
+	if before == 2 {
+		return &MOASEvent{Kind: MOASEnd, Prefix: pp.prefix, Origins: sortedOrigins(origins), Time: ts}
+	}
+	return nil
+}
+
+// Prefix returns the origins currently seen for a prefix, sorted by origin ASN.
+func (m *MOASTracker) Prefix(prefix string) []*OriginState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []*OriginState
+	for origin, oe := range m.prefixes[prefix] {
+		collectors := map[string]bool{}
+		for pk := range oe.peers {
+			collectors[pk.host] = true
+		}
+		st := &OriginState{
+			Origin:    origin,
+			FirstSeen: oe.firstSeen,
+			LastSeen:  oe.lastSeen,
+		}
+		for c := range collectors {
+			st.Collectors = append(st.Collectors, c)
+		}
+		sort.Strings(st.Collectors)
+		result = append(result, st)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Origin < result[j].Origin })
+	return result
+}
+
+// Origin returns the prefixes currently originated by the ASN, sorted.
+func (m *MOASTracker) Origin(asn int32) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []string
+	for prefix, origins := range m.prefixes {
+		if _, ok := origins[asn]; ok {
+			result = append(result, prefix)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Conflicts returns all prefixes currently in a MOAS conflict, with their origins.
+func (m *MOASTracker) Conflicts() map[string][]int32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := map[string][]int32{}
+	for prefix, origins := range m.prefixes {
+		if len(origins) > 1 {
+			result[prefix] = sortedOrigins(origins)
+		}
+	}
+	return result
+}
+
+func sortedOrigins(origins map[int32]*originEntry) []int32 {
+	result := make([]int32, 0, len(origins))
+	for o := range origins {
+		result = append(result, o)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
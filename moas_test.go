@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// announce builds an UPDATE message from a peer on a collector for a set of prefixes.
+func announce(ts float64, host, peer string, path []interface{}, prefixes ...string) *RisMessageData {
+	rm := &RisMessageData{
+		Timestamp:     ts,
+		Host:          host,
+		Peer:          peer,
+		Type:          "UPDATE",
+		Path:          path,
+		Announcements: []*RisAnnouncement{{NextHop: peer, Prefixes: prefixes}},
+	}
+	digestPath(rm)
+	return rm
+}
+
+// withdraw builds an UPDATE message withdrawing a set of prefixes.
+func withdraw(ts float64, host, peer string, prefixes ...string) *RisMessageData {
+	return &RisMessageData{Timestamp: ts, Host: host, Peer: peer, Type: "UPDATE", Withdrawals: prefixes}
+}
+
+func TestMOASTrackerUpdate(t *testing.T) {
+	tests := []struct {
+		desc string
+		msgs []*RisMessageData
+		want []*MOASEvent
+	}{{
+		desc: "Success - single origin, no conflict",
+		msgs: []*RisMessageData{
+			announce(10, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			announce(11, "rrc01", "2.2.2.2", []interface{}{2, 100}, "192.0.2.0/24"),
+		},
+	}, {
+		desc: "Success - second origin starts a conflict",
+		msgs: []*RisMessageData{
+			announce(10, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			announce(11, "rrc01", "2.2.2.2", []interface{}{2, 200}, "192.0.2.0/24"),
+		},
+		want: []*MOASEvent{{Kind: MOASStart, Prefix: "192.0.2.0/24", Origins: []int32{100, 200}, Time: time.Unix(11, 0)}},
+	}, {
+		desc: "Success - withdrawal ends a conflict",
+		msgs: []*RisMessageData{
+			announce(10, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			announce(11, "rrc01", "2.2.2.2", []interface{}{2, 200}, "192.0.2.0/24"),
+			withdraw(12, "rrc01", "2.2.2.2", "192.0.2.0/24"),
+		},
+		want: []*MOASEvent{
+			{Kind: MOASStart, Prefix: "192.0.2.0/24", Origins: []int32{100, 200}, Time: time.Unix(11, 0)},
+			{Kind: MOASEnd, Prefix: "192.0.2.0/24", Origins: []int32{100}, Time: time.Unix(12, 0)},
+		},
+	}, {
+		desc: "Success - origin change from the same peer ends a conflict",
+		msgs: []*RisMessageData{
+			announce(10, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			announce(11, "rrc01", "2.2.2.2", []interface{}{2, 200}, "192.0.2.0/24"),
+			announce(12, "rrc01", "2.2.2.2", []interface{}{2, 100}, "192.0.2.0/24"),
+		},
+		want: []*MOASEvent{
+			{Kind: MOASStart, Prefix: "192.0.2.0/24", Origins: []int32{100, 200}, Time: time.Unix(11, 0)},
+			{Kind: MOASEnd, Prefix: "192.0.2.0/24", Origins: []int32{100}, Time: time.Unix(12, 0)},
+		},
+	}, {
+		desc: "Success - origin seen by another peer is not expired",
+		msgs: []*RisMessageData{
+			announce(10, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+			announce(11, "rrc01", "2.2.2.2", []interface{}{2, 200}, "192.0.2.0/24"),
+			announce(12, "rrc01", "3.3.3.3", []interface{}{3, 200}, "192.0.2.0/24"),
+			withdraw(13, "rrc01", "2.2.2.2", "192.0.2.0/24"),
+		},
+		want: []*MOASEvent{{Kind: MOASStart, Prefix: "192.0.2.0/24", Origins: []int32{100, 200}, Time: time.Unix(11, 0)}},
+	}}
+
+	for _, test := range tests {
+		m := NewMOASTracker()
+		var got []*MOASEvent
+		for _, rm := range test.msgs {
+			got = append(got, m.Update(rm)...)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestMOASTrackerQuery(t *testing.T) {
+	m := NewMOASTracker()
+	m.Update(announce(10, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24", "198.51.100.0/24"))
+	m.Update(announce(11, "rrc01", "2.2.2.2", []interface{}{2, 200}, "192.0.2.0/24"))
+	m.Update(announce(12, "rrc03", "3.3.3.3", []interface{}{3, 200}, "192.0.2.0/24"))
+
+	wantPrefix := []*OriginState{{
+		Origin:     100,
+		FirstSeen:  time.Unix(10, 0),
+		LastSeen:   time.Unix(10, 0),
+		Collectors: []string{"rrc00"},
+	}, {
+		Origin:     200,
+		FirstSeen:  time.Unix(11, 0),
+		LastSeen:   time.Unix(12, 0),
+		Collectors: []string{"rrc01", "rrc03"},
+	}}
+	if diff := cmp.Diff(m.Prefix("192.0.2.0/24"), wantPrefix); diff != "" {
+		t.Errorf("Prefix() got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if diff := cmp.Diff(m.Origin(100), []string{"192.0.2.0/24", "198.51.100.0/24"}); diff != "" {
+		t.Errorf("Origin() got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if diff := cmp.Diff(m.Conflicts(), map[string][]int32{"192.0.2.0/24": {100, 200}}); diff != "" {
+		t.Errorf("Conflicts() got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
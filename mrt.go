@@ -0,0 +1,412 @@
+// Read MRT files (RFC 6396), as the RIS archive publishes them: the updates
+// files, of BGP4MP and BGP4MP_ET records of each peer's BGP messages and state
+// changes, and the bview files, TABLE_DUMP_V2 snapshots of each peer's RIB.
+// Files may be gzip, bzip2 or zstd compressed.
+//
+// Records are converted to RisMessageData as RIS Live sends them. Each RIB entry
+// becomes an UPDATE announcing its prefix from its peer, so a RIB can be
+// bootstrapped from a bview, then the updates after it replayed, through the
+// same filters and detectors as the live stream.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+
+	log "github.com/golang/glog"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	mrtHeaderLen = 12
+	mrtMaxLen    = 1 << 24 // Larger records are taken as a corrupt file.
+)
+
+// MRT record types, and the subtypes which are decoded.
+const (
+	mrtTableDumpV2 = 13
+	mrtBGP4MP      = 16
+	mrtBGP4MPET    = 17
+
+	tdv2PeerIndexTable = 1
+	tdv2RIBIPv4Unicast = 2
+	tdv2RIBIPv6Unicast = 4
+
+	bgp4mpStateChange    = 0
+	bgp4mpMessage        = 1
+	bgp4mpMessageAS4     = 4
+	bgp4mpStateChangeAS4 = 5
+)
+
+// bgpEstablished is the BGP FSM state of an established session.
+const bgpEstablished = 6
+
+// mrtPeer is an entry of the PEER_INDEX_TABLE of a TABLE_DUMP_V2 file.
+type mrtPeer struct {
+	addr, asn string
+}
+
+// mrtRecordError is an MRT record which failed to decode. The reader continues
+// with the next record.
+type mrtRecordError struct {
+	typ, subtype uint16
+	err          error
+}
+
+func (e *mrtRecordError) Error() string {
+	return fmt.Sprintf("failed to decode MRT record of type %v subtype %v: %v", e.typ, e.subtype, e.err)
+}
+
+// isMRTRecordError reports whether err is an mrtRecordError, which skips the record.
+func isMRTRecordError(err error) bool {
+	_, ok := err.(*mrtRecordError)
+	return ok
+}
+
+// MRTReader reads the records of an MRT file as RisMessageData.
+type MRTReader struct {
+	Host string // The collector of the messages, ie: rrc00, which MRT does not record.
+
+	r       io.ReadCloser
+	c       io.Closer
+	peers   []mrtPeer         // The peers of RIB entries, from the PEER_INDEX_TABLE.
+	pending []*RisMessageData // The messages of the last record not yet returned.
+	err     error             // The error which ended the file.
+}
+
+// decompress returns a reader of the content of r, decompressed if it is gzip,
+// bzip2 or zstd compressed, which is detected by its magic bytes. Closing it
+// releases the decompressor, not r.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(r, 1<<16)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip header: %v", err)
+		}
+		return zr, nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return ioutil.NopCloser(bzip2.NewReader(br)), nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd header: %v", err)
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return ioutil.NopCloser(br), nil
+}
+
+// NewMRTReader creates an MRTReader of r, setting host as the collector of its messages.
+func NewMRTReader(r io.Reader, host string) (*MRTReader, error) {
+	dr, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	return &MRTReader{Host: host, r: dr}, nil
+}
+
+// OpenMRT opens an MRT file, see NewMRTReader.
+func OpenMRT(file, host string) (*MRTReader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MRT file(%v): %v", file, err)
+	}
+	m, err := NewMRTReader(f, host)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read MRT file(%v): %v", file, err)
+	}
+	m.c = f
+	return m, nil
+}
+
+// Close releases the decompressor, and closes the file of a reader created by OpenMRT.
+func (m *MRTReader) Close() error {
+	m.r.Close()
+	if m.c == nil {
+		return nil
+	}
+	return m.c.Close()
+}
+
+// Next returns the next message of the file, or io.EOF at its end. A record
+// which fails to decode returns an error, after which Next may be called to
+// continue with the next record. Records of other types are skipped.
+func (m *MRTReader) Next() (*RisMessageData, error) {
+	for len(m.pending) == 0 {
+		if m.err != nil {
+			return nil, m.err
+		}
+		var h [mrtHeaderLen]byte
+		if _, err := io.ReadFull(m.r, h[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = fmt.Errorf("truncated MRT record header")
+			}
+			m.err = err
+			return nil, err
+		}
+		ts := float64(binary.BigEndian.Uint32(h[0:]))
+		typ, subtype := binary.BigEndian.Uint16(h[4:]), binary.BigEndian.Uint16(h[6:])
+		l := binary.BigEndian.Uint32(h[8:])
+		if l > mrtMaxLen {
+			m.err = fmt.Errorf("MRT record length %v exceeds the maximum of %v", l, mrtMaxLen)
+			return nil, m.err
+		}
+		b := make([]byte, l)
+		if _, err := io.ReadFull(m.r, b); err != nil {
+			m.err = fmt.Errorf("truncated MRT record: %v", err)
+			return nil, m.err
+		}
+		msgs, err := m.record(typ, subtype, ts, b)
+		if err != nil {
+			return nil, &mrtRecordError{typ: typ, subtype: subtype, err: err}
+		}
+		m.pending = msgs
+	}
+	rm := m.pending[0]
+	m.pending = m.pending[1:]
+	return rm, nil
+}
+
+// record decodes the body of a record to its messages.
+func (m *MRTReader) record(typ, subtype uint16, ts float64, b []byte) ([]*RisMessageData, error) {
+	switch typ {
+	case mrtBGP4MPET:
+		if len(b) < 4 {
+			return nil, fmt.Errorf("truncated microsecond timestamp")
+		}
+		ts += float64(binary.BigEndian.Uint32(b)) / 1e6
+		b = b[4:]
+		fallthrough
+	case mrtBGP4MP:
+		rm, err := m.bgp4mp(subtype, ts, b)
+		if rm == nil || err != nil {
+			return nil, err
+		}
+		return []*RisMessageData{rm}, nil
+	case mrtTableDumpV2:
+		switch subtype {
+		case tdv2PeerIndexTable:
+			return nil, m.peerIndex(b)
+		case tdv2RIBIPv4Unicast:
+			return m.rib(afiIPv4, b)
+		case tdv2RIBIPv6Unicast:
+			return m.rib(afiIPv6, b)
+		}
+	}
+	log.V(2).Infof("skipping MRT record of type %v subtype %v", typ, subtype)
+	return nil, nil
+}
+
+// mrtAddr decodes an address of the family from the front of b.
+func mrtAddr(b []byte, afi int) (string, []byte, error) {
+	switch afi {
+	case afiIPv4:
+		if len(b) < net.IPv4len {
+			return "", nil, fmt.Errorf("truncated IPv4 address")
+		}
+		return net.IP(b[:net.IPv4len]).String(), b[net.IPv4len:], nil
+	case afiIPv6:
+		if len(b) < net.IPv6len {
+			return "", nil, fmt.Errorf("truncated IPv6 address")
+		}
+		return ipv6String(b[:net.IPv6len]), b[net.IPv6len:], nil
+	}
+	return "", nil, fmt.Errorf("unsupported address family %v", afi)
+}
+
+// mrtASN decodes an ASN of asnLen bytes from the front of b.
+func mrtASN(b []byte, asnLen int) (string, []byte) {
+	if asnLen == 4 {
+		return strconv.FormatUint(uint64(binary.BigEndian.Uint32(b)), 10), b[4:]
+	}
+	return strconv.FormatUint(uint64(binary.BigEndian.Uint16(b)), 10), b[2:]
+}
+
+// bgp4mp decodes a BGP4MP record, a BGP message or a state change of the peer.
+// State changes to or from established are RIS_PEER_STATE messages, other
+// changes, and locally generated messages, are skipped.
+func (m *MRTReader) bgp4mp(subtype uint16, ts float64, b []byte) (*RisMessageData, error) {
+	asnLen := 2
+	switch subtype {
+	case bgp4mpMessageAS4, bgp4mpStateChangeAS4:
+		asnLen = 4
+	case bgp4mpMessage, bgp4mpStateChange:
+	default:
+		log.V(2).Infof("skipping BGP4MP record subtype %v", subtype)
+		return nil, nil
+	}
+	if len(b) < 2*asnLen+4 {
+		return nil, fmt.Errorf("truncated BGP4MP header")
+	}
+	rm := &RisMessageData{Timestamp: ts, Host: m.Host}
+	rm.PeerASN, b = mrtASN(b, asnLen)
+	// The local ASN and interface index.
+	b = b[asnLen+2:]
+	afi := int(binary.BigEndian.Uint16(b))
+	var err error
+	if rm.Peer, b, err = mrtAddr(b[2:], afi); err != nil {
+		return nil, err
+	}
+	if _, b, err = mrtAddr(b, afi); err != nil {
+		return nil, err
+	}
+
+	if subtype == bgp4mpStateChange || subtype == bgp4mpStateChangeAS4 {
+		if len(b) < 4 {
+			return nil, fmt.Errorf("truncated BGP4MP state change")
+		}
+		old, state := binary.BigEndian.Uint16(b), binary.BigEndian.Uint16(b[2:])
+		switch {
+		case state == bgpEstablished:
+			rm.State = "connected"
+		case old == bgpEstablished:
+			rm.State = "down"
+		default:
+			return nil, nil
+		}
+		rm.Type = "RIS_PEER_STATE"
+		return rm, nil
+	}
+	if err := parseBGPMessage(b, asnLen == 4, rm); err != nil {
+		// Malformed attributes withdraw the UPDATE's prefixes (RFC 7606).
+		if _, ok := err.(*bgpAttrError); !ok {
+			return nil, err
+		}
+		log.Errorf("UPDATE from %v of %v: %v", rm.Peer, m.Host, err)
+	}
+	return rm, nil
+}
+
+// peerIndex decodes a PEER_INDEX_TABLE, the peers of the RIB entries which follow it.
+func (m *MRTReader) peerIndex(b []byte) error {
+	// The collector BGP ID, and the view name.
+	if len(b) < 6 {
+		return fmt.Errorf("truncated PEER_INDEX_TABLE header")
+	}
+	l := int(binary.BigEndian.Uint16(b[4:]))
+	if len(b) < 8+l {
+		return fmt.Errorf("truncated PEER_INDEX_TABLE view name")
+	}
+	n := int(binary.BigEndian.Uint16(b[6+l:]))
+	b = b[8+l:]
+	m.peers = make([]mrtPeer, n)
+	for i := range m.peers {
+		if len(b) < 5 {
+			return fmt.Errorf("truncated peer entry %v", i)
+		}
+		// The peer type flags the IPv6 address and 4 byte ASN, the BGP ID follows.
+		typ := b[0]
+		afi, asnLen := afiIPv4, 2
+		if typ&0x01 != 0 {
+			afi = afiIPv6
+		}
+		if typ&0x02 != 0 {
+			asnLen = 4
+		}
+		var err error
+		if m.peers[i].addr, b, err = mrtAddr(b[5:], afi); err != nil {
+			return fmt.Errorf("failed to decode peer entry %v: %v", i, err)
+		}
+		if len(b) < asnLen {
+			return fmt.Errorf("truncated peer entry %v ASN", i)
+		}
+		m.peers[i].asn, b = mrtASN(b, asnLen)
+	}
+	return nil
+}
+
+// rib decodes a RIB record of the address family, returning an UPDATE for each
+// peer's route to the prefix, timestamped when the peer's route was received.
+func (m *MRTReader) rib(afi int, b []byte) ([]*RisMessageData, error) {
+	size := net.IPv4len
+	if afi == afiIPv6 {
+		size = net.IPv6len
+	}
+	// The sequence number.
+	if len(b) < 5 {
+		return nil, fmt.Errorf("truncated RIB header")
+	}
+	n, l, err := parsePrefixBytes(b[4:], size)
+	if err != nil {
+		return nil, err
+	}
+	b = b[4+l:]
+	if len(b) < 2 {
+		return nil, fmt.Errorf("truncated RIB entry count")
+	}
+	count := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	prefix := n.String()
+
+	var result []*RisMessageData
+	for i := 0; i < count; i++ {
+		if len(b) < 8 {
+			return nil, fmt.Errorf("truncated RIB entry %v", i)
+		}
+		idx := int(binary.BigEndian.Uint16(b))
+		if idx >= len(m.peers) {
+			return nil, fmt.Errorf("RIB entry %v of unknown peer %v", i, idx)
+		}
+		ts := float64(binary.BigEndian.Uint32(b[2:]))
+		attrs, rest, err := bgpField(b[6:], "RIB entry attributes")
+		if err != nil {
+			return nil, err
+		}
+		b = rest
+		// TABLE_DUMP_V2 paths are always of 4 byte ASNs.
+		a, err := parseBGPAttrs(attrs, true, afi)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode RIB entry %v: %v", i, err)
+		}
+		rm := &RisMessageData{
+			Timestamp: ts,
+			Host:      m.Host,
+			Peer:      m.peers[idx].addr,
+			PeerASN:   m.peers[idx].asn,
+			Type:      "UPDATE",
+		}
+		a.apply(rm)
+		nextHops := a.mpNextHop
+		if afi == afiIPv4 && a.nextHop != "" {
+			nextHops = []string{a.nextHop}
+		}
+		for _, nh := range nextHops {
+			rm.Announcements = append(rm.Announcements, &RisAnnouncement{NextHop: nh, Prefixes: []string{prefix}})
+		}
+		result = append(result, rm)
+	}
+	return result, nil
+}
+
+// readMRT reads the MRT files in order to the channel, ie: a bview followed by
+// the updates files after it. Records which fail to decode are logged and skipped.
+func (r *RisLive) readMRT(logf io.Writer) error {
+	for _, file := range r.MRTFiles {
+		m, err := OpenMRT(file, r.MRTHost)
+		if err != nil {
+			return err
+		}
+		err = r.readMessages(m, isMRTRecordError, logf)
+		m.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read MRT file(%v): %v", file, err)
+		}
+	}
+	return nil
+}
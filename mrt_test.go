@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/klauspost/compress/zstd"
+)
+
+// mrtRecord encodes an MRT record of the body.
+func mrtRecord(ts uint32, typ, subtype uint16, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	h := make([]byte, mrtHeaderLen)
+	binary.BigEndian.PutUint32(h, ts)
+	binary.BigEndian.PutUint16(h[4:], typ)
+	binary.BigEndian.PutUint16(h[6:], subtype)
+	binary.BigEndian.PutUint32(h[8:], uint32(len(b)))
+	return append(h, b...)
+}
+
+func u16(v uint16) []byte { return []byte{byte(v >> 8), byte(v)} }
+func u32(v uint32) []byte { return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)} }
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("failed to decode hex(%v): %v", s, err)
+	}
+	return b
+}
+
+// testUpdate returns an UPDATE, of 4 byte ASNs, and its message as received
+// from the peer of asn at ts by host.
+func testUpdate(t *testing.T, ts float64, host, peer, asn string) ([]byte, *RisMessageData) {
+	raw := "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF003E02000000234001010040020A02020000E15F00009312400304C43C09A5E00808E15F2EE0E15F2EE118C43246"
+	return mustHex(t, raw), &RisMessageData{
+		Timestamp:     ts,
+		Host:          host,
+		Peer:          peer,
+		PeerASN:       asn,
+		Type:          "UPDATE",
+		DigestedPath:  []int32{57695, 37650},
+		Community:     [][]int32{{57695, 12000}, {57695, 12001}},
+		Origin:        "igp",
+		Announcements: []*RisAnnouncement{{NextHop: "196.60.9.165", Prefixes: []string{"196.50.70.0/24"}}},
+		Raw:           raw,
+	}
+}
+
+// testWithdrawal returns an UPDATE of malformed attributes, an ORIGIN of 2
+// bytes, and its message as received from the peer of asn at ts by host: the
+// withdrawal of 192.0.2.0/24 and of its NLRI 198.51.100.0/24.
+func testWithdrawal(t *testing.T, ts float64, host, peer, asn string) ([]byte, *RisMessageData) {
+	raw := "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" + "0034" + "02" + "0004" + "18C00002" + "0015" +
+		"4001020000" + "400206" + "0202FBF0FBF1" + "400304C0000201" + "18C63364"
+	return mustHex(t, raw), &RisMessageData{
+		Timestamp:   ts,
+		Host:        host,
+		Peer:        peer,
+		PeerASN:     asn,
+		Type:        "UPDATE",
+		Withdrawals: []string{"192.0.2.0/24", "198.51.100.0/24"},
+		Raw:         raw,
+	}
+}
+
+// readMessages reads every message of a reader, returning the number of errors
+// for which skip is true.
+func readMessages(t *testing.T, m messageReader, skip func(error) bool) ([]*RisMessageData, int) {
+	t.Helper()
+	var msgs []*RisMessageData
+	var errs int
+	for {
+		rm, err := m.Next()
+		switch {
+		case err == nil:
+			msgs = append(msgs, rm)
+		case skip(err):
+			errs++
+		case err == io.EOF:
+			return msgs, errs
+		default:
+			t.Fatalf("failed to read: %v", err)
+		}
+	}
+}
+
+// testReader checks that a reader returns want, skipping wantErrs messages.
+func testReader(t *testing.T, desc string, m messageReader, skip func(error) bool, want []*RisMessageData, wantErrs int) {
+	t.Helper()
+	got, errs := readMessages(t, m, skip)
+	if errs != wantErrs {
+		t.Errorf("[%v]: got %v skipped errors, want %v", desc, errs, wantErrs)
+	}
+	if diff := cmp.Diff(got, want, cmpopts.EquateEmpty(), cmpopts.EquateApprox(0, 1e-6)); diff != "" {
+		t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", desc, diff)
+	}
+}
+
+// testReaderFailure checks that a reader fails with an error which is not
+// skipped, and which ends it.
+func testReaderFailure(t *testing.T, desc string, m messageReader, skip func(error) bool) {
+	t.Helper()
+	var err error
+	for err == nil {
+		_, err = m.Next()
+	}
+	if skip(err) || err == io.EOF {
+		t.Errorf("[%v]: got %v, want a read error", desc, err)
+	}
+	if _, err2 := m.Next(); err2 != err {
+		t.Errorf("[%v]: got %v after the error, want %v", desc, err2, err)
+	}
+}
+
+// testMRT returns the records of a bview and updates file, and the messages they hold.
+func testMRT(t *testing.T) ([]byte, []*RisMessageData) {
+	peer4, peer6 := net.ParseIP("192.0.2.1").To4(), net.ParseIP("2001:db8::1")
+	local := net.ParseIP("192.0.2.254").To4()
+	update, updateMsg := testUpdate(t, 1558620047.08, "rrc00", "192.0.2.1", "57695")
+	withdrawal, withdrawalMsg := testWithdrawal(t, 1558620047, "rrc00", "192.0.2.1", "64496")
+	records := [][]byte{
+		mrtRecord(1558620000, mrtTableDumpV2, tdv2PeerIndexTable,
+			local, u16(4), []byte("rrc0"), u16(2),
+			[]byte{0x02}, peer4, peer4, u32(4200000000),
+			[]byte{0x03}, peer4, peer6, u32(64497)),
+		mrtRecord(1558620000, mrtTableDumpV2, tdv2RIBIPv4Unicast,
+			u32(0), []byte{24, 8, 8, 8}, u16(1),
+			u16(0), u32(1558610000), u16(24),
+			mustHex(t, "40010100"), mustHex(t, "40020A"), mustHex(t, "0202FA56EA0000003B41"), mustHex(t, "400304C0000201")),
+		mrtRecord(1558620000, mrtTableDumpV2, tdv2RIBIPv6Unicast,
+			u32(1), []byte{32, 0x20, 0x01, 0x0d, 0xb8}, u16(1),
+			u16(1), u32(1558610001), u16(37),
+			mustHex(t, "40010100"), mustHex(t, "40020A"), mustHex(t, "02020000FBF10000FBFF"), mustHex(t, "800E11"), []byte{16}, peer6),
+		// A TABLE_DUMP record, which is not supported.
+		mrtRecord(1558620000, 12, 1, u32(0)),
+		mrtRecord(1558620047, mrtBGP4MPET, bgp4mpMessageAS4,
+			u32(80000), u32(57695), u32(12654), u16(0), u16(afiIPv4), peer4, local, update),
+		// Malformed attributes, which withdraw the prefixes.
+		mrtRecord(1558620047, mrtBGP4MP, bgp4mpMessage,
+			u16(64496), u16(12654), u16(0), u16(afiIPv4), peer4, local, withdrawal),
+		// A truncated message, which fails to decode.
+		mrtRecord(1558620048, mrtBGP4MP, bgp4mpMessage, u16(57695), u16(12654), u16(0), u16(afiIPv4), peer4),
+		// A state change other than to or from established, which is skipped.
+		mrtRecord(1558620049, mrtBGP4MP, bgp4mpStateChange,
+			u16(57695), u16(12654), u16(0), u16(afiIPv4), peer4, local, u16(1), u16(2)),
+		mrtRecord(1558620050, mrtBGP4MP, bgp4mpStateChangeAS4,
+			u32(64497), u32(12654), u16(0), u16(afiIPv6), peer6, net.ParseIP("2001:db8::fe"), u16(bgpEstablished), u16(1)),
+	}
+	want := []*RisMessageData{{
+		Timestamp:     1558610000,
+		Host:          "rrc00",
+		Peer:          "192.0.2.1",
+		PeerASN:       "4200000000",
+		Type:          "UPDATE",
+		Origin:        "igp",
+		DigestedPath:  []int32{int32(-94967296), 15169},
+		Announcements: []*RisAnnouncement{{NextHop: "192.0.2.1", Prefixes: []string{"8.8.8.0/24"}}},
+	}, {
+		Timestamp:     1558610001,
+		Host:          "rrc00",
+		Peer:          "2001:db8::1",
+		PeerASN:       "64497",
+		Type:          "UPDATE",
+		Origin:        "igp",
+		DigestedPath:  []int32{64497, 64511},
+		Announcements: []*RisAnnouncement{{NextHop: "2001:db8::1", Prefixes: []string{"2001:db8::/32"}}},
+	}, updateMsg, withdrawalMsg, {
+		Timestamp: 1558620050,
+		Host:      "rrc00",
+		Peer:      "2001:db8::1",
+		PeerASN:   "64497",
+		Type:      "RIS_PEER_STATE",
+		State:     "down",
+	}}
+	return bytes.Join(records, nil), want
+}
+
+func TestMRTReader(t *testing.T) {
+	raw, want := testMRT(t)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(raw)
+	zw.Close()
+	var zst bytes.Buffer
+	zsw, err := zstd.NewWriter(&zst)
+	if err != nil {
+		t.Fatalf("failed to create zstd writer: %v", err)
+	}
+	zsw.Write(raw)
+	zsw.Close()
+	bz, err := ioutil.ReadFile("testdata/mrt.bz2")
+	if err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+
+	tests := []struct {
+		desc string
+		data []byte
+	}{{
+		desc: "Success - uncompressed",
+		data: raw,
+	}, {
+		desc: "Success - gzip",
+		data: gz.Bytes(),
+	}, {
+		desc: "Success - bzip2",
+		data: bz,
+	}, {
+		desc: "Success - zstd",
+		data: zst.Bytes(),
+	}}
+	for _, test := range tests {
+		m, err := NewMRTReader(bytes.NewReader(test.data), "rrc00")
+		if err != nil {
+			t.Errorf("[%v]: failed to create reader: %v", test.desc, err)
+			continue
+		}
+		testReader(t, test.desc, m, isMRTRecordError, want, 1)
+	}
+}
+
+func TestMRTReaderFailure(t *testing.T) {
+	tests := []struct {
+		desc string
+		data []byte
+	}{{
+		desc: "Failure - truncated header",
+		data: []byte{0, 0, 0, 1, 0, 16},
+	}, {
+		desc: "Failure - truncated record",
+		data: mrtRecord(1, mrtBGP4MP, bgp4mpMessage, make([]byte, 10))[:15],
+	}, {
+		desc: "Failure - record too long",
+		data: []byte{0, 0, 0, 1, 0, 16, 0, 1, 0xff, 0xff, 0xff, 0xff},
+	}, {
+		desc: "Failure - bad gzip",
+		data: []byte{0x1f, 0x8b, 0x08, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3},
+	}}
+	for _, test := range tests {
+		m, err := NewMRTReader(bytes.NewReader(test.data), "rrc00")
+		if err != nil {
+			continue
+		}
+		testReaderFailure(t, test.desc, m, isMRTRecordError)
+	}
+}
+
+func TestListenMRT(t *testing.T) {
+	raw, want := testMRT(t)
+	f, err := ioutil.TempFile("", "mrt")
+	if err != nil {
+		t.Fatalf("failed to create MRT file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(raw); err != nil {
+		t.Fatalf("failed to write MRT file: %v", err)
+	}
+	r := &RisLive{
+		File:      new(string),
+		Filter:    &RisFilter{},
+		Chan:      make(chan RisMessage, 10),
+		MRTFiles:  []string{f.Name(), f.Name()},
+		MRTHost:   "rrc00",
+		Prefilter: func(rm *RisMessageData) bool { return rm.Type == "UPDATE" },
+	}
+	go r.Listen()
+	var got []*RisMessageData
+	for rm := range r.Chan {
+		got = append(got, rm.Data)
+	}
+	// Both files are read, the prefilter selecting the updates.
+	want = append(want[:4:4], want[:4]...)
+	if diff := cmp.Diff(got, want, cmpopts.EquateEmpty(), cmpopts.EquateApprox(0, 1e-6)); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
@@ -0,0 +1,326 @@
+// Archive messages as MRT BGP4MP_ET records (RFC 6396), which standard tools,
+// bgpdump or bgpreader, and MRTReader read.
+//
+// As the RIS archive, each collector's messages are written to files of a fixed
+// period, Dir/<collector>/updates.YYYYMMDD.HHMM, gzip compressed if Gzip is set.
+// Files are rotated by the message timestamps, so a replay archives as a live
+// stream would. A file whose period is over is also closed by Run, once the
+// stream time, advanced by the clock while the stream is quiet, passes it, so a
+// quiet collector's file is complete. A message which carries its raw BGP
+// message is written as it was received, others are encoded from their fields.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// mrtFile is an open archive file.
+type mrtFile struct {
+	start time.Time
+	fd    *os.File
+	zw    *gzip.Writer
+	w     *bufio.Writer
+}
+
+func (f *mrtFile) Close() error {
+	err := f.w.Flush()
+	if f.zw != nil {
+		if zerr := f.zw.Close(); err == nil {
+			err = zerr
+		}
+	}
+	if cerr := f.fd.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// MRTWriter writes messages to rotating MRT files.
+type MRTWriter struct {
+	Dir      string
+	Interval time.Duration // The period of each file, files start at a multiple of it.
+	Gzip     bool
+	LocalASN uint32 // The ASN of the collector, MRT records the local end of each session.
+
+	mu     sync.Mutex
+	files  map[string]*mrtFile // collector -> open file.
+	latest time.Time           // The latest message timestamp written.
+	seen   time.Time           // The time latest was written.
+	now    func() time.Time
+}
+
+// NewMRTWriter creates an MRTWriter of files of interval under dir.
+func NewMRTWriter(dir string, interval time.Duration, gz bool) *MRTWriter {
+	return &MRTWriter{Dir: dir, Interval: interval, Gzip: gz, files: map[string]*mrtFile{}, now: time.Now}
+}
+
+// mrtFileName returns the name of the file of the collector starting at start.
+func (w *MRTWriter) mrtFileName(host string, start time.Time) string {
+	name := filepath.Join(w.Dir, host, start.UTC().Format("updates.20060102.1504"))
+	if w.Gzip {
+		name += ".gz"
+	}
+	return name
+}
+
+// file returns the file of the collector for a message at ts, rotating the open
+// file if ts is past its period. Earlier messages are written to the open file.
+func (w *MRTWriter) file(host string, ts time.Time) (*mrtFile, error) {
+	f, ok := w.files[host]
+	if ok && ts.Before(f.start.Add(w.Interval)) {
+		return f, nil
+	}
+	if ok {
+		delete(w.files, host)
+		if err := f.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close MRT file: %v", err)
+		}
+	}
+	start := ts.Truncate(w.Interval)
+	name := w.mrtFileName(host, start)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create MRT directory: %v", err)
+	}
+	// A file which exists, ie: after a restart, is appended to. A gzip file
+	// gains a second member, which gzip readers continue into.
+	fd, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MRT file(%v): %v", name, err)
+	}
+	f = &mrtFile{start: start, fd: fd}
+	var out io.Writer = fd
+	if w.Gzip {
+		f.zw = gzip.NewWriter(fd)
+		out = f.zw
+	}
+	f.w = bufio.NewWriter(out)
+	w.files[host] = f
+	return f, nil
+}
+
+// Write appends the records of a message to its collector's file.
+func (w *MRTWriter) Write(rm *RisMessageData) error {
+	records, err := mrtRecords(rm, w.LocalASN)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ts := rm.Time()
+	if ts.After(w.latest) {
+		w.latest, w.seen = ts, w.now()
+	}
+	f, err := w.file(rm.Host, ts)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if _, err := f.w.Write(r); err != nil {
+			return fmt.Errorf("failed to write MRT record: %v", err)
+		}
+	}
+	return nil
+}
+
+// Run writes the messages of in until it is closed, logging those which fail.
+// Files whose period is over are closed every tenth of the Interval.
+func (w *MRTWriter) Run(in <-chan RisMessage) {
+	t := time.NewTicker(w.Interval / 10)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			if err := w.Expire(now); err != nil {
+				log.Errorf("failed to close expired MRT files: %v", err)
+			}
+		case rm, ok := <-in:
+			if !ok {
+				return
+			}
+			if rm.Data == nil {
+				rm.Release()
+				continue
+			}
+			if err := w.Write(rm.Data); err != nil {
+				log.Errorf("failed to archive message(%v): %v", rm.Data.ID, err)
+			}
+			rm.Release()
+		}
+	}
+}
+
+// Expire closes the files whose period is over at the stream time of now: the
+// latest message timestamp written, advanced by the time since it was written.
+func (w *MRTWriter) Expire(now time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.latest.IsZero() {
+		return nil
+	}
+	streamNow := w.latest.Add(now.Sub(w.seen))
+	var err error
+	for host, f := range w.files {
+		if streamNow.Before(f.start.Add(w.Interval)) {
+			continue
+		}
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to close MRT file: %v", cerr)
+		}
+		delete(w.files, host)
+	}
+	return err
+}
+
+// Close closes the open files.
+func (w *MRTWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var err error
+	for host, f := range w.files {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to close MRT file: %v", cerr)
+		}
+		delete(w.files, host)
+	}
+	return err
+}
+
+// rawBGPMessage returns the raw BGP message of rm, and whether its ASNs are of 4
+// bytes. RIS Live does not say, so a path decoded from the raw message is
+// compared with the message's path.
+func rawBGPMessage(rm *RisMessageData) ([]byte, bool, bool) {
+	if rm.Raw == "" {
+		return nil, false, false
+	}
+	b, err := hex.DecodeString(rm.Raw)
+	if err != nil {
+		return nil, false, false
+	}
+	for _, as4 := range []bool{true, false} {
+		var d RisMessageData
+		if parseBGPMessage(b, as4, &d) != nil {
+			continue
+		}
+		if d.Type != "UPDATE" || equalASPath(d.DigestedPath, rm.DigestedPath) {
+			return b, as4, true
+		}
+	}
+	return nil, false, false
+}
+
+func equalASPath(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mrtRecords encodes a message as BGP4MP_ET records. Peer state changes are
+// recorded as a transition to or from established. Messages other than UPDATEs
+// and KEEPALIVEs without their raw BGP message, are not recorded.
+func mrtRecords(rm *RisMessageData, localASN uint32) ([][]byte, error) {
+	var msgs [][]byte
+	as4, subtype := true, uint16(bgp4mpMessageAS4)
+	if raw, a, ok := rawBGPMessage(rm); ok {
+		msgs, as4 = [][]byte{raw}, a
+		if !as4 {
+			subtype = bgp4mpMessage
+		}
+	} else {
+		switch rm.Type {
+		case "UPDATE":
+			var err error
+			if msgs, err = encodeBGPUpdates(rm); err != nil {
+				return nil, err
+			}
+		case "KEEPALIVE":
+			msgs = [][]byte{bgpMessage(bgpKeepalive, nil)}
+		case "RIS_PEER_STATE":
+			subtype = bgp4mpStateChangeAS4
+			switch rm.State {
+			case "connected":
+				msgs = [][]byte{{0, 5, 0, bgpEstablished}}
+			case "down":
+				msgs = [][]byte{{0, bgpEstablished, 0, 1}}
+			}
+		}
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+
+	peer := net.ParseIP(rm.Peer)
+	if peer == nil {
+		return nil, fmt.Errorf("failed to parse peer: %q", rm.Peer)
+	}
+	afi, local := afiIPv6, net.IPv6unspecified
+	if p4 := peer.To4(); p4 != nil && ipv6String(peer) != rm.Peer {
+		afi, peer, local = afiIPv4, p4, net.IPv4zero.To4()
+	}
+	var peerASN uint64
+	if rm.PeerASN != "" {
+		var err error
+		if peerASN, err = strconv.ParseUint(rm.PeerASN, 10, 32); err != nil {
+			return nil, fmt.Errorf("failed to parse peer ASN(%v): %v", rm.PeerASN, err)
+		}
+	}
+	sec, frac := math.Modf(rm.Timestamp)
+	usec := uint32(math.Round(frac * 1e6))
+	if usec >= 1e6 {
+		sec, usec = sec+1, 0
+	}
+
+	var hdr []byte
+	if as4 {
+		hdr = make([]byte, 12)
+		binary.BigEndian.PutUint32(hdr, uint32(peerASN))
+		binary.BigEndian.PutUint32(hdr[4:], localASN)
+	} else {
+		hdr = make([]byte, 8)
+		binary.BigEndian.PutUint16(hdr, asn2(uint32(peerASN)))
+		binary.BigEndian.PutUint16(hdr[2:], asn2(localASN))
+	}
+	// The interface index is left 0.
+	binary.BigEndian.PutUint16(hdr[len(hdr)-2:], uint16(afi))
+	hdr = append(append(hdr, peer...), local...)
+
+	var result [][]byte
+	for _, m := range msgs {
+		l := 4 + len(hdr) + len(m)
+		r := make([]byte, mrtHeaderLen+4, mrtHeaderLen+l)
+		binary.BigEndian.PutUint32(r, uint32(sec))
+		binary.BigEndian.PutUint16(r[4:], mrtBGP4MPET)
+		binary.BigEndian.PutUint16(r[6:], subtype)
+		binary.BigEndian.PutUint32(r[8:], uint32(l))
+		binary.BigEndian.PutUint32(r[12:], usec)
+		result = append(result, append(append(r, hdr...), m...))
+	}
+	return result, nil
+}
+
+// asn2 returns an ASN as a 2 byte ASN, AS_TRANS if it is of 4 bytes (RFC 6793).
+func asn2(asn uint32) uint16 {
+	if asn > math.MaxUint16 {
+		return bgpASTrans
+	}
+	return uint16(asn)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// readTestMessages reads the messages of a RIS Live capture.
+func readTestMessages(t *testing.T, file string) []*RisMessageData {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("failed to open testdata: %v", err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	var msgs []*RisMessageData
+	for s.Scan() {
+		var rm RisMessage
+		if err := json.Unmarshal(s.Bytes(), &rm); err != nil {
+			t.Fatalf("failed to parse testdata(%s): %v", s.Bytes(), err)
+		}
+		if err := digestPath(rm.Data); err != nil {
+			t.Fatalf("failed to digest path(%v): %v", rm.Data.Path, err)
+		}
+		// Messages are decoded without a Path, as by a RisDecoder.
+		rm.Data.Path = nil
+		msgs = append(msgs, rm.Data)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+	return msgs
+}
+
+// readMRTDir reads every message of the MRT files of a directory tree, in file name order.
+func readMRTDir(t *testing.T, dir string) ([]*RisMessageData, []string) {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to list MRT files: %v", err)
+	}
+	var msgs []*RisMessageData
+	var names []string
+	for _, file := range files {
+		rel, _ := filepath.Rel(dir, file)
+		names = append(names, rel)
+		m, err := OpenMRT(file, filepath.Dir(rel))
+		if err != nil {
+			t.Fatalf("failed to open MRT file(%v): %v", file, err)
+		}
+		got, errs := readMessages(t, m, isMRTRecordError)
+		m.Close()
+		if errs != 0 {
+			t.Errorf("got %v record errors in %v, want 0", errs, file)
+		}
+		msgs = append(msgs, got...)
+	}
+	return msgs, names
+}
+
+func TestMRTWriterRoundTrip(t *testing.T) {
+	tests := []struct {
+		desc   string
+		gz     bool
+		noRaw  bool
+		ignore []string
+	}{{
+		desc: "Success - raw messages",
+	}, {
+		desc: "Success - raw messages gzip compressed",
+		gz:   true,
+	}, {
+		desc:   "Success - messages encoded from their fields",
+		noRaw:  true,
+		ignore: []string{"Raw"},
+	}}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "mrt")
+		if err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		want := readTestMessages(t, "testdata/1k-msgs")
+		w := NewMRTWriter(dir, 24*time.Hour, test.gz)
+		for _, rm := range want {
+			if test.noRaw {
+				rm.Raw = ""
+			}
+			if err := w.Write(rm); err != nil {
+				t.Fatalf("[%v]: failed to write message(%v): %v", test.desc, rm.ID, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("[%v]: failed to close writer: %v", test.desc, err)
+		}
+
+		// Each collector's file is read in turn.
+		sort.SliceStable(want, func(i, j int) bool { return want[i].Host < want[j].Host })
+		got, _ := readMRTDir(t, dir)
+		opts := []cmp.Option{
+			cmpopts.EquateEmpty(),
+			cmpopts.EquateApprox(0, 1e-6),
+			cmpopts.IgnoreFields(RisMessageData{}, append(test.ignore, "ID")...),
+		}
+		if diff := cmp.Diff(got, want, opts...); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestMRTWriterRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mrt")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	msg := func(ts float64, host, state string) *RisMessageData {
+		return &RisMessageData{Timestamp: ts, Host: host, Peer: "192.0.2.1", PeerASN: "64496", Type: "RIS_PEER_STATE", State: state}
+	}
+	msgs := []*RisMessageData{
+		msg(1558620000, "rrc00", "connected"),
+		msg(1558620010, "rrc01", "connected"),
+		msg(1558620299.5, "rrc00", "down"),
+		msg(1558620300, "rrc00", "connected"),
+		// An earlier message is written to the open file.
+		msg(1558620100, "rrc00", "down"),
+		// Unrecorded messages create no file.
+		{Timestamp: 1558621000, Host: "rrc02", Peer: "192.0.2.1", Type: "OPEN"},
+	}
+	w := NewMRTWriter(dir, 5*time.Minute, false)
+	for _, rm := range msgs {
+		if err := w.Write(rm); err != nil {
+			t.Fatalf("failed to write message: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close writer: %v", err)
+	}
+
+	got, names := readMRTDir(t, dir)
+	wantNames := []string{"rrc00/updates.20190523.1400", "rrc00/updates.20190523.1405", "rrc01/updates.20190523.1400"}
+	if diff := cmp.Diff(names, wantNames); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	want := []*RisMessageData{msgs[0], msgs[2], msgs[3], msgs[4], msgs[1]}
+	if diff := cmp.Diff(got, want, cmpopts.EquateApprox(0, 1e-6)); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+func TestMRTWriterMappedPrefix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mrt")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An IPv4-mapped IPv6 prefix is encoded as IPv6, its mask is of 128 bits.
+	rm := &RisMessageData{
+		Timestamp:     1558620000,
+		Peer:          "2001:db8::1",
+		PeerASN:       "64496",
+		Host:          "rrc00",
+		Type:          "UPDATE",
+		Origin:        "igp",
+		Path:          []interface{}{float64(64496)},
+		DigestedPath:  []int32{64496},
+		Announcements: []*RisAnnouncement{{NextHop: "2001:db8::1", Prefixes: []string{"::ffff:1.2.3.0/120"}}},
+		Withdrawals:   []string{"::ffff:1.2.4.0/120"},
+	}
+	w := NewMRTWriter(dir, 24*time.Hour, false)
+	if err := w.Write(rm); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close writer: %v", err)
+	}
+	got, _ := readMRTDir(t, dir)
+	if len(got) != 1 {
+		t.Fatalf("got %d messages, want 1", len(got))
+	}
+	// The NLRI of MP_REACH_NLRI and MP_UNREACH_NLRI, of IPv6 unicast.
+	for _, nlri := range []string{
+		"00" + "78" + "00000000000000000000FFFF010203",
+		"800F13" + "000201" + "78" + "00000000000000000000FFFF010204",
+	} {
+		if !strings.Contains(got[0].Raw, nlri) {
+			t.Errorf("got raw message %v, want NLRI %v", got[0].Raw, nlri)
+		}
+	}
+}
+
+func TestMRTRecordsASTrans(t *testing.T) {
+	// A 2 byte session of a 4 byte peer: AS_PATH 64496 23456, AS4_PATH 4200000000.
+	rm := &RisMessageData{
+		Timestamp:    1558620000,
+		Peer:         "192.0.2.1",
+		PeerASN:      "4200000000",
+		Host:         "rrc00",
+		Type:         "UPDATE",
+		DigestedPath: []int32{64496, int32(-94967296)},
+		Raw: "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF" + "0038" + "02" + "0000" + "001D" +
+			"40010100" + "400206" + "0202FBF05BA0" + "C01106" + "0201FA56EA00" + "400304C0000201" +
+			"18C63364",
+	}
+	records, err := mrtRecords(rm, 4200000001)
+	if err != nil {
+		t.Fatalf("failed to encode records: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	r := records[0]
+	if subtype := binary.BigEndian.Uint16(r[6:]); subtype != bgp4mpMessage {
+		t.Errorf("got subtype %v, want %v", subtype, bgp4mpMessage)
+	}
+	// The peer and local ASNs follow the microseconds.
+	hdr := r[mrtHeaderLen+4:]
+	if peer, local := binary.BigEndian.Uint16(hdr), binary.BigEndian.Uint16(hdr[2:]); peer != bgpASTrans || local != bgpASTrans {
+		t.Errorf("got peer and local ASNs %v and %v, want AS_TRANS", peer, local)
+	}
+}
+
+func TestMRTWriterExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mrt")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Unix(1600000000, 0)
+	w := NewMRTWriter(dir, 5*time.Minute, true)
+	w.now = func() time.Time { return now }
+	rm := &RisMessageData{Timestamp: 1558620060, Host: "rrc00", Peer: "192.0.2.1", PeerASN: "64496", Type: "RIS_PEER_STATE", State: "connected"}
+	if err := w.Write(rm); err != nil {
+		t.Fatalf("failed to write message: %v", err)
+	}
+
+	// The file's period ends 4 minutes after the message.
+	tests := []struct {
+		desc      string
+		now       time.Time
+		wantFiles int
+	}{{
+		desc:      "Success - period not over",
+		now:       now.Add(3 * time.Minute),
+		wantFiles: 1,
+	}, {
+		desc:      "Success - period over",
+		now:       now.Add(4 * time.Minute),
+		wantFiles: 0,
+	}}
+	for _, test := range tests {
+		if err := w.Expire(test.now); err != nil {
+			t.Fatalf("[%v]: failed to expire files: %v", test.desc, err)
+		}
+		if got := len(w.files); got != test.wantFiles {
+			t.Errorf("[%v]: got %d open files, want %d", test.desc, got, test.wantFiles)
+		}
+	}
+
+	// The expired file is complete, without closing the writer.
+	got, _ := readMRTDir(t, dir)
+	if diff := cmp.Diff(got, []*RisMessageData{rm}, cmpopts.EquateApprox(0, 1e-6)); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
@@ -0,0 +1,105 @@
+// A parallel decode and filter pipeline. Raw messages are decoded, digested and
+// filtered by a pool of workers. Each peer's messages are handled by a single
+// worker, so the order of each peer's messages is preserved on output, while
+// messages of different peers may be reordered. Throughput scales with the
+// workers up to GOMAXPROCS, as they decode in parallel only on as many CPUs.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+)
+
+// DecodedMessage is the result of decoding a raw message. Its Message holds the
+// message, if pooled, which the receiver releases.
+type DecodedMessage struct {
+	Message RisMessage
+	Raw     []byte
+	Err     error // The message failed to decode, and should be dropped.
+	PathErr error // The message path failed to digest, the message is usable.
+	Match   bool  // The message passed the pipeline's Filter.
+}
+
+// DecodePipeline decodes raw messages with a pool of Workers.
+type DecodePipeline struct {
+	Workers int
+	Filter  func(rm *RisMessageData) bool // If set, evaluated by the workers for each message.
+	Buffer  int                           // The queue depth of each worker.
+	Decoder *RisDecoder                   // If set, used in place of encoding/json and digestPath.
+}
+
+// Run decodes the messages from in until it is closed, returning the channel of
+// decoded messages, which is closed when all messages have been decoded.
+func (p *DecodePipeline) Run(in <-chan []byte) <-chan DecodedMessage {
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	out := make(chan DecodedMessage, workers*p.Buffer)
+	queues := make([]chan []byte, workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan []byte, p.Buffer)
+		wg.Add(1)
+		go func(q <-chan []byte) {
+			defer wg.Done()
+			for raw := range q {
+				out <- p.decode(raw)
+			}
+		}(queues[i])
+	}
+
+	go func() {
+		for raw := range in {
+			queues[shard(raw, workers)] <- raw
+		}
+		for _, q := range queues {
+			close(q)
+		}
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// decode decodes, digests and filters a single message. The Decoder decodes
+// into pooled messages.
+func (p *DecodePipeline) decode(raw []byte) DecodedMessage {
+	d := DecodedMessage{Raw: raw}
+	if p.Decoder != nil {
+		d.Message = GetRisMessage()
+		if d.Err = p.Decoder.Decode(raw, &d.Message); d.Err != nil || d.Message.Data == nil {
+			return d
+		}
+	} else {
+		if d.Err = json.Unmarshal(raw, &d.Message); d.Err != nil || d.Message.Data == nil {
+			return d
+		}
+		d.PathErr = digestPath(d.Message.Data)
+	}
+	d.Match = p.Filter == nil || p.Filter(d.Message.Data)
+	return d
+}
+
+var peerField = []byte(`"peer":"`)
+
+// shard returns the worker for a raw message, by a hash of its peer address.
+// Messages without a peer, ie: pongs, go to the first worker.
+func shard(raw []byte, workers int) int {
+	if workers == 1 {
+		return 0
+	}
+	i := bytes.Index(raw, peerField)
+	if i < 0 {
+		return 0
+	}
+	peer := raw[i+len(peerField):]
+	if j := bytes.IndexByte(peer, '"'); j >= 0 {
+		peer = peer[:j]
+	}
+	h := fnv.New32a()
+	h.Write(peer)
+	return int(h.Sum32() % uint32(workers))
+}
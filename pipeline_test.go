@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// readLines returns the lines of a test file.
+func readLines(tb testing.TB, file string) [][]byte {
+	fd, err := ioutil.ReadFile(file)
+	if err != nil {
+		tb.Fatalf("failed to read %v: %v", file, err)
+	}
+	return bytes.Split(bytes.TrimSpace(fd), []byte("\n"))
+}
+
+func runPipeline(p *DecodePipeline, lines [][]byte) []DecodedMessage {
+	in := make(chan []byte)
+	out := p.Run(in)
+	go func() {
+		for _, l := range lines {
+			in <- l
+		}
+		close(in)
+	}()
+	var result []DecodedMessage
+	for d := range out {
+		result = append(result, d)
+	}
+	return result
+}
+
+func TestDecodePipeline(t *testing.T) {
+	lines := readLines(t, "testdata/1k-msgs")
+	lines = append(lines, []byte(`{"type":"ris_message","data":{"timestamp":"bad"}}`), []byte(`{"type":"pong","data":null}`))
+
+	// The expected order of each peer's messages, by ID.
+	want := map[string][]string{}
+	for _, l := range lines[:1000] {
+		var rm RisMessage
+		if err := json.Unmarshal(l, &rm); err != nil {
+			t.Fatalf("failed to decode test message: %v", err)
+		}
+		want[rm.Data.Peer] = append(want[rm.Data.Peer], rm.Data.ID)
+	}
+
+	for _, workers := range []int{1, 4, 16} {
+		desc := fmt.Sprintf("%d workers", workers)
+		p := &DecodePipeline{
+			Workers: workers,
+			Filter:  func(rm *RisMessageData) bool { return rm.Host == "rrc00" },
+			Buffer:  8,
+		}
+		got := map[string][]string{}
+		var errs, pongs, matches, rrc00 int
+		for _, d := range runPipeline(p, lines) {
+			switch {
+			case d.Err != nil:
+				errs++
+				continue
+			case d.Message.Type == "pong":
+				pongs++
+				continue
+			}
+			rmd := d.Message.Data
+			got[rmd.Peer] = append(got[rmd.Peer], rmd.ID)
+			if d.Match {
+				matches++
+			}
+			if rmd.Host == "rrc00" {
+				rrc00++
+			}
+			if d.PathErr == nil && len(rmd.DigestedPath) == 0 && len(rmd.Path) > 0 {
+				t.Errorf("[%v]: message %v was not digested", desc, rmd.ID)
+			}
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("[%v]: per-peer order got/want mismatch diff(-got, +want):\n%v\n", desc, diff)
+		}
+		if errs != 1 || pongs != 1 {
+			t.Errorf("[%v]: got %d errors and %d pongs, want 1 of each", desc, errs, pongs)
+		}
+		if matches != rrc00 || matches == 0 {
+			t.Errorf("[%v]: got %d matches, want %d", desc, matches, rrc00)
+		}
+	}
+}
+
+func TestShard(t *testing.T) {
+	a := []byte(`{"type":"ris_message","data":{"peer_asn":"1","peer":"192.0.2.1","id":"x"}}`)
+	b := []byte(`{"type":"ris_message","data":{"peer":"192.0.2.1","peer_asn":"1","id":"y"}}`)
+	if shard(a, 8) != shard(b, 8) {
+		t.Errorf("messages of the same peer got different shards")
+	}
+	if got := shard([]byte(`{"type":"pong"}`), 8); got != 0 {
+		t.Errorf("got shard %d for a message without a peer, want 0", got)
+	}
+}
+
+// BenchmarkDecodeSerial decodes testdata/1k-msgs on one goroutine, as Listen did.
+func BenchmarkDecodeSerial(b *testing.B) {
+	lines := readLines(b, "testdata/1k-msgs")
+	b.SetBytes(int64(len(bytes.Join(lines, nil))))
+	b.ReportAllocs()
+	p := &DecodePipeline{}
+	for i := 0; i < b.N; i++ {
+		for _, l := range lines {
+			p.decode(l)
+		}
+	}
+}
+
+// BenchmarkDecodePipeline decodes testdata/1k-msgs with increasing numbers of
+// workers, and with a worker for each of GOMAXPROCS, also with a RisDecoder
+// into pooled messages. Workers only add
+// throughput up to GOMAXPROCS, beyond it they add overhead, so the scaling is
+// seen by varying it:
+//
+//	go test -run NONE -bench DecodePipeline -cpu 1,2,4,8
+func BenchmarkDecodePipeline(b *testing.B) {
+	lines := readLines(b, "testdata/1k-msgs")
+	b.Run("workers=gomaxprocs", func(b *testing.B) {
+		b.SetBytes(int64(len(bytes.Join(lines, nil))))
+		b.ReportAllocs()
+		p := &DecodePipeline{Workers: runtime.GOMAXPROCS(0), Buffer: 64}
+		for i := 0; i < b.N; i++ {
+			runPipeline(p, lines)
+		}
+	})
+	b.Run("workers=gomaxprocs,decoder", func(b *testing.B) {
+		b.SetBytes(int64(len(bytes.Join(lines, nil))))
+		b.ReportAllocs()
+		p := &DecodePipeline{Workers: runtime.GOMAXPROCS(0), Buffer: 64, Decoder: NewRisDecoder()}
+		for i := 0; i < b.N; i++ {
+			for _, d := range runPipeline(p, lines) {
+				d.Message.Release()
+			}
+		}
+	})
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(bytes.Join(lines, nil))))
+			b.ReportAllocs()
+			p := &DecodePipeline{Workers: workers, Buffer: 64}
+			for i := 0; i < b.N; i++ {
+				runPipeline(p, lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+// Record the raw messages of RIS Live to time-rotated, gzip compressed files of
+// json lines, which a replay reads as they are.
+//
+// Each file is written as a series of gzip members, blocks, each of which can be
+// decompressed alone. The index of a recording, index.jsonl, has an entry of the
+// file, first and last message timestamps, and byte offset of each block, so a
+// replay of a time window can seek to the blocks which hold it, without reading
+// everything before them.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// recordIndexFile is the name of the index of a recording.
+const recordIndexFile = "index.jsonl"
+
+// RecordBlock is an entry of the index of a recording.
+type RecordBlock struct {
+	File   string  `json:"file"`   // The name of the file, in the recording directory.
+	First  float64 `json:"first"`  // The earliest timestamp of the block's messages, 0 if none have one.
+	Last   float64 `json:"last"`   // The latest timestamp of the block's messages.
+	Offset int64   `json:"offset"` // The byte offset of the block in the file.
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	*c.n += int64(n)
+	return n, err
+}
+
+// Recorder writes raw messages to the files of a recording.
+type Recorder struct {
+	Dir      string
+	Interval time.Duration // The period of each file, files start at a multiple of it.
+	Block    time.Duration // The period of each block, the granularity of the index.
+
+	now func() time.Time
+
+	mu     sync.Mutex
+	index  *os.File
+	f      *os.File
+	start  time.Time    // The start of the period of f.
+	offset int64        // The size of f.
+	zw     *gzip.Writer // The open block, nil between blocks.
+	block  RecordBlock  // The index entry of the open block.
+	opened time.Time    // When the open block was started.
+}
+
+// NewRecorder creates a Recorder of files of interval, indexed in blocks of
+// block, in dir. The index of an earlier recording in dir is appended to.
+func NewRecorder(dir string, interval, block time.Duration) (*Recorder, error) {
+	if interval <= 0 || block <= 0 {
+		return nil, fmt.Errorf("recording interval(%v) and block(%v) must be positive", interval, block)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %v", err)
+	}
+	name := filepath.Join(dir, recordIndexFile)
+	index, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index file(%v): %v", name, err)
+	}
+	return &Recorder{Dir: dir, Interval: interval, Block: block, now: time.Now, index: index}, nil
+}
+
+// recordFileName returns the name of the file starting at start.
+func recordFileName(start time.Time) string {
+	return start.UTC().Format("ris-live.20060102.1504.jsonl.gz")
+}
+
+// Write appends a raw message, of the timestamp, 0 if it has none, to the
+// recording, rotating the file and the block as they fall due.
+func (r *Recorder) Write(raw []byte, ts float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	if r.f != nil && !now.Before(r.start.Add(r.Interval)) {
+		if err := r.closeFile(); err != nil {
+			return err
+		}
+	}
+	if r.f == nil {
+		if err := r.openFile(now); err != nil {
+			return err
+		}
+	}
+	if r.zw != nil && !now.Before(r.opened.Add(r.Block)) {
+		if err := r.closeBlock(); err != nil {
+			return err
+		}
+	}
+	if r.zw == nil {
+		r.zw = gzip.NewWriter(&countWriter{w: r.f, n: &r.offset})
+		r.block = RecordBlock{File: filepath.Base(r.f.Name()), Offset: r.offset}
+		r.opened = now
+	}
+	if _, err := r.zw.Write(append(raw, '\n')); err != nil {
+		return fmt.Errorf("failed to write recording: %v", err)
+	}
+	if ts != 0 {
+		if r.block.First == 0 || ts < r.block.First {
+			r.block.First = ts
+		}
+		if ts > r.block.Last {
+			r.block.Last = ts
+		}
+	}
+	return nil
+}
+
+// openFile opens the file of the period of now. A file which exists, ie: after
+// a restart, is appended to.
+func (r *Recorder) openFile(now time.Time) error {
+	start := now.Truncate(r.Interval)
+	name := filepath.Join(r.Dir, recordFileName(start))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open recording file(%v): %v", name, err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat recording file(%v): %v", name, err)
+	}
+	r.f, r.start, r.offset = f, start, fi.Size()
+	log.Infof("recording to %v", name)
+	return nil
+}
+
+// closeBlock ends the open block, adding it to the index.
+func (r *Recorder) closeBlock() error {
+	if r.zw == nil {
+		return nil
+	}
+	err := r.zw.Close()
+	r.zw = nil
+	if err != nil {
+		return fmt.Errorf("failed to write recording: %v", err)
+	}
+	b, err := json.Marshal(r.block)
+	if err != nil {
+		return fmt.Errorf("failed to encode index entry: %v", err)
+	}
+	if _, err := r.index.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write index: %v", err)
+	}
+	return nil
+}
+
+func (r *Recorder) closeFile() error {
+	err := r.closeBlock()
+	if cerr := r.f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to close recording file: %v", cerr)
+	}
+	r.f = nil
+	return err
+}
+
+// Close ends the open block and file, and closes the index.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	if r.f != nil {
+		err = r.closeFile()
+	}
+	if cerr := r.index.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to close index: %v", cerr)
+	}
+	return err
+}
+
+// ReadRecordIndex reads the index of the recording in dir.
+func ReadRecordIndex(dir string) ([]RecordBlock, error) {
+	name := filepath.Join(dir, recordIndexFile)
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index file(%v): %v", name, err)
+	}
+	defer f.Close()
+	var blocks []RecordBlock
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var b RecordBlock
+		if err := json.Unmarshal(s.Bytes(), &b); err != nil {
+			return nil, fmt.Errorf("failed to decode index entry(%s): %v", s.Bytes(), err)
+		}
+		blocks = append(blocks, b)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read index file(%v): %v", name, err)
+	}
+	return blocks, nil
+}
+
+// findRecordBlocks returns the blocks which hold messages of the window from
+// and to, inclusive, in the order they were written.
+func findRecordBlocks(blocks []RecordBlock, from, to float64) []RecordBlock {
+	var found []RecordBlock
+	for _, b := range blocks {
+		if b.First != 0 && b.First <= to && b.Last >= from {
+			found = append(found, b)
+		}
+	}
+	return found
+}
+
+// openRecordBlock opens the file of a block of the recording in dir, returning
+// it and a reader of the block's messages, seeking to it in the file.
+func openRecordBlock(dir string, b RecordBlock) (*os.File, io.ReadCloser, error) {
+	name := filepath.Join(dir, b.File)
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open recording file(%v): %v", name, err)
+	}
+	if _, err := f.Seek(b.Offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to seek recording file(%v): %v", name, err)
+	}
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to read block at %v of recording file(%v): %v", b.Offset, name, err)
+	}
+	zr.Multistream(false)
+	return f, zr, nil
+}
+
+// openRecording opens the blocks of the recording in dir which hold messages
+// of the window from and to, either of which may be zero for an open end, to
+// replay the messages of the window at the speed.
+func openRecording(dir string, from, to time.Time, speed float64) (*replayStream, error) {
+	blocks, err := ReadRecordIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &replayStream{Speed: speed, now: time.Now, sleep: time.Sleep, to: math.Inf(1)}
+	if !from.IsZero() {
+		s.from = float64(from.UnixNano()) / float64(time.Second)
+	}
+	if !to.IsZero() {
+		s.to = float64(to.UnixNano()) / float64(time.Second)
+	}
+	found := findRecordBlocks(blocks, s.from, s.to)
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no blocks of recording(%v) hold %v to %v", dir, from, to)
+	}
+	for _, b := range found {
+		f, zr, err := openRecordBlock(dir, b)
+		if err == nil {
+			err = s.addReader(fmt.Sprintf("%v@%v", b.File, b.Offset), f, zr)
+		}
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	log.Infof("replaying %v blocks of recording %v", len(found), dir)
+	return s, nil
+}
+
+// Record writes the raw messages of the remote stream to rec, reconnecting as
+// Listen does.
+func (r *RisLive) Record(rec *Recorder) {
+	r.reconnect(func(s risStream) error {
+		return r.watch(s, func() error { return r.record(s, rec) })
+	})
+}
+
+// record writes the raw messages of the stream to rec until it fails.
+func (r *RisLive) record(s risStream, rec *Recorder) error {
+	for {
+		raw, err := s.Next()
+		if err != nil {
+			return err
+		}
+		h := parseRawHeader(raw)
+		// Pongs do not count as liveness, as in handle.
+		now := time.Now()
+		if h.Type == "pong" {
+			if rtt, ok := r.Watchdog.Pong(now); ok {
+				r.Metrics.PingRTT.Set(rtt.Seconds())
+			}
+		} else {
+			r.Watchdog.Observe(nil, now)
+		}
+		if err := rec.Write(raw, h.timestamp()); err != nil {
+			return err
+		}
+		if h.Data != nil {
+			r.Metrics.Messages.Inc(h.Type, h.Data.Host)
+		}
+	}
+}
+
+// record runs the record command, writing the raw stream to a recording in
+// recordDir until it is interrupted.
+func record() {
+	r := NewRisLive(risLive, risFile, risClient, &RisFilter{}, buffer)
+	r.Watchdog.Timeout = *stallTimeout
+	r.PingInterval = *pingInterval
+	rec, err := NewRecorder(*recordDir, *recordInterval, *recordBlock)
+	if err != nil {
+		log.Fatalf("failed to create recorder: %v", err)
+	}
+	// The open block is only indexed once it is closed.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		if err := rec.Close(); err != nil {
+			log.Errorf("failed to close recording: %v", err)
+		}
+		log.Flush()
+		os.Exit(0)
+	}()
+	r.Record(rec)
+}
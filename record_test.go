@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+// readRecordBlock reads the lines of a block of a recording.
+func readRecordBlock(t *testing.T, dir string, b RecordBlock) []string {
+	t.Helper()
+	f, zr, err := openRecordBlock(dir, b)
+	if err != nil {
+		t.Fatalf("failed to open block: %v", err)
+	}
+	defer f.Close()
+	defer zr.Close()
+	var lines []string
+	s := bufio.NewScanner(zr)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("failed to read block: %v", err)
+	}
+	return lines
+}
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	rec, err := NewRecorder(dir, time.Hour, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	start := time.Date(2019, 5, 23, 14, 0, 0, 0, time.UTC)
+	var now time.Time
+	rec.now = func() time.Time { return now }
+
+	// The messages are received at an offset from start, in seconds.
+	msgs := []struct {
+		at  float64
+		raw string
+	}{
+		{0, strings.TrimSpace(replayMsg("a", 1558620000))},
+		{10, `{"type":"ris_error","data":null}`},
+		{30, strings.TrimSpace(replayMsg("b", 1558620030))},
+		{65, strings.TrimSpace(replayMsg("c", 1558620065))},
+		{3600, strings.TrimSpace(replayMsg("d", 1558623600))},
+		{3601, strings.TrimSpace(replayMsg("e", 1558623599))},
+	}
+	for _, m := range msgs {
+		now = start.Add(time.Duration(m.at * float64(time.Second)))
+		if err := rec.Write([]byte(m.raw), parseRawHeader([]byte(m.raw)).timestamp()); err != nil {
+			t.Fatalf("failed to write message: %v", err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("failed to close recorder: %v", err)
+	}
+
+	blocks, err := ReadRecordIndex(dir)
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	for i := range blocks {
+		if blocks[i].Offset == 0 {
+			continue
+		}
+		// Offsets are checked by reading the blocks, compressed sizes vary.
+		blocks[i].Offset = -1
+	}
+	want := []RecordBlock{
+		{File: "ris-live.20190523.1400.jsonl.gz", First: 1558620000, Last: 1558620030},
+		{File: "ris-live.20190523.1400.jsonl.gz", First: 1558620065, Last: 1558620065, Offset: -1},
+		{File: "ris-live.20190523.1500.jsonl.gz", First: 1558623599, Last: 1558623600},
+	}
+	if diff := cmp.Diff(blocks, want); diff != "" {
+		t.Errorf("index got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+
+	blocks, _ = ReadRecordIndex(dir)
+	wantLines := [][]string{{msgs[0].raw, msgs[1].raw, msgs[2].raw}, {msgs[3].raw}, {msgs[4].raw, msgs[5].raw}}
+	for i, b := range blocks {
+		if diff := cmp.Diff(readRecordBlock(t, dir, b), wantLines[i]); diff != "" {
+			t.Errorf("block %v got/want mismatch diff(-got, +want):\n%v\n", i, diff)
+		}
+	}
+
+	// The files of a recording are replayed as they are.
+	s, err := openReplay([]string{filepath.Join(dir, "*.jsonl.gz")}, 0)
+	if err != nil {
+		t.Fatalf("failed to open replay: %v", err)
+	}
+	defer s.Close()
+	got, _ := replayIDs(t, s)
+	if diff := cmp.Diff(got, []string{"a", "ris_error", "b", "c", "d", "e"}); diff != "" {
+		t.Errorf("replay got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+
+	// A restarted recorder appends to the file and the index.
+	rec, err = NewRecorder(dir, time.Hour, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	rec.now = func() time.Time { return start.Add(2 * time.Hour) }
+	rec.Write([]byte(msgs[0].raw), 1558627200)
+	rec.Write([]byte(msgs[1].raw), 0)
+	rec.Close()
+	rec, _ = NewRecorder(dir, time.Hour, time.Minute)
+	rec.now = func() time.Time { return start.Add(2*time.Hour + time.Minute) }
+	rec.Write([]byte(msgs[2].raw), 1558627260)
+	rec.Close()
+	blocks, _ = ReadRecordIndex(dir)
+	if len(blocks) != 5 || blocks[4].Offset == 0 || blocks[3].File != blocks[4].File {
+		t.Fatalf("got index %+v, want 2 blocks appended to a file", blocks)
+	}
+	if diff := cmp.Diff(readRecordBlock(t, dir, blocks[4]), []string{msgs[2].raw}); diff != "" {
+		t.Errorf("appended block got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+func TestNewRecorderFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		desc            string
+		interval, block time.Duration
+	}{{
+		desc:  "Failure - zero interval",
+		block: time.Minute,
+	}, {
+		desc:     "Failure - negative block",
+		interval: time.Hour,
+		block:    -time.Minute,
+	}}
+	for _, test := range tests {
+		if _, err := NewRecorder(dir, test.interval, test.block); err == nil {
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		}
+	}
+}
+
+func TestFindRecordBlocks(t *testing.T) {
+	blocks := []RecordBlock{
+		{File: "a", First: 100, Last: 159},
+		{File: "a", Offset: 10},
+		{File: "a", First: 160, Last: 219, Offset: 20},
+		{File: "b", First: 220, Last: 279},
+	}
+	tests := []struct {
+		desc     string
+		from, to float64
+		want     []string
+	}{{
+		desc: "Success - within a block",
+		from: 110,
+		to:   120,
+		want: []string{"a@0"},
+	}, {
+		desc: "Success - spanning blocks and files",
+		from: 159.5,
+		to:   220,
+		want: []string{"a@20", "b@0"},
+	}, {
+		desc: "Success - open ended",
+		from: 0,
+		to:   1e12,
+		want: []string{"a@0", "a@20", "b@0"},
+	}, {
+		desc: "Success - outside the recording",
+		from: 300,
+		to:   400,
+	}}
+	for _, test := range tests {
+		var got []string
+		for _, b := range findRecordBlocks(blocks, test.from, test.to) {
+			got = append(got, fmt.Sprintf("%v@%v", b.File, b.Offset))
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestOpenRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	rec, err := NewRecorder(dir, time.Hour, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	// Messages are received every 30 seconds, a block of each minute.
+	for i := 0; i < 600; i += 30 {
+		now := time.Unix(int64(1558620000+i), 0)
+		rec.now = func() time.Time { return now }
+		id := now.UTC().Format("1504:05")
+		if err := rec.Write([]byte(strings.TrimSpace(replayMsg(id, float64(now.Unix())))), float64(now.Unix())); err != nil {
+			t.Fatalf("failed to write message: %v", err)
+		}
+	}
+	rec.Close()
+
+	tests := []struct {
+		desc     string
+		from, to time.Time
+		want     []string
+		wantErr  bool
+	}{{
+		desc: "Success - a window",
+		from: time.Unix(1558620150, 0),
+		to:   time.Unix(1558620210, 0),
+		want: []string{"1402:30", "1403:00", "1403:30"},
+	}, {
+		desc: "Success - from a time",
+		from: time.Unix(1558620520, 0),
+		want: []string{"1409:00", "1409:30"},
+	}, {
+		desc: "Success - to a time",
+		to:   time.Unix(1558620030, 0),
+		want: []string{"1400:00", "1400:30"},
+	}, {
+		desc:    "Failure - outside the recording",
+		from:    time.Unix(1558630000, 0),
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		s, err := openRecording(dir, test.from, test.to, 0)
+		if (err != nil) != test.wantErr {
+			t.Errorf("[%v]: got error %v, want error %v", test.desc, err, test.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		got, _ := replayIDs(t, s)
+		s.Close()
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	rec, err := NewRecorder(dir, time.Hour, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+
+	ts := testServer("testdata/10-msg")
+	defer ts.Close()
+	r := &RisLive{
+		URL:      &ts.URL,
+		UA:       proto.String(""),
+		Metrics:  NewMetrics(),
+		Watchdog: NewWatchdog(0),
+	}
+	s, err := r.connect()
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	r.record(s, rec)
+	s.Close()
+	rec.Close()
+
+	want, err := ioutil.ReadFile("testdata/10-msg")
+	if err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+	blocks, err := ReadRecordIndex(dir)
+	if err != nil || len(blocks) != 1 {
+		t.Fatalf("got index %+v(%v), want 1 block", blocks, err)
+	}
+	got := readRecordBlock(t, dir, blocks[0])
+	if diff := cmp.Diff(got, strings.Split(string(bytes.TrimSpace(want)), "\n")); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if got := r.Metrics.Messages.Get("ris_message", "rrc19"); got == 0 {
+		t.Errorf("got no messages counted of rrc19")
+	}
+}
@@ -0,0 +1,236 @@
+// Replay files of RIS Live json messages, ie: captures of the stream endpoint
+// with one message per line, to reproduce an incident. Files may be gzip, bzip2
+// or zstd compressed, and are read as they are consumed. Lines are passed on
+// undecoded, so a line which is not a message is a decode error of the stream,
+// rather than the end of the replay.
+//
+// The messages of several files, each in timestamp order, are merged in
+// timestamp order. They are sent as fast as they are consumed, or paced as they
+// were received, or a multiple of that speed, by their timestamps.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// replayFile is an open file of a replay, with its next message.
+type replayFile struct {
+	name  string
+	f     *os.File
+	zr    io.ReadCloser
+	r     *bufio.Reader
+	index int // The order of the file, which breaks timestamp ties.
+
+	next []byte
+	ts   float64 // The timestamp of next, or of the message before it if next has none.
+}
+
+// advance reads the next line of the file, skipping blank lines, returning
+// io.EOF at its end.
+func (f *replayFile) advance() error {
+	var raw []byte
+	for len(raw) == 0 {
+		line, err := f.r.ReadBytes('\n')
+		// The last line may not end in a newline.
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return err
+		}
+		raw = bytes.TrimSpace(line)
+	}
+	f.next = raw
+	// Messages without a timestamp, ie: ris_error, keep the place of the message before.
+	if ts := parseRawHeader(raw).timestamp(); ts != 0 {
+		f.ts = ts
+	}
+	return nil
+}
+
+// rawHeader is the part of a raw message needed to order it, decoded without
+// decoding the rest of it.
+type rawHeader struct {
+	Type string `json:"type"`
+	Data *struct {
+		Timestamp float64 `json:"timestamp"`
+		Host      string  `json:"host"`
+	} `json:"data"`
+}
+
+// parseRawHeader decodes the header of a raw message, which is empty if the
+// message fails to decode.
+func parseRawHeader(raw []byte) *rawHeader {
+	h := &rawHeader{}
+	if json.Unmarshal(raw, h) != nil {
+		return &rawHeader{}
+	}
+	return h
+}
+
+// timestamp returns the timestamp of the message, 0 if it has none.
+func (h *rawHeader) timestamp() float64 {
+	if h.Data == nil {
+		return 0
+	}
+	return h.Data.Timestamp
+}
+
+func (f *replayFile) Close() error {
+	f.zr.Close()
+	return f.f.Close()
+}
+
+// replayHeap orders files by the timestamp of their next message.
+type replayHeap []*replayFile
+
+func (h replayHeap) Len() int { return len(h) }
+func (h replayHeap) Less(i, j int) bool {
+	if h[i].ts != h[j].ts {
+		return h[i].ts < h[j].ts
+	}
+	return h[i].index < h[j].index
+}
+func (h replayHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *replayHeap) Push(x interface{}) { *h = append(*h, x.(*replayFile)) }
+func (h *replayHeap) Pop() interface{} {
+	old := *h
+	f := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return f
+}
+
+// replayStream is a risStream of the merged messages of files.
+type replayStream struct {
+	Speed float64 // The multiple of the received pace to send messages at, as fast as possible if 0.
+
+	files replayHeap
+	open  []*replayFile
+	err   error // The error which ended the replay.
+
+	started bool
+	start   time.Time // The time the first message was sent.
+	first   float64   // The timestamp of the first message.
+	from    float64   // Messages timestamped outside from and to are skipped, if to is set.
+	to      float64
+	now     func() time.Time
+	sleep   func(time.Duration)
+}
+
+// openReplay opens the files matching the glob patterns, ie: rrc00.*.json.gz, to
+// replay at the speed.
+func openReplay(patterns []string, speed float64) (*replayStream, error) {
+	s := &replayStream{Speed: speed, now: time.Now, sleep: time.Sleep}
+	for _, p := range patterns {
+		names, err := filepath.Glob(p)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to expand pattern(%v): %v", p, err)
+		}
+		if len(names) == 0 {
+			s.Close()
+			return nil, fmt.Errorf("no files match pattern(%v)", p)
+		}
+		for _, name := range names {
+			if err := s.add(name); err != nil {
+				s.Close()
+				return nil, err
+			}
+		}
+	}
+	log.Infof("replaying %v files", len(s.open))
+	return s, nil
+}
+
+// add opens a file, queueing its first message.
+func (s *replayStream) add(name string) error {
+	fd, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open replay file(%v): %v", name, err)
+	}
+	zr, err := decompress(fd)
+	if err != nil {
+		fd.Close()
+		return fmt.Errorf("failed to read replay file(%v): %v", name, err)
+	}
+	return s.addReader(name, fd, zr)
+}
+
+// addReader adds the messages of zr, decompressed from fd, queueing the first.
+func (s *replayStream) addReader(name string, fd *os.File, zr io.ReadCloser) error {
+	f := &replayFile{name: name, f: fd, zr: zr, r: bufio.NewReader(zr), index: len(s.open)}
+	s.open = append(s.open, f)
+	return s.push(f)
+}
+
+// push queues the next message of a file, unless it has ended.
+func (s *replayStream) push(f *replayFile) error {
+	switch err := f.advance(); err {
+	case nil:
+		heap.Push(&s.files, f)
+	case io.EOF:
+	default:
+		return fmt.Errorf("failed to read replay file(%v): %v", f.name, err)
+	}
+	return nil
+}
+
+// Next returns the message with the earliest timestamp of the files, once it is
+// due, or io.EOF once they have ended. Messages outside the window of a
+// recording are skipped. A failure to read a file, ie: a corrupt compressed
+// file, ends the replay.
+func (s *replayStream) Next() ([]byte, error) {
+	for {
+		if s.err != nil {
+			return nil, s.err
+		}
+		if len(s.files) == 0 {
+			s.err = io.EOF
+			return nil, s.err
+		}
+		f := heap.Pop(&s.files).(*replayFile)
+		raw, ts := f.next, f.ts
+		if err := s.push(f); err != nil {
+			s.err = err
+		}
+		if s.to != 0 && (ts < s.from || ts > s.to) {
+			continue
+		}
+		s.pace(ts)
+		return raw, nil
+	}
+}
+
+// pace waits until a message of the timestamp is due.
+func (s *replayStream) pace(ts float64) {
+	if s.Speed <= 0 || ts == 0 {
+		return
+	}
+	if !s.started {
+		s.started, s.start, s.first = true, s.now(), ts
+		return
+	}
+	due := s.start.Add(time.Duration((ts - s.first) / s.Speed * float64(time.Second)))
+	if d := due.Sub(s.now()); d > 0 {
+		s.sleep(d)
+	}
+}
+
+// Close closes the files.
+func (s *replayStream) Close() error {
+	var err error
+	for _, f := range s.open {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	s.open, s.files = nil, nil
+	return err
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/zstd"
+)
+
+// replayMsg encodes a message of the id and timestamp.
+func replayMsg(id string, ts float64) string {
+	return fmt.Sprintf(`{"type":"ris_message","data":{"timestamp":%v,"peer":"192.0.2.1","peer_asn":"64496","id":%q,"host":"rrc00","type":"KEEPALIVE"}}`+"\n", ts, id)
+}
+
+// writeReplayFiles writes replay files to a temporary directory, gzip or zstd
+// compressed by their extension, along with testdata/replay.json.bz2.
+func writeReplayFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	bz, err := ioutil.ReadFile("testdata/replay.json.bz2")
+	if err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "d.json.bz2"), bz, 0644); err != nil {
+		t.Fatalf("failed to write replay file: %v", err)
+	}
+	for name, content := range files {
+		var b bytes.Buffer
+		var w io.WriteCloser
+		switch filepath.Ext(name) {
+		case ".gz":
+			w = gzip.NewWriter(&b)
+		case ".zst":
+			if w, err = zstd.NewWriter(&b); err != nil {
+				t.Fatalf("failed to create zstd writer: %v", err)
+			}
+		default:
+			b.WriteString(content)
+		}
+		if w != nil {
+			w.Write([]byte(content))
+			w.Close()
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), b.Bytes(), 0644); err != nil {
+			t.Fatalf("failed to write replay file: %v", err)
+		}
+	}
+	return dir
+}
+
+// replayIDs reads the ids of the messages of a replay, "bad" for those which fail to decode.
+func replayIDs(t *testing.T, s *replayStream) ([]string, error) {
+	t.Helper()
+	var ids []string
+	for {
+		raw, err := s.Next()
+		if err != nil {
+			return ids, err
+		}
+		var rm RisMessage
+		if err := json.Unmarshal(raw, &rm); err != nil {
+			ids = append(ids, "bad")
+			continue
+		}
+		id := rm.Type
+		if rm.Data != nil {
+			id = rm.Data.ID
+		}
+		ids = append(ids, id)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dir := writeReplayFiles(t, map[string]string{
+		"a.json":     replayMsg("a-1", 1558620001) + `{"type":"ris_error","data":null}` + "\n" + replayMsg("a-2", 1558620004) + replayMsg("a-3", 1558620007),
+		"b.json.gz":  replayMsg("b-1", 1558620002) + replayMsg("b-2", 1558620005),
+		"c.json.zst": replayMsg("c-1", 1558620003) + replayMsg("c-2", 1558620006.5),
+		"e.json":     replayMsg("e-1", 1558620001) + "{bad json\n\n" + replayMsg("e-2", 1558620006) + strings.TrimSpace(replayMsg("e-3", 1558620008)),
+		"other.txt":  "",
+	})
+	defer os.RemoveAll(dir)
+	// A gzip file of a bad checksum, which fails once it is read.
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(replayMsg("f-1", 1558620001)))
+	zw.Close()
+	corrupt := gz.Bytes()
+	corrupt[len(corrupt)-8]++
+	if err := ioutil.WriteFile(filepath.Join(dir, "f.json.gz"), corrupt, 0644); err != nil {
+		t.Fatalf("failed to write replay file: %v", err)
+	}
+
+	tests := []struct {
+		desc     string
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{{
+		desc:     "Success - a file",
+		patterns: []string{filepath.Join(dir, "a.json")},
+		want:     []string{"a-1", "ris_error", "a-2", "a-3"},
+	}, {
+		desc:     "Success - glob of compressed files merged",
+		patterns: []string{filepath.Join(dir, "[a-d].json*")},
+		want:     []string{"a-1", "ris_error", "b-1", "d-1", "c-1", "a-2", "b-2", "c-2", "a-3", "d-2"},
+	}, {
+		desc:     "Success - comma separated patterns",
+		patterns: []string{filepath.Join(dir, "c.json.zst"), filepath.Join(dir, "b.*")},
+		want:     []string{"b-1", "c-1", "b-2", "c-2"},
+	}, {
+		desc:     "Success - bad lines are passed on",
+		patterns: []string{filepath.Join(dir, "e.json"), filepath.Join(dir, "b.json.gz")},
+		want:     []string{"e-1", "bad", "b-1", "b-2", "e-2", "e-3"},
+	}, {
+		desc:     "Failure - a corrupt file ends the replay",
+		patterns: []string{filepath.Join(dir, "f.json.gz")},
+		want:     []string{"f-1"},
+		wantErr:  true,
+	}}
+	for _, test := range tests {
+		s, err := openReplay(test.patterns, 0)
+		if err != nil {
+			t.Errorf("[%v]: failed to open replay: %v", test.desc, err)
+			continue
+		}
+		got, err := replayIDs(t, s)
+		s.Close()
+		if (err != io.EOF) != test.wantErr {
+			t.Errorf("[%v]: got error %v, want error %v", test.desc, err, test.wantErr)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestReplayOpenFailure(t *testing.T) {
+	tests := []struct {
+		desc     string
+		patterns []string
+	}{{
+		desc:     "Failure - no files match",
+		patterns: []string{"testdata/1-msg", "testdata/no-such-file*"},
+	}, {
+		desc:     "Failure - bad pattern",
+		patterns: []string{"testdata/["},
+	}}
+	for _, test := range tests {
+		if _, err := openReplay(test.patterns, 0); err == nil {
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		}
+	}
+}
+
+func TestReplayPace(t *testing.T) {
+	dir := writeReplayFiles(t, map[string]string{
+		"a.json":    replayMsg("a-1", 1558620000) + replayMsg("a-2", 1558620001) + replayMsg("a-3", 1558620001) + replayMsg("a-4", 1558620004),
+		"b.json.gz": replayMsg("b-1", 1558620003),
+	})
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		desc  string
+		speed float64
+		want  []time.Duration // The consumer takes 250ms for each message.
+	}{{
+		desc:  "Success - as fast as possible",
+		speed: 0,
+	}, {
+		desc:  "Success - real-time",
+		speed: 1,
+		want:  []time.Duration{750 * time.Millisecond, 1500 * time.Millisecond, 750 * time.Millisecond},
+	}, {
+		desc:  "Success - 2x",
+		speed: 2,
+		want:  []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, 250 * time.Millisecond},
+	}, {
+		desc:  "Success - 0.5x",
+		speed: 0.5,
+		want:  []time.Duration{1750 * time.Millisecond, 3500 * time.Millisecond, 1750 * time.Millisecond},
+	}}
+	for _, test := range tests {
+		s, err := openReplay([]string{filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json.gz")}, test.speed)
+		if err != nil {
+			t.Fatalf("[%v]: failed to open replay: %v", test.desc, err)
+		}
+		now := time.Unix(1700000000, 0)
+		var got []time.Duration
+		s.now = func() time.Time { return now }
+		s.sleep = func(d time.Duration) {
+			got = append(got, d)
+			now = now.Add(d)
+		}
+		for {
+			if _, err := s.Next(); err != nil {
+				break
+			}
+			now = now.Add(250 * time.Millisecond)
+		}
+		s.Close()
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
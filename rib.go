@@ -0,0 +1,295 @@
+// A RIB of the routes each peer of the stream currently carries, indexed by a
+// trie per address family for longest-match and more-specific lookups, and by
+// the origin ASN and the AS adjacencies of the paths.
+//
+// A route is replaced by the peer's next announcement of the prefix, and
+// removed by its withdrawal, or when the peer's session goes down.
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Route is a peer's current route to a prefix.
+type Route struct {
+	Collector string
+	Peer      string
+	PeerASN   string
+	Path      []int32
+	NextHop   string
+	Community [][]int32
+	Updated   time.Time
+}
+
+// Origin returns the origin ASN of the route, false if the path is empty.
+func (r *Route) Origin() (int32, bool) {
+	if len(r.Path) == 0 {
+		return 0, false
+	}
+	return r.Path[len(r.Path)-1], true
+}
+
+// Neighbor is an ASN adjacent to another in the paths of the RIB.
+type Neighbor struct {
+	ASN    int32
+	Routes int // The routes with a path carrying the adjacency.
+}
+
+// RIB holds the current routes of every peer in the stream.
+type RIB struct {
+	mu        sync.RWMutex
+	v4, v6    *Tree
+	routes    map[string]map[peerKey]*Route // prefix -> peer -> route.
+	origins   map[int32]map[string]int      // origin -> prefix -> routes.
+	neighbors map[int32]map[int32]int       // ASN -> neighbor -> routes.
+}
+
+// NewRIB creates a new, empty, RIB.
+func NewRIB() *RIB {
+	v4, _ := New("0.0.0.0/0")
+	v6, _ := New("::/0")
+	return &RIB{
+		v4:        v4,
+		v6:        v6,
+		routes:    map[string]map[peerKey]*Route{},
+		origins:   map[int32]map[string]int{},
+		neighbors: map[int32]map[int32]int{},
+	}
+}
+
+// tree returns the trie of the address family of n.
+func (r *RIB) tree(n *net.IPNet) *Tree {
+	if n.IP.To4() != nil {
+		return r.v4
+	}
+	return r.v6
+}
+
+// parsePrefix parses a prefix to its canonical form.
+func parsePrefix(prefix string) (*net.IPNet, error) {
+	_, n, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prefix(%v): %v", prefix, err)
+	}
+	if ip := n.IP.To4(); ip != nil {
+		n.IP = ip
+	}
+	return n, nil
+}
+
+// pathLinks returns the adjacent pairs of ASNs in path, each once, ignoring
+// prepends. A pair is ordered lower ASN first.
+func pathLinks(path []int32) [][2]int32 {
+	var result [][2]int32
+	seen := map[[2]int32]bool{}
+	for i := 1; i < len(path); i++ {
+		l := [2]int32{path[i-1], path[i]}
+		if uint32(l[0]) > uint32(l[1]) {
+			l[0], l[1] = l[1], l[0]
+		}
+		if l[0] == l[1] || seen[l] {
+			continue
+		}
+		seen[l] = true
+		result = append(result, l)
+	}
+	return result
+}
+
+// Update applies the announcements and withdrawals of a message to the RIB.
+// Prefixes which fail to parse are ignored.
+func (r *RIB) Update(rm *RisMessageData) {
+	if rm == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pk := peerKey{host: rm.Host, peer: rm.Peer}
+	if rm.Type == "RIS_PEER_STATE" && rm.State == "down" {
+		r.flush(pk)
+		return
+	}
+	for _, prefix := range rm.Withdrawals {
+		if n, err := parsePrefix(prefix); err == nil {
+			r.remove(n, pk)
+		}
+	}
+	if len(rm.Announcements) == 0 {
+		return
+	}
+	// The routes of the message share a copy of its path and communities.
+	path, community := clonePath(rm.DigestedPath), cloneCommunity(rm.Community)
+	for _, a := range rm.Announcements {
+		for _, prefix := range a.Prefixes {
+			n, err := parsePrefix(prefix)
+			if err != nil {
+				continue
+			}
+			r.remove(n, pk)
+			r.add(n, pk, &Route{
+				Collector: rm.Host,
+				Peer:      rm.Peer,
+				PeerASN:   rm.PeerASN,
+				Path:      path,
+				NextHop:   a.NextHop,
+				Community: community,
+				Updated:   rm.Time(),
+			})
+		}
+	}
+}
+
+// add records the peer's route to n.
+func (r *RIB) add(n *net.IPNet, pk peerKey, rt *Route) {
+	prefix := n.String()
+	peers, ok := r.routes[prefix]
+	if !ok {
+		peers = map[peerKey]*Route{}
+		r.routes[prefix] = peers
+		r.tree(n).Insert(n)
+	}
+	peers[pk] = rt
+	if origin, ok := rt.Origin(); ok {
+		if r.origins[origin] == nil {
+			r.origins[origin] = map[string]int{}
+		}
+		r.origins[origin][prefix]++
+	}
+	for _, l := range pathLinks(rt.Path) {
+		for _, pair := range [][2]int32{l, {l[1], l[0]}} {
+			if r.neighbors[pair[0]] == nil {
+				r.neighbors[pair[0]] = map[int32]int{}
+			}
+			r.neighbors[pair[0]][pair[1]]++
+		}
+	}
+}
+
+// remove deletes the peer's route to n, if it has one.
+func (r *RIB) remove(n *net.IPNet, pk peerKey) {
+	prefix := n.String()
+	rt, ok := r.routes[prefix][pk]
+	if !ok {
+		return
+	}
+	delete(r.routes[prefix], pk)
+	if len(r.routes[prefix]) == 0 {
+		delete(r.routes, prefix)
+		r.tree(n).Delete(n)
+	}
+	if origin, ok := rt.Origin(); ok {
+		if r.origins[origin][prefix]--; r.origins[origin][prefix] == 0 {
+			delete(r.origins[origin], prefix)
+			if len(r.origins[origin]) == 0 {
+				delete(r.origins, origin)
+			}
+		}
+	}
+	for _, l := range pathLinks(rt.Path) {
+		for _, pair := range [][2]int32{l, {l[1], l[0]}} {
+			if r.neighbors[pair[0]][pair[1]]--; r.neighbors[pair[0]][pair[1]] == 0 {
+				delete(r.neighbors[pair[0]], pair[1])
+				if len(r.neighbors[pair[0]]) == 0 {
+					delete(r.neighbors, pair[0])
+				}
+			}
+		}
+	}
+}
+
+// flush removes every route of the peer.
+func (r *RIB) flush(pk peerKey) {
+	var prefixes []*net.IPNet
+	for prefix, peers := range r.routes {
+		if _, ok := peers[pk]; ok {
+			if n, err := parsePrefix(prefix); err == nil {
+				prefixes = append(prefixes, n)
+			}
+		}
+	}
+	for _, n := range prefixes {
+		r.remove(n, pk)
+	}
+}
+
+// Run applies the messages of in to the RIB until the channel is closed.
+func (r *RIB) Run(in <-chan RisMessage) {
+	for rm := range in {
+		r.Update(rm.Data)
+		rm.Release()
+	}
+}
+
+// Len returns the number of prefixes with at least one route.
+func (r *RIB) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.routes)
+}
+
+// Routes returns the routes to exactly n, sorted by collector and peer.
+func (r *RIB) Routes(n *net.IPNet) []*Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []*Route
+	for _, rt := range r.routes[n.String()] {
+		result = append(result, rt)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Collector != result[j].Collector {
+			return result[i].Collector < result[j].Collector
+		}
+		return result[i].Peer < result[j].Peer
+	})
+	return result
+}
+
+// LongestMatch returns the most specific prefix with routes which covers n, or
+// n itself, nil if there is none.
+func (r *RIB) LongestMatch(n *net.IPNet) *net.IPNet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	covering := r.tree(n).Covering(n)
+	for i := len(covering) - 1; i >= 0; i-- {
+		if _, ok := r.routes[covering[i].String()]; ok {
+			return covering[i]
+		}
+	}
+	return nil
+}
+
+// MoreSpecifics returns the prefixes with routes more specific than n.
+func (r *RIB) MoreSpecifics(n *net.IPNet) []*net.IPNet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.tree(n).MoreSpecifics(n)
+}
+
+// Originated returns the prefixes asn currently originates, sorted.
+func (r *RIB) Originated(asn int32) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []string
+	for prefix := range r.origins[asn] {
+		result = append(result, prefix)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Neighbors returns the ASNs adjacent to asn in the current paths, sorted by ASN.
+func (r *RIB) Neighbors(asn int32) []*Neighbor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []*Neighbor
+	for n, routes := range r.neighbors[asn] {
+		result = append(result, &Neighbor{ASN: n, Routes: routes})
+	}
+	sort.Slice(result, func(i, j int) bool { return uint32(result[i].ASN) < uint32(result[j].ASN) })
+	return result
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// ribMessages are announcements of 8.8.8.0/24 by two peers, and of a more specific by one.
+var ribMessages = []*RisMessageData{{
+	Timestamp:     1558620047,
+	Host:          "rrc00",
+	Peer:          "192.0.2.1",
+	PeerASN:       "64496",
+	DigestedPath:  []int32{64496, 3356, 15169},
+	Announcements: []*RisAnnouncement{{NextHop: "192.0.2.1", Prefixes: []string{"8.8.8.0/24", "2001:db8::/32"}}},
+}, {
+	Timestamp:     1558620048,
+	Host:          "rrc01",
+	Peer:          "192.0.2.2",
+	PeerASN:       "64497",
+	DigestedPath:  []int32{64497, 64497, 3356, 15169},
+	Announcements: []*RisAnnouncement{{NextHop: "192.0.2.2", Prefixes: []string{"8.8.8.0/24"}}},
+}, {
+	Timestamp:     1558620049,
+	Host:          "rrc01",
+	Peer:          "192.0.2.2",
+	PeerASN:       "64497",
+	DigestedPath:  []int32{64497, 64511},
+	Announcements: []*RisAnnouncement{{NextHop: "192.0.2.2", Prefixes: []string{"8.8.8.128/25"}}},
+}}
+
+func newTestRIB() *RIB {
+	r := NewRIB()
+	for _, rm := range ribMessages {
+		r.Update(rm)
+	}
+	return r
+}
+
+func TestRIB(t *testing.T) {
+	r := newTestRIB()
+	if got := r.Len(); got != 3 {
+		t.Errorf("got %v prefixes, want 3", got)
+	}
+	routes := r.Routes(mustCIDR(t, "8.8.8.0/24"))
+	var got [][]string
+	for _, rt := range routes {
+		got = append(got, []string{rt.Collector, rt.Peer, rt.NextHop})
+	}
+	want := [][]string{{"rrc00", "192.0.2.1", "192.0.2.1"}, {"rrc01", "192.0.2.2", "192.0.2.2"}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("routes got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+
+	lpm := []struct {
+		desc   string
+		prefix string
+		want   string
+	}{{
+		desc:   "Success - exact",
+		prefix: "8.8.8.0/24",
+		want:   "8.8.8.0/24",
+	}, {
+		desc:   "Success - more specific announced",
+		prefix: "8.8.8.129/32",
+		want:   "8.8.8.128/25",
+	}, {
+		desc:   "Success - covered",
+		prefix: "8.8.8.1/32",
+		want:   "8.8.8.0/24",
+	}, {
+		desc:   "Success - IPv6",
+		prefix: "2001:db8::1/128",
+		want:   "2001:db8::/32",
+	}, {
+		desc:   "Failure - not routed",
+		prefix: "192.0.2.0/24",
+	}}
+	for _, test := range lpm {
+		var got string
+		if n := r.LongestMatch(mustCIDR(t, test.prefix)); n != nil {
+			got = n.String()
+		}
+		if got != test.want {
+			t.Errorf("[%v]: got %v, want %v", test.desc, got, test.want)
+		}
+	}
+
+	if diff := cmp.Diff(prefixStrings(r.MoreSpecifics(mustCIDR(t, "8.0.0.0/8"))), []string{"8.8.8.0/24", "8.8.8.128/25"}); diff != "" {
+		t.Errorf("more specifics got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if diff := cmp.Diff(r.Originated(15169), []string{"2001:db8::/32", "8.8.8.0/24"}); diff != "" {
+		t.Errorf("originated got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	wantNeighbors := []*Neighbor{{ASN: 15169, Routes: 3}, {ASN: 64496, Routes: 2}, {ASN: 64497, Routes: 1}}
+	if diff := cmp.Diff(r.Neighbors(3356), wantNeighbors); diff != "" {
+		t.Errorf("neighbors got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+
+	// The rrc01 peer changes its route, then withdraws it.
+	r.Update(&RisMessageData{
+		Host:          "rrc01",
+		Peer:          "192.0.2.2",
+		DigestedPath:  []int32{64497, 174, 15169},
+		Announcements: []*RisAnnouncement{{Prefixes: []string{"8.8.8.0/24"}}},
+	})
+	if diff := cmp.Diff(r.Neighbors(3356), []*Neighbor{{ASN: 15169, Routes: 2}, {ASN: 64496, Routes: 2}}); diff != "" {
+		t.Errorf("neighbors after replacement got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	r.Update(&RisMessageData{Host: "rrc01", Peer: "192.0.2.2", Withdrawals: []string{"8.8.8.0/24", "8.8.8.128/25"}})
+	if got := len(r.Routes(mustCIDR(t, "8.8.8.0/24"))); got != 1 {
+		t.Errorf("got %v routes after withdrawal, want 1", got)
+	}
+	if got := r.Neighbors(64511); len(got) != 0 {
+		t.Errorf("got neighbors %v of a withdrawn origin, want none", got)
+	}
+	if got := r.LongestMatch(mustCIDR(t, "8.8.8.129/32")).String(); got != "8.8.8.0/24" {
+		t.Errorf("got longest match %v after withdrawal, want 8.8.8.0/24", got)
+	}
+	if got := r.Len(); got != 2 {
+		t.Errorf("got %v prefixes after withdrawal, want 2", got)
+	}
+
+	// The routes of a peer whose session goes down are removed.
+	r.Update(&RisMessageData{Host: "rrc00", Peer: "192.0.2.1", Type: "RIS_PEER_STATE", State: "down"})
+	if got := r.Len(); got != 0 {
+		t.Errorf("got %v prefixes after the peer went down, want 0", got)
+	}
+	if got := r.Originated(15169); len(got) != 0 {
+		t.Errorf("got originated prefixes %v after the peer went down, want none", got)
+	}
+}
+
+func TestPathLinks(t *testing.T) {
+	got := pathLinks([]int32{4, 2, 2, 3, 2, 3, -1})
+	want := [][2]int32{{2, 4}, {2, 3}, {3, -1}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
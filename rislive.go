@@ -5,30 +5,74 @@
 //  InvalidTransitAS - monitor for prefixes transiting an AS that shouldn't transit that AS. (map)
 //  Origins - monitor for prefixes with designated origins (slice)
 //  Prefix - monitor for a designated set of prefixes (slice)
+//  Bogons - include or exclude prefixes/paths containing bogons (BogonMode)
 //
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/golang/glog"
+	pb "github.com/morrowc/rislive/rislivepb"
+	"google.golang.org/grpc"
 )
 
 var (
-	risFile   = flag.String("risFile", "", "A file of json content, to help in testing.")
-	risLive   = flag.String("rislive", "https://ris-live.ripe.net/v1/stream/?format=json", "RIS Live firehose url")
+	risFile   = flag.String("risFile", "", "Comma separated files or glob patterns of json content, gzip, bzip2 or zstd compressed, replayed in timestamp order, to help in testing.")
+	risLive   = flag.String("rislive", "https://ris-live.ripe.net/v1/stream/?format=json", "RIS Live firehose url, ws(s):// urls use the WebSocket endpoint, ie: wss://ris-live.ripe.net/v1/ws/")
 	risClient = flag.String("risclient", "golang-rislive-morrowc", "Clientname to send to rislive")
 	buffer    = flag.Int("buffer", 1000, "Max depth of Ris messages to queue.")
+	bogonFile = flag.String("bogonFile", "", "A file of unallocated prefixes, one per line, to treat as bogons.")
+
+	adjacencyFile  = flag.String("adjacencyFile", "", "A file to persist the learned adjacencies of the monitored origins.")
+	adjacencyLearn = flag.Duration("adjacencyLearn", 24*time.Hour, "The period to learn adjacencies before alerting on new ones.")
+	dedupWindow    = flag.Duration("dedupWindow", 5*time.Minute, "The window within which repeated alerts are aggregated.")
+	sinks          = flag.String("sinks", "", "Comma separated alert sinks: http(s)://..., syslog+udp://host:port, file:///path")
+	suppress       = flag.String("suppress", "", "Semicolon separated alert suppression rules, ie: kind=FLAP_START,prefix=192.0.2.0/24")
+	stallTimeout   = flag.Duration("stallTimeout", 2*time.Minute, "Reconnect to RIS Live if no messages are received for this long, 0 to disable.")
+	pingInterval   = flag.Duration("pingInterval", 30*time.Second, "The interval between pings on the RIS Live WebSocket, 0 to disable.")
+	overflow       = flag.String("overflow", "block", "The action when the consumer falls behind: block, drop-newest, drop-oldest or spill.")
+	spillDir       = flag.String("spillDir", "", "The directory for the spill file of the spill overflow policy, the temporary directory if empty.")
+	workers        = flag.Int("workers", 1, "The number of workers decoding messages, each peer's messages are kept in order. More than GOMAXPROCS, by default the number of CPUs, add no throughput.")
+	fastDecode     = flag.Bool("fastDecode", false, "Decode messages with the specialized RIS Live decoder, rather than encoding/json.")
+	metricsAddr    = flag.String("metricsAddr", "", "The address to serve Prometheus metrics on /metrics, ie: :9090. Disabled if empty.")
+	serveAddr      = flag.String("serveAddr", "", "The address to serve the RIS Live API, /v1/ws/ and /v1/stream/, and SSE or NDJSON on /v1/messages/, ie: :8080. Disabled if empty.")
+	grpcAddr       = flag.String("grpcAddr", "", "The address to serve the gRPC API on, ie: :9091. Disabled if empty.")
+	apiAddr        = flag.String("apiAddr", "", "The address to serve the REST API of the RIB, /prefix/ and /asn/, ie: :8081. Disabled if empty.")
+	roaFile        = flag.String("roaFile", "", "A JSON export of ROAs, from rpki-client or routinator, to add the RPKI state to the REST API.")
+	mrtFiles       = flag.String("mrtFiles", "", "Comma separated MRT files, gzip, bzip2 or zstd compressed, to read in order in place of the stream, ie: a bview followed by updates.")
+	mrtHost        = flag.String("mrtHost", "mrt", "The collector name, ie: rrc00, of the messages of mrtFiles.")
+	mrtDir         = flag.String("mrtDir", "", "The directory to archive the filtered messages to as MRT BGP4MP_ET files, one directory per collector. Disabled if empty.")
+	mrtInterval    = flag.Duration("mrtInterval", 5*time.Minute, "The period of each MRT archive file.")
+	replaySpeed    = flag.Float64("replaySpeed", 0, "The speed to replay risFile at, by the message timestamps: 1 for real-time, 10 for 10 times faster, 0 for as fast as possible.")
+	bmpAddr        = flag.String("bmpAddr", "", "The address to accept BMP sessions of routers on, ie: :11019, their messages filtered alongside the stream's. Disabled if empty.")
+	bgpAddr        = flag.String("bgpAddr", "", "The address to accept BGP sessions of peers on, ie: :179, their UPDATEs filtered alongside the stream's. Nothing is advertised. Disabled if empty.")
+	bgpASN         = flag.Uint("bgpASN", 0, "The local ASN of the BGP sessions.")
+	bgpRouterID    = flag.String("bgpRouterID", "", "The BGP identifier of the BGP sessions, an IPv4 address.")
+	bgpHoldTime    = flag.Duration("bgpHoldTime", 90*time.Second, "The proposed hold time of the BGP sessions.")
+	bgpHost        = flag.String("bgpHost", "bgp", "The collector name of the messages of the BGP sessions.")
+	bgpNeighbors   = flag.String("bgpNeighbors", "", "Comma separated neighbors of the BGP speaker, [ASN@]address[:port], whose sessions alone are accepted. Those with a port, ie: 64496@192.0.2.1:179, are also connected to. Any peer is accepted if empty.")
+	mrtGzip        = flag.Bool("mrtGzip", true, "Gzip compress the MRT archive files.")
+	mrtLocalASN    = flag.Uint("mrtLocalASN", 0, "The ASN recorded as the local end, the collector, of each session in the MRT archive files.")
+	replayFrom     = flag.String("replayFrom", "", "The RFC 3339 start of the window of the recording directory risFile to replay, seeking by its index.")
+	replayTo       = flag.String("replayTo", "", "The RFC 3339 end of the window of the recording directory risFile to replay, seeking by its index.")
+	recordDir      = flag.String("recordDir", ".", "The directory the record command writes the recording to.")
+	recordInterval = flag.Duration("recordInterval", time.Hour, "The period of each file of a recording.")
+	recordBlock    = flag.Duration("recordBlock", time.Minute, "The period of each independently compressed block of a recording, the granularity of its index.")
 )
 
 // RisLive is a struct to hold basic data used in connecting to the RIS Live service
@@ -39,8 +83,32 @@ type RisLive struct {
 	File    *string
 	UA      *string
 	Filter  *RisFilter
-	Records int64
+	Records int64 // Updated atomically, read with Count.
 	Chan    chan RisMessage
+	Bogons  *BogonDetector
+	Metrics *Metrics
+
+	Watchdog     *Watchdog     // Reconnects the remote stream when it stalls.
+	PingInterval time.Duration // The interval between pings on the WebSocket transport.
+
+	Workers   int                           // Decode workers, each peer's messages stay in order.
+	Prefilter func(rm *RisMessageData) bool // If set, only messages it accepts are sent to Chan.
+	Decoder   *RisDecoder                   // If set, decodes messages in place of encoding/json, leaving Path unset.
+
+	Overflow OverflowPolicy // The action taken when Chan is full.
+	SpillDir string         // The directory for the OverflowSpill file, the temporary directory if empty.
+	spill    *spiller
+
+	ReplaySpeed float64   // The multiple of the received pace to replay File at, as fast as possible if 0.
+	ReplayFrom  time.Time // If either is set, File is a recording directory whose window is replayed.
+	ReplayTo    time.Time
+
+	MRTFiles []string // If set, MRT files are read in order, in place of the stream.
+	MRTHost  string   // The collector of the messages of MRTFiles.
+
+	BMPAddr string      // If set, the address to accept BMP sessions on, their messages sent alongside the stream's.
+	BGP     *BGPSpeaker // If set, accepts BGP sessions on its Addr, their messages sent alongside the stream's.
+	hmu     sync.Mutex  // Serializes handle, which the BMP sessions share with the stream.
 }
 
 // RisFilter is an object to hold content used to filter the collected BGP
@@ -50,12 +118,15 @@ type RisFilter struct {
 	InvalidTransitAS map[int32]bool // {"701":true, "3356":true}.
 	Origins          []string       // A list of interesting origin ASH.
 	Prefix           []string       // Prefix: ["1.2.3.0/24", "2001:db8::/32"] a list of prefixes.
+	Bogons           BogonMode      // Include or exclude messages with bogon prefixes/ASNs.
 }
 
 // RisMessage is a single ris_message json message from the ris firehose.
 type RisMessage struct {
 	Type string          `json:"type"`
 	Data *RisMessageData `json:"data"`
+
+	pool *pooledData // Set if Data is taken from the pool, see GetRisMessage.
 }
 
 // RisMessageData is the BGP oriented content of the single RisMessage message type.
@@ -66,12 +137,61 @@ type RisMessageData struct {
 	ID            string        `json:"id"`
 	Host          string        `json:"host"`
 	Type          string        `json:"type"`
-	Path          []interface{} `json:"path"`
+	Path          []interface{} `json:"path"` // Only set by encoding/json, see ASPath.
 	DigestedPath  []int32
+	PathSets      []PathSet          // The AS_SETs of the DigestedPath.
 	Community     [][]int32          `json:"community"`
 	Origin        string             `json:"origin"`
 	Announcements []*RisAnnouncement `json:"announcements"`
+	Withdrawals   []string           `json:"withdrawals"`
 	Raw           string             `json:"raw"`
+	State         string             `json:"state,omitempty"` // The session state of RIS_PEER_STATE messages, ie: connected, down.
+	Stats         map[string]uint64  `json:"stats,omitempty"` // The counters of STATS messages, from BMP Stats Reports.
+}
+
+// PathSet is an AS_SET of a DigestedPath, its ASNs being DigestedPath[Start:End].
+type PathSet struct {
+	Start, End int
+}
+
+// ASPath returns the Path of the message, as encoding/json decodes it: ASNs as
+// float64 and AS_SETs as lists of them. If the message has no Path, it is built
+// from the DigestedPath and PathSets on each call, as consumers share messages.
+func (r *RisMessageData) ASPath() []interface{} {
+	if r.Path != nil || len(r.DigestedPath) == 0 {
+		return r.Path
+	}
+	path := make([]interface{}, 0, len(r.DigestedPath))
+	sets := r.PathSets
+	for i := 0; i < len(r.DigestedPath) || len(sets) > 0; {
+		if len(sets) > 0 && sets[0].Start <= i {
+			set := make([]interface{}, 0, sets[0].End-sets[0].Start)
+			for _, asn := range r.DigestedPath[sets[0].Start:sets[0].End] {
+				set = append(set, float64(uint32(asn)))
+			}
+			path = append(path, set)
+			i, sets = sets[0].End, sets[1:]
+			continue
+		}
+		path = append(path, float64(uint32(r.DigestedPath[i])))
+		i++
+	}
+	return path
+}
+
+// Time returns the message timestamp as a time.Time.
+func (r *RisMessageData) Time() time.Time {
+	sec := int64(r.Timestamp)
+	return time.Unix(sec, int64((r.Timestamp-float64(sec))*1e9))
+}
+
+// OriginASN returns the origin ASN of the message, the last ASN in the DigestedPath.
+// If the path is empty, ok is false.
+func (r *RisMessageData) OriginASN() (int32, bool) {
+	if len(r.DigestedPath) == 0 {
+		return 0, false
+	}
+	return r.DigestedPath[len(r.DigestedPath)-1], true
 }
 
 // MatchASPath matches a fragment of an aspath with an as-path in an announcement.
@@ -151,11 +271,20 @@ func NewRisLive(url, file, ua *string, rf *RisFilter, buffer *int) *RisLive {
 		Filter:  rf,
 		Records: 0,
 		Chan:    make(chan (RisMessage), *buffer),
+		Metrics: NewMetrics(),
+
+		Watchdog:     NewWatchdog(2 * time.Minute),
+		PingInterval: 30 * time.Second,
 	}
 }
 
+// Count returns the number of messages read from the stream.
+func (r *RisLive) Count() int64 {
+	return atomic.LoadInt64(&r.Records)
+}
+
 func digestPath(m *RisMessageData) error {
-	m.DigestedPath = []int32{}
+	m.DigestedPath, m.PathSets = []int32{}, nil
 	for _, p := range m.Path {
 		var o int32
 		switch v := p.(type) {
@@ -164,21 +293,24 @@ func digestPath(m *RisMessageData) error {
 		// I would also combine these but typecasting is dumb and
 		// without this separation the compiler considers v an interface
 		// :(
+		// ASNs of 2^31 and above wrap in the int32, as in the decoder and MRT.
 		case int:
-			o = int32(v)
+			o = int32(uint32(v))
 		case float64:
-			o = int32(v)
+			o = int32(uint32(v))
 		case []interface{}:
 			// Convert p to a slice of interface.
 			listSlice, ok := p.([]interface{})
 			if !ok {
 				return fmt.Errorf("failed to cast path element: %v as %v", p, reflect.TypeOf(p))
 			}
+			start := len(m.DigestedPath)
 			for _, e := range listSlice {
 				// I would move this down to the outside of the function but that's difficult
 				// and probably not efficient, assuming an input of mostly ints or float64's
-				m.DigestedPath = append(m.DigestedPath, int32(e.(float64)))
+				m.DigestedPath = append(m.DigestedPath, int32(uint32(e.(float64))))
 			}
+			m.PathSets = append(m.PathSets, PathSet{Start: start, End: len(m.DigestedPath)})
 			// not the cleanest but there's no sane way to clean this up otherwise
 			continue
 		default:
@@ -190,35 +322,136 @@ func digestPath(m *RisMessageData) error {
 	return nil
 }
 
-// Listen connects to the RisLive service, parses the stream into structs
-// and makes the data stream available for analysis through the RisLive.Chan channel.
-func (r *RisLive) Listen() {
-	var body io.ReadCloser
-	// If there's a file provided read/use that, else open the remote
-	// socket and consume the firehose.
-	switch len(*r.File) == 0 {
-	case true:
-		log.Infof("Reading from the firehose...")
-		client := &http.Client{}
-		req, err := http.NewRequest("GET", *r.URL, nil)
+// messageReader is a source of decoded messages, ie: an MRT file or a BMP session.
+type messageReader interface {
+	// Next returns the next message, or io.EOF at the end of the source.
+	Next() (*RisMessageData, error)
+}
+
+// readMessages reads the messages of m to the channel until it ends. Errors for
+// which skip is true, those of a single message, are logged and counted as
+// decode errors, and the message skipped.
+func (r *RisLive) readMessages(m messageReader, skip func(error) bool, logf io.Writer) error {
+	for {
+		rm, err := m.Next()
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil && skip(err):
+			r.Metrics.DecodeErrors.Inc()
+			log.Errorf("%v", err)
+			continue
+		case err != nil:
+			return err
+		}
+		r.handle(&DecodedMessage{
+			Message: RisMessage{Type: "ris_message", Data: rm},
+			Match:   r.Prefilter == nil || r.Prefilter(rm),
+		}, logf)
+	}
+}
+
+// risStream is a connection to a source of RIS messages, returning each raw message.
+type risStream interface {
+	Next() ([]byte, error)
+	Close() error
+}
+
+// pinger is implemented by streams which support RIS Live ping messages.
+type pinger interface {
+	Ping() error
+}
+
+// jsonStream reads a stream of json messages, from a file or the HTTP stream endpoint.
+type jsonStream struct {
+	dec *json.Decoder
+	c   io.Closer
+}
+
+// Next returns the next json value of the stream. The decoder can not continue
+// past a syntax error, so that ends the stream.
+func (s *jsonStream) Next() ([]byte, error) {
+	var raw json.RawMessage
+	if err := s.dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func (s *jsonStream) Close() error { return s.c.Close() }
+
+// wsStream reads messages from the RIS Live WebSocket endpoint.
+type wsStream struct {
+	ws *WebSocket
+}
+
+func (s *wsStream) Next() ([]byte, error) {
+	for {
+		op, data, err := s.ws.ReadMessage()
 		if err != nil {
-			log.Fatalf("failed to create new request to ris-live: %v\n", err)
-		}
-		req.Header.Set("User-Agent", *r.UA)
-		resp, err := client.Do(req)
-		defer resp.Body.Close()
-		body = resp.Body
-	default:
-		log.Infof("Heres a file read")
-		fd, err := ioutil.ReadFile(*r.File)
+			return nil, err
+		}
+		if op == wsText {
+			return data, nil
+		}
+	}
+}
+
+func (s *wsStream) Ping() error { return s.ws.WriteMessage(wsText, []byte(`{"type":"ping"}`)) }
+
+func (s *wsStream) Close() error { return s.ws.Close() }
+
+// connect opens the RIS Live stream. URLs with a ws:// or wss:// scheme use the
+// WebSocket endpoint, subscribing to all messages, others the HTTP stream endpoint.
+func (r *RisLive) connect() (risStream, error) {
+	u, err := url.Parse(*r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ris-live url(%v): %v", *r.URL, err)
+	}
+	if u.Scheme == "ws" || u.Scheme == "wss" {
+		if q := u.Query(); q.Get("client") == "" {
+			q.Set("client", *r.UA)
+			u.RawQuery = q.Encode()
+		}
+		ws, err := DialWebSocket(u.String(), http.Header{"User-Agent": {*r.UA}})
 		if err != nil {
-			log.Fatalf("failed to read risFile(%v): %v\n", *r.File, err)
+			return nil, err
+		}
+		if err := ws.WriteMessage(wsText, []byte(`{"type":"ris_subscribe","data":{}}`)); err != nil {
+			ws.Close()
+			return nil, fmt.Errorf("failed to subscribe to ris-live: %v", err)
 		}
-		body = ioutil.NopCloser(bytes.NewReader(fd))
-		log.Infof("Finished Reading File")
+		return &wsStream{ws: ws}, nil
 	}
 
-	dec := json.NewDecoder(body)
+	client := &http.Client{}
+	req, err := http.NewRequest("GET", *r.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new request to ris-live: %v", err)
+	}
+	req.Header.Set("User-Agent", *r.UA)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ris-live: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("ris-live returned: %v", resp.Status)
+	}
+	return &jsonStream{dec: json.NewDecoder(resp.Body), c: resp.Body}, nil
+}
+
+// Listen connects to the RisLive service, parses the stream into structs
+// and makes the data stream available for analysis through the RisLive.Chan channel.
+// The remote stream is reconnected, with backoff, when it fails or the Watchdog
+// finds it stalled. A file is read once, and the channel closed at its end.
+func (r *RisLive) Listen() {
+	if r.Metrics == nil {
+		r.Metrics = NewMetrics()
+	}
+	if r.Watchdog == nil {
+		r.Watchdog = NewWatchdog(0)
+	}
 
 	// Remove log file once done.
 	f, err := os.Create("/tmp/log")
@@ -226,34 +459,297 @@ func (r *RisLive) Listen() {
 		log.Fatalf("failed to open log file: %v", err)
 	}
 	defer f.Close()
+
+	// BMP and BGP sessions are accepted until a file ends, or for good with the stream.
+	var stops []func()
+	stopSessions := func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+	if r.BMPAddr != "" {
+		l, err := net.Listen("tcp", r.BMPAddr)
+		if err != nil {
+			log.Fatalf("failed to listen for BMP(%v): %v", r.BMPAddr, err)
+		}
+		stops = append(stops, r.serveBMP(l, f))
+	}
+	if r.BGP != nil {
+		l, err := net.Listen("tcp", r.BGP.Addr)
+		if err != nil {
+			log.Fatalf("failed to listen for BGP(%v): %v", r.BGP.Addr, err)
+		}
+		stops = append(stops, r.serveBGP(l, r.BGP, f))
+	}
+
+	if len(r.MRTFiles) > 0 {
+		if err := r.readMRT(f); err != nil {
+			log.Errorf("failed to read MRT files: %v", err)
+		}
+		stopSessions()
+		r.closeChan()
+		return
+	}
+
+	// If there are files provided replay those, else open the remote
+	// socket and consume the firehose.
+	if len(*r.File) != 0 {
+		var s *replayStream
+		if !r.ReplayFrom.IsZero() || !r.ReplayTo.IsZero() {
+			s, err = openRecording(*r.File, r.ReplayFrom, r.ReplayTo, r.ReplaySpeed)
+		} else {
+			s, err = openReplay(strings.Split(*r.File, ","), r.ReplaySpeed)
+		}
+		if err != nil {
+			log.Fatalf("failed to open risFile(%v): %v", *r.File, err)
+		}
+		if err := r.read(s, f); err != io.EOF {
+			log.Errorf("failed to read risFile(%v): %v", *r.File, err)
+		}
+		s.Close()
+		stopSessions()
+		r.closeChan()
+		return
+	}
+
+	r.reconnect(func(s risStream) error {
+		return r.watch(s, func() error { return r.read(s, f) })
+	})
+}
+
+// reconnect connects to the remote stream and runs run on it, reconnecting with
+// backoff when it fails.
+func (r *RisLive) reconnect(run func(s risStream) error) {
+	const maxBackoff = time.Minute
+	backoff := time.Second
 	for {
-		var rm RisMessage
-		err := dec.Decode(&rm)
-		switch {
-		case err != nil && err != io.EOF:
-			_, err := f.WriteString(fmt.Sprintf("bad json content: %+v\n", rm.Data))
+		log.Infof("Reading from the firehose...")
+		start := time.Now()
+		s, err := r.connect()
+		if err == nil {
+			r.Metrics.Connects.Inc()
+			err = run(s)
+		}
+		if time.Since(start) > maxBackoff {
+			backoff = time.Second
+		}
+		log.Errorf("ris-live stream failed: %v, reconnecting in %v", err, backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// watch runs read on the stream until it fails. Meanwhile the stream is closed
+// if the Watchdog finds it stalled, and pinged every PingInterval if it supports
+// pings.
+func (r *RisLive) watch(s risStream, read func() error) error {
+	r.Watchdog.Reset(time.Now())
+	interval := time.Second
+	if t := r.Watchdog.Timeout / 4; t > 0 && t < interval {
+		interval = t
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		check := time.NewTicker(interval)
+		defer check.Stop()
+		var ping <-chan time.Time
+		p, ok := s.(pinger)
+		if ok && r.PingInterval > 0 {
+			t := time.NewTicker(r.PingInterval)
+			defer t.Stop()
+			ping = t.C
+		}
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ping:
+				if err := p.Ping(); err != nil {
+					log.Errorf("failed to ping ris-live: %v", err)
+					continue
+				}
+				r.Watchdog.PingSent(now)
+			case now := <-check.C:
+				for _, f := range r.Watchdog.Freshness() {
+					r.Metrics.Age.Set(now.Sub(f.Received).Seconds(), f.Collector)
+				}
+				if r.Watchdog.Stalled(now) {
+					log.Errorf("no messages from ris-live for %v, reconnecting", r.Watchdog.Timeout)
+					r.Metrics.Stalls.Inc()
+					s.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	err := read()
+	s.Close()
+	return err
+}
+
+// isPong reports whether a raw message is a pong. Pongs are tiny, so only short
+// messages are decoded to check.
+func isPong(raw []byte) bool {
+	return len(raw) < 64 && parseRawHeader(raw).Type == "pong"
+}
+
+// read reads messages from the stream to the channel until the stream fails,
+// decoding them with a DecodePipeline of Workers. Messages are observed by the
+// Watchdog as they are read, and it is held while the pipeline is full, so the
+// consumer falling behind is not taken for a stall of the stream.
+func (r *RisLive) read(s risStream, logf io.Writer) error {
+	p := &DecodePipeline{Workers: r.Workers, Filter: r.Prefilter, Buffer: 64, Decoder: r.Decoder}
+	in := make(chan []byte, 64)
+	out := p.Run(in)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(in)
+		for {
+			raw, err := s.Next()
 			if err != nil {
-				log.Fatalf("failed to write to log: %v", err)
+				errc <- err
+				return
+			}
+			if !isPong(raw) {
+				r.Watchdog.Observe(nil, time.Now())
+			}
+			select {
+			case in <- raw:
+			default:
+				r.Watchdog.Hold()
+				in <- raw
+				r.Watchdog.Release(time.Now())
 			}
-			continue
-		case err == io.EOF:
-			close(r.Chan)
-			return
 		}
-		err = digestPath(rm.Data)
-		if err != nil {
-			fmt.Printf("decoding the message data path(%v) failed: %v\n", rm.Data.Path, err)
-			log.Infof("decoding the message data path(%v) failed: %v", rm.Data.Path, err)
+	}()
+	for d := range out {
+		r.handle(&d, logf)
+	}
+	return <-errc
+}
+
+// handle sends a decoded message to the channel, updating the watchdog and
+// metrics. The message is released once handled, the channel holding its own.
+func (r *RisLive) handle(d *DecodedMessage, logf io.Writer) {
+	defer d.Message.Release()
+	r.hmu.Lock()
+	defer r.hmu.Unlock()
+	if d.Err != nil {
+		r.Metrics.DecodeErrors.Inc()
+		if _, err := fmt.Fprintf(logf, "bad json content(%v): %s\n", d.Err, d.Raw); err != nil {
+			log.Fatalf("failed to write to log: %v", err)
 		}
-		r.Records++
-		r.Chan <- rm
+		return
+	}
+	rm := d.Message
+	// Pongs do not count as liveness, a stalled stream may still answer pings.
+	// Messages of the stream were observed as they were read, this records the
+	// freshness of their collector.
+	now := time.Now()
+	if rm.Type == "pong" {
+		if rtt, ok := r.Watchdog.Pong(now); ok {
+			r.Metrics.PingRTT.Set(rtt.Seconds())
+		}
+		return
+	}
+	r.Watchdog.Observe(rm.Data, now)
+	if rm.Data == nil {
+		log.V(2).Infof("dropping %v message without data", rm.Type)
+		return
+	}
+	if d.PathErr != nil {
+		log.Infof("decoding the message data path(%v) failed: %v", rm.Data.ASPath(), d.PathErr)
+		r.Metrics.PathErrors.Inc()
+	}
+	r.observe(rm)
+	atomic.AddInt64(&r.Records, 1)
+	if d.Match {
+		rm.Retain()
+		r.send(rm)
 	}
 }
 
+// serveSessions accepts sessions of the protocol on l, running session for each
+// with the address of the remote end, until the returned function is called,
+// which closes l and the sessions, and waits for them to end.
+func (r *RisLive) serveSessions(l net.Listener, proto string, session func(c net.Conn, host string) error) func() {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		conns = map[net.Conn]bool{}
+		done  bool
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				mu.Lock()
+				stopped := done
+				mu.Unlock()
+				if !stopped {
+					log.Errorf("failed to accept %v session: %v", proto, err)
+				}
+				return
+			}
+			mu.Lock()
+			if done {
+				mu.Unlock()
+				c.Close()
+				return
+			}
+			conns[c] = true
+			wg.Add(1)
+			mu.Unlock()
+			go func() {
+				defer wg.Done()
+				host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+				if err != nil {
+					host = c.RemoteAddr().String()
+				}
+				log.Infof("%v session from %v", proto, c.RemoteAddr())
+				err = session(c, host)
+				mu.Lock()
+				if err != nil && !done {
+					log.Errorf("%v session from %v failed: %v", proto, c.RemoteAddr(), err)
+				}
+				delete(conns, c)
+				mu.Unlock()
+				c.Close()
+			}()
+		}
+	}()
+	return func() {
+		mu.Lock()
+		done = true
+		l.Close()
+		for c := range conns {
+			c.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}
+}
+
+// observe updates the stream metrics with a received message.
+func (r *RisLive) observe(rm RisMessage) {
+	r.Metrics.Messages.Inc(rm.Type, rm.Data.Host)
+	r.Metrics.Lag.Set(time.Since(rm.Data.Time()).Seconds(), rm.Data.Host)
+	r.Metrics.LastMessage.Set(rm.Data.Timestamp, rm.Data.Host)
+}
+
 // Get collects messages from the RisLive.Chan channel and filters results prior
-// to display or handling downstream.
-// TODO(morrowc): Why is Get accepting a Filter? Why not just use the Filter in RisLive?
+// to display or handling downstream, with the filter f, or RisLive.Filter if f is nil.
 func (r *RisLive) Get(f *RisFilter) string {
+	if f == nil {
+		f = r.Filter
+	}
 	for rm := range r.Chan {
 		rmd := rm.Data
 		prefix := ""
@@ -268,7 +764,7 @@ func (r *RisLive) Get(f *RisFilter) string {
 					fmt.Printf("Prefixes: %v Origin: %v Path: %v\n",
 						strings.Join(prefixes, ", "),
 						rmd.DigestedPath[len(rmd.DigestedPath)-1],
-						rmd.Path)
+						rmd.ASPath())
 				}
 			}
 		}
@@ -277,19 +773,69 @@ func (r *RisLive) Get(f *RisFilter) string {
 		// the logic here needs to be more complicated, depending upon what's set
 		// in the filter to check. Suggest make 'checkTests' like function, evaluate
 		// so only the set filter parts matter.
-		if r.CheckASPath(rmd) && r.CheckInvalidTransitAS(rmd) &&
-			r.CheckOrigins(rmd) && r.CheckPrefix(rmd) {
-			return fmt.Sprintf("Message(%d): Peer/ASN -> %v/%v Prefix1: %v\n", r.Records, rmd.Peer, rmd.PeerASN, prefix)
+		if f.CheckASPath(rmd) && f.CheckInvalidTransitAS(rmd) &&
+			f.CheckOrigins(rmd) && f.CheckPrefix(rmd) && f.CheckBogons(rmd, r.Bogons) {
+			result := fmt.Sprintf("Message(%d): Peer/ASN -> %v/%v Prefix1: %v\n", r.Count(), rmd.Peer, rmd.PeerASN, prefix)
+			rm.Release()
+			return result
 		}
+		rm.Release()
 	}
 	return "Done"
 }
 
+// Match reports whether a message passes the filter, evaluating only the parts
+// of the filter which are set. An empty filter matches every message.
+// Unlike CheckOrigins, which compares the BGP origin attribute, the filter's
+// Origins are compared with the message's origin ASN.
+func (r *RisLive) Match(rm *RisMessageData) bool {
+	return r.Filter.Match(rm, r.Bogons)
+}
+
+// Match reports whether a message passes the filter, as RisLive.Match, with
+// bogons found by the detector b.
+func (f *RisFilter) Match(rm *RisMessageData, b *BogonDetector) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.ASPath) > 0 && !rm.MatchASPath(f.ASPath) {
+		return false
+	}
+	if len(f.InvalidTransitAS) > 0 && !rm.InvalidTransitAS(f.InvalidTransitAS) {
+		return false
+	}
+	if len(f.Origins) > 0 {
+		origin, ok := rm.OriginASN()
+		if !ok {
+			return false
+		}
+		found := false
+		for _, o := range f.Origins {
+			if o == strconv.FormatUint(uint64(uint32(origin)), 10) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Prefix) > 0 && !f.CheckPrefix(rm) {
+		return false
+	}
+	return f.CheckBogons(rm, b)
+}
+
 // CheckASPath checks the filterable ASPath, if it's set.
 // If not set, always return true.
 func (r *RisLive) CheckASPath(rm *RisMessageData) bool {
-	if len(r.Filter.ASPath) > 0 {
-		return rm.MatchASPath(r.Filter.ASPath)
+	return r.Filter.CheckASPath(rm)
+}
+
+// CheckASPath checks the filterable ASPath, as RisLive.CheckASPath.
+func (f *RisFilter) CheckASPath(rm *RisMessageData) bool {
+	if len(f.ASPath) > 0 {
+		return rm.MatchASPath(f.ASPath)
 	}
 	return true
 }
@@ -297,8 +843,13 @@ func (r *RisLive) CheckASPath(rm *RisMessageData) bool {
 // CheckInvalidTransitAS checks to see if there is a marked invalid ASN in the as-path.
 // If there is no map, this check returns false: there is nothing to match, so no match.
 func (r *RisLive) CheckInvalidTransitAS(rm *RisMessageData) bool {
-	if len(r.Filter.InvalidTransitAS) > 0 {
-		return rm.InvalidTransitAS(r.Filter.InvalidTransitAS)
+	return r.Filter.CheckInvalidTransitAS(rm)
+}
+
+// CheckInvalidTransitAS checks for a marked invalid ASN, as RisLive.CheckInvalidTransitAS.
+func (f *RisFilter) CheckInvalidTransitAS(rm *RisMessageData) bool {
+	if len(f.InvalidTransitAS) > 0 {
+		return rm.InvalidTransitAS(f.InvalidTransitAS)
 	}
 	return false
 }
@@ -306,12 +857,35 @@ func (r *RisLive) CheckInvalidTransitAS(rm *RisMessageData) bool {
 // CheckOrigins checks the inbound message origin against a list of possible origins.
 // If there is no list of origins, return false, an origin must be specified in the filter.
 func (r *RisLive) CheckOrigins(rm *RisMessageData) bool {
-	if len(r.Filter.Origins) > 0 {
-		return rm.CheckOrigins(r.Filter.Origins)
+	return r.Filter.CheckOrigins(rm)
+}
+
+// CheckOrigins checks the message origin, as RisLive.CheckOrigins.
+func (f *RisFilter) CheckOrigins(rm *RisMessageData) bool {
+	if len(f.Origins) > 0 {
+		return rm.CheckOrigins(f.Origins)
 	}
 	return false
 }
 
+// CheckBogons checks the message for bogon prefixes and ASNs, according to the
+// filter's BogonMode. If the mode is BogonIgnore, or there is no detector, return true.
+func (r *RisLive) CheckBogons(rm *RisMessageData) bool {
+	return r.Filter.CheckBogons(rm, r.Bogons)
+}
+
+// CheckBogons checks the message for bogons found by the detector b, as RisLive.CheckBogons.
+func (f *RisFilter) CheckBogons(rm *RisMessageData, b *BogonDetector) bool {
+	if f.Bogons == BogonIgnore || b == nil {
+		return true
+	}
+	found := len(b.Check(rm)) > 0
+	if f.Bogons == BogonInclude {
+		return found
+	}
+	return !found
+}
+
 // CheckPrefix will check each announcement in a message, and return true
 // if there is a prefix in the message that matches the watched prefixes.
 // These are exact matches of strings, there is no super/subnet/covering route
@@ -321,9 +895,14 @@ func (r *RisLive) CheckOrigins(rm *RisMessageData) bool {
 // TODO(morrowc): Provide super/subnet verification of each announced prefix
 // to the requestors list of supernets.
 func (r *RisLive) CheckPrefix(rm *RisMessageData) bool {
-	if len(r.Filter.Prefix) > 0 {
+	return r.Filter.CheckPrefix(rm)
+}
+
+// CheckPrefix checks the announced prefixes of the message, as RisLive.CheckPrefix.
+func (f *RisFilter) CheckPrefix(rm *RisMessageData) bool {
+	if len(f.Prefix) > 0 {
 		filterPrefixes := []*net.IPNet{}
-		for _, prefix := range r.Filter.Prefix {
+		for _, prefix := range f.Prefix {
 			_, subnet, err := net.ParseCIDR(prefix)
 			if err != nil {
 				log.Infof("failed to convert filter prefix(%v) to IPNet: %v", prefix, err)
@@ -349,15 +928,175 @@ func (r *RisLive) CheckPrefix(rm *RisMessageData) bool {
 	return false
 }
 
+// parseFlagTime parses the RFC 3339 time of a flag, zero if it is empty.
+func parseFlagTime(name, v string) time.Time {
+	if v == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		log.Fatalf("failed to parse -%v(%v): %v", name, v, err)
+	}
+	return t
+}
+
 func main() {
 	flag.Parse()
+	// rislive record writes the raw stream to a recording, and does nothing else.
+	// Its flags may come before or after the command.
+	if flag.Arg(0) == "record" {
+		flag.CommandLine.Parse(flag.Args()[1:])
+		record()
+		return
+	}
 	rf := &RisFilter{
 		Prefix:  []string{"130.137.85.0/24", "199.168.88.0/22", "8.8.8.0/24", "8.8.4.0/24", "216.239.32.0/19"},
 		Origins: []string{"15169", "54054", "396982"},
 	}
 	r := NewRisLive(risLive, risFile, risClient, rf, buffer)
+	r.Watchdog.Timeout = *stallTimeout
+	r.PingInterval = *pingInterval
+	policy, err := ParseOverflowPolicy(*overflow)
+	if err != nil {
+		log.Fatalf("failed to parse overflow policy: %v", err)
+	}
+	r.Overflow, r.SpillDir = policy, *spillDir
+	r.Workers = *workers
+	if *mrtFiles != "" {
+		r.MRTFiles, r.MRTHost = strings.Split(*mrtFiles, ","), *mrtHost
+	}
+	r.ReplaySpeed = *replaySpeed
+	r.ReplayFrom, r.ReplayTo = parseFlagTime("replayFrom", *replayFrom), parseFlagTime("replayTo", *replayTo)
+	r.BMPAddr = *bmpAddr
+	if *bgpAddr != "" {
+		id := net.ParseIP(*bgpRouterID)
+		if id == nil || id.To4() == nil || *bgpASN == 0 || *bgpASN > math.MaxUint32 {
+			log.Fatalf("a BGP speaker needs a -bgpASN and an IPv4 -bgpRouterID, not %v and %q", *bgpASN, *bgpRouterID)
+		}
+		neighbors, err := ParseBGPNeighbors(*bgpNeighbors)
+		if err != nil {
+			log.Fatalf("failed to parse -bgpNeighbors: %v", err)
+		}
+		r.BGP = &BGPSpeaker{Addr: *bgpAddr, ASN: uint32(*bgpASN), RouterID: id, HoldTime: *bgpHoldTime, Host: *bgpHost, Neighbors: neighbors}
+	}
+	if *fastDecode {
+		r.Decoder = NewRisDecoder()
+	}
+	bd, err := NewBogonDetector(*bogonFile)
+	if err != nil {
+		log.Fatalf("failed to create bogon detector: %v", err)
+	}
+	r.Bogons = bd
+
+	detectors, err := newDetectors(r)
+	if err != nil {
+		log.Fatalf("failed to create detectors: %v", err)
+	}
+	rules, err := ParseSuppressRules(*suppress)
+	if err != nil {
+		log.Fatalf("failed to parse suppress rules: %v", err)
+	}
+	p := NewAlertPipeline(detectors, rules, *dedupWindow, *buffer)
+	sink, err := ParseSinks(*sinks)
+	if err != nil {
+		log.Fatalf("failed to create alert sinks: %v", err)
+	}
+	defer sink.Close()
+
+	if *metricsAddr != "" {
+		r.Metrics.GaugeFunc("rislive_channel_depth", "Messages queued in the RisLive channel.", func() float64 { return float64(len(r.Chan)) })
+		r.Metrics.GaugeFunc("rislive_channel_capacity", "The buffer size of the RisLive channel.", func() float64 { return float64(cap(r.Chan)) })
+		http.Handle("/metrics", r.Metrics)
+		go func() {
+			log.Fatalf("failed to serve metrics: %v", http.ListenAndServe(*metricsAddr, nil))
+		}()
+	}
+
+	b := NewBroker(r.Bogons, r.Metrics)
+	sub, err := b.Subscribe("alerts", nil, *buffer, OverflowBlock)
+	if err != nil {
+		log.Fatalf("failed to subscribe the alert pipeline: %v", err)
+	}
+
+	if *serveAddr != "" {
+		go func() {
+			log.Fatalf("failed to serve RIS Live API: %v", http.ListenAndServe(*serveAddr, NewLiveServer(b, *buffer)))
+		}()
+	}
+
+	if *apiAddr != "" {
+		api := &QueryAPI{RIB: NewRIB()}
+		if *roaFile != "" {
+			if api.ROAs, err = LoadROAs(*roaFile); err != nil {
+				log.Fatalf("failed to load ROAs: %v", err)
+			}
+		}
+		ribSub, err := b.Subscribe("rib", nil, *buffer, OverflowBlock)
+		if err != nil {
+			log.Fatalf("failed to subscribe the RIB: %v", err)
+		}
+		go api.RIB.Run(ribSub.C)
+		go func() {
+			log.Fatalf("failed to serve REST API: %v", http.ListenAndServe(*apiAddr, api))
+		}()
+	}
+
+	// The archive is closed once the stream ends and its subscription drains.
+	mrtDone := make(chan struct{})
+	if *mrtDir != "" {
+		if *mrtInterval <= 0 || *mrtLocalASN > math.MaxUint32 {
+			log.Fatalf("the MRT archive needs a positive -mrtInterval and a -mrtLocalASN of 32 bits, not %v and %v", *mrtInterval, *mrtLocalASN)
+		}
+		w := NewMRTWriter(*mrtDir, *mrtInterval, *mrtGzip)
+		w.LocalASN = uint32(*mrtLocalASN)
+		mrtSub, err := b.Subscribe("mrt", rf, *buffer, OverflowBlock)
+		if err != nil {
+			log.Fatalf("failed to subscribe the MRT writer: %v", err)
+		}
+		go func() {
+			w.Run(mrtSub.C)
+			if err := w.Close(); err != nil {
+				log.Errorf("failed to close MRT archive: %v", err)
+			}
+			close(mrtDone)
+		}()
+	} else {
+		close(mrtDone)
+	}
+
+	hub := NewAlertHub()
+	defer hub.Close()
+	if *grpcAddr != "" {
+		gs := NewGRPCServer(b, hub, *buffer)
+		for _, d := range detectors {
+			switch d := d.(type) {
+			case *MOASDetector:
+				gs.MOAS = d.T
+			case *VisibilityDetector:
+				gs.Visibility = d.T
+			}
+		}
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatalf("failed to listen for gRPC(%v): %v", *grpcAddr, err)
+		}
+		srv := grpc.NewServer()
+		pb.RegisterRisLiveServer(srv, gs)
+		go func() {
+			log.Fatalf("failed to serve gRPC API: %v", srv.Serve(lis))
+		}()
+	}
 
 	go r.Listen()
-	result := r.Get(r.Filter)
-	fmt.Printf("Result: %v\n", result)
+	go b.Run(r.Chan)
+	go p.Run(sub.C)
+	for a := range p.Out {
+		log.Infof("alert: %v", a)
+		r.Metrics.Alerts.Inc(a.Detector, a.Severity.String())
+		hub.Publish(a)
+		if err := sink.Send(a); err != nil {
+			log.Errorf("alert delivery failed: %v", err)
+		}
+	}
+	<-mrtDone
 }
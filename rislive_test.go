@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 var (
@@ -20,16 +22,32 @@ var (
 	msg06 = &RisMessageData{Path: []interface{}{1, 2, 3, []string{"6"}}, Origin: "9"}
 )
 
+// risData decodes the json data of a RIS message.
+func risData(t *testing.T, raw string) *RisMessageData {
+	t.Helper()
+	rm := &RisMessageData{}
+	if err := json.Unmarshal([]byte(raw), rm); err != nil {
+		t.Fatalf("failed to decode message(%v): %v", raw, err)
+	}
+	return rm
+}
+
 func TestDigestPath(t *testing.T) {
 	tests := []struct {
-		desc    string
-		msg     *RisMessageData
-		want    []int32
-		wantErr bool
+		desc     string
+		msg      *RisMessageData
+		want     []int32
+		wantSets []PathSet
+		wantErr  bool
 	}{{
 		desc: "Success decode",
 		msg:  msg01,
 		want: []int32{1, 2, 3, 4, 5, 6, 7, 8},
+	}, {
+		desc:     "Success decode of 32bit ASNs",
+		msg:      risData(t, `{"path":[64496,4200000001,[4200000002,64497]]}`),
+		want:     []int32{64496, int32(-94967295), int32(-94967294), 64497},
+		wantSets: []PathSet{{2, 4}},
 	}, {
 		desc:    "Error, path is words",
 		msg:     msg05,
@@ -51,6 +69,53 @@ func TestDigestPath(t *testing.T) {
 			if !cmp.Equal(test.msg.DigestedPath, test.want) {
 				t.Errorf("[%v]: got/want mismatch:\n%v\n", test.desc, cmp.Diff(test.msg.DigestedPath, test.want))
 			}
+			if diff := cmp.Diff(test.msg.PathSets, test.wantSets, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("[%v]: PathSets got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+			}
+		}
+	}
+}
+
+func TestASPath(t *testing.T) {
+	tests := []struct {
+		desc string
+		msg  *RisMessageData
+		want []interface{}
+	}{{
+		desc: "Success - sequence",
+		msg:  &RisMessageData{DigestedPath: []int32{1, 2, 3}},
+		want: []interface{}{float64(1), float64(2), float64(3)},
+	}, {
+		desc: "Success - sets inside and at the end",
+		msg: &RisMessageData{
+			DigestedPath: []int32{1, 2, 3, 4, int32(-94967295)},
+			PathSets:     []PathSet{{1, 3}, {4, 5}},
+		},
+		want: []interface{}{
+			float64(1),
+			[]interface{}{float64(2), float64(3)},
+			float64(4),
+			[]interface{}{float64(4200000001)},
+		},
+	}, {
+		desc: "Success - empty set",
+		msg: &RisMessageData{
+			DigestedPath: []int32{1},
+			PathSets:     []PathSet{{1, 1}},
+		},
+		want: []interface{}{float64(1), []interface{}{}},
+	}, {
+		desc: "Success - Path is returned",
+		msg: &RisMessageData{
+			Path:         []interface{}{float64(1)},
+			DigestedPath: []int32{2},
+		},
+		want: []interface{}{float64(1)},
+	}}
+
+	for _, test := range tests {
+		if diff := cmp.Diff(test.msg.ASPath(), test.want); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
 		}
 	}
 }
@@ -569,6 +634,7 @@ func TestListen(t *testing.T) {
 				Type:         "UPDATE",
 				Path:         []interface{}{float64(2497), float64(6453), float64(18705), float64(26281), []interface{}{float64(13340)}},
 				DigestedPath: []int32{int32(2497), int32(6453), int32(18705), int32(26281), int32(13340)},
+				PathSets:     []PathSet{{4, 5}},
 				Origin:       "incomplete",
 				Announcements: []*RisAnnouncement{
 					&RisAnnouncement{
@@ -605,8 +671,8 @@ func TestListen(t *testing.T) {
 		}
 		got := <-r.Chan
 
-		if !cmp.Equal(got, test.want) {
-			t.Errorf("[%v]: got/want differ(+got/-want):\n%v\n", test.desc, cmp.Diff(got, test.want))
+		if !cmp.Equal(got, test.want, cmpopts.IgnoreUnexported(RisMessage{})) {
+			t.Errorf("[%v]: got/want differ(+got/-want):\n%v\n", test.desc, cmp.Diff(got, test.want, cmpopts.IgnoreUnexported(RisMessage{})))
 		}
 	}
 }
@@ -642,3 +708,65 @@ func TestGet(t *testing.T) {
 		}
 	}
 }
+
+func TestMatch(t *testing.T) {
+	msg := &RisMessageData{
+		Path:          []interface{}{float64(57695), float64(37650)},
+		Announcements: []*RisAnnouncement{{Prefixes: []string{"196.50.70.0/24"}}},
+	}
+	if err := digestPath(msg); err != nil {
+		t.Fatalf("failed to digest path elements: %v", err)
+	}
+
+	tests := []struct {
+		desc   string
+		filter *RisFilter
+		want   bool
+	}{{
+		desc:   "Success - empty filter matches",
+		filter: &RisFilter{},
+		want:   true,
+	}, {
+		desc: "Success - all set parts match",
+		filter: &RisFilter{
+			Prefix:  []string{"196.50.0.0/16"},
+			ASPath:  []int32{57695},
+			Origins: []string{"37650"},
+		},
+		want: true,
+	}, {
+		desc:   "Success - origin ASN does not match",
+		filter: &RisFilter{Prefix: []string{"196.50.0.0/16"}, Origins: []string{"15169"}},
+		want:   false,
+	}, {
+		desc:   "Success - transit AS not in path",
+		filter: &RisFilter{InvalidTransitAS: map[int32]bool{3356: true}},
+		want:   false,
+	}}
+
+	for _, test := range tests {
+		r := &RisLive{Filter: test.filter}
+		if got := r.Match(msg); got != test.want {
+			t.Errorf("[%v]: got(%v)/want(%v) mismatch", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestGetFilter(t *testing.T) {
+	// The filter passed to Get is used in place of RisLive.Filter, which matches nothing.
+	r := &RisLive{
+		File:   proto.String("testdata/1-msg"),
+		Filter: &RisFilter{},
+		Chan:   make(chan RisMessage, 10),
+	}
+	go r.Listen()
+	got := r.Get(&RisFilter{
+		Origins:          []string{"igp"},
+		InvalidTransitAS: map[int32]bool{57695: true},
+		Prefix:           []string{"196.50.70.0/24"},
+	})
+	want := "Message(1): Peer/ASN -> 196.60.9.165/57695 Prefix1: \n"
+	if got != want {
+		t.Errorf("got/want mismatch:\n%v\n", cmp.Diff(got, want))
+	}
+}
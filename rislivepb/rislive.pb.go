@@ -0,0 +1,1405 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: rislive.proto
+
+package rislivepb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type BogonMode int32
+
+const (
+	BogonMode_BOGON_IGNORE  BogonMode = 0
+	BogonMode_BOGON_INCLUDE BogonMode = 1
+	BogonMode_BOGON_EXCLUDE BogonMode = 2
+)
+
+var BogonMode_name = map[int32]string{
+	0: "BOGON_IGNORE",
+	1: "BOGON_INCLUDE",
+	2: "BOGON_EXCLUDE",
+}
+
+var BogonMode_value = map[string]int32{
+	"BOGON_IGNORE":  0,
+	"BOGON_INCLUDE": 1,
+	"BOGON_EXCLUDE": 2,
+}
+
+func (x BogonMode) String() string {
+	return proto.EnumName(BogonMode_name, int32(x))
+}
+
+func (BogonMode) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{0}
+}
+
+type Severity int32
+
+const (
+	Severity_SEVERITY_INFO     Severity = 0
+	Severity_SEVERITY_WARNING  Severity = 1
+	Severity_SEVERITY_CRITICAL Severity = 2
+)
+
+var Severity_name = map[int32]string{
+	0: "SEVERITY_INFO",
+	1: "SEVERITY_WARNING",
+	2: "SEVERITY_CRITICAL",
+}
+
+var Severity_value = map[string]int32{
+	"SEVERITY_INFO":     0,
+	"SEVERITY_WARNING":  1,
+	"SEVERITY_CRITICAL": 2,
+}
+
+func (x Severity) String() string {
+	return proto.EnumName(Severity_name, int32(x))
+}
+
+func (Severity) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{1}
+}
+
+type Announcement struct {
+	NextHop              string   `protobuf:"bytes,1,opt,name=next_hop,json=nextHop,proto3" json:"next_hop,omitempty"`
+	Prefixes             []string `protobuf:"bytes,2,rep,name=prefixes,proto3" json:"prefixes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Announcement) Reset()         { *m = Announcement{} }
+func (m *Announcement) String() string { return proto.CompactTextString(m) }
+func (*Announcement) ProtoMessage()    {}
+func (*Announcement) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{0}
+}
+
+func (m *Announcement) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Announcement.Unmarshal(m, b)
+}
+func (m *Announcement) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Announcement.Marshal(b, m, deterministic)
+}
+func (m *Announcement) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Announcement.Merge(m, src)
+}
+func (m *Announcement) XXX_Size() int {
+	return xxx_messageInfo_Announcement.Size(m)
+}
+func (m *Announcement) XXX_DiscardUnknown() {
+	xxx_messageInfo_Announcement.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Announcement proto.InternalMessageInfo
+
+func (m *Announcement) GetNextHop() string {
+	if m != nil {
+		return m.NextHop
+	}
+	return ""
+}
+
+func (m *Announcement) GetPrefixes() []string {
+	if m != nil {
+		return m.Prefixes
+	}
+	return nil
+}
+
+type Community struct {
+	Asn                  uint32   `protobuf:"varint,1,opt,name=asn,proto3" json:"asn,omitempty"`
+	Value                uint32   `protobuf:"varint,2,opt,name=value,proto3" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Community) Reset()         { *m = Community{} }
+func (m *Community) String() string { return proto.CompactTextString(m) }
+func (*Community) ProtoMessage()    {}
+func (*Community) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{1}
+}
+
+func (m *Community) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Community.Unmarshal(m, b)
+}
+func (m *Community) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Community.Marshal(b, m, deterministic)
+}
+func (m *Community) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Community.Merge(m, src)
+}
+func (m *Community) XXX_Size() int {
+	return xxx_messageInfo_Community.Size(m)
+}
+func (m *Community) XXX_DiscardUnknown() {
+	xxx_messageInfo_Community.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Community proto.InternalMessageInfo
+
+func (m *Community) GetAsn() uint32 {
+	if m != nil {
+		return m.Asn
+	}
+	return 0
+}
+
+func (m *Community) GetValue() uint32 {
+	if m != nil {
+		return m.Value
+	}
+	return 0
+}
+
+// RisMessage is a single ris_message of the stream.
+type RisMessage struct {
+	Timestamp            *timestamp.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Host                 string               `protobuf:"bytes,2,opt,name=host,proto3" json:"host,omitempty"`
+	Peer                 string               `protobuf:"bytes,3,opt,name=peer,proto3" json:"peer,omitempty"`
+	PeerAsn              uint32               `protobuf:"varint,4,opt,name=peer_asn,json=peerAsn,proto3" json:"peer_asn,omitempty"`
+	Id                   string               `protobuf:"bytes,5,opt,name=id,proto3" json:"id,omitempty"`
+	Type                 string               `protobuf:"bytes,6,opt,name=type,proto3" json:"type,omitempty"`
+	Path                 []uint32             `protobuf:"varint,7,rep,packed,name=path,proto3" json:"path,omitempty"`
+	Communities          []*Community         `protobuf:"bytes,8,rep,name=communities,proto3" json:"communities,omitempty"`
+	Origin               string               `protobuf:"bytes,9,opt,name=origin,proto3" json:"origin,omitempty"`
+	Announcements        []*Announcement      `protobuf:"bytes,10,rep,name=announcements,proto3" json:"announcements,omitempty"`
+	Withdrawals          []string             `protobuf:"bytes,11,rep,name=withdrawals,proto3" json:"withdrawals,omitempty"`
+	Raw                  []byte               `protobuf:"bytes,12,opt,name=raw,proto3" json:"raw,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *RisMessage) Reset()         { *m = RisMessage{} }
+func (m *RisMessage) String() string { return proto.CompactTextString(m) }
+func (*RisMessage) ProtoMessage()    {}
+func (*RisMessage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{2}
+}
+
+func (m *RisMessage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RisMessage.Unmarshal(m, b)
+}
+func (m *RisMessage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RisMessage.Marshal(b, m, deterministic)
+}
+func (m *RisMessage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RisMessage.Merge(m, src)
+}
+func (m *RisMessage) XXX_Size() int {
+	return xxx_messageInfo_RisMessage.Size(m)
+}
+func (m *RisMessage) XXX_DiscardUnknown() {
+	xxx_messageInfo_RisMessage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RisMessage proto.InternalMessageInfo
+
+func (m *RisMessage) GetTimestamp() *timestamp.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
+func (m *RisMessage) GetHost() string {
+	if m != nil {
+		return m.Host
+	}
+	return ""
+}
+
+func (m *RisMessage) GetPeer() string {
+	if m != nil {
+		return m.Peer
+	}
+	return ""
+}
+
+func (m *RisMessage) GetPeerAsn() uint32 {
+	if m != nil {
+		return m.PeerAsn
+	}
+	return 0
+}
+
+func (m *RisMessage) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *RisMessage) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *RisMessage) GetPath() []uint32 {
+	if m != nil {
+		return m.Path
+	}
+	return nil
+}
+
+func (m *RisMessage) GetCommunities() []*Community {
+	if m != nil {
+		return m.Communities
+	}
+	return nil
+}
+
+func (m *RisMessage) GetOrigin() string {
+	if m != nil {
+		return m.Origin
+	}
+	return ""
+}
+
+func (m *RisMessage) GetAnnouncements() []*Announcement {
+	if m != nil {
+		return m.Announcements
+	}
+	return nil
+}
+
+func (m *RisMessage) GetWithdrawals() []string {
+	if m != nil {
+		return m.Withdrawals
+	}
+	return nil
+}
+
+func (m *RisMessage) GetRaw() []byte {
+	if m != nil {
+		return m.Raw
+	}
+	return nil
+}
+
+// Filter selects messages, as the RisFilter of rislive: every field set must match.
+type Filter struct {
+	AsPath               []uint32  `protobuf:"varint,1,rep,packed,name=as_path,json=asPath,proto3" json:"as_path,omitempty"`
+	InvalidTransitAs     []uint32  `protobuf:"varint,2,rep,packed,name=invalid_transit_as,json=invalidTransitAs,proto3" json:"invalid_transit_as,omitempty"`
+	Origins              []uint32  `protobuf:"varint,3,rep,packed,name=origins,proto3" json:"origins,omitempty"`
+	Prefixes             []string  `protobuf:"bytes,4,rep,name=prefixes,proto3" json:"prefixes,omitempty"`
+	Bogons               BogonMode `protobuf:"varint,5,opt,name=bogons,proto3,enum=rislive.BogonMode" json:"bogons,omitempty"`
+	IncludeRaw           bool      `protobuf:"varint,6,opt,name=include_raw,json=includeRaw,proto3" json:"include_raw,omitempty"`
+	Buffer               uint32    `protobuf:"varint,7,opt,name=buffer,proto3" json:"buffer,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *Filter) Reset()         { *m = Filter{} }
+func (m *Filter) String() string { return proto.CompactTextString(m) }
+func (*Filter) ProtoMessage()    {}
+func (*Filter) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{3}
+}
+
+func (m *Filter) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Filter.Unmarshal(m, b)
+}
+func (m *Filter) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Filter.Marshal(b, m, deterministic)
+}
+func (m *Filter) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Filter.Merge(m, src)
+}
+func (m *Filter) XXX_Size() int {
+	return xxx_messageInfo_Filter.Size(m)
+}
+func (m *Filter) XXX_DiscardUnknown() {
+	xxx_messageInfo_Filter.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Filter proto.InternalMessageInfo
+
+func (m *Filter) GetAsPath() []uint32 {
+	if m != nil {
+		return m.AsPath
+	}
+	return nil
+}
+
+func (m *Filter) GetInvalidTransitAs() []uint32 {
+	if m != nil {
+		return m.InvalidTransitAs
+	}
+	return nil
+}
+
+func (m *Filter) GetOrigins() []uint32 {
+	if m != nil {
+		return m.Origins
+	}
+	return nil
+}
+
+func (m *Filter) GetPrefixes() []string {
+	if m != nil {
+		return m.Prefixes
+	}
+	return nil
+}
+
+func (m *Filter) GetBogons() BogonMode {
+	if m != nil {
+		return m.Bogons
+	}
+	return BogonMode_BOGON_IGNORE
+}
+
+func (m *Filter) GetIncludeRaw() bool {
+	if m != nil {
+		return m.IncludeRaw
+	}
+	return false
+}
+
+func (m *Filter) GetBuffer() uint32 {
+	if m != nil {
+		return m.Buffer
+	}
+	return 0
+}
+
+// Alert is a single event reported by a detector.
+type Alert struct {
+	Kind                 string               `protobuf:"bytes,1,opt,name=kind,proto3" json:"kind,omitempty"`
+	Detector             string               `protobuf:"bytes,2,opt,name=detector,proto3" json:"detector,omitempty"`
+	Severity             Severity             `protobuf:"varint,3,opt,name=severity,proto3,enum=rislive.Severity" json:"severity,omitempty"`
+	Prefix               string               `protobuf:"bytes,4,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Origin               uint32               `protobuf:"varint,5,opt,name=origin,proto3" json:"origin,omitempty"`
+	Asn                  uint32               `protobuf:"varint,6,opt,name=asn,proto3" json:"asn,omitempty"`
+	Path                 []uint32             `protobuf:"varint,7,rep,packed,name=path,proto3" json:"path,omitempty"`
+	Collector            string               `protobuf:"bytes,8,opt,name=collector,proto3" json:"collector,omitempty"`
+	Peer                 string               `protobuf:"bytes,9,opt,name=peer,proto3" json:"peer,omitempty"`
+	FirstSeen            *timestamp.Timestamp `protobuf:"bytes,10,opt,name=first_seen,json=firstSeen,proto3" json:"first_seen,omitempty"`
+	LastSeen             *timestamp.Timestamp `protobuf:"bytes,11,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	Count                int64                `protobuf:"varint,12,opt,name=count,proto3" json:"count,omitempty"`
+	Message              string               `protobuf:"bytes,13,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Alert) Reset()         { *m = Alert{} }
+func (m *Alert) String() string { return proto.CompactTextString(m) }
+func (*Alert) ProtoMessage()    {}
+func (*Alert) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{4}
+}
+
+func (m *Alert) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Alert.Unmarshal(m, b)
+}
+func (m *Alert) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Alert.Marshal(b, m, deterministic)
+}
+func (m *Alert) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Alert.Merge(m, src)
+}
+func (m *Alert) XXX_Size() int {
+	return xxx_messageInfo_Alert.Size(m)
+}
+func (m *Alert) XXX_DiscardUnknown() {
+	xxx_messageInfo_Alert.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Alert proto.InternalMessageInfo
+
+func (m *Alert) GetKind() string {
+	if m != nil {
+		return m.Kind
+	}
+	return ""
+}
+
+func (m *Alert) GetDetector() string {
+	if m != nil {
+		return m.Detector
+	}
+	return ""
+}
+
+func (m *Alert) GetSeverity() Severity {
+	if m != nil {
+		return m.Severity
+	}
+	return Severity_SEVERITY_INFO
+}
+
+func (m *Alert) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *Alert) GetOrigin() uint32 {
+	if m != nil {
+		return m.Origin
+	}
+	return 0
+}
+
+func (m *Alert) GetAsn() uint32 {
+	if m != nil {
+		return m.Asn
+	}
+	return 0
+}
+
+func (m *Alert) GetPath() []uint32 {
+	if m != nil {
+		return m.Path
+	}
+	return nil
+}
+
+func (m *Alert) GetCollector() string {
+	if m != nil {
+		return m.Collector
+	}
+	return ""
+}
+
+func (m *Alert) GetPeer() string {
+	if m != nil {
+		return m.Peer
+	}
+	return ""
+}
+
+func (m *Alert) GetFirstSeen() *timestamp.Timestamp {
+	if m != nil {
+		return m.FirstSeen
+	}
+	return nil
+}
+
+func (m *Alert) GetLastSeen() *timestamp.Timestamp {
+	if m != nil {
+		return m.LastSeen
+	}
+	return nil
+}
+
+func (m *Alert) GetCount() int64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *Alert) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+// AlertFilter selects alerts: every field set must match.
+type AlertFilter struct {
+	Detectors            []string `protobuf:"bytes,1,rep,name=detectors,proto3" json:"detectors,omitempty"`
+	MinSeverity          Severity `protobuf:"varint,2,opt,name=min_severity,json=minSeverity,proto3,enum=rislive.Severity" json:"min_severity,omitempty"`
+	Prefixes             []string `protobuf:"bytes,3,rep,name=prefixes,proto3" json:"prefixes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AlertFilter) Reset()         { *m = AlertFilter{} }
+func (m *AlertFilter) String() string { return proto.CompactTextString(m) }
+func (*AlertFilter) ProtoMessage()    {}
+func (*AlertFilter) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{5}
+}
+
+func (m *AlertFilter) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AlertFilter.Unmarshal(m, b)
+}
+func (m *AlertFilter) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AlertFilter.Marshal(b, m, deterministic)
+}
+func (m *AlertFilter) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AlertFilter.Merge(m, src)
+}
+func (m *AlertFilter) XXX_Size() int {
+	return xxx_messageInfo_AlertFilter.Size(m)
+}
+func (m *AlertFilter) XXX_DiscardUnknown() {
+	xxx_messageInfo_AlertFilter.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AlertFilter proto.InternalMessageInfo
+
+func (m *AlertFilter) GetDetectors() []string {
+	if m != nil {
+		return m.Detectors
+	}
+	return nil
+}
+
+func (m *AlertFilter) GetMinSeverity() Severity {
+	if m != nil {
+		return m.MinSeverity
+	}
+	return Severity_SEVERITY_INFO
+}
+
+func (m *AlertFilter) GetPrefixes() []string {
+	if m != nil {
+		return m.Prefixes
+	}
+	return nil
+}
+
+type PrefixRequest struct {
+	Prefix               string   `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PrefixRequest) Reset()         { *m = PrefixRequest{} }
+func (m *PrefixRequest) String() string { return proto.CompactTextString(m) }
+func (*PrefixRequest) ProtoMessage()    {}
+func (*PrefixRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{6}
+}
+
+func (m *PrefixRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PrefixRequest.Unmarshal(m, b)
+}
+func (m *PrefixRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PrefixRequest.Marshal(b, m, deterministic)
+}
+func (m *PrefixRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PrefixRequest.Merge(m, src)
+}
+func (m *PrefixRequest) XXX_Size() int {
+	return xxx_messageInfo_PrefixRequest.Size(m)
+}
+func (m *PrefixRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PrefixRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PrefixRequest proto.InternalMessageInfo
+
+func (m *PrefixRequest) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+// OriginState is an origin ASN seen announcing a prefix.
+type OriginState struct {
+	Origin               uint32               `protobuf:"varint,1,opt,name=origin,proto3" json:"origin,omitempty"`
+	FirstSeen            *timestamp.Timestamp `protobuf:"bytes,2,opt,name=first_seen,json=firstSeen,proto3" json:"first_seen,omitempty"`
+	LastSeen             *timestamp.Timestamp `protobuf:"bytes,3,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	Collectors           []string             `protobuf:"bytes,4,rep,name=collectors,proto3" json:"collectors,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *OriginState) Reset()         { *m = OriginState{} }
+func (m *OriginState) String() string { return proto.CompactTextString(m) }
+func (*OriginState) ProtoMessage()    {}
+func (*OriginState) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{7}
+}
+
+func (m *OriginState) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_OriginState.Unmarshal(m, b)
+}
+func (m *OriginState) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_OriginState.Marshal(b, m, deterministic)
+}
+func (m *OriginState) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_OriginState.Merge(m, src)
+}
+func (m *OriginState) XXX_Size() int {
+	return xxx_messageInfo_OriginState.Size(m)
+}
+func (m *OriginState) XXX_DiscardUnknown() {
+	xxx_messageInfo_OriginState.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_OriginState proto.InternalMessageInfo
+
+func (m *OriginState) GetOrigin() uint32 {
+	if m != nil {
+		return m.Origin
+	}
+	return 0
+}
+
+func (m *OriginState) GetFirstSeen() *timestamp.Timestamp {
+	if m != nil {
+		return m.FirstSeen
+	}
+	return nil
+}
+
+func (m *OriginState) GetLastSeen() *timestamp.Timestamp {
+	if m != nil {
+		return m.LastSeen
+	}
+	return nil
+}
+
+func (m *OriginState) GetCollectors() []string {
+	if m != nil {
+		return m.Collectors
+	}
+	return nil
+}
+
+type Peer struct {
+	Collector            string   `protobuf:"bytes,1,opt,name=collector,proto3" json:"collector,omitempty"`
+	Address              string   `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Peer) Reset()         { *m = Peer{} }
+func (m *Peer) String() string { return proto.CompactTextString(m) }
+func (*Peer) ProtoMessage()    {}
+func (*Peer) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{8}
+}
+
+func (m *Peer) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Peer.Unmarshal(m, b)
+}
+func (m *Peer) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Peer.Marshal(b, m, deterministic)
+}
+func (m *Peer) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Peer.Merge(m, src)
+}
+func (m *Peer) XXX_Size() int {
+	return xxx_messageInfo_Peer.Size(m)
+}
+func (m *Peer) XXX_DiscardUnknown() {
+	xxx_messageInfo_Peer.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Peer proto.InternalMessageInfo
+
+func (m *Peer) GetCollector() string {
+	if m != nil {
+		return m.Collector
+	}
+	return ""
+}
+
+func (m *Peer) GetAddress() string {
+	if m != nil {
+		return m.Address
+	}
+	return ""
+}
+
+// PrefixState is the routing state of a prefix. Visibility is only tracked for
+// the watched prefixes.
+type PrefixState struct {
+	Prefix               string         `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Origins              []*OriginState `protobuf:"bytes,2,rep,name=origins,proto3" json:"origins,omitempty"`
+	Visibility           float64        `protobuf:"fixed64,3,opt,name=visibility,proto3" json:"visibility,omitempty"`
+	SeenPeers            int32          `protobuf:"varint,4,opt,name=seen_peers,json=seenPeers,proto3" json:"seen_peers,omitempty"`
+	TotalPeers           int32          `protobuf:"varint,5,opt,name=total_peers,json=totalPeers,proto3" json:"total_peers,omitempty"`
+	Peers                []*Peer        `protobuf:"bytes,6,rep,name=peers,proto3" json:"peers,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *PrefixState) Reset()         { *m = PrefixState{} }
+func (m *PrefixState) String() string { return proto.CompactTextString(m) }
+func (*PrefixState) ProtoMessage()    {}
+func (*PrefixState) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{9}
+}
+
+func (m *PrefixState) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PrefixState.Unmarshal(m, b)
+}
+func (m *PrefixState) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PrefixState.Marshal(b, m, deterministic)
+}
+func (m *PrefixState) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PrefixState.Merge(m, src)
+}
+func (m *PrefixState) XXX_Size() int {
+	return xxx_messageInfo_PrefixState.Size(m)
+}
+func (m *PrefixState) XXX_DiscardUnknown() {
+	xxx_messageInfo_PrefixState.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PrefixState proto.InternalMessageInfo
+
+func (m *PrefixState) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *PrefixState) GetOrigins() []*OriginState {
+	if m != nil {
+		return m.Origins
+	}
+	return nil
+}
+
+func (m *PrefixState) GetVisibility() float64 {
+	if m != nil {
+		return m.Visibility
+	}
+	return 0
+}
+
+func (m *PrefixState) GetSeenPeers() int32 {
+	if m != nil {
+		return m.SeenPeers
+	}
+	return 0
+}
+
+func (m *PrefixState) GetTotalPeers() int32 {
+	if m != nil {
+		return m.TotalPeers
+	}
+	return 0
+}
+
+func (m *PrefixState) GetPeers() []*Peer {
+	if m != nil {
+		return m.Peers
+	}
+	return nil
+}
+
+type OriginRequest struct {
+	Asn                  uint32   `protobuf:"varint,1,opt,name=asn,proto3" json:"asn,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *OriginRequest) Reset()         { *m = OriginRequest{} }
+func (m *OriginRequest) String() string { return proto.CompactTextString(m) }
+func (*OriginRequest) ProtoMessage()    {}
+func (*OriginRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{10}
+}
+
+func (m *OriginRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_OriginRequest.Unmarshal(m, b)
+}
+func (m *OriginRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_OriginRequest.Marshal(b, m, deterministic)
+}
+func (m *OriginRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_OriginRequest.Merge(m, src)
+}
+func (m *OriginRequest) XXX_Size() int {
+	return xxx_messageInfo_OriginRequest.Size(m)
+}
+func (m *OriginRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_OriginRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_OriginRequest proto.InternalMessageInfo
+
+func (m *OriginRequest) GetAsn() uint32 {
+	if m != nil {
+		return m.Asn
+	}
+	return 0
+}
+
+type OriginPrefixes struct {
+	Asn                  uint32   `protobuf:"varint,1,opt,name=asn,proto3" json:"asn,omitempty"`
+	Prefixes             []string `protobuf:"bytes,2,rep,name=prefixes,proto3" json:"prefixes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *OriginPrefixes) Reset()         { *m = OriginPrefixes{} }
+func (m *OriginPrefixes) String() string { return proto.CompactTextString(m) }
+func (*OriginPrefixes) ProtoMessage()    {}
+func (*OriginPrefixes) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{11}
+}
+
+func (m *OriginPrefixes) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_OriginPrefixes.Unmarshal(m, b)
+}
+func (m *OriginPrefixes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_OriginPrefixes.Marshal(b, m, deterministic)
+}
+func (m *OriginPrefixes) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_OriginPrefixes.Merge(m, src)
+}
+func (m *OriginPrefixes) XXX_Size() int {
+	return xxx_messageInfo_OriginPrefixes.Size(m)
+}
+func (m *OriginPrefixes) XXX_DiscardUnknown() {
+	xxx_messageInfo_OriginPrefixes.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_OriginPrefixes proto.InternalMessageInfo
+
+func (m *OriginPrefixes) GetAsn() uint32 {
+	if m != nil {
+		return m.Asn
+	}
+	return 0
+}
+
+func (m *OriginPrefixes) GetPrefixes() []string {
+	if m != nil {
+		return m.Prefixes
+	}
+	return nil
+}
+
+type ConflictsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ConflictsRequest) Reset()         { *m = ConflictsRequest{} }
+func (m *ConflictsRequest) String() string { return proto.CompactTextString(m) }
+func (*ConflictsRequest) ProtoMessage()    {}
+func (*ConflictsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{12}
+}
+
+func (m *ConflictsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ConflictsRequest.Unmarshal(m, b)
+}
+func (m *ConflictsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ConflictsRequest.Marshal(b, m, deterministic)
+}
+func (m *ConflictsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ConflictsRequest.Merge(m, src)
+}
+func (m *ConflictsRequest) XXX_Size() int {
+	return xxx_messageInfo_ConflictsRequest.Size(m)
+}
+func (m *ConflictsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ConflictsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ConflictsRequest proto.InternalMessageInfo
+
+type Conflict struct {
+	Prefix               string   `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Origins              []uint32 `protobuf:"varint,2,rep,packed,name=origins,proto3" json:"origins,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Conflict) Reset()         { *m = Conflict{} }
+func (m *Conflict) String() string { return proto.CompactTextString(m) }
+func (*Conflict) ProtoMessage()    {}
+func (*Conflict) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{13}
+}
+
+func (m *Conflict) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Conflict.Unmarshal(m, b)
+}
+func (m *Conflict) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Conflict.Marshal(b, m, deterministic)
+}
+func (m *Conflict) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Conflict.Merge(m, src)
+}
+func (m *Conflict) XXX_Size() int {
+	return xxx_messageInfo_Conflict.Size(m)
+}
+func (m *Conflict) XXX_DiscardUnknown() {
+	xxx_messageInfo_Conflict.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Conflict proto.InternalMessageInfo
+
+func (m *Conflict) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *Conflict) GetOrigins() []uint32 {
+	if m != nil {
+		return m.Origins
+	}
+	return nil
+}
+
+type Conflicts struct {
+	Conflicts            []*Conflict `protobuf:"bytes,1,rep,name=conflicts,proto3" json:"conflicts,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *Conflicts) Reset()         { *m = Conflicts{} }
+func (m *Conflicts) String() string { return proto.CompactTextString(m) }
+func (*Conflicts) ProtoMessage()    {}
+func (*Conflicts) Descriptor() ([]byte, []int) {
+	return fileDescriptor_c37470b9f6b43115, []int{14}
+}
+
+func (m *Conflicts) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Conflicts.Unmarshal(m, b)
+}
+func (m *Conflicts) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Conflicts.Marshal(b, m, deterministic)
+}
+func (m *Conflicts) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Conflicts.Merge(m, src)
+}
+func (m *Conflicts) XXX_Size() int {
+	return xxx_messageInfo_Conflicts.Size(m)
+}
+func (m *Conflicts) XXX_DiscardUnknown() {
+	xxx_messageInfo_Conflicts.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Conflicts proto.InternalMessageInfo
+
+func (m *Conflicts) GetConflicts() []*Conflict {
+	if m != nil {
+		return m.Conflicts
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("rislive.BogonMode", BogonMode_name, BogonMode_value)
+	proto.RegisterEnum("rislive.Severity", Severity_name, Severity_value)
+	proto.RegisterType((*Announcement)(nil), "rislive.Announcement")
+	proto.RegisterType((*Community)(nil), "rislive.Community")
+	proto.RegisterType((*RisMessage)(nil), "rislive.RisMessage")
+	proto.RegisterType((*Filter)(nil), "rislive.Filter")
+	proto.RegisterType((*Alert)(nil), "rislive.Alert")
+	proto.RegisterType((*AlertFilter)(nil), "rislive.AlertFilter")
+	proto.RegisterType((*PrefixRequest)(nil), "rislive.PrefixRequest")
+	proto.RegisterType((*OriginState)(nil), "rislive.OriginState")
+	proto.RegisterType((*Peer)(nil), "rislive.Peer")
+	proto.RegisterType((*PrefixState)(nil), "rislive.PrefixState")
+	proto.RegisterType((*OriginRequest)(nil), "rislive.OriginRequest")
+	proto.RegisterType((*OriginPrefixes)(nil), "rislive.OriginPrefixes")
+	proto.RegisterType((*ConflictsRequest)(nil), "rislive.ConflictsRequest")
+	proto.RegisterType((*Conflict)(nil), "rislive.Conflict")
+	proto.RegisterType((*Conflicts)(nil), "rislive.Conflicts")
+}
+
+func init() { proto.RegisterFile("rislive.proto", fileDescriptor_c37470b9f6b43115) }
+
+var fileDescriptor_c37470b9f6b43115 = []byte{
+	// 1112 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x56, 0xdb, 0x6e, 0xdb, 0x46,
+	0x10, 0x0d, 0x25, 0xeb, 0xc2, 0xa1, 0xe8, 0xca, 0x5b, 0x27, 0x61, 0x84, 0x34, 0x51, 0xd9, 0x87,
+	0x1a, 0x41, 0x2b, 0x07, 0x76, 0xd0, 0x36, 0x68, 0x1a, 0x40, 0x56, 0x14, 0x55, 0x85, 0x23, 0x1b,
+	0x2b, 0xf7, 0xfa, 0x42, 0x50, 0xd2, 0xca, 0x5e, 0x94, 0x22, 0x55, 0xee, 0x4a, 0x8e, 0x1f, 0x0a,
+	0xf4, 0x1b, 0xfa, 0x31, 0x05, 0xfa, 0x2b, 0xfd, 0x84, 0x7e, 0x45, 0xb1, 0x17, 0x2e, 0x29, 0x3b,
+	0x69, 0xd0, 0x3e, 0x79, 0xe7, 0xec, 0xcc, 0x7a, 0x66, 0xce, 0x99, 0xa1, 0xc0, 0x4d, 0x29, 0x8b,
+	0xe8, 0x9a, 0x74, 0x96, 0x69, 0xc2, 0x13, 0x54, 0xd3, 0x66, 0xeb, 0xe1, 0x79, 0x92, 0x9c, 0x47,
+	0x64, 0x5f, 0xc2, 0x93, 0xd5, 0x7c, 0x9f, 0xd3, 0x05, 0x61, 0x3c, 0x5c, 0x2c, 0x95, 0xa7, 0xdf,
+	0x87, 0x46, 0x37, 0x8e, 0x93, 0x55, 0x3c, 0x25, 0x0b, 0x12, 0x73, 0x74, 0x0f, 0xea, 0x31, 0x79,
+	0xcd, 0x83, 0x8b, 0x64, 0xe9, 0x59, 0x6d, 0x6b, 0xcf, 0xc6, 0x35, 0x61, 0x7f, 0x9d, 0x2c, 0x51,
+	0x0b, 0xea, 0xcb, 0x94, 0xcc, 0xe9, 0x6b, 0xc2, 0xbc, 0x52, 0xbb, 0xbc, 0x67, 0x63, 0x63, 0xfb,
+	0x87, 0x60, 0xf7, 0x92, 0xc5, 0x62, 0x15, 0x53, 0x7e, 0x85, 0x9a, 0x50, 0x0e, 0x59, 0x2c, 0xc3,
+	0x5d, 0x2c, 0x8e, 0x68, 0x17, 0x2a, 0xeb, 0x30, 0x5a, 0x11, 0xaf, 0x24, 0x31, 0x65, 0xf8, 0xbf,
+	0x95, 0x01, 0x30, 0x65, 0xaf, 0x08, 0x63, 0xe1, 0x39, 0x41, 0x5f, 0x80, 0x6d, 0xb2, 0x93, 0xc1,
+	0xce, 0x41, 0xab, 0xa3, 0xf2, 0xef, 0x64, 0xf9, 0x77, 0xce, 0x32, 0x0f, 0x9c, 0x3b, 0x23, 0x04,
+	0x5b, 0x17, 0x09, 0xe3, 0xf2, 0x75, 0x1b, 0xcb, 0xb3, 0xc0, 0x96, 0x84, 0xa4, 0x5e, 0x59, 0x61,
+	0xe2, 0x2c, 0x8a, 0x13, 0x7f, 0x03, 0x91, 0xdd, 0x96, 0xcc, 0xa4, 0x26, 0xec, 0x2e, 0x8b, 0xd1,
+	0x36, 0x94, 0xe8, 0xcc, 0xab, 0x48, 0xe7, 0x12, 0x9d, 0x89, 0x70, 0x7e, 0xb5, 0x24, 0x5e, 0x55,
+	0x85, 0x8b, 0xb3, 0x7c, 0x32, 0xe4, 0x17, 0x5e, 0xad, 0x5d, 0xde, 0x73, 0xb1, 0x3c, 0xa3, 0x27,
+	0xe0, 0x4c, 0x75, 0xe1, 0x94, 0x30, 0xaf, 0xde, 0x2e, 0xef, 0x39, 0x07, 0xa8, 0x93, 0xd1, 0x61,
+	0x9a, 0x82, 0x8b, 0x6e, 0xe8, 0x0e, 0x54, 0x93, 0x94, 0x9e, 0xd3, 0xd8, 0xb3, 0xe5, 0xfb, 0xda,
+	0x42, 0x5f, 0x82, 0x1b, 0x16, 0xd8, 0x60, 0x1e, 0xc8, 0xf7, 0x6e, 0x9b, 0xf7, 0x8a, 0x5c, 0xe1,
+	0x4d, 0x5f, 0xd4, 0x06, 0xe7, 0x92, 0xf2, 0x8b, 0x59, 0x1a, 0x5e, 0x86, 0x11, 0xf3, 0x1c, 0x49,
+	0x51, 0x11, 0x12, 0xc4, 0xa4, 0xe1, 0xa5, 0xd7, 0x68, 0x5b, 0x7b, 0x0d, 0x2c, 0x8e, 0xfe, 0xdf,
+	0x16, 0x54, 0x5f, 0xd2, 0x88, 0x93, 0x14, 0xdd, 0x85, 0x5a, 0xc8, 0x02, 0x59, 0xa0, 0x25, 0x0b,
+	0xac, 0x86, 0xec, 0x54, 0x94, 0xf8, 0x09, 0x20, 0x1a, 0xaf, 0xc3, 0x88, 0xce, 0x02, 0x9e, 0x86,
+	0x31, 0xa3, 0x3c, 0x08, 0x95, 0x02, 0x5c, 0xdc, 0xd4, 0x37, 0x67, 0xea, 0xa2, 0xcb, 0x90, 0x07,
+	0x35, 0x55, 0x0c, 0xf3, 0xca, 0xd2, 0x25, 0x33, 0x37, 0xf4, 0xb3, 0xb5, 0xa9, 0x1f, 0xf4, 0x08,
+	0xaa, 0x93, 0xe4, 0x3c, 0x89, 0x99, 0xa4, 0x60, 0xbb, 0xd0, 0xc1, 0x23, 0x01, 0xbf, 0x4a, 0x66,
+	0x04, 0x6b, 0x0f, 0xf4, 0x10, 0x1c, 0x1a, 0x4f, 0xa3, 0xd5, 0x8c, 0x04, 0xa2, 0x1a, 0xc1, 0x50,
+	0x1d, 0x83, 0x86, 0x70, 0x78, 0x29, 0xba, 0x3b, 0x59, 0xcd, 0xe7, 0x24, 0xf5, 0x6a, 0x92, 0x64,
+	0x6d, 0xf9, 0xbf, 0x97, 0xa1, 0xd2, 0x8d, 0x48, 0x2a, 0xc5, 0xf1, 0x33, 0x8d, 0x67, 0x5a, 0xe1,
+	0xf2, 0x2c, 0xd2, 0x9b, 0x11, 0x4e, 0xa6, 0x3c, 0x49, 0xb5, 0x90, 0x8c, 0x8d, 0x3e, 0x85, 0x3a,
+	0x23, 0x6b, 0x92, 0x52, 0x7e, 0x25, 0x05, 0xb5, 0x7d, 0xb0, 0x63, 0x12, 0x1c, 0xeb, 0x0b, 0x6c,
+	0x5c, 0x44, 0x02, 0xaa, 0x32, 0xa9, 0x32, 0x1b, 0x6b, 0xab, 0x40, 0x7b, 0x45, 0x25, 0xa6, 0xac,
+	0x6c, 0x60, 0xaa, 0xf9, 0xc0, 0xbc, 0x49, 0x6a, 0xf7, 0xc1, 0x9e, 0x26, 0x51, 0xa4, 0x32, 0xac,
+	0xcb, 0x87, 0x73, 0xc0, 0xe8, 0xdd, 0x2e, 0xe8, 0xfd, 0x29, 0xc0, 0x9c, 0xa6, 0x8c, 0x07, 0x8c,
+	0x90, 0xd8, 0x83, 0x77, 0x8f, 0x94, 0xf4, 0x1e, 0x13, 0x12, 0xa3, 0xcf, 0xc1, 0x8e, 0xc2, 0x2c,
+	0xd2, 0x79, 0x67, 0x64, 0x3d, 0x0a, 0x75, 0xe0, 0x2e, 0x54, 0xa6, 0xc9, 0x2a, 0xe6, 0x52, 0x65,
+	0x65, 0xac, 0x0c, 0xa1, 0x8a, 0x85, 0x1a, 0x73, 0xcf, 0x55, 0x5b, 0x45, 0x9b, 0xfe, 0xaf, 0xe0,
+	0x48, 0x4e, 0xb4, 0x0a, 0xef, 0x83, 0x9d, 0x75, 0x9d, 0x49, 0x1d, 0xda, 0x38, 0x07, 0xd0, 0x13,
+	0x68, 0x2c, 0x68, 0x1c, 0x18, 0x2e, 0x4a, 0x6f, 0xe3, 0xc2, 0x59, 0xd0, 0x38, 0x33, 0x36, 0x84,
+	0x57, 0xbe, 0xb6, 0xb8, 0x3e, 0x06, 0xf7, 0x54, 0x9e, 0x31, 0xf9, 0x65, 0x45, 0x18, 0x2f, 0x70,
+	0x67, 0x15, 0xb9, 0xf3, 0xff, 0xb4, 0xc0, 0x39, 0x91, 0x74, 0x8d, 0x79, 0xc8, 0x49, 0x81, 0x4b,
+	0x6b, 0x83, 0xcb, 0xcd, 0x9e, 0x97, 0xfe, 0x77, 0xcf, 0xcb, 0xff, 0xa1, 0xe7, 0x0f, 0x00, 0x8c,
+	0x10, 0xb2, 0xd9, 0x2a, 0x20, 0xfe, 0x73, 0xd8, 0x3a, 0x25, 0xaa, 0xb9, 0x06, 0xd5, 0xe5, 0xe5,
+	0x80, 0xe0, 0x28, 0x9c, 0xcd, 0x52, 0xc2, 0x98, 0xd6, 0x7f, 0x66, 0xfa, 0x7f, 0x59, 0xe0, 0xa8,
+	0x2e, 0x99, 0xda, 0xdf, 0xd4, 0x23, 0xd4, 0xc9, 0x67, 0xbf, 0x24, 0x17, 0xd7, 0xae, 0x61, 0xa6,
+	0xd0, 0xba, 0x7c, 0x23, 0x3c, 0x00, 0x58, 0x53, 0x46, 0x27, 0x34, 0xca, 0x06, 0xcb, 0xc2, 0x05,
+	0x04, 0x7d, 0x00, 0x20, 0x7a, 0x11, 0x08, 0x31, 0x33, 0x39, 0x4b, 0x15, 0x6c, 0x0b, 0x44, 0x54,
+	0x23, 0x17, 0x01, 0x4f, 0x78, 0x18, 0xe9, 0xfb, 0x8a, 0xbc, 0x07, 0x09, 0x29, 0x87, 0x8f, 0xa0,
+	0xa2, 0xae, 0xaa, 0x32, 0x1b, 0xd7, 0x64, 0x23, 0xae, 0xb1, 0xba, 0xf3, 0x3f, 0x04, 0x57, 0x25,
+	0x97, 0x29, 0xe0, 0xc6, 0xe7, 0xcb, 0x7f, 0x0e, 0xdb, 0xca, 0xe5, 0x34, 0xdb, 0x57, 0x37, 0x7c,
+	0xfe, 0xf5, 0xeb, 0x88, 0xa0, 0xd9, 0x4b, 0xe2, 0x79, 0x44, 0xa7, 0x9c, 0xe9, 0xff, 0xe2, 0x3f,
+	0x83, 0x7a, 0x86, 0xbd, 0xb5, 0x9f, 0xde, 0x66, 0x3f, 0xf3, 0x5d, 0xea, 0x3f, 0x03, 0x3b, 0x8b,
+	0x66, 0x68, 0x5f, 0xd0, 0xaa, 0x0d, 0x39, 0x33, 0x4e, 0x61, 0x24, 0x32, 0x37, 0x9c, 0xfb, 0x3c,
+	0xea, 0x81, 0x6d, 0xd6, 0x2a, 0x6a, 0x42, 0xe3, 0xe8, 0x64, 0x70, 0x32, 0x0a, 0x86, 0x83, 0xd1,
+	0x09, 0xee, 0x37, 0x6f, 0xa1, 0x1d, 0x70, 0x35, 0x32, 0xea, 0x1d, 0x7f, 0xfb, 0xa2, 0xdf, 0xb4,
+	0x72, 0xa8, 0xff, 0x83, 0x82, 0x4a, 0x8f, 0xbe, 0x81, 0xba, 0x99, 0xb0, 0x1d, 0x70, 0xc7, 0xfd,
+	0xef, 0xfa, 0x78, 0x78, 0xf6, 0x63, 0x30, 0x1c, 0xbd, 0x3c, 0x69, 0xde, 0x42, 0xbb, 0xd0, 0x34,
+	0xd0, 0xf7, 0x5d, 0x3c, 0x1a, 0x8e, 0x06, 0x4d, 0x0b, 0xdd, 0x86, 0x1d, 0x83, 0xf6, 0xf0, 0xf0,
+	0x6c, 0xd8, 0xeb, 0x1e, 0x37, 0x4b, 0x07, 0x7f, 0x94, 0xa0, 0x86, 0x29, 0x3b, 0xa6, 0x6b, 0x82,
+	0x0e, 0xc1, 0x1e, 0xaf, 0x26, 0x6c, 0x9a, 0xd2, 0x09, 0x41, 0xef, 0x99, 0x3a, 0xd4, 0x7e, 0x68,
+	0xbd, 0x6f, 0x80, 0xfc, 0x97, 0xc3, 0x63, 0x0b, 0x7d, 0x06, 0x8d, 0x31, 0x4f, 0x49, 0xb8, 0x90,
+	0xbb, 0x84, 0xa1, 0x5c, 0x78, 0x85, 0xe5, 0xd2, 0xda, 0xde, 0x44, 0x1f, 0x5b, 0xe8, 0x29, 0xd8,
+	0x03, 0xc2, 0x4f, 0xf5, 0x7a, 0xce, 0xf5, 0x51, 0x5c, 0x09, 0xad, 0xdd, 0x6b, 0xb8, 0x1a, 0x82,
+	0x17, 0xb0, 0x33, 0x20, 0xfc, 0x9a, 0x2e, 0xee, 0x5c, 0x13, 0x7c, 0xf6, 0xc4, 0xdd, 0x6b, 0xb8,
+	0x09, 0xf8, 0x0a, 0x1a, 0x03, 0xc2, 0x73, 0x2e, 0xef, 0xdd, 0x20, 0x2e, 0x53, 0x4c, 0x0b, 0xdd,
+	0xbc, 0x3a, 0x72, 0x7e, 0xb2, 0x35, 0xb8, 0x9c, 0x4c, 0xaa, 0x72, 0x49, 0x1c, 0xfe, 0x33, 0x00,
+	0xea, 0x9c, 0xd8, 0x74, 0x0d, 0x0a, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// RisLiveClient is the client API for RisLive service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type RisLiveClient interface {
+	// Subscribe streams the messages matching the filter, until the client
+	// cancels or the upstream ends.
+	Subscribe(ctx context.Context, in *Filter, opts ...grpc.CallOption) (RisLive_SubscribeClient, error)
+	// StreamAlerts streams the alerts of the detectors matching the filter.
+	StreamAlerts(ctx context.Context, in *AlertFilter, opts ...grpc.CallOption) (RisLive_StreamAlertsClient, error)
+	// GetPrefix returns the origins and visibility of a prefix.
+	GetPrefix(ctx context.Context, in *PrefixRequest, opts ...grpc.CallOption) (*PrefixState, error)
+	// GetOriginPrefixes returns the prefixes an ASN currently originates.
+	GetOriginPrefixes(ctx context.Context, in *OriginRequest, opts ...grpc.CallOption) (*OriginPrefixes, error)
+	// GetConflicts returns the prefixes currently originated by more than one ASN.
+	GetConflicts(ctx context.Context, in *ConflictsRequest, opts ...grpc.CallOption) (*Conflicts, error)
+}
+
+type risLiveClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewRisLiveClient(cc *grpc.ClientConn) RisLiveClient {
+	return &risLiveClient{cc}
+}
+
+func (c *risLiveClient) Subscribe(ctx context.Context, in *Filter, opts ...grpc.CallOption) (RisLive_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_RisLive_serviceDesc.Streams[0], "/rislive.RisLive/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &risLiveSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type RisLive_SubscribeClient interface {
+	Recv() (*RisMessage, error)
+	grpc.ClientStream
+}
+
+type risLiveSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *risLiveSubscribeClient) Recv() (*RisMessage, error) {
+	m := new(RisMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *risLiveClient) StreamAlerts(ctx context.Context, in *AlertFilter, opts ...grpc.CallOption) (RisLive_StreamAlertsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_RisLive_serviceDesc.Streams[1], "/rislive.RisLive/StreamAlerts", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &risLiveStreamAlertsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type RisLive_StreamAlertsClient interface {
+	Recv() (*Alert, error)
+	grpc.ClientStream
+}
+
+type risLiveStreamAlertsClient struct {
+	grpc.ClientStream
+}
+
+func (x *risLiveStreamAlertsClient) Recv() (*Alert, error) {
+	m := new(Alert)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *risLiveClient) GetPrefix(ctx context.Context, in *PrefixRequest, opts ...grpc.CallOption) (*PrefixState, error) {
+	out := new(PrefixState)
+	err := c.cc.Invoke(ctx, "/rislive.RisLive/GetPrefix", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *risLiveClient) GetOriginPrefixes(ctx context.Context, in *OriginRequest, opts ...grpc.CallOption) (*OriginPrefixes, error) {
+	out := new(OriginPrefixes)
+	err := c.cc.Invoke(ctx, "/rislive.RisLive/GetOriginPrefixes", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *risLiveClient) GetConflicts(ctx context.Context, in *ConflictsRequest, opts ...grpc.CallOption) (*Conflicts, error) {
+	out := new(Conflicts)
+	err := c.cc.Invoke(ctx, "/rislive.RisLive/GetConflicts", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RisLiveServer is the server API for RisLive service.
+type RisLiveServer interface {
+	// Subscribe streams the messages matching the filter, until the client
+	// cancels or the upstream ends.
+	Subscribe(*Filter, RisLive_SubscribeServer) error
+	// StreamAlerts streams the alerts of the detectors matching the filter.
+	StreamAlerts(*AlertFilter, RisLive_StreamAlertsServer) error
+	// GetPrefix returns the origins and visibility of a prefix.
+	GetPrefix(context.Context, *PrefixRequest) (*PrefixState, error)
+	// GetOriginPrefixes returns the prefixes an ASN currently originates.
+	GetOriginPrefixes(context.Context, *OriginRequest) (*OriginPrefixes, error)
+	// GetConflicts returns the prefixes currently originated by more than one ASN.
+	GetConflicts(context.Context, *ConflictsRequest) (*Conflicts, error)
+}
+
+// UnimplementedRisLiveServer can be embedded to have forward compatible implementations.
+type UnimplementedRisLiveServer struct {
+}
+
+func (*UnimplementedRisLiveServer) Subscribe(req *Filter, srv RisLive_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (*UnimplementedRisLiveServer) StreamAlerts(req *AlertFilter, srv RisLive_StreamAlertsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamAlerts not implemented")
+}
+func (*UnimplementedRisLiveServer) GetPrefix(ctx context.Context, req *PrefixRequest) (*PrefixState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPrefix not implemented")
+}
+func (*UnimplementedRisLiveServer) GetOriginPrefixes(ctx context.Context, req *OriginRequest) (*OriginPrefixes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOriginPrefixes not implemented")
+}
+func (*UnimplementedRisLiveServer) GetConflicts(ctx context.Context, req *ConflictsRequest) (*Conflicts, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetConflicts not implemented")
+}
+
+func RegisterRisLiveServer(s *grpc.Server, srv RisLiveServer) {
+	s.RegisterService(&_RisLive_serviceDesc, srv)
+}
+
+func _RisLive_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Filter)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RisLiveServer).Subscribe(m, &risLiveSubscribeServer{stream})
+}
+
+type RisLive_SubscribeServer interface {
+	Send(*RisMessage) error
+	grpc.ServerStream
+}
+
+type risLiveSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *risLiveSubscribeServer) Send(m *RisMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _RisLive_StreamAlerts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AlertFilter)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RisLiveServer).StreamAlerts(m, &risLiveStreamAlertsServer{stream})
+}
+
+type RisLive_StreamAlertsServer interface {
+	Send(*Alert) error
+	grpc.ServerStream
+}
+
+type risLiveStreamAlertsServer struct {
+	grpc.ServerStream
+}
+
+func (x *risLiveStreamAlertsServer) Send(m *Alert) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _RisLive_GetPrefix_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PrefixRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RisLiveServer).GetPrefix(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rislive.RisLive/GetPrefix",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RisLiveServer).GetPrefix(ctx, req.(*PrefixRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RisLive_GetOriginPrefixes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OriginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RisLiveServer).GetOriginPrefixes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rislive.RisLive/GetOriginPrefixes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RisLiveServer).GetOriginPrefixes(ctx, req.(*OriginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RisLive_GetConflicts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConflictsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RisLiveServer).GetConflicts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rislive.RisLive/GetConflicts",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RisLiveServer).GetConflicts(ctx, req.(*ConflictsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _RisLive_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "rislive.RisLive",
+	HandlerType: (*RisLiveServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPrefix",
+			Handler:    _RisLive_GetPrefix_Handler,
+		},
+		{
+			MethodName: "GetOriginPrefixes",
+			Handler:    _RisLive_GetOriginPrefixes_Handler,
+		},
+		{
+			MethodName: "GetConflicts",
+			Handler:    _RisLive_GetConflicts_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _RisLive_Subscribe_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamAlerts",
+			Handler:       _RisLive_StreamAlerts_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "rislive.proto",
+}
@@ -0,0 +1,151 @@
+// Validate route origins against a table of ROAs (Route Origin Authorizations),
+// as RFC 6811. The table is loaded from the JSON export of a relying party,
+// rpki-client or routinator:
+//
+//	{"roas": [{"asn": "AS13335", "prefix": "1.0.0.0/24", "maxLength": 24}, ...]}
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// RPKIState is the RFC 6811 validation state of a route.
+type RPKIState int
+
+const (
+	RPKINotFound RPKIState = iota // No ROA covers the prefix.
+	RPKIValid                     // A ROA covering the prefix authorizes the origin and length.
+	RPKIInvalid                   // ROAs cover the prefix, none authorize the origin and length.
+)
+
+func (s RPKIState) String() string {
+	switch s {
+	case RPKIValid:
+		return "valid"
+	case RPKIInvalid:
+		return "invalid"
+	}
+	return "not-found"
+}
+
+// MarshalText encodes the state by its name.
+func (s RPKIState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ROA is a single Route Origin Authorization.
+type ROA struct {
+	Prefix    *net.IPNet
+	MaxLength int
+	ASN       int32
+}
+
+// ROATable holds ROAs, indexed by their prefix.
+type ROATable struct {
+	v4, v6 *Tree
+	roas   map[string][]*ROA // prefix -> ROAs.
+}
+
+// NewROATable creates a new, empty, ROATable.
+func NewROATable() *ROATable {
+	v4, _ := New("0.0.0.0/0")
+	v6, _ := New("::/0")
+	return &ROATable{v4: v4, v6: v6, roas: map[string][]*ROA{}}
+}
+
+func (t *ROATable) tree(n *net.IPNet) *Tree {
+	if n.IP.To4() != nil {
+		return t.v4
+	}
+	return t.v6
+}
+
+// Add adds a ROA to the table.
+func (t *ROATable) Add(r *ROA) {
+	prefix := r.Prefix.String()
+	t.roas[prefix] = append(t.roas[prefix], r)
+	t.tree(r.Prefix).Insert(r.Prefix)
+}
+
+// Len returns the number of ROAs in the table.
+func (t *ROATable) Len() int {
+	var l int
+	for _, roas := range t.roas {
+		l += len(roas)
+	}
+	return l
+}
+
+// Validate returns the validation state of the route to n from origin. A route
+// without a known origin, ie: ending in an AS_SET, is passed as origin 0, which
+// no ROA authorizes.
+func (t *ROATable) Validate(n *net.IPNet, origin int32) RPKIState {
+	ones, _ := n.Mask.Size()
+	state := RPKINotFound
+	for _, c := range t.tree(n).Covering(n) {
+		for _, r := range t.roas[c.String()] {
+			state = RPKIInvalid
+			if origin != 0 && r.ASN == origin && ones <= r.MaxLength {
+				return RPKIValid
+			}
+		}
+	}
+	return state
+}
+
+// roaASN is an ASN in a ROA export, a number or a string with an optional AS prefix.
+type roaASN int32
+
+func (a *roaASN) UnmarshalJSON(b []byte) error {
+	s := strings.TrimPrefix(strings.ToUpper(strings.Trim(string(b), `"`)), "AS")
+	asn, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return fmt.Errorf("failed to parse ASN(%s): %v", b, err)
+	}
+	*a = roaASN(asn)
+	return nil
+}
+
+// ParseROAs parses the JSON export of a relying party to a ROATable.
+func ParseROAs(data []byte) (*ROATable, error) {
+	var export struct {
+		ROAs []struct {
+			ASN       roaASN `json:"asn"`
+			Prefix    string `json:"prefix"`
+			MaxLength int    `json:"maxLength"`
+		} `json:"roas"`
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to parse ROAs: %v", err)
+	}
+	t := NewROATable()
+	for _, r := range export.ROAs {
+		n, err := parsePrefix(r.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		ones, bits := n.Mask.Size()
+		if r.MaxLength == 0 {
+			r.MaxLength = ones
+		}
+		if r.MaxLength < ones || r.MaxLength > bits {
+			return nil, fmt.Errorf("invalid maxLength %v for prefix %v", r.MaxLength, r.Prefix)
+		}
+		t.Add(&ROA{Prefix: n, MaxLength: r.MaxLength, ASN: int32(r.ASN)})
+	}
+	return t, nil
+}
+
+// LoadROAs reads a ROATable from a file, see ParseROAs.
+func LoadROAs(file string) (*ROATable, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ROAs(%v): %v", file, err)
+	}
+	return ParseROAs(data)
+}
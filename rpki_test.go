@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+)
+
+const testROAs = `{"metadata": {"buildtime": "2019-05-23T14:00:00Z"}, "roas": [
+	{"asn": "AS15169", "prefix": "8.8.8.0/24", "maxLength": 24, "ta": "arin"},
+	{"asn": "AS13335", "prefix": "1.0.0.0/22", "maxLength": 24, "ta": "apnic"},
+	{"asn": 0, "prefix": "192.0.2.0/24", "maxLength": 24, "ta": "arin"},
+	{"asn": "AS64496", "prefix": "2001:db8::/32", "maxLength": 48, "ta": "ripe"}
+]}`
+
+func TestROATableValidate(t *testing.T) {
+	roas, err := ParseROAs([]byte(testROAs))
+	if err != nil {
+		t.Fatalf("failed to parse ROAs: %v", err)
+	}
+	if got := roas.Len(); got != 4 {
+		t.Errorf("got %v ROAs, want 4", got)
+	}
+	tests := []struct {
+		desc   string
+		prefix string
+		origin int32
+		want   RPKIState
+	}{{
+		desc:   "Valid - exact",
+		prefix: "8.8.8.0/24",
+		origin: 15169,
+		want:   RPKIValid,
+	}, {
+		desc:   "Valid - within maxLength",
+		prefix: "1.0.1.0/24",
+		origin: 13335,
+		want:   RPKIValid,
+	}, {
+		desc:   "Valid - IPv6",
+		prefix: "2001:db8:1::/48",
+		origin: 64496,
+		want:   RPKIValid,
+	}, {
+		desc:   "Invalid - origin",
+		prefix: "8.8.8.0/24",
+		origin: 64511,
+		want:   RPKIInvalid,
+	}, {
+		desc:   "Invalid - longer than maxLength",
+		prefix: "1.0.0.0/25",
+		origin: 13335,
+		want:   RPKIInvalid,
+	}, {
+		desc:   "Invalid - AS0",
+		prefix: "192.0.2.0/24",
+		origin: 64496,
+		want:   RPKIInvalid,
+	}, {
+		desc:   "Invalid - no origin",
+		prefix: "8.8.8.0/24",
+		want:   RPKIInvalid,
+	}, {
+		desc:   "NotFound - uncovered",
+		prefix: "9.9.9.0/24",
+		origin: 19281,
+		want:   RPKINotFound,
+	}, {
+		desc:   "NotFound - less specific",
+		prefix: "8.8.0.0/16",
+		origin: 15169,
+		want:   RPKINotFound,
+	}}
+	for _, test := range tests {
+		if got := roas.Validate(mustCIDR(t, test.prefix), test.origin); got != test.want {
+			t.Errorf("[%v]: got %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestParseROAs(t *testing.T) {
+	tests := []struct {
+		desc    string
+		data    string
+		wantErr bool
+	}{{
+		desc: "Success - maxLength defaults to the prefix length",
+		data: `{"roas": [{"asn": 15169, "prefix": "8.8.8.0/24"}]}`,
+	}, {
+		desc:    "Failure - bad json",
+		data:    `{"roas": [`,
+		wantErr: true,
+	}, {
+		desc:    "Failure - bad ASN",
+		data:    `{"roas": [{"asn": "ASX", "prefix": "8.8.8.0/24"}]}`,
+		wantErr: true,
+	}, {
+		desc:    "Failure - bad prefix",
+		data:    `{"roas": [{"asn": 15169, "prefix": "8.8.8.8"}]}`,
+		wantErr: true,
+	}, {
+		desc:    "Failure - maxLength shorter than the prefix",
+		data:    `{"roas": [{"asn": 15169, "prefix": "8.8.8.0/24", "maxLength": 16}]}`,
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		_, err := ParseROAs([]byte(test.data))
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		}
+	}
+}
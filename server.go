@@ -0,0 +1,274 @@
+// A RIS Live compatible server, which re-publishes the messages of a single
+// upstream stream to local clients. Clients of RIS Live can be pointed at it
+// unchanged: the WebSocket endpoint, /v1/ws/, takes ris_subscribe and
+// ris_unsubscribe messages and answers pings; the HTTP endpoint,
+// /v1/stream/?format=json, streams the messages selected by its query.
+// /v1/messages/ streams messages filtered by a RisFilter, see events.go.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// LiveServer serves the RIS Live API from the messages published to a Broker.
+type LiveServer struct {
+	Broker *Broker
+	Buffer int            // The queue depth of each client.
+	Policy OverflowPolicy // The action when a client falls behind, it should not be OverflowBlock.
+
+	Heartbeat time.Duration // The interval of keepalives to Server-Sent Events clients, 0 to disable.
+}
+
+// NewLiveServer creates a LiveServer, dropping the newest messages for clients which fall behind.
+func NewLiveServer(b *Broker, buffer int) *LiveServer {
+	return &LiveServer{Broker: b, Buffer: buffer, Policy: OverflowDropNewest, Heartbeat: 15 * time.Second}
+}
+
+// liveData is a RisMessageData as RIS Live sends it.
+type liveData struct {
+	Timestamp     float64            `json:"timestamp"`
+	Peer          string             `json:"peer"`
+	PeerASN       string             `json:"peer_asn"`
+	ID            string             `json:"id"`
+	Host          string             `json:"host"`
+	Type          string             `json:"type"`
+	Path          []interface{}      `json:"path,omitempty"`
+	Community     [][]int32          `json:"community,omitempty"`
+	Origin        string             `json:"origin,omitempty"`
+	Announcements []*RisAnnouncement `json:"announcements,omitempty"`
+	Withdrawals   []string           `json:"withdrawals,omitempty"`
+	Raw           string             `json:"raw,omitempty"`
+	State         string             `json:"state,omitempty"`
+	Stats         map[string]uint64  `json:"stats,omitempty"`
+}
+
+// liveMessage encodes a message as RIS Live sends it, with the path built from
+// its DigestedPath and AS_SETs unless it has a Path.
+func liveMessage(rm *RisMessageData, includeRaw bool) ([]byte, error) {
+	d := liveData{
+		Timestamp:     rm.Timestamp,
+		Peer:          rm.Peer,
+		PeerASN:       rm.PeerASN,
+		ID:            rm.ID,
+		Host:          rm.Host,
+		Type:          rm.Type,
+		Path:          rm.ASPath(),
+		Community:     rm.Community,
+		Origin:        rm.Origin,
+		Announcements: rm.Announcements,
+		Withdrawals:   rm.Withdrawals,
+		State:         rm.State,
+		Stats:         rm.Stats,
+	}
+	if includeRaw {
+		d.Raw = rm.Raw
+	}
+	return liveReply("ris_message", d)
+}
+
+// liveReply encodes a message of the type to a client.
+func liveReply(typ string, data interface{}) ([]byte, error) {
+	b, err := json.Marshal(struct {
+		Type string      `json:"type"`
+		Data interface{} `json:"data"`
+	}{typ, data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %v message: %v", typ, err)
+	}
+	return b, nil
+}
+
+// ServeHTTP routes requests to the WebSocket and stream endpoints.
+func (s *LiveServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/v1/ws"):
+		s.serveWebSocket(w, req)
+	case strings.HasPrefix(req.URL.Path, "/v1/stream"):
+		s.serveStream(w, req)
+	case strings.HasPrefix(req.URL.Path, "/v1/messages"):
+		s.serveMessages(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// clientName names a client's broker subscription, from its client parameter.
+func clientName(kind string, req *http.Request) string {
+	if c := req.URL.Query().Get("client"); c != "" {
+		return kind + ":" + c
+	}
+	return kind
+}
+
+// liveClient holds the subscriptions of a WebSocket client, a message is sent
+// if any subscription matches it.
+type liveClient struct {
+	mu   sync.RWMutex
+	subs map[string]*RisSubscribe
+}
+
+func (c *liveClient) match(rm *RisMessageData) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, s := range c.subs {
+		if s.Match(rm) {
+			return true
+		}
+	}
+	return false
+}
+
+// includeRaw reports whether a subscription matching the message asked for the raw BGP message.
+func (c *liveClient) includeRaw(rm *RisMessageData) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, s := range c.subs {
+		if s.SocketOptions != nil && s.SocketOptions.IncludeRaw && s.Match(rm) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *liveClient) subscribe(s *RisSubscribe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subs[s.Key()] = s
+}
+
+func (c *liveClient) unsubscribe(s *RisSubscribe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.subs, s.Key())
+}
+
+// serveWebSocket serves a WebSocket client until it disconnects, or the broker closes.
+func (s *LiveServer) serveWebSocket(w http.ResponseWriter, req *http.Request) {
+	ws, err := UpgradeWebSocket(w, req)
+	if err != nil {
+		log.Infof("failed to accept websocket from %v: %v", req.RemoteAddr, err)
+		return
+	}
+	c := &liveClient{subs: map[string]*RisSubscribe{}}
+	sub, err := s.Broker.SubscribeFunc(clientName("ws", req), c.match, s.Buffer, s.Policy)
+	if err != nil {
+		log.Errorf("failed to subscribe websocket client %v: %v", req.RemoteAddr, err)
+		ws.Close()
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer ws.Close()
+		for rm := range sub.C {
+			b, err := liveMessage(rm.Data, c.includeRaw(rm.Data))
+			rm.Release()
+			if err == nil {
+				err = ws.WriteMessage(wsText, b)
+			}
+			if err != nil {
+				log.Infof("failed to send to websocket client %v: %v", req.RemoteAddr, err)
+				return
+			}
+		}
+	}()
+	defer func() {
+		s.Broker.Unsubscribe(sub)
+		<-done
+	}()
+
+	reply := func(typ string, data interface{}) error {
+		b, err := liveReply(typ, data)
+		if err != nil {
+			return err
+		}
+		return ws.WriteMessage(wsText, b)
+	}
+	replyError := func(format string, a ...interface{}) error {
+		return reply("ris_error", map[string]string{"message": fmt.Sprintf(format, a...)})
+	}
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			err = replyError("failed to parse message: %v", err)
+		} else {
+			switch msg.Type {
+			case "ping":
+				err = reply("pong", nil)
+			case "ris_subscribe", "ris_unsubscribe":
+				rs, perr := ParseRisSubscribe(msg.Data)
+				switch {
+				case perr != nil:
+					err = replyError("%v", perr)
+				case msg.Type == "ris_unsubscribe":
+					c.unsubscribe(rs)
+				default:
+					c.subscribe(rs)
+					if rs.SocketOptions != nil && rs.SocketOptions.Acknowledge {
+						err = reply("ris_subscribe_ok", map[string]interface{}{
+							"subscription":  rs,
+							"socketOptions": rs.SocketOptions,
+						})
+					}
+				}
+			default:
+				err = replyError("unsupported message type: %q", msg.Type)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// serveStream streams the messages matching the query as lines of JSON, until
+// the client disconnects or the broker closes. The raw BGP message is included
+// as by RIS Live, unless includeRaw=false.
+func (s *LiveServer) serveStream(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	if f := q.Get("format"); f != "" && f != "json" {
+		http.Error(w, fmt.Sprintf("unsupported format: %q", f), http.StatusBadRequest)
+		return
+	}
+	rs, err := ParseRisSubscribeQuery(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	o := &streamOptions{buffer: s.Buffer, policy: s.Policy, includeRaw: true}
+	if v := q.Get("includeRaw"); v != "" {
+		if o.includeRaw, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, fmt.Sprintf("failed to parse includeRaw(%v): %v", v, err), http.StatusBadRequest)
+			return
+		}
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	sub, err := s.Broker.SubscribeFunc(clientName("stream", req), rs.Match, s.Buffer, s.Policy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer s.Broker.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "application/json")
+	s.stream(w, req, sub, o)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var (
+	serverMsg00 = RisMessage{Type: "ris_message", Data: &RisMessageData{
+		Timestamp:     1558620047.08,
+		Host:          "rrc00",
+		Peer:          "192.0.2.1",
+		Type:          "UPDATE",
+		DigestedPath:  []int32{64496, 15169},
+		Announcements: []*RisAnnouncement{{NextHop: "192.0.2.1", Prefixes: []string{"8.8.8.0/24"}}},
+		Raw:           "FFFF",
+	}}
+	serverMsg01 = RisMessage{Type: "ris_message", Data: &RisMessageData{
+		Timestamp:   1558620048.08,
+		Host:        "rrc01",
+		Peer:        "192.0.2.2",
+		Type:        "UPDATE",
+		Path:        []interface{}{float64(64497), []interface{}{float64(64498), float64(64499)}},
+		Withdrawals: []string{"192.0.2.0/24"},
+		Raw:         "FFFF",
+	}}
+)
+
+// readLive reads the next message from a RIS Live WebSocket.
+func readLive(t *testing.T, ws *WebSocket) map[string]interface{} {
+	t.Helper()
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("failed to parse message(%s): %v", data, err)
+	}
+	return m
+}
+
+func TestLiveServerWebSocket(t *testing.T) {
+	b := NewBroker(nil, nil)
+	srv := httptest.NewServer(NewLiveServer(b, 10))
+	defer srv.Close()
+	ws, err := DialWebSocket("ws"+strings.TrimPrefix(srv.URL, "http")+"/v1/ws/?client=test", nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer ws.Close()
+	send := func(msg string) {
+		if err := ws.WriteMessage(wsText, []byte(msg)); err != nil {
+			t.Fatalf("failed to send %v: %v", msg, err)
+		}
+	}
+
+	send(`{"type":"ris_subscribe","data":{"host":"rrc01","socketOptions":{"acknowledge":true}}}`)
+	if m := readLive(t, ws); m["type"] != "ris_subscribe_ok" {
+		t.Fatalf("got %v, want ris_subscribe_ok", m)
+	}
+	if subs := b.Subscriptions(); len(subs) != 1 || subs[0].Name != "ws:test" {
+		t.Errorf("got subscriptions %v, want ws:test", subs)
+	}
+	b.Publish(serverMsg00)
+	b.Publish(serverMsg01)
+	m := readLive(t, ws)
+	data, _ := m["data"].(map[string]interface{})
+	if m["type"] != "ris_message" || data["host"] != "rrc01" {
+		t.Errorf("got %v, want the rrc01 message", m)
+	}
+	if _, ok := data["raw"]; ok {
+		t.Errorf("got raw message without includeRaw: %v", m)
+	}
+	if got, want := data["path"], []interface{}{float64(64497), []interface{}{float64(64498), float64(64499)}}; !jsonEqual(got, want) {
+		t.Errorf("got path %v, want %v", got, want)
+	}
+
+	// A second subscription adds to the first, and may ask for raw messages.
+	send(`{"type":"ris_subscribe","data":{"prefix":"8.0.0.0/8","socketOptions":{"includeRaw":true,"acknowledge":true}}}`)
+	readLive(t, ws)
+	b.Publish(serverMsg00)
+	m = readLive(t, ws)
+	data, _ = m["data"].(map[string]interface{})
+	if data["host"] != "rrc00" || data["raw"] != "FFFF" {
+		t.Errorf("got %v, want the rrc00 message with raw", m)
+	}
+	if got, want := data["path"], []interface{}{float64(64496), float64(15169)}; !jsonEqual(got, want) {
+		t.Errorf("got digested path %v, want %v", got, want)
+	}
+
+	send(`{"type":"ris_unsubscribe","data":{"host":"rrc01"}}`)
+	send(`{"type":"ping"}`)
+	if m := readLive(t, ws); m["type"] != "pong" {
+		t.Errorf("got %v, want pong", m)
+	}
+	b.Publish(serverMsg01)
+	b.Publish(serverMsg00)
+	if m := readLive(t, ws); m["data"].(map[string]interface{})["host"] != "rrc00" {
+		t.Errorf("got %v after unsubscribing rrc01, want the rrc00 message", m)
+	}
+
+	send(`{"type":"ris_subscribe","data":{"prefix":"not-a-prefix"}}`)
+	if m := readLive(t, ws); m["type"] != "ris_error" {
+		t.Errorf("got %v, want ris_error", m)
+	}
+	send(`{"type":"request_everything"}`)
+	if m := readLive(t, ws); m["type"] != "ris_error" {
+		t.Errorf("got %v, want ris_error", m)
+	}
+
+	// Closing the broker ends the connection.
+	b.Close()
+	if _, _, err := ws.ReadMessage(); err == nil {
+		t.Errorf("did not get error reading after the broker closed")
+	}
+}
+
+// jsonEqual compares values decoded from JSON.
+func jsonEqual(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+func TestLiveServerStream(t *testing.T) {
+	b := NewBroker(nil, nil)
+	srv := httptest.NewServer(NewLiveServer(b, 10))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/v1/stream/?format=json&prefix=8.8.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to get stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %v, want 200", resp.Status)
+	}
+	b.Publish(serverMsg01)
+	b.Publish(serverMsg00)
+
+	s := bufio.NewScanner(resp.Body)
+	if !s.Scan() {
+		t.Fatalf("failed to read message: %v", s.Err())
+	}
+	var got RisMessage
+	if err := json.Unmarshal(s.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse message(%s): %v", s.Bytes(), err)
+	}
+	if got.Type != "ris_message" || got.Data.Host != "rrc00" || got.Data.Raw != "FFFF" {
+		t.Errorf("got %s, want the rrc00 message with raw", s.Bytes())
+	}
+
+	// Closing the broker ends the stream.
+	b.Close()
+	if s.Scan() {
+		t.Errorf("got %s after the broker closed, want end of stream", s.Bytes())
+	}
+}
+
+func TestLiveServerBadRequest(t *testing.T) {
+	srv := httptest.NewServer(NewLiveServer(NewBroker(nil, nil), 10))
+	defer srv.Close()
+	tests := []struct {
+		desc string
+		path string
+		want int
+	}{{
+		desc: "Failure - unknown format",
+		path: "/v1/stream/?format=xml",
+		want: http.StatusBadRequest,
+	}, {
+		desc: "Failure - bad filter",
+		path: "/v1/stream/?require=nothing",
+		want: http.StatusBadRequest,
+	}, {
+		desc: "Failure - websocket without handshake",
+		path: "/v1/ws/",
+		want: http.StatusBadRequest,
+	}, {
+		desc: "Failure - unknown path",
+		path: "/v2/",
+		want: http.StatusNotFound,
+	}}
+
+	for _, test := range tests {
+		resp, err := http.Get(srv.URL + test.path)
+		if err != nil {
+			t.Errorf("[%v]: failed to get: %v", test.desc, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.want {
+			t.Errorf("[%v]: got status %v, want %v", test.desc, resp.StatusCode, test.want)
+		}
+	}
+}
+
+// TestLiveServerRisLive points a RisLive client at the server, as at RIS Live.
+func TestLiveServerRisLive(t *testing.T) {
+	b := NewBroker(nil, nil)
+	srv := httptest.NewServer(NewLiveServer(b, 10))
+	defer srv.Close()
+	// Closing the broker first ends the connections of the reconnecting clients.
+	defer b.Close()
+	for _, u := range []string{
+		"ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/ws/",
+		srv.URL + "/v1/stream/?format=json",
+	} {
+		r := &RisLive{
+			URL:      proto.String(u),
+			File:     proto.String(""),
+			UA:       proto.String("test"),
+			Filter:   &RisFilter{},
+			Chan:     make(chan RisMessage, 10),
+			Metrics:  NewMetrics(),
+			Watchdog: NewWatchdog(0),
+		}
+		go r.Listen()
+		// The client subscribes asynchronously, publish until a message arrives.
+		tick := time.NewTicker(10 * time.Millisecond)
+		timeout := time.After(5 * time.Second)
+	wait:
+		for {
+			select {
+			case rm := <-r.Chan:
+				if rm.Data.Host != "rrc00" || len(rm.Data.DigestedPath) != 2 {
+					t.Errorf("[%v]: got %+v, want the rrc00 message", u, rm.Data)
+				}
+				break wait
+			case <-tick.C:
+				b.Publish(serverMsg00)
+			case <-timeout:
+				t.Fatalf("[%v]: timed out waiting for a message", u)
+			}
+		}
+		tick.Stop()
+	}
+}
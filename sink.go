@@ -0,0 +1,452 @@
+// Alert sinks, which deliver Alerts from the AlertPipeline to external systems.
+//
+// Sinks implement the Sink interface, and a MultiSink delivers each alert to
+// several sinks at once. Provided sinks are: an HTTP webhook (JSON body, with
+// retry and backoff), RFC 5424 syslog over UDP, TCP or a unix socket, and a
+// rotating JSON-lines file. The SMTP sink is in email.go.
+//
+// Delivery may be slow, or retried for a while, so ParseSinks queues each sink's
+// alerts and delivers them from a goroutine of its own. A full queue drops
+// alerts, rather than blocking the pipeline, and the stream, behind a sink.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// sinkQueue is the number of alerts queued for each sink by ParseSinks.
+const sinkQueue = 1000
+
+// Sink delivers alerts to a destination.
+type Sink interface {
+	Send(a *Alert) error
+	Close() error
+}
+
+// MultiSink sends each alert to all of its sinks. A failing sink does not stop
+// delivery to the others.
+type MultiSink []Sink
+
+// Send sends the alert to every sink, returning the errors of those which failed.
+func (m MultiSink) Send(a *Alert) error {
+	var errs []string
+	for _, s := range m {
+		if err := s.Send(a); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send alert to %d sink(s): %v", len(errs), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Close closes every sink.
+func (m MultiSink) Close() error {
+	var errs []string
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close %d sink(s): %v", len(errs), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// QueuedSink delivers alerts to a Sink from a goroutine, queueing up to a limit
+// and dropping alerts beyond it, so Send never waits for delivery.
+type QueuedSink struct {
+	Sink Sink
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan *Alert
+	done   chan struct{}
+}
+
+// NewQueuedSink creates a QueuedSink of s, queueing up to size alerts.
+func NewQueuedSink(s Sink, size int) *QueuedSink {
+	q := &QueuedSink{Sink: s, queue: make(chan *Alert, size), done: make(chan struct{})}
+	go q.run()
+	return q
+}
+
+func (q *QueuedSink) run() {
+	defer close(q.done)
+	for a := range q.queue {
+		if err := q.Sink.Send(a); err != nil {
+			log.Errorf("alert delivery failed: %v", err)
+		}
+	}
+}
+
+// Send queues the alert, returning an error if it is dropped as the queue is full.
+func (q *QueuedSink) Send(a *Alert) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return fmt.Errorf("failed to queue alert: sink is closed")
+	}
+	select {
+	case q.queue <- a:
+		return nil
+	default:
+		return fmt.Errorf("dropped alert(%v %v): queue of %d full", a.Kind, a.Prefix, cap(q.queue))
+	}
+}
+
+// Close delivers the queued alerts, then closes the sink.
+func (q *QueuedSink) Close() error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+	<-q.done
+	return q.Sink.Close()
+}
+
+// WebhookSink POSTs each alert, as JSON, to a URL.
+type WebhookSink struct {
+	URL     string
+	Client  *http.Client
+	Retries int           // Attempts after the first which fail, before giving up.
+	Backoff time.Duration // The delay before the first retry, doubled for each retry after.
+	Headers map[string]string
+}
+
+// NewWebhookSink creates a WebhookSink with 3 retries, starting at 1 second.
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		URL:     url,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		Retries: 3,
+		Backoff: time.Second,
+	}
+}
+
+// Send POSTs the alert, retrying on errors and 5xx/429 responses.
+func (w *WebhookSink) Send(a *Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %v", err)
+	}
+	backoff := w.Backoff
+	for attempt := 0; ; attempt++ {
+		err = w.post(body)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(permanentError); ok || attempt >= w.Retries {
+			return fmt.Errorf("webhook(%v) failed after %d attempt(s): %v", w.URL, attempt+1, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// permanentError is an error which retrying will not resolve, ie: a 4xx response.
+type permanentError struct {
+	error
+}
+
+func (w *WebhookSink) post(body []byte) error {
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("server returned: %v", resp.Status)
+	}
+	return permanentError{fmt.Errorf("server returned: %v", resp.Status)}
+}
+
+// Close is a no-op for the WebhookSink.
+func (w *WebhookSink) Close() error { return nil }
+
+// SyslogSink writes alerts as RFC 5424 syslog messages.
+type SyslogSink struct {
+	Network  string // udp, tcp or unix (unixgram is also accepted).
+	Addr     string
+	Facility int // The syslog facility, ie: 1 (user), 16 (local0).
+	Hostname string
+	AppName  string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink creates a SyslogSink, connecting to addr over network.
+func NewSyslogSink(network, addr string) (*SyslogSink, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "-"
+	}
+	s := &SyslogSink{Network: network, Addr: addr, Facility: 16, Hostname: host, AppName: "rislive"}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SyslogSink) connect() error {
+	network := s.Network
+	if network == "unix" {
+		// Local syslog daemons usually listen on a datagram socket.
+		if conn, err := net.Dial("unixgram", s.Addr); err == nil {
+			s.conn = conn
+			return nil
+		}
+	}
+	conn, err := net.DialTimeout(network, s.Addr, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog(%v/%v): %v", s.Network, s.Addr, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// syslogSeverity maps an alert Severity to a syslog severity.
+func syslogSeverity(s Severity) int {
+	switch s {
+	case SeverityCritical:
+		return 2
+	case SeverityWarning:
+		return 4
+	}
+	return 6
+}
+
+// Format returns the alert as an RFC 5424 message, with the alert as JSON in the message body.
+func (s *SyslogSink) Format(a *Alert) ([]byte, error) {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode alert: %v", err)
+	}
+	pri := s.Facility*8 + syslogSeverity(a.Severity)
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		pri, a.LastSeen.UTC().Format(time.RFC3339Nano), s.Hostname, s.AppName, os.Getpid(), a.Kind, body)
+	return []byte(msg), nil
+}
+
+// Send writes the alert to the syslog connection, reconnecting once if the write fails.
+// Stream (tcp) transports use RFC 6587 octet counting framing.
+func (s *SyslogSink) Send(a *Alert) error {
+	msg, err := s.Format(a)
+	if err != nil {
+		return err
+	}
+	if s.Network == "tcp" {
+		msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.conn.Write(msg); err == nil {
+		return nil
+	}
+	s.conn.Close()
+	if err := s.connect(); err != nil {
+		return err
+	}
+	if _, err := s.conn.Write(msg); err != nil {
+		return fmt.Errorf("failed to write to syslog(%v/%v): %v", s.Network, s.Addr, err)
+	}
+	return nil
+}
+
+// Close closes the syslog connection.
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Close()
+}
+
+// FileSink writes alerts as JSON lines, rotating the file when it reaches MaxBytes.
+// Rotated files are renamed with a timestamp suffix, and only Keep are retained.
+type FileSink struct {
+	Path     string
+	MaxBytes int64
+	Keep     int
+
+	mu   sync.Mutex
+	fd   *os.File
+	size int64
+}
+
+// NewFileSink creates a FileSink, appending to path.
+func NewFileSink(path string, maxBytes int64, keep int) (*FileSink, error) {
+	f := &FileSink{Path: path, MaxBytes: maxBytes, Keep: keep}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileSink) open() error {
+	fd, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open alert file(%v): %v", f.Path, err)
+	}
+	st, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return fmt.Errorf("failed to stat alert file(%v): %v", f.Path, err)
+	}
+	f.fd, f.size = fd, st.Size()
+	return nil
+}
+
+// Send appends the alert to the file, rotating first if the file is full.
+func (f *FileSink) Send(a *Alert) error {
+	line, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %v", err)
+	}
+	line = append(line, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.MaxBytes > 0 && f.size > 0 && f.size+int64(len(line)) > f.MaxBytes {
+		// The alert is still written, to the full file, if it can not be rotated.
+		if err := f.rotate(); err != nil {
+			log.Errorf("alert file not rotated: %v", err)
+		}
+	}
+	n, err := f.fd.Write(line)
+	f.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write alert file(%v): %v", f.Path, err)
+	}
+	return nil
+}
+
+// rotatedLayout is the timestamp suffix of rotated files, which sorts in time order.
+const rotatedLayout = "20060102T150405.000000000"
+
+// rotate renames the current file aside, opens a new file, and removes the
+// oldest rotated files beyond Keep. The current file is kept open, and written
+// to, if it can not be rotated.
+func (f *FileSink) rotate() error {
+	fd := f.fd
+	rotated := fmt.Sprintf("%s.%s", f.Path, time.Now().UTC().Format(rotatedLayout))
+	if err := os.Rename(f.Path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate alert file(%v): %v", f.Path, err)
+	}
+	if err := f.open(); err != nil {
+		// The renamed file is still open.
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		log.Errorf("failed to close rotated alert file(%v): %v", rotated, err)
+	}
+	if f.Keep > 0 {
+		old, err := f.rotatedFiles()
+		if err != nil {
+			return err
+		}
+		for len(old) > f.Keep {
+			os.Remove(old[0])
+			old = old[1:]
+		}
+	}
+	return nil
+}
+
+// rotatedFiles lists the rotated files of the sink, oldest first. Other files
+// named after it, ie: alerts.json.bak, are not rotated files.
+func (f *FileSink) rotatedFiles() ([]string, error) {
+	dir, prefix := filepath.Dir(f.Path), filepath.Base(f.Path)+"."
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rotated alert files(%v): %v", dir, err)
+	}
+	var result []string
+	// ReadDir returns the files sorted by name.
+	for _, fi := range fis {
+		name := fi.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := time.Parse(rotatedLayout, name[len(prefix):]); err != nil {
+			continue
+		}
+		result = append(result, filepath.Join(dir, name))
+	}
+	return result, nil
+}
+
+// Close closes the alert file.
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fd.Close()
+}
+
+// ParseSinks creates the sinks described by a comma separated list of sink URLs,
+// each queued by a QueuedSink:
+//
+//	http(s)://host/path - a webhook.
+//	syslog+udp://host:port, syslog+tcp://host:port, syslog+unix:///dev/log - syslog.
+//	file:///path/to/alerts.json - a JSON lines file, rotated at 100MB, keeping 10.
+func ParseSinks(s string) (MultiSink, error) {
+	var result MultiSink
+	for _, u := range strings.Split(s, ",") {
+		u = strings.TrimSpace(u)
+		var sink Sink
+		var err error
+		switch {
+		case u == "":
+			continue
+		case strings.HasPrefix(u, "http://"), strings.HasPrefix(u, "https://"):
+			sink = NewWebhookSink(u)
+		case strings.HasPrefix(u, "syslog+"):
+			parts := strings.SplitN(strings.TrimPrefix(u, "syslog+"), "://", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid syslog sink: %v", u)
+			}
+			sink, err = NewSyslogSink(parts[0], parts[1])
+		case strings.HasPrefix(u, "smtp://"):
+			sink, err = NewEmailSinkFromURL(u)
+		case strings.HasPrefix(u, "file://"):
+			sink, err = NewFileSink(strings.TrimPrefix(u, "file://"), 100<<20, 10)
+		default:
+			return nil, fmt.Errorf("unknown sink: %v", u)
+		}
+		if err != nil {
+			result.Close()
+			return nil, err
+		}
+		result = append(result, NewQueuedSink(sink, sinkQueue))
+	}
+	return result, nil
+}
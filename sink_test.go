@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testAlert = &Alert{
+	Kind:      "MOAS_START",
+	Detector:  "moas",
+	Severity:  SeverityWarning,
+	Prefix:    "192.0.2.0/24",
+	Origin:    64500,
+	FirstSeen: time.Unix(10, 0).UTC(),
+	LastSeen:  time.Unix(10, 0).UTC(),
+	Count:     1,
+}
+
+func TestWebhookSink(t *testing.T) {
+	tests := []struct {
+		desc      string
+		statuses  []int // The response status for each attempt.
+		wantCalls int32
+		wantErr   bool
+	}{{
+		desc:      "Success - first attempt",
+		statuses:  []int{200},
+		wantCalls: 1,
+	}, {
+		desc:      "Success - retried after server errors",
+		statuses:  []int{500, 503, 200},
+		wantCalls: 3,
+	}, {
+		desc:      "Failure - client error is not retried",
+		statuses:  []int{400},
+		wantCalls: 1,
+		wantErr:   true,
+	}, {
+		desc:      "Failure - retries exhausted",
+		statuses:  []int{500, 500, 500, 500, 500},
+		wantCalls: 3,
+		wantErr:   true,
+	}}
+
+	for _, test := range tests {
+		var calls int32
+		var got *Alert
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&calls, 1)
+			got = &Alert{}
+			if err := json.NewDecoder(r.Body).Decode(got); err != nil {
+				t.Errorf("[%v]: failed to decode webhook body: %v", test.desc, err)
+			}
+			w.WriteHeader(test.statuses[n-1])
+		}))
+		w := NewWebhookSink(ts.URL)
+		w.Retries = 2
+		w.Backoff = time.Millisecond
+
+		err := w.Send(testAlert)
+		ts.Close()
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		}
+		if calls != test.wantCalls {
+			t.Errorf("[%v]: got %v calls, want %v", test.desc, calls, test.wantCalls)
+		}
+		if diff := cmp.Diff(got, testAlert); diff != "" {
+			t.Errorf("[%v]: webhook body got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslog")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen on udp: %v", err)
+	}
+	defer udp.Close()
+	unix, err := net.ListenPacket("unixgram", filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatalf("failed to listen on unix socket: %v", err)
+	}
+	defer unix.Close()
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen on tcp: %v", err)
+	}
+	defer tcp.Close()
+
+	// The tcp listener reads a single octet counted frame.
+	tcpMsg := make(chan string, 1)
+	go func() {
+		conn, err := tcp.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		n, _ := r.ReadString(' ')
+		buf := make([]byte, 4096)
+		m, _ := r.Read(buf)
+		tcpMsg <- n + string(buf[:m])
+	}()
+	readPacket := func(pc net.PacketConn) string {
+		pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 4096)
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err.Error()
+		}
+		return string(buf[:n])
+	}
+
+	tests := []struct {
+		desc    string
+		network string
+		addr    string
+		read    func() string
+	}{
+		{desc: "udp", network: "udp", addr: udp.LocalAddr().String(), read: func() string { return readPacket(udp) }},
+		{desc: "unix", network: "unix", addr: filepath.Join(dir, "log"), read: func() string { return readPacket(unix) }},
+		{desc: "tcp", network: "tcp", addr: tcp.Addr().String(), read: func() string { return <-tcpMsg }},
+	}
+
+	for _, test := range tests {
+		s, err := NewSyslogSink(test.network, test.addr)
+		if err != nil {
+			t.Fatalf("[%v]: failed to create syslog sink: %v", test.desc, err)
+		}
+		s.Hostname = "host"
+		if err := s.Send(testAlert); err != nil {
+			t.Errorf("[%v]: failed to send: %v", test.desc, err)
+		}
+		got := test.read()
+		s.Close()
+
+		// local0.warning = 16*8+4.
+		prefix := "<132>1 1970-01-01T00:00:10Z host rislive "
+		if test.network == "tcp" {
+			prefix = strings.SplitN(got, " ", 2)[0] + " " + prefix
+		}
+		if !strings.HasPrefix(got, prefix) || !strings.Contains(got, ` MOAS_START - {"kind":"MOAS_START"`) {
+			t.Errorf("[%v]: got message %q, want prefix %q", test.desc, got, prefix)
+		}
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesink")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alerts.json")
+
+	// Files named after the alert file, which are not rotated files.
+	for _, name := range []string{"alerts.json.bak", "alerts.json.20060102"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+
+	line, _ := json.Marshal(testAlert)
+	// Room for two alerts per file, keeping two rotated files.
+	f, err := NewFileSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatalf("failed to create file sink: %v", err)
+	}
+	for i := 0; i < 7; i++ {
+		if err := f.Send(testAlert); err != nil {
+			t.Fatalf("failed to send alert %d: %v", i, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("failed to close file sink: %v", err)
+	}
+
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 4 {
+		t.Errorf("got %d files, want 2 rotated and 2 others: %v", len(rotated), rotated)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read alert file: %v", err)
+	}
+	if got, want := string(b), string(line)+"\n"; got != want {
+		t.Errorf("alert file got %q want %q", got, want)
+	}
+}
+
+func TestFileSinkRotateFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesink")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alerts.json")
+
+	f, err := NewFileSink(path, 1, 2)
+	if err != nil {
+		t.Fatalf("failed to create file sink: %v", err)
+	}
+	defer f.Close()
+	if err := f.Send(testAlert); err != nil {
+		t.Fatalf("failed to send alert: %v", err)
+	}
+	// The file can not be renamed once it is removed, the sink keeps writing to it.
+	os.Remove(path)
+	for i := 0; i < 2; i++ {
+		if err := f.Send(testAlert); err != nil {
+			t.Errorf("failed to send alert %d: %v", i, err)
+		}
+	}
+	if rotated, _ := filepath.Glob(path + ".*"); len(rotated) != 0 {
+		t.Errorf("got %d rotated files, want 0: %v", len(rotated), rotated)
+	}
+	line, _ := json.Marshal(testAlert)
+	if got, want := f.size, int64(3*(len(line)+1)); got != want {
+		t.Errorf("got %v bytes written, want %v", got, want)
+	}
+}
+
+// blockingSink records alerts, each Send waiting until it is released.
+type blockingSink struct {
+	started chan *Alert
+	release chan struct{}
+	got     []string
+	closed  bool
+}
+
+func (b *blockingSink) Send(a *Alert) error {
+	b.started <- a
+	<-b.release
+	b.got = append(b.got, a.Kind)
+	return nil
+}
+
+func (b *blockingSink) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestQueuedSink(t *testing.T) {
+	b := &blockingSink{started: make(chan *Alert, 10), release: make(chan struct{})}
+	q := NewQueuedSink(b, 1)
+	alert := func(kind string) *Alert { return &Alert{Kind: kind, Prefix: "192.0.2.0/24"} }
+
+	// The first alert is being delivered, the second queued and the third dropped,
+	// without waiting for the sink.
+	if err := q.Send(alert("A")); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	<-b.started
+	if err := q.Send(alert("B")); err != nil {
+		t.Errorf("failed to queue: %v", err)
+	}
+	if err := q.Send(alert("C")); err == nil {
+		t.Errorf("did not get error for an alert beyond the queue")
+	}
+
+	close(b.release)
+	if err := q.Close(); err != nil {
+		t.Errorf("failed to close: %v", err)
+	}
+	if diff := cmp.Diff(b.got, []string{"A", "B"}); diff != "" || !b.closed {
+		t.Errorf("got closed %v, got/want mismatch diff(-got, +want):\n%v\n", b.closed, diff)
+	}
+	if err := q.Send(alert("D")); err == nil {
+		t.Errorf("did not get error sending to a closed sink")
+	}
+}
+
+func TestParseSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parsesinks")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		desc    string
+		sinks   string
+		want    int
+		wantErr bool
+	}{
+		{desc: "Success - empty", sinks: "", want: 0},
+		{desc: "Success - webhook and file", sinks: "https://example.com/hook, file://" + filepath.Join(dir, "a.json"), want: 2},
+		{desc: "Failure - unknown scheme", sinks: "ftp://example.com", wantErr: true},
+		{desc: "Failure - bad syslog", sinks: "syslog+udp", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseSinks(test.sinks)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil && len(got) != test.want:
+			t.Errorf("[%v]: got %d sinks, want %d", test.desc, len(got), test.want)
+		}
+		got.Close()
+	}
+}
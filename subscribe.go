@@ -0,0 +1,229 @@
+// The RIS Live subscription filter, the data of a ris_subscribe message, which
+// selects the messages a client of the RIS Live API receives.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RisSubscribe is the data of a ris_subscribe message. Empty fields match every message.
+type RisSubscribe struct {
+	Host          string         `json:"host,omitempty"`    // The collector, ie: rrc00.
+	Type          string         `json:"type,omitempty"`    // The message type, ie: UPDATE.
+	Require       string         `json:"require,omitempty"` // "announcements" or "withdrawals".
+	Peer          string         `json:"peer,omitempty"`    // The peer address.
+	Path          string         `json:"path,omitempty"`    // ASNs in the path, ie: "^701,3356" or "15169$".
+	Prefix        prefixList     `json:"prefix,omitempty"`  // Prefixes announced or withdrawn.
+	MoreSpecific  *bool          `json:"moreSpecific,omitempty"`
+	LessSpecific  *bool          `json:"lessSpecific,omitempty"`
+	SocketOptions *SocketOptions `json:"socketOptions,omitempty"`
+
+	path                   []int32
+	anchorStart, anchorEnd bool
+	prefixes               []*net.IPNet
+}
+
+// SocketOptions are the per connection options of a ris_subscribe message.
+type SocketOptions struct {
+	IncludeRaw  bool `json:"includeRaw,omitempty"`  // Include the raw BGP message.
+	Acknowledge bool `json:"acknowledge,omitempty"` // Answer with ris_subscribe_ok.
+}
+
+// prefixList is a prefix or a list of prefixes, RIS Live accepts either.
+type prefixList []string
+
+func (p *prefixList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*p = prefixList{s}
+		return nil
+	}
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return fmt.Errorf("prefix must be a string or a list of strings: %v", err)
+	}
+	*p = l
+	return nil
+}
+
+// ParseRisSubscribe parses and compiles the data of a ris_subscribe message.
+func ParseRisSubscribe(data []byte) (*RisSubscribe, error) {
+	s := &RisSubscribe{}
+	if len(data) > 0 && string(data) != "null" {
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("failed to parse subscription(%s): %v", data, err)
+		}
+	}
+	if err := s.Compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ParseRisSubscribeQuery compiles a subscription from the query parameters of
+// the RIS Live stream endpoint, named as the ris_subscribe fields. Prefix may
+// be repeated or comma separated.
+func ParseRisSubscribeQuery(q url.Values) (*RisSubscribe, error) {
+	s := &RisSubscribe{
+		Host:    q.Get("host"),
+		Type:    q.Get("type"),
+		Require: q.Get("require"),
+		Peer:    q.Get("peer"),
+		Path:    q.Get("path"),
+	}
+	s.Prefix = queryList(q, "prefix")
+	for name, b := range map[string]**bool{"moreSpecific": &s.MoreSpecific, "lessSpecific": &s.LessSpecific} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %v(%v): %v", name, v, err)
+		}
+		*b = &t
+	}
+	if err := s.Compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Compile validates the subscription and prepares it for Match.
+func (s *RisSubscribe) Compile() error {
+	switch s.Require {
+	case "", "announcements", "withdrawals":
+	default:
+		return fmt.Errorf("require must be announcements or withdrawals: %q", s.Require)
+	}
+	if s.Peer != "" && net.ParseIP(s.Peer) == nil {
+		return fmt.Errorf("failed to parse peer address: %q", s.Peer)
+	}
+
+	s.path, s.anchorStart, s.anchorEnd = nil, false, false
+	path := strings.TrimSpace(s.Path)
+	if strings.HasPrefix(path, "^") {
+		s.anchorStart, path = true, path[1:]
+	}
+	if strings.HasSuffix(path, "$") {
+		s.anchorEnd, path = true, path[:len(path)-1]
+	}
+	if path != "" {
+		for _, a := range strings.Split(path, ",") {
+			asn, err := strconv.ParseUint(strings.TrimSpace(a), 10, 32)
+			if err != nil {
+				return fmt.Errorf("failed to parse path ASN(%v): %v", a, err)
+			}
+			s.path = append(s.path, int32(asn))
+		}
+	}
+
+	s.prefixes = nil
+	for _, p := range s.Prefix {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("failed to parse prefix(%v): %v", p, err)
+		}
+		s.prefixes = append(s.prefixes, n)
+	}
+	return nil
+}
+
+// Key returns a canonical form of the subscription, equal for equal subscriptions.
+func (s *RisSubscribe) Key() string {
+	c := *s
+	c.SocketOptions = nil
+	b, _ := json.Marshal(&c)
+	return string(b)
+}
+
+// Match reports whether a message is selected by the subscription.
+func (s *RisSubscribe) Match(rm *RisMessageData) bool {
+	switch {
+	case s.Host != "" && s.Host != rm.Host:
+		return false
+	case s.Type != "" && !strings.EqualFold(s.Type, rm.Type):
+		return false
+	case s.Require == "announcements" && len(rm.Announcements) == 0:
+		return false
+	case s.Require == "withdrawals" && len(rm.Withdrawals) == 0:
+		return false
+	case s.Peer != "" && !net.ParseIP(s.Peer).Equal(net.ParseIP(rm.Peer)):
+		return false
+	case len(s.path) > 0 && !s.matchPath(rm.DigestedPath):
+		return false
+	case len(s.prefixes) > 0 && !s.matchPrefixes(rm):
+		return false
+	}
+	return true
+}
+
+// matchPath reports whether the subscription's ASNs appear in order in the
+// path, at its start or end when anchored.
+func (s *RisSubscribe) matchPath(path []int32) bool {
+	for i := 0; i+len(s.path) <= len(path); i++ {
+		if s.anchorStart && i > 0 {
+			return false
+		}
+		if s.anchorEnd && i+len(s.path) != len(path) {
+			continue
+		}
+		match := true
+		for j, asn := range s.path {
+			if path[i+j] != asn {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefixes reports whether an announced or withdrawn prefix matches: equal
+// to a subscribed prefix, more specific unless moreSpecific is false, or less
+// specific if lessSpecific is true.
+func (s *RisSubscribe) matchPrefixes(rm *RisMessageData) bool {
+	more := s.MoreSpecific == nil || *s.MoreSpecific
+	less := s.LessSpecific != nil && *s.LessSpecific
+	match := func(p string) bool {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return false
+		}
+		nl, _ := n.Mask.Size()
+		for _, f := range s.prefixes {
+			fl, _ := f.Mask.Size()
+			switch {
+			case len(n.IP) != len(f.IP):
+			case nl == fl && f.IP.Equal(n.IP):
+				return true
+			case more && nl > fl && f.Contains(n.IP):
+				return true
+			case less && nl < fl && n.Contains(f.IP):
+				return true
+			}
+		}
+		return false
+	}
+	for _, a := range rm.Announcements {
+		for _, p := range a.Prefixes {
+			if match(p) {
+				return true
+			}
+		}
+	}
+	for _, p := range rm.Withdrawals {
+		if match(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRisSubscribeMatch(t *testing.T) {
+	msg := &RisMessageData{
+		Host:         "rrc01",
+		Type:         "UPDATE",
+		Peer:         "2001:db8::1",
+		DigestedPath: []int32{701, 3356, 15169},
+		Announcements: []*RisAnnouncement{{
+			NextHop:  "192.0.2.1",
+			Prefixes: []string{"8.8.8.0/24"},
+		}},
+	}
+	tests := []struct {
+		desc string
+		data string
+		want bool
+	}{{
+		desc: "Success - empty subscription",
+		data: `{}`,
+		want: true,
+	}, {
+		desc: "Success - host and type",
+		data: `{"host":"rrc01","type":"update"}`,
+		want: true,
+	}, {
+		desc: "Success - other host",
+		data: `{"host":"rrc00"}`,
+	}, {
+		desc: "Success - require announcements",
+		data: `{"require":"announcements"}`,
+		want: true,
+	}, {
+		desc: "Success - require withdrawals",
+		data: `{"require":"withdrawals"}`,
+	}, {
+		desc: "Success - peer in another form",
+		data: `{"peer":"2001:db8:0::1"}`,
+		want: true,
+	}, {
+		desc: "Success - path fragment",
+		data: `{"path":"3356"}`,
+		want: true,
+	}, {
+		desc: "Success - path sequence",
+		data: `{"path":"3356,15169"}`,
+		want: true,
+	}, {
+		desc: "Success - path out of order",
+		data: `{"path":"15169,3356"}`,
+	}, {
+		desc: "Success - path anchored at origin",
+		data: `{"path":"15169$"}`,
+		want: true,
+	}, {
+		desc: "Success - path not anchored at origin",
+		data: `{"path":"3356$"}`,
+	}, {
+		desc: "Success - path anchored at peer",
+		data: `{"path":"^701,3356"}`,
+		want: true,
+	}, {
+		desc: "Success - path not anchored at peer",
+		data: `{"path":"^3356"}`,
+	}, {
+		desc: "Success - exact prefix",
+		data: `{"prefix":"8.8.8.0/24"}`,
+		want: true,
+	}, {
+		desc: "Success - more specific prefix",
+		data: `{"prefix":["192.0.2.0/24","8.0.0.0/8"]}`,
+		want: true,
+	}, {
+		desc: "Success - more specific prefix excluded",
+		data: `{"prefix":"8.0.0.0/8","moreSpecific":false}`,
+	}, {
+		desc: "Success - less specific prefix excluded by default",
+		data: `{"prefix":"8.8.8.128/25"}`,
+	}, {
+		desc: "Success - less specific prefix",
+		data: `{"prefix":"8.8.8.128/25","lessSpecific":true}`,
+		want: true,
+	}, {
+		desc: "Success - other address family",
+		data: `{"prefix":"::/0"}`,
+	}}
+
+	for _, test := range tests {
+		s, err := ParseRisSubscribe([]byte(test.data))
+		if err != nil {
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+			continue
+		}
+		if got := s.Match(msg); got != test.want {
+			t.Errorf("[%v]: got %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestParseRisSubscribe(t *testing.T) {
+	tests := []struct {
+		desc    string
+		data    string
+		wantErr bool
+	}{{
+		desc: "Success - null data",
+		data: `null`,
+	}, {
+		desc: "Success - socket options",
+		data: `{"socketOptions":{"includeRaw":true,"acknowledge":true}}`,
+	}, {
+		desc:    "Failure - bad require",
+		data:    `{"require":"communities"}`,
+		wantErr: true,
+	}, {
+		desc:    "Failure - bad peer",
+		data:    `{"peer":"rrc00"}`,
+		wantErr: true,
+	}, {
+		desc:    "Failure - bad path",
+		data:    `{"path":"701,AS3356"}`,
+		wantErr: true,
+	}, {
+		desc:    "Failure - bad prefix",
+		data:    `{"prefix":"8.8.8.0"}`,
+		wantErr: true,
+	}, {
+		desc:    "Failure - prefix not a string",
+		data:    `{"prefix":8}`,
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		_, err := ParseRisSubscribe([]byte(test.data))
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		}
+	}
+}
+
+func TestParseRisSubscribeQuery(t *testing.T) {
+	tests := []struct {
+		desc    string
+		query   string
+		want    string
+		wantErr bool
+	}{{
+		desc:  "Success - fields",
+		query: "host=rrc01&type=UPDATE&require=announcements&path=15169$",
+		want:  `{"host":"rrc01","type":"UPDATE","require":"announcements","path":"15169$"}`,
+	}, {
+		desc:  "Success - prefixes and specifics",
+		query: "prefix=8.8.8.0/24,8.8.4.0/24&prefix=2001:db8::/32&moreSpecific=false&lessSpecific=1",
+		want:  `{"prefix":["8.8.8.0/24","8.8.4.0/24","2001:db8::/32"],"moreSpecific":false,"lessSpecific":true}`,
+	}, {
+		desc:    "Failure - bad boolean",
+		query:   "moreSpecific=maybe",
+		wantErr: true,
+	}, {
+		desc:    "Failure - bad prefix",
+		query:   "prefix=8.8.8.8",
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		q, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatalf("[%v]: failed to parse query: %v", test.desc, err)
+		}
+		s, err := ParseRisSubscribeQuery(q)
+		switch {
+		case err != nil && !test.wantErr:
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+		case err == nil && test.wantErr:
+			t.Errorf("[%v]: did not get error when expecting one", test.desc)
+		case err == nil:
+			if got := s.Key(); got != test.want {
+				t.Errorf("[%v]: got %v, want %v", test.desc, got, test.want)
+			}
+		}
+	}
+}
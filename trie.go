@@ -32,6 +32,7 @@ func (p *Prefix) GetNet() *net.IPNet { return p.Network }
 type Node struct {
 	Name   string      // A nexthop.
 	Prefix *Prefix     // The prefix information for this node, IP and Network.
+	stored bool        // The prefix was inserted, rather than the node joining others.
 	parent *Node       // The node to which this node attaches.
 	l, r   *Node       // The nodes which attach to this node.
 	lock   *sync.Mutex // A mutex, to permit locking the structure if changes are to be made.
@@ -48,14 +49,85 @@ func New(root string) (*Tree, error) {
 		Root: &Node{Name: root,
 			Prefix: &Prefix{IP: ip,
 				Network: net},
+			stored: true,
 		},
 		elements: 1,
 	}, nil
 }
 
-// PrefixLpm implements a Longest Prefix Match for a prefix in the LPM tree.
+// family returns ip in the length of the tree's address family, or nil if it
+// is of the other family.
+func (t *Tree) family(ip net.IP) net.IP {
+	if len(t.Root.Prefix.Network.IP) == net.IPv4len {
+		return ip.To4()
+	}
+	if ip.To4() != nil {
+		return nil
+	}
+	return ip.To16()
+}
+
+// bit returns the i'th bit of ip, counting from the most significant.
+func bit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+// walk follows the path of ip down the tree to a depth of ones bits, calling f
+// with each stored prefix on the way. The node at the depth is returned, nil if
+// it does not exist, and if create is set missing nodes are created.
+func (t *Tree) walk(ip net.IP, ones int, create bool, f func(*Node)) *Node {
+	rootOnes, bits := t.Root.Prefix.Network.Mask.Size()
+	n := t.Root
+	for i := rootOnes; ; i++ {
+		if n.stored && f != nil {
+			f(n)
+		}
+		if i >= ones {
+			return n
+		}
+		child := &n.l
+		if bit(ip, i) == 1 {
+			child = &n.r
+		}
+		if *child == nil {
+			if !create {
+				return nil
+			}
+			mask := net.CIDRMask(i+1, bits)
+			*child = &Node{parent: n, Prefix: &Prefix{IP: ip.Mask(mask), Network: &net.IPNet{IP: ip.Mask(mask), Mask: mask}}}
+		}
+		n = *child
+	}
+}
+
+// contains reports whether the prefix is within the tree's root prefix, returning
+// the prefix address in the tree's family and the prefix length.
+func (t *Tree) contains(n *net.IPNet) (net.IP, int, bool) {
+	ip := t.family(n.IP)
+	if ip == nil || n.IP == nil {
+		return nil, 0, false
+	}
+	ones, bits := n.Mask.Size()
+	rootOnes, _ := t.Root.Prefix.Network.Mask.Size()
+	if bits != len(ip)*8 || ones < rootOnes || !t.Root.Prefix.Network.Contains(ip) {
+		return nil, 0, false
+	}
+	return ip, ones, true
+}
+
+// PrefixLpm implements a Longest Prefix Match for a prefix in the LPM tree, the
+// most specific prefix in the tree which covers n, or n itself.
 func (t *Tree) PrefixLpm(n *net.IPNet) (*net.IPNet, error) {
-	return t.Lpm(n.IP)
+	if n == nil {
+		return nil, fmt.Errorf("can not LPM a nil prefix: %v", n)
+	}
+	ip, ones, ok := t.contains(n)
+	if !ok {
+		return nil, fmt.Errorf("prefix %v is not within the tree root %v", n, t.Root.Prefix.Network)
+	}
+	var result *net.IPNet
+	t.walk(ip, ones, false, func(n *Node) { result = n.Prefix.Network })
+	return result, nil
 }
 
 // Lpm performs a longest prefix match in a Tree for a net.IP.
@@ -69,37 +141,125 @@ func (t *Tree) Lpm(n net.IP) (*net.IPNet, error) {
 	}
 
 	// Searching the root, this is recursive down the root/nodes.
-	return t.Root.Search(n)
+	result, err := t.Root.Search(n)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, fmt.Errorf("no match for %v", n)
+	}
+	return result, nil
 }
 
 // Insert adds a prefix to the tree, provided the prefix doesn't already exist in the tree.
+// Prefixes outside the tree's root prefix are not added.
 func (t *Tree) Insert(n *net.IPNet) bool {
+	ip, ones, ok := t.contains(n)
+	if !ok {
+		return false
+	}
+	node := t.walk(ip, ones, true, nil)
+	if node.stored {
+		return false
+	}
+	node.Name, node.stored = node.Prefix.Network.String(), true
+	t.elements++
+	return true
+}
+
+// Delete removes a prefix from the tree, reporting whether it was present. The
+// root prefix is never removed.
+func (t *Tree) Delete(n *net.IPNet) bool {
+	ip, ones, ok := t.contains(n)
+	if !ok {
+		return false
+	}
+	node := t.walk(ip, ones, false, nil)
+	if node == nil || !node.stored || node == t.Root {
+		return false
+	}
+	node.Name, node.stored = "", false
+	t.elements--
+	// Prune the branch of nodes which no longer lead to a prefix.
+	for node != t.Root && !node.stored && node.l == nil && node.r == nil {
+		p := node.parent
+		if p.l == node {
+			p.l = nil
+		} else {
+			p.r = nil
+		}
+		node = p
+	}
 	return true
 }
 
+// Len returns the number of prefixes in the tree, including the root.
+func (t *Tree) Len() int {
+	return int(t.elements)
+}
+
+// Covering returns the prefixes in the tree which cover n, including n itself,
+// from the least to the most specific.
+func (t *Tree) Covering(n *net.IPNet) []*net.IPNet {
+	ip, ones, ok := t.contains(n)
+	if !ok {
+		return nil
+	}
+	var result []*net.IPNet
+	t.walk(ip, ones, false, func(n *Node) { result = append(result, n.Prefix.Network) })
+	return result
+}
+
+// MoreSpecifics returns the prefixes in the tree which are more specific than n,
+// in tree order, lower addresses and shorter prefixes first.
+func (t *Tree) MoreSpecifics(n *net.IPNet) []*net.IPNet {
+	ip, ones, ok := t.contains(n)
+	if !ok {
+		return nil
+	}
+	node := t.walk(ip, ones, false, nil)
+	if node == nil {
+		return nil
+	}
+	var result []*net.IPNet
+	var collect func(*Node)
+	collect = func(n *Node) {
+		if n == nil {
+			return
+		}
+		if n.stored {
+			result = append(result, n.Prefix.Network)
+		}
+		collect(n.l)
+		collect(n.r)
+	}
+	collect(node.l)
+	collect(node.r)
+	return result
+}
+
+// Search returns the most specific prefix at or below the node which contains
+// ip, or nil if there is none.
 func (n *Node) Search(ip net.IP) (*net.IPNet, error) {
 	if ip == nil {
 		return nil, errors.New("ip to search is nil")
 	}
-
-	var result *net.IPNet
-	// Search down the L tree leg, if ip is in l.Prefix, descend.
-	if n.l.Prefix.Network.Contains(ip) {
-		var err error
-		result, err = n.l.Search(ip)
-		if err != nil {
-			return nil, fmt.Errorf("failed searching a left branch: %s", err)
-		}
+	if n == nil || n.Prefix == nil || n.Prefix.Network == nil || !n.Prefix.Network.Contains(ip) {
+		return nil, nil
 	}
 
-	// No success on the left branch, search the right.
-	if result == nil {
-		var err error
-		result, err = n.r.Search(ip)
+	// Search down the L or R tree leg containing ip, a prefix found there is more specific.
+	for _, c := range []*Node{n.l, n.r} {
+		found, err := c.Search(ip)
 		if err != nil {
-			return nil, fmt.Errorf("failed searching a right branch: %s", err)
+			return nil, fmt.Errorf("failed searching a branch: %s", err)
+		}
+		if found != nil {
+			return found, nil
 		}
 	}
-	// Search down the R tree leg.
-	return result, nil
+	if n.stored {
+		return n.Prefix.Network, nil
+	}
+	return nil, nil
 }
@@ -44,3 +44,120 @@ func TestSearch(t *testing.T) {
 		}
 	}
 }
+
+// mustCIDR parses a prefix for a test.
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatalf("failed to parse %v: %v", s, err)
+	}
+	return n
+}
+
+// prefixStrings returns the string forms of prefixes.
+func prefixStrings(ns []*net.IPNet) []string {
+	var result []string
+	for _, n := range ns {
+		result = append(result, n.String())
+	}
+	return result
+}
+
+func TestTree(t *testing.T) {
+	tree, err := New("0.0.0.0/0")
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	for _, p := range []string{"8.0.0.0/8", "8.8.0.0/16", "8.8.8.0/24", "8.8.4.0/24", "9.0.0.0/8"} {
+		if !tree.Insert(mustCIDR(t, p)) {
+			t.Errorf("failed to insert %v", p)
+		}
+	}
+	for _, p := range []string{"8.8.8.0/24", "2001:db8::/32"} {
+		if tree.Insert(mustCIDR(t, p)) {
+			t.Errorf("inserted %v, a duplicate or of the other family", p)
+		}
+	}
+	if tree.Len() != 6 {
+		t.Errorf("got %v prefixes, want 6", tree.Len())
+	}
+
+	lpm := []struct {
+		desc string
+		ip   string
+		want string
+	}{{
+		desc: "Success - most specific",
+		ip:   "8.8.8.8",
+		want: "8.8.8.0/24",
+	}, {
+		desc: "Success - covering prefix",
+		ip:   "8.8.9.1",
+		want: "8.8.0.0/16",
+	}, {
+		desc: "Success - root",
+		ip:   "10.0.0.1",
+		want: "0.0.0.0/0",
+	}}
+	for _, test := range lpm {
+		got, err := tree.Lpm(net.ParseIP(test.ip))
+		if err != nil {
+			t.Errorf("[%v]: got error when not expecting one: %v", test.desc, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("[%v]: got %v, want %v", test.desc, got, test.want)
+		}
+	}
+	if _, err := tree.Lpm(net.ParseIP("2001:db8::1")); err == nil {
+		t.Errorf("did not get error matching an address of the other family")
+	}
+
+	got, err := tree.PrefixLpm(mustCIDR(t, "8.8.0.0/12"))
+	if err != nil || got.String() != "8.0.0.0/8" {
+		t.Errorf("got prefix match %v (%v), want 8.0.0.0/8", got, err)
+	}
+	if diff := cmp.Diff(prefixStrings(tree.Covering(mustCIDR(t, "8.8.8.0/25"))), []string{"0.0.0.0/0", "8.0.0.0/8", "8.8.0.0/16", "8.8.8.0/24"}); diff != "" {
+		t.Errorf("covering got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if diff := cmp.Diff(prefixStrings(tree.MoreSpecifics(mustCIDR(t, "8.0.0.0/8"))), []string{"8.8.0.0/16", "8.8.4.0/24", "8.8.8.0/24"}); diff != "" {
+		t.Errorf("more specifics got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+
+	// Deleting a prefix leaves the others.
+	if !tree.Delete(mustCIDR(t, "8.8.0.0/16")) || tree.Delete(mustCIDR(t, "8.8.0.0/16")) {
+		t.Errorf("failed to delete 8.8.0.0/16 once")
+	}
+	if tree.Delete(mustCIDR(t, "0.0.0.0/0")) {
+		t.Errorf("deleted the root")
+	}
+	if got, _ := tree.Lpm(net.ParseIP("8.8.9.1")); got.String() != "8.0.0.0/8" {
+		t.Errorf("got %v after deleting, want 8.0.0.0/8", got)
+	}
+	for _, p := range []string{"8.8.8.0/24", "8.8.4.0/24"} {
+		tree.Delete(mustCIDR(t, p))
+	}
+	if n := tree.walk(net.ParseIP("8.0.0.0").To4(), 8, false, nil); n == nil || n.l != nil || n.r != nil {
+		t.Errorf("branches below 8.0.0.0/8 were not pruned")
+	}
+}
+
+func TestTreeIPv6(t *testing.T) {
+	tree, err := New("::/0")
+	if err != nil {
+		t.Fatalf("failed to create tree: %v", err)
+	}
+	tree.Insert(mustCIDR(t, "2001:db8::/32"))
+	tree.Insert(mustCIDR(t, "2001:db8:1::/48"))
+	if tree.Insert(mustCIDR(t, "192.0.2.0/24")) {
+		t.Errorf("inserted an IPv4 prefix")
+	}
+	got, err := tree.Lpm(net.ParseIP("2001:db8:1::1"))
+	if err != nil || got.String() != "2001:db8:1::/48" {
+		t.Errorf("got %v (%v), want 2001:db8:1::/48", got, err)
+	}
+	if _, err := tree.Lpm(net.ParseIP("192.0.2.1")); err == nil {
+		t.Errorf("did not get error matching an IPv4 address")
+	}
+}
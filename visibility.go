@@ -0,0 +1,334 @@
+// Track the visibility of watched prefixes across the RIS collectors and peers.
+//
+// A prefix's visibility is the fraction of active peers of its address family
+// which currently have a route to the prefix, a peer being of the families of
+// the routes it has sent. A peer is active until Expire finds it has sent nothing
+// within the configured timeout, peers which fall silent are not counted against
+// a prefix. RIS Live carries only updates, not table state, so visibility is
+// learned as peers announce routes and is understated until the stream has run
+// a while: the visibility of each prefix is only a baseline for the warm up
+// period after it is first evaluated.
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VisibilityConfig holds the thresholds used by a VisibilityTracker.
+type VisibilityConfig struct {
+	Prefixes      []string      // The prefixes to watch, exact matches. Empty watches all prefixes.
+	Threshold     float64       // Visibility (0.0 - 1.0) below which a prefix is alerted as low.
+	Delta         float64       // The change in visibility which causes a VisibilityChange event.
+	MinPeers      int           // The number of active peers of a prefix's address family required before it emits events.
+	ActiveTimeout time.Duration // A peer is inactive once it has sent nothing for this long.
+	WarmUp        time.Duration // The period after a prefix is first evaluated during which it emits no events.
+}
+
+// DefaultVisibilityConfig returns a VisibilityConfig watching prefixes.
+func DefaultVisibilityConfig(prefixes []string) *VisibilityConfig {
+	return &VisibilityConfig{
+		Prefixes:      prefixes,
+		Threshold:     0.5,
+		Delta:         0.1,
+		MinPeers:      10,
+		ActiveTimeout: 10 * time.Minute,
+		WarmUp:        10 * time.Minute,
+	}
+}
+
+// VisibilityEventKind describes the change a VisibilityEvent reports.
+type VisibilityEventKind int
+
+const (
+	VisibilityChange   VisibilityEventKind = iota // Visibility moved by at least Delta.
+	VisibilityLow                                 // Visibility dropped below Threshold.
+	VisibilityRestored                            // Visibility recovered to Threshold or above.
+)
+
+func (k VisibilityEventKind) String() string {
+	switch k {
+	case VisibilityChange:
+		return "VISIBILITY_CHANGE"
+	case VisibilityLow:
+		return "VISIBILITY_LOW"
+	case VisibilityRestored:
+		return "VISIBILITY_RESTORED"
+	}
+	return "VISIBILITY_UNKNOWN"
+}
+
+// VisibilityEvent is emitted when a prefix's visibility changes.
+type VisibilityEvent struct {
+	Kind       VisibilityEventKind
+	Prefix     string
+	Visibility float64 // The current visibility.
+	Previous   float64 // The visibility last reported.
+	Seen       int     // The active peers with a route to the prefix.
+	Total      int     // The active peers of the prefix's address family.
+	Time       time.Time
+}
+
+// Visibility is the current visibility of a single prefix.
+type Visibility struct {
+	Prefix     string
+	Visibility float64
+	Seen       int
+	Total      int
+	Collectors map[string]int // collector -> active peers with a route.
+}
+
+type prefixVisibility struct {
+	peers    map[peerKey]bool // Peers with a route to the prefix.
+	reported float64          // The visibility as of the last event, or the baseline.
+	baseline time.Time        // When the prefix was first evaluated, zero until it is.
+	low      bool
+}
+
+// Address families, as indexes of the peers of each.
+const (
+	familyIPv4 = iota
+	familyIPv6
+)
+
+// prefixFamily returns the address family of a prefix.
+func prefixFamily(prefix string) int {
+	if strings.Contains(prefix, ":") {
+		return familyIPv6
+	}
+	return familyIPv4
+}
+
+type activePeer struct {
+	last     time.Time // The time of the last message.
+	families [2]bool   // The address families the peer has sent routes of.
+}
+
+// VisibilityTracker maintains per prefix sets of peers with a route.
+type VisibilityTracker struct {
+	mu       sync.Mutex
+	cfg      *VisibilityConfig
+	watched  map[string]bool
+	peers    map[peerKey]*activePeer
+	families [2]int // The number of active peers of each address family.
+	prefixes map[string]*prefixVisibility
+}
+
+// NewVisibilityTracker creates a VisibilityTracker from cfg.
+func NewVisibilityTracker(cfg *VisibilityConfig) *VisibilityTracker {
+	v := &VisibilityTracker{
+		cfg:      cfg,
+		watched:  map[string]bool{},
+		peers:    map[peerKey]*activePeer{},
+		prefixes: map[string]*prefixVisibility{},
+	}
+	for _, p := range cfg.Prefixes {
+		v.watched[p] = true
+	}
+	return v
+}
+
+func (v *VisibilityTracker) watching(prefix string) bool {
+	return len(v.watched) == 0 || v.watched[prefix]
+}
+
+// Update applies a single message to the tracker, returning visibility events for
+// the prefixes the message announces or withdraws.
+func (v *VisibilityTracker) Update(rm *RisMessageData) []*VisibilityEvent {
+	if rm == nil {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	ts := rm.Time()
+	pk := peerKey{host: rm.Host, peer: rm.Peer}
+	ap, ok := v.peers[pk]
+	if !ok {
+		ap = &activePeer{}
+		v.peers[pk] = ap
+	}
+	if ts.After(ap.last) {
+		ap.last = ts
+	}
+
+	changed := map[string]bool{}
+	for _, prefix := range rm.Withdrawals {
+		v.addFamily(ap, prefix)
+		if pv, ok := v.prefixes[prefix]; ok && pv.peers[pk] {
+			delete(pv.peers, pk)
+			changed[prefix] = true
+		}
+	}
+	for _, a := range rm.Announcements {
+		for _, prefix := range a.Prefixes {
+			v.addFamily(ap, prefix)
+			if !v.watching(prefix) {
+				continue
+			}
+			pv, ok := v.prefixes[prefix]
+			if !ok {
+				pv = &prefixVisibility{peers: map[peerKey]bool{}, reported: -1}
+				v.prefixes[prefix] = pv
+			}
+			if !pv.peers[pk] {
+				pv.peers[pk] = true
+				changed[prefix] = true
+			}
+		}
+	}
+
+	var prefixes []string
+	for p := range changed {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+	var events []*VisibilityEvent
+	for _, p := range prefixes {
+		events = append(events, v.evaluate(p, ts)...)
+	}
+	return events
+}
+
+// addFamily counts the peer as one of the address family of prefix.
+func (v *VisibilityTracker) addFamily(ap *activePeer, prefix string) {
+	if f := prefixFamily(prefix); !ap.families[f] {
+		ap.families[f] = true
+		v.families[f]++
+	}
+}
+
+// Expire removes peers which have been silent for longer than the active timeout,
+// returning the visibility events this causes.
+func (v *VisibilityTracker) Expire(now time.Time) []*VisibilityEvent {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for pk, ap := range v.peers {
+		if now.Sub(ap.last) > v.cfg.ActiveTimeout {
+			delete(v.peers, pk)
+			for f, ok := range ap.families {
+				if ok {
+					v.families[f]--
+				}
+			}
+			for _, pv := range v.prefixes {
+				delete(pv.peers, pk)
+			}
+		}
+	}
+	var prefixes []string
+	for p := range v.prefixes {
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+	var events []*VisibilityEvent
+	for _, p := range prefixes {
+		events = append(events, v.evaluate(p, now)...)
+	}
+	return events
+}
+
+// active returns the set of peers of an address family which have sent a
+// message within the timeout.
+func (v *VisibilityTracker) active(family int, now time.Time) map[peerKey]bool {
+	result := map[peerKey]bool{}
+	for pk, ap := range v.peers {
+		if ap.families[family] && now.Sub(ap.last) <= v.cfg.ActiveTimeout {
+			result[pk] = true
+		}
+	}
+	return result
+}
+
+// evaluate computes the visibility of prefix, returning events if it has changed.
+// The peers with a route to a prefix are always active peers, as Expire removes
+// both together, and of its address family, so this is independent of the
+// number of peers.
+func (v *VisibilityTracker) evaluate(prefix string, ts time.Time) []*VisibilityEvent {
+	pv := v.prefixes[prefix]
+	total := v.families[prefixFamily(prefix)]
+	if total < v.cfg.MinPeers || total == 0 {
+		return nil
+	}
+	seen := len(pv.peers)
+	vis := float64(seen) / float64(total)
+
+	// The first evaluation of a prefix, ie: its first announcement, and those of
+	// the warm up after it, set the baseline while peers' routes are learned.
+	if pv.baseline.IsZero() {
+		pv.baseline = ts
+	}
+	if pv.reported < 0 || ts.Before(pv.baseline.Add(v.cfg.WarmUp)) {
+		pv.reported = vis
+		return nil
+	}
+
+	e := &VisibilityEvent{
+		Prefix:     prefix,
+		Visibility: vis,
+		Previous:   pv.reported,
+		Seen:       seen,
+		Total:      total,
+		Time:       ts,
+	}
+	switch {
+	case !pv.low && vis < v.cfg.Threshold:
+		pv.low = true
+		e.Kind = VisibilityLow
+	case pv.low && vis >= v.cfg.Threshold:
+		pv.low = false
+		e.Kind = VisibilityRestored
+	case vis-pv.reported >= v.cfg.Delta || pv.reported-vis >= v.cfg.Delta:
+		e.Kind = VisibilityChange
+	default:
+		return nil
+	}
+	pv.reported = vis
+	return []*VisibilityEvent{e}
+}
+
+// Prefix returns the current visibility of a prefix, or nil if it is not tracked.
+func (v *VisibilityTracker) Prefix(prefix string, now time.Time) *Visibility {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	pv, ok := v.prefixes[prefix]
+	if !ok {
+		return nil
+	}
+	active := v.active(prefixFamily(prefix), now)
+	result := &Visibility{Prefix: prefix, Total: len(active), Collectors: map[string]int{}}
+	for pk := range pv.peers {
+		if active[pk] {
+			result.Seen++
+			result.Collectors[pk.host]++
+		}
+	}
+	if result.Total > 0 {
+		result.Visibility = float64(result.Seen) / float64(result.Total)
+	}
+	return result
+}
+
+// Peers returns the peers, as collector/peer pairs, which currently have a route to prefix.
+func (v *VisibilityTracker) Peers(prefix string) [][2]string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var result [][2]string
+	if pv, ok := v.prefixes[prefix]; ok {
+		for pk := range pv.peers {
+			result = append(result, [2]string{pk.host, pk.peer})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i][0] != result[j][0] {
+			return result[i][0] < result[j][0]
+		}
+		return result[i][1] < result[j][1]
+	})
+	return result
+}
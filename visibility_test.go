@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestVisibilityTrackerUpdate(t *testing.T) {
+	cfg := &VisibilityConfig{
+		Prefixes:      []string{"192.0.2.0/24"},
+		Threshold:     0.5,
+		Delta:         0.2,
+		MinPeers:      2,
+		ActiveTimeout: time.Minute,
+	}
+	// Four peers, all announcing the watched prefix.
+	base := []*RisMessageData{
+		announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+		announce(0, "rrc00", "2.2.2.2", []interface{}{2, 100}, "192.0.2.0/24"),
+		announce(0, "rrc01", "3.3.3.3", []interface{}{3, 100}, "192.0.2.0/24"),
+		announce(0, "rrc01", "4.4.4.4", []interface{}{4, 100}, "192.0.2.0/24"),
+	}
+
+	tests := []struct {
+		desc   string
+		msgs   []*RisMessageData
+		expire time.Time
+		want   []*VisibilityEvent
+	}{{
+		desc: "Success - full visibility, no events",
+		msgs: base,
+	}, {
+		desc: "Success - unwatched prefix is ignored",
+		msgs: append(base,
+			announce(1, "rrc00", "1.1.1.1", []interface{}{1, 200}, "198.51.100.0/24"),
+		),
+	}, {
+		desc: "Success - first announcement of a prefix sets the baseline",
+		msgs: []*RisMessageData{
+			announce(0, "rrc00", "1.1.1.1", []interface{}{1, 200}, "198.51.100.0/24"),
+			announce(0, "rrc00", "2.2.2.2", []interface{}{2, 200}, "198.51.100.0/24"),
+			announce(0, "rrc01", "3.3.3.3", []interface{}{3, 200}, "198.51.100.0/24"),
+			announce(0, "rrc01", "4.4.4.4", []interface{}{4, 200}, "198.51.100.0/24"),
+			announce(1, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+		},
+	}, {
+		desc: "Success - visibility change",
+		msgs: append(base,
+			withdraw(1, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+		),
+		want: []*VisibilityEvent{
+			{Kind: VisibilityChange, Prefix: "192.0.2.0/24", Visibility: 0.75, Previous: 1, Seen: 3, Total: 4, Time: time.Unix(1, 0)},
+		},
+	}, {
+		desc: "Success - visibility drops below threshold and is restored",
+		msgs: append(base,
+			withdraw(1, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+			withdraw(2, "rrc00", "2.2.2.2", "192.0.2.0/24"),
+			withdraw(3, "rrc01", "3.3.3.3", "192.0.2.0/24"),
+			announce(4, "rrc01", "3.3.3.3", []interface{}{3, 100}, "192.0.2.0/24"),
+		),
+		want: []*VisibilityEvent{
+			{Kind: VisibilityChange, Prefix: "192.0.2.0/24", Visibility: 0.75, Previous: 1, Seen: 3, Total: 4, Time: time.Unix(1, 0)},
+			{Kind: VisibilityChange, Prefix: "192.0.2.0/24", Visibility: 0.5, Previous: 0.75, Seen: 2, Total: 4, Time: time.Unix(2, 0)},
+			{Kind: VisibilityLow, Prefix: "192.0.2.0/24", Visibility: 0.25, Previous: 0.5, Seen: 1, Total: 4, Time: time.Unix(3, 0)},
+			{Kind: VisibilityRestored, Prefix: "192.0.2.0/24", Visibility: 0.5, Previous: 0.25, Seen: 2, Total: 4, Time: time.Unix(4, 0)},
+		},
+	}, {
+		desc: "Success - peers of the other address family are not counted",
+		msgs: append(base,
+			announce(0, "rrc00", "2001:db8::1", []interface{}{5, 200}, "2001:db8::/32"),
+			announce(0, "rrc01", "2001:db8::2", []interface{}{6, 200}, "2001:db8::/32"),
+			withdraw(1, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+		),
+		want: []*VisibilityEvent{
+			{Kind: VisibilityChange, Prefix: "192.0.2.0/24", Visibility: 0.75, Previous: 1, Seen: 3, Total: 4, Time: time.Unix(1, 0)},
+		},
+	}, {
+		desc: "Success - silent peers are not counted",
+		msgs: append(base[:2:2],
+			announce(100, "rrc01", "3.3.3.3", []interface{}{3, 100}, "192.0.2.0/24"),
+			announce(100, "rrc01", "4.4.4.4", []interface{}{4, 100}, "198.51.100.0/24"),
+		),
+		expire: time.Unix(100, 0),
+		want: []*VisibilityEvent{
+			{Kind: VisibilityChange, Prefix: "192.0.2.0/24", Visibility: 0.5, Previous: 1, Seen: 1, Total: 2, Time: time.Unix(100, 0)},
+		},
+	}}
+
+	for _, test := range tests {
+		v := NewVisibilityTracker(cfg)
+		var got []*VisibilityEvent
+		for _, rm := range test.msgs {
+			got = append(got, v.Update(rm)...)
+		}
+		if !test.expire.IsZero() {
+			got = append(got, v.Expire(test.expire)...)
+		}
+		if diff := cmp.Diff(got, test.want, cmpopts.EquateApprox(0, 0.001)); diff != "" {
+			t.Errorf("[%v]: got/want mismatch diff(-got, +want):\n%v\n", test.desc, diff)
+		}
+	}
+}
+
+func TestVisibilityTrackerWarmUp(t *testing.T) {
+	v := NewVisibilityTracker(&VisibilityConfig{
+		Prefixes:      []string{"192.0.2.0/24"},
+		Threshold:     0.5,
+		Delta:         0.2,
+		MinPeers:      2,
+		ActiveTimeout: time.Hour,
+		WarmUp:        time.Minute,
+	})
+	var got []*VisibilityEvent
+	for _, rm := range []*RisMessageData{
+		announce(0, "rrc00", "1.1.1.1", []interface{}{1, 200}, "198.51.100.0/24"),
+		announce(0, "rrc00", "2.2.2.2", []interface{}{2, 200}, "198.51.100.0/24"),
+		announce(0, "rrc01", "3.3.3.3", []interface{}{3, 200}, "198.51.100.0/24"),
+		announce(0, "rrc01", "4.4.4.4", []interface{}{4, 200}, "198.51.100.0/24"),
+		// Visibility is learned during the warm up, without events.
+		announce(1, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"),
+		announce(2, "rrc00", "2.2.2.2", []interface{}{2, 100}, "192.0.2.0/24"),
+		announce(30, "rrc01", "3.3.3.3", []interface{}{3, 100}, "192.0.2.0/24"),
+		// After the warm up, changes from the learned baseline are events.
+		withdraw(70, "rrc00", "1.1.1.1", "192.0.2.0/24"),
+		withdraw(71, "rrc00", "2.2.2.2", "192.0.2.0/24"),
+	} {
+		got = append(got, v.Update(rm)...)
+	}
+	want := []*VisibilityEvent{
+		{Kind: VisibilityChange, Prefix: "192.0.2.0/24", Visibility: 0.5, Previous: 0.75, Seen: 2, Total: 4, Time: time.Unix(70, 0)},
+		{Kind: VisibilityLow, Prefix: "192.0.2.0/24", Visibility: 0.25, Previous: 0.5, Seen: 1, Total: 4, Time: time.Unix(71, 0)},
+	}
+	if diff := cmp.Diff(got, want, cmpopts.EquateApprox(0, 0.001)); diff != "" {
+		t.Errorf("got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
+
+func TestVisibilityTrackerPrefix(t *testing.T) {
+	v := NewVisibilityTracker(DefaultVisibilityConfig(nil))
+	v.Update(announce(0, "rrc00", "1.1.1.1", []interface{}{1, 100}, "192.0.2.0/24"))
+	v.Update(announce(0, "rrc01", "2.2.2.2", []interface{}{2, 100}, "192.0.2.0/24"))
+	v.Update(announce(0, "rrc01", "3.3.3.3", []interface{}{3, 100}, "198.51.100.0/24"))
+	// A peer of the other address family.
+	v.Update(announce(0, "rrc01", "2001:db8::1", []interface{}{4, 100}, "2001:db8::/32"))
+
+	want := &Visibility{
+		Prefix:     "192.0.2.0/24",
+		Visibility: 2.0 / 3.0,
+		Seen:       2,
+		Total:      3,
+		Collectors: map[string]int{"rrc00": 1, "rrc01": 1},
+	}
+	if diff := cmp.Diff(v.Prefix("192.0.2.0/24", time.Unix(1, 0)), want, cmpopts.EquateApprox(0, 0.001)); diff != "" {
+		t.Errorf("Prefix() got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	wantPeers := [][2]string{{"rrc00", "1.1.1.1"}, {"rrc01", "2.2.2.2"}}
+	if diff := cmp.Diff(v.Peers("192.0.2.0/24"), wantPeers); diff != "" {
+		t.Errorf("Peers() got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+}
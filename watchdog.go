@@ -0,0 +1,128 @@
+// A liveness watchdog for the RIS Live stream, which can stall while keeping
+// its connection open. The watchdog tracks the newest message of each collector
+// against the wall clock, and the round trip time of pings on the WebSocket.
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Freshness is the newest message seen from a collector.
+type Freshness struct {
+	Collector string
+	Newest    time.Time // The newest message timestamp.
+	Received  time.Time // The wall clock time a message was last received.
+}
+
+// Lag returns the delay between the newest message timestamp and its receipt.
+func (f *Freshness) Lag() time.Duration {
+	return f.Received.Sub(f.Newest)
+}
+
+// Watchdog detects a stalled stream.
+type Watchdog struct {
+	Timeout time.Duration // The stream is stalled if no message is received for Timeout.
+
+	mu         sync.Mutex
+	last       time.Time // The wall clock time of the last message, or the connection.
+	held       bool      // Reading is held up by the consumer, so the stream can not stall.
+	collectors map[string]*Freshness
+	pingSent   time.Time
+	rtt        time.Duration
+}
+
+// NewWatchdog creates a Watchdog, which considers the stream stalled after timeout.
+func NewWatchdog(timeout time.Duration) *Watchdog {
+	return &Watchdog{Timeout: timeout, collectors: map[string]*Freshness{}}
+}
+
+// Reset restarts the timeout, when a new connection is made.
+func (w *Watchdog) Reset(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = now
+	w.held = false
+	w.pingSent = time.Time{}
+}
+
+// Hold suspends the timeout while reading is held up by the consumer, ie: a
+// backpressured pipeline, so its delay is not taken for a stall of the stream.
+func (w *Watchdog) Hold() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.held = true
+}
+
+// Release resumes the timeout from now, once reading continues.
+func (w *Watchdog) Release(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.held = false
+	w.last = now
+}
+
+// Observe records a message received at now.
+func (w *Watchdog) Observe(rm *RisMessageData, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = now
+	if rm == nil {
+		return
+	}
+	f, ok := w.collectors[rm.Host]
+	if !ok {
+		f = &Freshness{Collector: rm.Host}
+		w.collectors[rm.Host] = f
+	}
+	if ts := rm.Time(); ts.After(f.Newest) {
+		f.Newest = ts
+	}
+	f.Received = now
+}
+
+// Stalled reports whether no message has been received within the timeout.
+func (w *Watchdog) Stalled(now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Timeout > 0 && !w.held && !w.last.IsZero() && now.Sub(w.last) > w.Timeout
+}
+
+// PingSent records that a ping was sent at now.
+func (w *Watchdog) PingSent(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pingSent = now
+}
+
+// Pong records a pong received at now, returning the round trip time of the
+// outstanding ping. If there is no outstanding ping, ok is false.
+func (w *Watchdog) Pong(now time.Time) (rtt time.Duration, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.pingSent.IsZero() {
+		return 0, false
+	}
+	w.rtt, w.pingSent = now.Sub(w.pingSent), time.Time{}
+	return w.rtt, true
+}
+
+// RTT returns the round trip time of the last answered ping.
+func (w *Watchdog) RTT() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rtt
+}
+
+// Freshness returns the freshness of each collector, sorted by collector.
+func (w *Watchdog) Freshness() []Freshness {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	result := make([]Freshness, 0, len(w.collectors))
+	for _, f := range w.collectors {
+		result = append(result, *f)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Collector < result[j].Collector })
+	return result
+}
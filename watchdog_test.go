@@ -0,0 +1,173 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWatchdog(t *testing.T) {
+	start := time.Unix(1000, 0)
+	w := NewWatchdog(time.Minute)
+
+	if w.Stalled(start.Add(time.Hour)) {
+		t.Errorf("watchdog stalled before a connection")
+	}
+	w.Reset(start)
+	if w.Stalled(start.Add(30 * time.Second)) {
+		t.Errorf("watchdog stalled within the timeout")
+	}
+	if !w.Stalled(start.Add(61 * time.Second)) {
+		t.Errorf("watchdog not stalled after the timeout")
+	}
+
+	w.Observe(&RisMessageData{Host: "rrc01", Timestamp: 990}, start.Add(50*time.Second))
+	w.Observe(&RisMessageData{Host: "rrc00", Timestamp: 1040}, start.Add(55*time.Second))
+	// An older message does not move the newest timestamp back.
+	w.Observe(&RisMessageData{Host: "rrc01", Timestamp: 980}, start.Add(60*time.Second))
+	if w.Stalled(start.Add(61 * time.Second)) {
+		t.Errorf("watchdog stalled after a message")
+	}
+	want := []Freshness{
+		{Collector: "rrc00", Newest: time.Unix(1040, 0), Received: start.Add(55 * time.Second)},
+		{Collector: "rrc01", Newest: time.Unix(990, 0), Received: start.Add(60 * time.Second)},
+	}
+	got := w.Freshness()
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("freshness got/want mismatch diff(-got, +want):\n%v\n", diff)
+	}
+	if lag := got[1].Lag(); lag != 70*time.Second {
+		t.Errorf("got lag %v, want 70s", lag)
+	}
+
+	if _, ok := w.Pong(start); ok {
+		t.Errorf("got a round trip time without a ping")
+	}
+	w.PingSent(start)
+	if rtt, ok := w.Pong(start.Add(150 * time.Millisecond)); !ok || rtt != 150*time.Millisecond {
+		t.Errorf("got round trip time %v/%v, want 150ms", rtt, ok)
+	}
+	if rtt := w.RTT(); rtt != 150*time.Millisecond {
+		t.Errorf("got RTT %v, want 150ms", rtt)
+	}
+
+	// The timeout is suspended while reading is held up by the consumer.
+	w.Hold()
+	if w.Stalled(start.Add(time.Hour)) {
+		t.Errorf("watchdog stalled while held")
+	}
+	w.Release(start.Add(time.Hour))
+	if w.Stalled(start.Add(time.Hour + 30*time.Second)) {
+		t.Errorf("watchdog stalled within the timeout of its release")
+	}
+	if !w.Stalled(start.Add(time.Hour + 61*time.Second)) {
+		t.Errorf("watchdog not stalled after the timeout of its release")
+	}
+}
+
+// TestListenBackpressure runs Listen against a stream which sends more messages
+// than the pipeline buffers then idles, with a consumer which reads none of them.
+// The consumer holding up reading is not a stall of the stream.
+func TestListenBackpressure(t *testing.T) {
+	msgs, err := ioutil.ReadFile("testdata/1k-msgs")
+	if err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+	idle := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(msgs)
+		w.(http.Flusher).Flush()
+		<-idle
+	}))
+	defer srv.Close()
+	defer close(idle)
+
+	r := &RisLive{
+		URL:      &srv.URL,
+		File:     proto.String(""),
+		UA:       proto.String("test"),
+		Filter:   &RisFilter{},
+		Chan:     make(chan RisMessage, 1),
+		Metrics:  NewMetrics(),
+		Watchdog: NewWatchdog(200 * time.Millisecond),
+	}
+	go r.Listen()
+
+	time.Sleep(time.Second)
+	if got := r.Metrics.Stalls.Get(); got != 0 {
+		t.Errorf("got %v stalls of a backpressured stream, want 0", got)
+	}
+	if got := r.Metrics.Connects.Get(); got != 1 {
+		t.Errorf("got %v connections, want 1", got)
+	}
+}
+
+// TestListenStall runs Listen against a fake RIS Live WebSocket server, which
+// answers pings and sends one message per connection before stalling.
+func TestListenStall(t *testing.T) {
+	var conns, pings int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("client") != "test" {
+			t.Errorf("got client %q, want test", req.URL.Query().Get("client"))
+		}
+		ws := wsTestUpgrade(t, w, req)
+		defer ws.Close()
+		atomic.AddInt32(&conns, 1)
+		sent := false
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.Contains(string(data), "ris_subscribe") && !sent:
+				ws.WriteMessage(wsText, []byte(`{"type":"ris_message","data":{"timestamp":1558620047.08,"host":"rrc19","peer":"196.60.9.165","path":[57695,37650]}}`))
+				sent = true
+			case strings.Contains(string(data), `"ping"`):
+				atomic.AddInt32(&pings, 1)
+				ws.WriteMessage(wsText, []byte(`{"type":"pong","data":null}`))
+			}
+		}
+	}))
+	defer srv.Close()
+
+	r := &RisLive{
+		URL:          proto.String("ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/ws/"),
+		File:         proto.String(""),
+		UA:           proto.String("test"),
+		Filter:       &RisFilter{},
+		Chan:         make(chan RisMessage, 10),
+		Metrics:      NewMetrics(),
+		Watchdog:     NewWatchdog(300 * time.Millisecond),
+		PingInterval: 50 * time.Millisecond,
+	}
+	go r.Listen()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case rm := <-r.Chan:
+			if rm.Data.Host != "rrc19" {
+				t.Errorf("got message from %v, want rrc19", rm.Data.Host)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for message %d", i)
+		}
+	}
+	if got := r.Metrics.Stalls.Get(); got < 1 {
+		t.Errorf("got %v stalls, want at least 1", got)
+	}
+	if got := atomic.LoadInt32(&conns); got < 2 {
+		t.Errorf("got %v connections, want at least 2", got)
+	}
+	// Pings are answered, but do not keep a stalled stream alive.
+	if p, rtt := atomic.LoadInt32(&pings), r.Watchdog.RTT(); p == 0 || rtt == 0 {
+		t.Errorf("got %v pings and rtt %v, want pings answered", p, rtt)
+	}
+}
@@ -0,0 +1,325 @@
+// A minimal WebSocket (RFC 6455) implementation, sufficient for the RIS Live
+// client and server: text and binary messages, fragmentation, ping/pong and close.
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// wsGUID is appended to the client key to compute Sec-WebSocket-Accept.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxMessage is the largest message accepted, to bound memory use.
+const wsMaxMessage = 16 << 20
+
+// WebSocket is a WebSocket connection.
+type WebSocket struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool // Clients mask the frames they send, servers do not.
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+// wsAccept returns the Sec-WebSocket-Accept value for a Sec-WebSocket-Key.
+func wsAccept(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// DialWebSocket connects to a ws:// or wss:// URL, sending header with the handshake.
+func DialWebSocket(rawurl string, header http.Header) (*WebSocket, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse websocket url(%v): %v", rawurl, err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		switch u.Scheme {
+		case "ws":
+			host = net.JoinHostPort(u.Hostname(), "80")
+		case "wss":
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+	}
+	d := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = d.Dial("tcp", host)
+	case "wss":
+		conn, err = tls.DialWithDialer(d, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme: %v", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to websocket(%v): %v", rawurl, err)
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create websocket key: %v", err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req := &http.Request{
+		Method:     "GET",
+		URL:        &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Host:       u.Host,
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send websocket handshake: %v", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read websocket handshake: %v", err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode != http.StatusSwitchingProtocols:
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed: %v", resp.Status)
+	case !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket"):
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed, upgrade: %q", resp.Header.Get("Upgrade"))
+	case resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key):
+		conn.Close()
+		return nil, errors.New("websocket handshake failed, bad Sec-WebSocket-Accept")
+	}
+	conn.SetDeadline(time.Time{})
+	return &WebSocket{conn: conn, br: br, client: true}, nil
+}
+
+// UpgradeWebSocket accepts a WebSocket handshake from a client. On failure an
+// HTTP error has been written to w.
+func UpgradeWebSocket(w http.ResponseWriter, req *http.Request) (*WebSocket, error) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case req.Method != "GET":
+		http.Error(w, "websocket handshake must be a GET", http.StatusMethodNotAllowed)
+		return nil, fmt.Errorf("websocket handshake method: %v", req.Method)
+	case !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") || key == "":
+		http.Error(w, "not a websocket handshake", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	case req.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("unsupported websocket version: %v", req.Header.Get("Sec-WebSocket-Version"))
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("http.ResponseWriter does not support hijacking")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hijack connection: %v", err)
+	}
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	brw.WriteString("Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to write websocket handshake: %v", err)
+	}
+	return &WebSocket{conn: conn, br: brw.Reader}, nil
+}
+
+// ReadMessage returns the next text or binary message. Ping frames are answered
+// and pong frames dropped. A close frame is answered, and io.EOF returned.
+func (ws *WebSocket) ReadMessage() (opcode byte, data []byte, err error) {
+	var msgOp byte
+	var msg []byte
+	for {
+		fin, op, payload, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := ws.WriteMessage(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			ws.closeWith(payload)
+			return 0, nil, io.EOF
+		case wsContinuation:
+			if msg == nil {
+				return 0, nil, errors.New("websocket continuation frame without a message")
+			}
+		case wsText, wsBinary:
+			if msg != nil {
+				return 0, nil, errors.New("websocket message interleaved with a fragmented message")
+			}
+			msgOp, msg = op, []byte{}
+		default:
+			return 0, nil, fmt.Errorf("unknown websocket opcode: %#x", op)
+		}
+		if len(msg)+len(payload) > wsMaxMessage {
+			return 0, nil, fmt.Errorf("websocket message larger than %d bytes", wsMaxMessage)
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msgOp, msg, nil
+		}
+	}
+}
+
+// readFrame reads a single frame, unmasking the payload. Clients must mask their
+// frames and servers must not, a frame which breaks this closes the connection.
+func (ws *WebSocket) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(ws.br, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = hdr[0]&0x80 != 0, hdr[0]&0x0f
+	masked := hdr[1]&0x80 != 0
+	// RFC 6455 section 5.1.
+	if masked == ws.client {
+		ws.closeWith([]byte{0x03, 0xea}) // 1002, protocol error.
+		if ws.client {
+			return false, 0, nil, errors.New("websocket frame from the server is masked")
+		}
+		return false, 0, nil, errors.New("websocket frame from the client is not masked")
+	}
+	n := uint64(hdr[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxMessage {
+		return false, 0, nil, fmt.Errorf("websocket frame larger than %d bytes", wsMaxMessage)
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(ws.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage writes data as a single frame of the opcode, ie: wsText.
+func (ws *WebSocket) WriteMessage(opcode byte, data []byte) error {
+	ws.wmu.Lock()
+	defer ws.wmu.Unlock()
+	if ws.closed {
+		return errors.New("websocket is closed")
+	}
+	return ws.writeFrame(opcode, data)
+}
+
+// writeFrame writes a frame, the write lock must be held.
+func (ws *WebSocket) writeFrame(opcode byte, data []byte) error {
+	frame := make([]byte, 0, len(data)+14)
+	frame = append(frame, 0x80|opcode)
+	var maskBit byte
+	if ws.client {
+		maskBit = 0x80
+	}
+	switch n := len(data); {
+	case n < 126:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, maskBit|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(append(frame, maskBit|127), ext[:]...)
+	}
+	if ws.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return fmt.Errorf("failed to create websocket mask: %v", err)
+		}
+		frame = append(frame, mask[:]...)
+		for i, b := range data {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, data...)
+	}
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// closeWith sends a close frame with the payload, if one has not been sent, and
+// closes the connection.
+func (ws *WebSocket) closeWith(payload []byte) error {
+	ws.wmu.Lock()
+	defer ws.wmu.Unlock()
+	if ws.closed {
+		return nil
+	}
+	ws.closed = true
+	ws.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	ws.writeFrame(wsClose, payload)
+	return ws.conn.Close()
+}
+
+// Close sends a normal closure frame and closes the connection.
+func (ws *WebSocket) Close() error {
+	return ws.closeWith([]byte{0x03, 0xe8}) // 1000, normal closure.
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wsTestUpgrade accepts a WebSocket handshake on the server side of a test.
+func wsTestUpgrade(t *testing.T, w http.ResponseWriter, req *http.Request) *WebSocket {
+	ws, err := UpgradeWebSocket(w, req)
+	if err != nil {
+		t.Fatalf("failed to upgrade connection: %v", err)
+	}
+	return ws
+}
+
+func TestWebSocket(t *testing.T) {
+	big := strings.Repeat("x", 70000)
+	tests := []struct {
+		desc string
+		// send writes frames from the server to the client.
+		send func(ws *WebSocket)
+		want []string
+	}{{
+		desc: "Success - short, medium and long messages",
+		send: func(ws *WebSocket) {
+			ws.WriteMessage(wsText, []byte("hello"))
+			ws.WriteMessage(wsText, []byte(strings.Repeat("y", 300)))
+			ws.WriteMessage(wsBinary, []byte(big))
+		},
+		want: []string{"hello", strings.Repeat("y", 300), big},
+	}, {
+		desc: "Success - fragmented message with interleaved ping",
+		send: func(ws *WebSocket) {
+			ws.conn.Write([]byte{wsText, 3, 'a', 'b', 'c'})
+			ws.conn.Write([]byte{0x80 | wsPing, 2, 'h', 'i'})
+			ws.conn.Write([]byte{0x80 | wsContinuation, 3, 'd', 'e', 'f'})
+		},
+		want: []string{"abcdef"},
+	}}
+
+	for _, test := range tests {
+		pongs := make(chan string, 1)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ws := wsTestUpgrade(t, w, req)
+			// The client's subscription, which must arrive masked.
+			op, data, err := ws.ReadMessage()
+			if err != nil || op != wsText || string(data) != "subscribe" {
+				t.Errorf("[%v]: got message %v/%q/%v, want subscribe", test.desc, op, data, err)
+			}
+			test.send(ws)
+			// Read the pong to any ping, then close.
+			_, op, data, err = ws.readFrame()
+			if err == nil && op == wsPong {
+				pongs <- string(data)
+			}
+			ws.Close()
+		}))
+
+		ws, err := DialWebSocket("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?client=test", nil)
+		if err != nil {
+			t.Fatalf("[%v]: failed to dial: %v", test.desc, err)
+		}
+		if err := ws.WriteMessage(wsText, []byte("subscribe")); err != nil {
+			t.Errorf("[%v]: failed to write: %v", test.desc, err)
+		}
+		var got []string
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				if err != io.EOF {
+					t.Errorf("[%v]: got error %v, want io.EOF", test.desc, err)
+				}
+				break
+			}
+			got = append(got, string(data))
+			if len(got) == len(test.want) {
+				// Close the connection, answering any ping first.
+				ws.WriteMessage(wsClose, nil)
+			}
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("[%v]: got %d messages, want %d", test.desc, len(got), len(test.want))
+		}
+		for i := range got {
+			if i < len(test.want) && got[i] != test.want[i] {
+				t.Errorf("[%v]: message %d got %d bytes, want %d", test.desc, i, len(got[i]), len(test.want[i]))
+			}
+		}
+		select {
+		case p := <-pongs:
+			if p != "hi" {
+				t.Errorf("[%v]: got pong %q, want hi", test.desc, p)
+			}
+		default:
+		}
+		ws.Close()
+		srv.Close()
+	}
+}
+
+func TestDialWebSocketBadAccept(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: bad\r\n\r\n"))
+		conn.Close()
+	}))
+	defer srv.Close()
+	if _, err := DialWebSocket("ws"+strings.TrimPrefix(srv.URL, "http"), nil); err == nil {
+		t.Errorf("did not get error for a bad Sec-WebSocket-Accept")
+	}
+}
+
+func TestUpgradeWebSocketFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, err := UpgradeWebSocket(w, req); err == nil {
+			t.Errorf("did not get error upgrading a plain request")
+		}
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %v, want 400", resp.Status)
+	}
+}
+
+func TestWebSocketMasking(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	client := &WebSocket{conn: c1, client: true}
+	go client.WriteMessage(wsText, []byte("masked"))
+
+	frame := make([]byte, 2+4+len("masked"))
+	if _, err := io.ReadFull(c2, frame); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if frame[1]&0x80 == 0 || bytes.Contains(frame, []byte("masked")) {
+		t.Errorf("client frame is not masked: %q", frame)
+	}
+	server := &WebSocket{br: bufio.NewReader(bytes.NewReader(frame))}
+	_, data, err := server.ReadMessage()
+	if err != nil || string(data) != "masked" {
+		t.Errorf("got %q/%v, want masked", data, err)
+	}
+}
+
+func TestWebSocketUnmaskedClientFrame(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	// An unmasked text frame, as only a server sends.
+	frame := append([]byte{0x80 | wsText, byte(len("unmasked"))}, "unmasked"...)
+	server := &WebSocket{conn: c1, br: bufio.NewReader(bytes.NewReader(frame))}
+	closed := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(c2)
+		closed <- b
+	}()
+	if _, data, err := server.ReadMessage(); err == nil {
+		t.Errorf("got message %q, want an error", data)
+	}
+	// The server closes the connection with a protocol error.
+	if got, want := <-closed, []byte{0x80 | wsClose, 2, 0x03, 0xea}; !bytes.Equal(got, want) {
+		t.Errorf("got %x sent, want close frame %x", got, want)
+	}
+}